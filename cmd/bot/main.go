@@ -4,18 +4,24 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/glizzus/sound-off/internal/config"
 	"github.com/glizzus/sound-off/internal/datalayer"
 	"github.com/glizzus/sound-off/internal/handler"
+	"github.com/glizzus/sound-off/internal/reconciler"
 	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/transcoder"
 	"github.com/glizzus/sound-off/internal/voice"
 	"github.com/glizzus/sound-off/internal/worker"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -40,6 +46,7 @@ func runBotForever() error {
 		return fmt.Errorf("failed to migrate postgres: %w", err)
 	}
 
+	guildSettings := repository.NewPostgresGuildSettingsRepository(pool)
 	repository := repository.NewPostgresSoundCronRepository(pool)
 
 	minioStorage, err := datalayer.NewMinioStorageFromEnv()
@@ -51,11 +58,38 @@ func runBotForever() error {
 		return fmt.Errorf("failed to ensure minio bucket: %w", err)
 	}
 
+	blobReconciler := reconciler.NewBlobReconciler(minioStorage, repository)
+	go blobReconciler.Run(context.Background(), 6*time.Hour)
+
+	queueConfig, err := config.NewQueueConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load queue config: %w", err)
+	}
+
+	workerConfig, err := config.NewWorkerConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load worker config: %w", err)
+	}
+
+	audioConfig, err := config.NewAudioConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load audio config: %w", err)
+	}
+
 	var blacklistAdder worker.BlacklistAdder
 	var jobHandler worker.JobSender
+	// Without a transcode queue, audio is encoded inside the bot.
+	var transcodeQueue *transcoder.RedisQueue
+	// With a memory job queue, the bot is its own worker.
+	var jobQueue *worker.MemoryJobQueue
+	memoryBlacklist := worker.NewMemoryBlacklistAdder()
 	if *dryRun {
 		jobHandler = &worker.PrintingJobSender{}
-		blacklistAdder = worker.NewMemoryBlacklistAdder()
+		blacklistAdder = memoryBlacklist
+	} else if queueConfig.Backend == worker.QueueMemory {
+		jobQueue = worker.NewMemoryJobQueue(workerConfig.DeliveryPolicy())
+		jobHandler = jobQueue
+		blacklistAdder = memoryBlacklist
 	} else {
 		redisConfig, err := config.NewRedisConfigFromEnv()
 		if err != nil {
@@ -66,14 +100,56 @@ func runBotForever() error {
 			Password: redisConfig.Password,
 		})
 
-		jobHandler, err = worker.NewRedisJobSender(redisClient)
-		if err != nil {
-			return fmt.Errorf("failed to create Redis job handler: %w", err)
+		if queueConfig.Backend == worker.QueueNATS {
+			nc, err := nats.Connect(queueConfig.NATSURL)
+			if err != nil {
+				return fmt.Errorf("failed to connect to NATS: %w", err)
+			}
+			defer nc.Close()
+			js, err := jetstream.New(nc)
+			if err != nil {
+				return fmt.Errorf("failed to create JetStream instance: %w", err)
+			}
+			jobHandler, err = worker.NewNATSJobSender(context.Background(), js)
+			if err != nil {
+				return fmt.Errorf("failed to create NATS job handler: %w", err)
+			}
+		} else {
+			jobHandler, err = worker.NewRedisJobSender(redisClient)
+			if err != nil {
+				return fmt.Errorf("failed to create Redis job handler: %w", err)
+			}
 		}
 		blacklistAdder = worker.NewRedisBlacklistHandler(redisClient)
+
+		consumer, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to get hostname: %w", err)
+		}
+		transcodeQueue, err = transcoder.NewRedisQueue(redisClient, consumer, transcoder.NewDeliveryPolicy(*audioConfig))
+		if err != nil {
+			return fmt.Errorf("failed to create Redis transcode queue: %w", err)
+		}
 	}
 
-	interactionHandler := handler.NewDiscordInteractionHandler(repository, minioStorage, blacklistAdder)
+	var transcodeJobs transcoder.JobSender
+	if transcodeQueue != nil {
+		transcodeJobs = transcodeQueue
+	}
+	operatorConfig, err := config.NewOperatorConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load operator config: %w", err)
+	}
+
+	interactionHandler := handler.NewDiscordInteractionHandler(
+		repository,
+		minioStorage,
+		guildSettings,
+		blacklistAdder,
+		transcodeJobs,
+		*audioConfig,
+		operatorConfig.OperatorIDs,
+	)
 
 	discordConfig, err := config.NewDiscordConfigFromEnv()
 	if err != nil {
@@ -101,6 +177,15 @@ func runBotForever() error {
 		return fmt.Errorf("failed to establish commands: %w", err)
 	}
 
+	if transcodeQueue != nil {
+		go func() {
+			err := handler.ListenTranscodeResults(context.Background(), session, transcodeQueue)
+			if err != nil {
+				slog.Error("stopped listening for transcode results", "error", err)
+			}
+		}()
+	}
+
 	ticker := time.NewTicker(27 * time.Second)
 	go func() {
 		for {
@@ -114,22 +199,20 @@ func runBotForever() error {
 
 				var streamJobs []worker.SoundCronStreamJob
 				for _, job := range upcoming {
-					guild, err := session.State.Guild(job.GuildID)
-					if err != nil {
-						slog.Error("failed to get guild", "guildID", job.GuildID, "error", err)
-						continue
-					}
-					maxAttendedChannelID := voice.MaxAttendedVoiceChannel(guild.VoiceStates)
-					if maxAttendedChannelID == "" {
-						continue
+					// A soundcron that plays in more than one channel is sent as one job
+					// with every channel, best first. The worker plays them one after
+					// another, since the bot can only be in one voice channel of a guild
+					// at a time. It chooses the channels again just before they play,
+					// and skips the job if nobody is listening, so these are only hints
+					// for when it can not.
+					var channelIDs []string
+					if guild, err := session.State.Guild(job.GuildID); err != nil {
+						slog.Warn("failed to get guild, sending job without channels", "guildID", job.GuildID, "error", err)
+					} else {
+						selector := voice.NewChannelSelector(job.Channels, job.CreatorID)
+						channelIDs = selector.SelectChannels(voice.NewGuild(session, guild))
 					}
-					streamJobs = append(streamJobs, worker.SoundCronStreamJob{
-						SoundCronID:     job.SoundCronID,
-						Name:            job.Name,
-						GuildID:         job.GuildID,
-						RunTime:         job.RunTime,
-						TargetChannelID: maxAttendedChannelID,
-					})
+					streamJobs = append(streamJobs, worker.NewStreamJob(job, channelIDs))
 				}
 
 				go jobHandler.HandleJobs(context.Background(), streamJobs...)
@@ -142,10 +225,53 @@ func runBotForever() error {
 		}
 	}()
 
+	playerCtx, stopPlayer := context.WithCancel(context.Background())
+	defer stopPlayer()
+	playerDone := make(chan error, 1)
+	if jobQueue != nil {
+		player := &worker.Player{
+			Session:   session,
+			Jobs:      jobQueue.Receiver(),
+			Blacklist: memoryBlacklist,
+			Guilds: &worker.GuildQueue{
+				Locker:       worker.NewMemoryGuildLocker(),
+				Policy:       workerConfig.CollisionPolicy,
+				MaxWait:      workerConfig.CollisionMaxWait,
+				PollInterval: time.Second,
+			},
+			FetchAudio: func(ctx context.Context, soundCronID string) (io.ReadCloser, error) {
+				return minioStorage.Get(ctx, datalayer.OpusAudioKey(soundCronID))
+			},
+			FFmpegThreads: audioConfig.FFmpegThreads,
+			BroadcastGap:  workerConfig.BroadcastGap,
+			ShutdownGrace: workerConfig.ShutdownGrace,
+			DrainTimeout:  workerConfig.DrainTimeout(),
+			AckWait:       workerConfig.JobAckWait,
+			MaxLateness:   workerConfig.JobMaxLateness,
+		}
+		go func() {
+			playerDone <- player.Run(playerCtx)
+		}()
+	}
+
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	// Kubernetes sends SIGTERM to stop the bot, which drains the soundcrons
+	// that it plays itself with the memory job queue.
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
-	<-stop
+	select {
+	case <-stop:
+	case err := <-playerDone:
+		return fmt.Errorf("failed to play soundcrons: %w", err)
+	}
+	if jobQueue != nil {
+		// Jobs of the memory queue are lost once the bot stops,
+		// so soundcrons that are due soon are played first.
+		stopPlayer()
+		if err := <-playerDone; err != nil {
+			return fmt.Errorf("failed to play soundcrons: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -11,7 +12,11 @@ import (
 	"github.com/glizzus/sound-off/internal/config"
 	"github.com/glizzus/sound-off/internal/datalayer"
 	"github.com/glizzus/sound-off/internal/generator"
+	"github.com/glizzus/sound-off/internal/opus"
+	"github.com/glizzus/sound-off/internal/reconciler"
 	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/worker"
+	"github.com/redis/go-redis/v9"
 	"github.com/urfave/cli/v2"
 )
 
@@ -25,6 +30,22 @@ func prompt(label string) string {
 	return strings.TrimSpace(input)
 }
 
+// newDeadLetters connects to the Redis instance that workers receive jobs from.
+func newDeadLetters(ctx context.Context) (*worker.RedisDeadLetters, error) {
+	redisConfig, err := config.NewRedisConfigFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load redis config: %w", err)
+	}
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     redisConfig.Addr,
+		Password: redisConfig.Password,
+	})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return worker.NewRedisDeadLetters(rdb), nil
+}
+
 func main() {
 	if err := config.LoadEnv(); err != nil {
 		log.Fatalf("Failed to load .env file: %v", err)
@@ -100,6 +121,9 @@ func main() {
 						Name:     name,
 						Cron:     cron,
 						FileSize: fileSize,
+						// The CLI does not upload audio, so mark the job as ready
+						// to have it scheduled like a fully processed soundcron.
+						Status: repository.SoundCronStatusReady,
 					}
 
 					if err := repo.Save(c.Context, sc); err != nil {
@@ -117,6 +141,134 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:  "backfill-sizes",
+				Usage: "Record the uploaded and encoded size of every soundcron from blob storage",
+				Action: func(c *cli.Context) error {
+					minioStorage, err := datalayer.NewMinioStorageFromEnv()
+					if err != nil {
+						return cli.Exit("Failed to create minio storage: "+err.Error(), 1)
+					}
+
+					updated, err := reconciler.BackfillSizes(c.Context, minioStorage, repo)
+					if err != nil {
+						return cli.Exit("Failed to backfill sizes: "+err.Error(), 1)
+					}
+
+					log.Printf("Backfilled sizes for %d soundcron(s).", updated)
+					return nil
+				},
+			},
+			{
+				Name:  "migrate-storage",
+				Usage: "Rewrite the encoded audio of every soundcron in the given storage format",
+				Action: func(c *cli.Context) error {
+					format, err := opus.ParseFormat(c.String("format"))
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+
+					minioStorage, err := datalayer.NewMinioStorageFromEnv()
+					if err != nil {
+						return cli.Exit("Failed to create minio storage: "+err.Error(), 1)
+					}
+
+					migrated, err := reconciler.MigrateStorageFormat(c.Context, minioStorage, repo, format)
+					if err != nil {
+						return cli.Exit("Failed to migrate storage: "+err.Error(), 1)
+					}
+
+					log.Printf("Rewrote the audio of %d soundcron(s) as %s.", migrated, format)
+					return nil
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: `Storage format to rewrite audio in, either "ogg" or "length-prefixed"`,
+						Value: "ogg",
+					},
+				},
+			},
+			{
+				Name:  "dead-letters",
+				Usage: "Inspect and replay soundcron jobs that workers gave up on",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "List dead-lettered jobs, oldest first",
+						Action: func(c *cli.Context) error {
+							deadLetters, err := newDeadLetters(c.Context)
+							if err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							jobs, err := deadLetters.List(c.Context, c.Int64("count"))
+							if err != nil {
+								return cli.Exit("Failed to list dead-lettered jobs: "+err.Error(), 1)
+							}
+
+							if len(jobs) == 0 {
+								log.Println("No dead-lettered jobs found.")
+								return nil
+							}
+
+							for _, job := range jobs {
+								log.Printf("%s: %s (message %s) %+v", job.ID, job.Reason, job.MessageID, job.Values)
+							}
+							return nil
+						},
+						Flags: []cli.Flag{
+							&cli.Int64Flag{
+								Name:  "count",
+								Usage: "Most jobs to list",
+								Value: 100,
+							},
+						},
+					},
+					{
+						Name:  "replay",
+						Usage: "Send a dead-lettered job to workers again, which play it right away, however long ago its run time passed",
+						Action: func(c *cli.Context) error {
+							deadLetters, err := newDeadLetters(c.Context)
+							if err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							ids := c.StringSlice("id")
+							if c.Bool("all") {
+								jobs, err := deadLetters.List(c.Context, 0)
+								if err != nil {
+									return cli.Exit("Failed to list dead-lettered jobs: "+err.Error(), 1)
+								}
+								for _, job := range jobs {
+									ids = append(ids, job.ID)
+								}
+							}
+							if len(ids) == 0 {
+								return cli.Exit("Please provide a job ID using --id, or use --all", 1)
+							}
+
+							for _, id := range ids {
+								if err := deadLetters.Replay(c.Context, id); err != nil {
+									return cli.Exit("Failed to replay job: "+err.Error(), 1)
+								}
+								log.Printf("Replayed %s.", id)
+							}
+							return nil
+						},
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "id",
+								Usage: "ID of a dead-lettered job to replay, as shown by list",
+							},
+							&cli.BoolFlag{
+								Name:  "all",
+								Usage: "Replay every dead-lettered job",
+							},
+						},
+					},
+				},
+			},
 		},
 	}
 
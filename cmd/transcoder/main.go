@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/glizzus/sound-off/internal/config"
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/transcoder"
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultConcurrency is the number of ffmpeg processes that run at once
+// when TRANSCODER_CONCURRENCY is not set.
+const defaultConcurrency = 2
+
+func concurrencyFromEnv() (int, error) {
+	value := os.Getenv("TRANSCODER_CONCURRENCY")
+	if value == "" {
+		return defaultConcurrency, nil
+	}
+	concurrency, err := strconv.Atoi(value)
+	if err != nil || concurrency < 1 {
+		return 0, fmt.Errorf("TRANSCODER_CONCURRENCY must be a positive integer, got %q", value)
+	}
+	return concurrency, nil
+}
+
+func runTranscoderForever() error {
+	if err := config.LoadEnv(); err != nil {
+		if os.IsNotExist(err) {
+			slog.Warn("No .env file found, continuing without it")
+		} else {
+			return fmt.Errorf("failed to load .env file: %w", err)
+		}
+	}
+
+	concurrency, err := concurrencyFromEnv()
+	if err != nil {
+		return err
+	}
+
+	pool, err := datalayer.NewPostgresPoolFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to create postgres pool: %w", err)
+	}
+	guildSettings := repository.NewPostgresGuildSettingsRepository(pool)
+	repository := repository.NewPostgresSoundCronRepository(pool)
+
+	minioStorage, err := datalayer.NewMinioStorageFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to create minio storage: %w", err)
+	}
+
+	redisConfig, err := config.NewRedisConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load redis config: %w", err)
+	}
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     redisConfig.Addr,
+		Password: redisConfig.Password,
+	})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	consumer, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	audioConfig, err := config.NewAudioConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load audio config: %w", err)
+	}
+
+	queue, err := transcoder.NewRedisQueue(rdb, consumer, transcoder.NewDeliveryPolicy(*audioConfig))
+	if err != nil {
+		return fmt.Errorf("failed to create Redis transcode queue: %w", err)
+	}
+
+	t := transcoder.NewTranscoder(minioStorage, repository, *audioConfig)
+	t.Quota = &transcoder.QuotaChecker{
+		SoundCrons:    repository,
+		GuildSettings: guildSettings,
+	}
+
+	// Each job runs ffmpeg, so the number of jobs in flight is bounded.
+	// Jobs are only received once a slot is free, since a job that waits for
+	// one is claimed by another transcoder once it has been idle for too long.
+	slots := make(chan struct{}, concurrency)
+	slog.Info("Transcoder is ready", "concurrency", concurrency)
+	for {
+		slots <- struct{}{}
+		jobs, err := queue.ReceiveJobs(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to receive jobs: %w", err)
+		}
+		if len(jobs) == 0 {
+			<-slots
+			continue
+		}
+
+		for i, job := range jobs {
+			if i > 0 {
+				slots <- struct{}{}
+			}
+			go func() {
+				defer func() { <-slots }()
+
+				ctx := context.Background()
+				slog.Info("Transcoding soundcron audio", "soundCronID", job.SoundCronID, "replace", job.Replace)
+				result := t.Process(ctx, job)
+				if err := queue.SendResult(ctx, result); err != nil {
+					slog.Error(
+						"failed to send transcode result",
+						slog.String("soundCronID", job.SoundCronID),
+						slog.Any("error", err),
+					)
+				}
+				// A job that is not acknowledged is run again once it has been
+				// idle for the ack wait, which only repeats its outcome.
+				if err := queue.Ack(ctx, job); err != nil {
+					slog.Error(
+						"failed to acknowledge transcode job",
+						slog.String("soundCronID", job.SoundCronID),
+						slog.Any("error", err),
+					)
+				}
+			}()
+		}
+	}
+}
+
+func main() {
+	if err := runTranscoderForever(); err != nil {
+		slog.Error("Transcoder encountered an error", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
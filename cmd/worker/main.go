@@ -8,28 +8,18 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/bwmarrin/discordgo"
 	"github.com/glizzus/sound-off/internal/config"
 	"github.com/glizzus/sound-off/internal/handler"
-	"github.com/glizzus/sound-off/internal/opus"
-	"github.com/glizzus/sound-off/internal/schedule"
-	"github.com/glizzus/sound-off/internal/voice"
 	"github.com/glizzus/sound-off/internal/worker"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/redis/go-redis/v9"
 )
 
-func getLogAttrs(job worker.SoundCronStreamJob) []any {
-	return []any{
-		"soundCronID", job.SoundCronID,
-		"jobName", job.Name,
-		"guildID", job.GuildID,
-		"runAt", job.RunTime.Format("2006-01-02 15:04:05"),
-		"targetChannelID", job.TargetChannelID,
-	}
-}
-
 var dryRun = flag.Bool("dry-run", false, "Do not use Discord, just print job info to terminal")
 
 func runWorkerForever() error {
@@ -42,6 +32,14 @@ func runWorkerForever() error {
 		}
 	}
 
+	queueConfig, err := config.NewQueueConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load queue config: %w", err)
+	}
+	if queueConfig.Backend != worker.QueueRedis && queueConfig.Backend != worker.QueueNATS {
+		return fmt.Errorf("the %s queue backend plays soundcrons in the bot, not in a worker", queueConfig.Backend)
+	}
+
 	redisConfig, err := config.NewRedisConfigFromEnv()
 	if err != nil {
 		return fmt.Errorf("failed to load redis config: %w", err)
@@ -52,6 +50,16 @@ func runWorkerForever() error {
 		return fmt.Errorf("failed to load discord config: %w", err)
 	}
 
+	workerConfig, err := config.NewWorkerConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load worker config: %w", err)
+	}
+
+	audioConfig, err := config.NewAudioConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load audio config: %w", err)
+	}
+
 	minioEndpoint := os.Getenv("MINIO_ENDPOINT")
 	if minioEndpoint == "" {
 		return fmt.Errorf("MINIO_ENDPOINT is not set")
@@ -65,9 +73,28 @@ func runWorkerForever() error {
 		return fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	consumer, err := os.Hostname()
-	if err != nil {
-		return fmt.Errorf("failed to get hostname: %w", err)
+	var jobReceiver worker.JobReceiver
+	switch queueConfig.Backend {
+	case worker.QueueRedis:
+		consumer, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to get hostname: %w", err)
+		}
+		jobReceiver = worker.NewRedisJobReceiver(rdb, consumer, workerConfig.DeliveryPolicy())
+	case worker.QueueNATS:
+		nc, err := nats.Connect(queueConfig.NATSURL)
+		if err != nil {
+			return fmt.Errorf("failed to connect to nats: %w", err)
+		}
+		defer nc.Close()
+		js, err := jetstream.New(nc)
+		if err != nil {
+			return fmt.Errorf("failed to create jetstream instance: %w", err)
+		}
+		jobReceiver, err = worker.NewNATSJobReceiver(context.Background(), js, workerConfig.DeliveryPolicy())
+		if err != nil {
+			return fmt.Errorf("failed to create NATS job receiver: %w", err)
+		}
 	}
 
 	session, err := handler.NewSession(discordConfig.Token, handler.Handlers{
@@ -85,93 +112,40 @@ func runWorkerForever() error {
 		}
 	}()
 
-	blacklistChecker := worker.NewRedisBlacklistHandler(rdb)
-	jobReceiver := worker.NewRedisJobReceiver(rdb, consumer)
-
-	for {
-		jobs, err := jobReceiver.ReceiveJobs(context.Background())
-		if err != nil {
-			return fmt.Errorf("failed to receive jobs: %w", err)
-		}
-
-		for _, job := range jobs {
-			respReady := make(chan io.ReadCloser, 1)
-			preloadTime := job.RunTime.Add(-time.Second * 5)
-			ctx := context.Background()
-
-			schedule.RunAt(ctx, preloadTime, func(ctx context.Context) {
-				blacklisted, err := blacklistChecker.IsBlacklisted(context.Background(), job.SoundCronID)
-				if err != nil {
-					slog.Error(
-						"failed to check blacklist",
-						slog.String("soundCronID", job.SoundCronID),
-						slog.Any("error", err),
-					)
-					respReady <- nil
-					return
-				}
-				if blacklisted {
-					slog.Info(
-						"skipping blacklisted job",
-						slog.String("soundCronID", job.SoundCronID),
-					)
-					respReady <- nil
-					return
-				}
-
-				endpoint := "http://" + minioEndpoint + "/soundoff/sound-off/opus/" + job.SoundCronID
-				if *dryRun {
-					slog.Info(
-						"Dry run mode: job would be preloaded",
-						"endpoint", endpoint,
-					)
-					return
-				}
-				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-				resp, err := http.DefaultClient.Do(req)
-				if err != nil {
-					slog.Error(
-						"failed to preload opus file",
-						slog.String("soundCronID", job.SoundCronID),
-						slog.Any("error", err),
-					)
-					respReady <- nil
-				} else {
-					respReady <- resp.Body
-				}
-			})
-
-			schedule.RunAt(ctx, job.RunTime, func(ctx context.Context) {
-				if *dryRun {
-					slog.Info(
-						"Dry run mode: job would be executed",
-						getLogAttrs(job)...,
-					)
-					return
-				}
-				respBody := <-respReady
-				if respBody == nil {
-					slog.Error(
-						"failed to preload opus file",
-						slog.String("soundCronID", job.SoundCronID),
-					)
-					return
-				}
-				defer respBody.Close()
-				reader := opus.NewFrameReader(respBody)
-				err := voice.WithVoiceChannel(session, job.GuildID, job.TargetChannelID, func(_ *discordgo.Session, vc *discordgo.VoiceConnection) error {
-					return opus.StreamToVoice(reader, vc)
-				})
-				if err != nil {
-					attrs := append(getLogAttrs(job), slog.Any("error", err))
-					slog.Error(
-						"failed to execute scheduled job",
-						attrs...,
-					)
-				}
-			})
-		}
+	player := &worker.Player{
+		Session:   session,
+		Jobs:      jobReceiver,
+		Blacklist: worker.NewRedisBlacklistHandler(rdb),
+		Skips:     worker.NewRedisSkipRecorder(rdb),
+		// Playback is serialized per guild across every worker.
+		Guilds: &worker.GuildQueue{
+			Locker:       worker.NewRedisGuildLocker(rdb),
+			Policy:       workerConfig.CollisionPolicy,
+			MaxWait:      workerConfig.CollisionMaxWait,
+			PollInterval: time.Second,
+		},
+		FetchAudio: func(ctx context.Context, soundCronID string) (io.ReadCloser, error) {
+			endpoint := "http://" + minioEndpoint + "/soundoff/sound-off/opus/" + soundCronID
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Body, nil
+		},
+		FFmpegThreads: audioConfig.FFmpegThreads,
+		BroadcastGap:  workerConfig.BroadcastGap,
+		ShutdownGrace: workerConfig.ShutdownGrace,
+		DrainTimeout:  workerConfig.DrainTimeout(),
+		AckWait:       workerConfig.JobAckWait,
+		MaxLateness:   workerConfig.JobMaxLateness,
+		DryRun:        *dryRun,
 	}
+
+	// Kubernetes sends SIGTERM to stop the worker, which stops it receiving jobs.
+	stopCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return player.Run(stopCtx)
 }
 
 func main() {
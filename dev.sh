@@ -2,6 +2,7 @@
 
 BLUE='\033[34m'
 GREEN='\033[32m'
+YELLOW='\033[33m'
 RESET='\033[0m'
 
 prefix() {
@@ -14,5 +15,6 @@ prefix() {
 
 go run ./cmd/bot 2>&1 | prefix "[BOT]" "$BLUE" &
 go run ./cmd/worker 2>&1 | prefix "[WORKER]" "$GREEN" &
+go run ./cmd/transcoder 2>&1 | prefix "[TRANSCODER]" "$YELLOW" &
 
 wait
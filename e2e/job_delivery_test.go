@@ -0,0 +1,213 @@
+package e2e_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/glizzus/sound-off/e2e"
+	"github.com/glizzus/sound-off/internal/worker"
+	"github.com/glizzus/sound-off/internal/worker/workertest"
+)
+
+var testDeliveryPolicy = worker.DeliveryPolicy{
+	AckWait:       300 * time.Millisecond,
+	MaxDeliveries: 2,
+}
+
+// useEmptyRedis returns a client of a Redis that has no keys.
+func useEmptyRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	opts, err := redis.ParseURL(e2e.UseRedis(t))
+	if err != nil {
+		t.Fatalf("failed to parse redis connection string: %v", err)
+	}
+	client := redis.NewClient(opts)
+	t.Cleanup(func() { client.Close() })
+	if err := client.FlushAll(t.Context()).Err(); err != nil {
+		t.Fatalf("failed to flush redis: %v", err)
+	}
+	return client
+}
+
+func TestRedisJobQueue(t *testing.T) {
+	workertest.TestJobQueue(t, func(t *testing.T) workertest.Queue {
+		client := useEmptyRedis(t)
+		sender, err := worker.NewRedisJobSender(client)
+		if err != nil {
+			t.Fatalf("failed to create job sender: %v", err)
+		}
+		receivers := 0
+		return workertest.Queue{
+			Sender: sender,
+			NewReceiver: func(t *testing.T) worker.JobReceiver {
+				receivers++
+				return worker.NewRedisJobReceiver(client, fmt.Sprintf("worker-%d", receivers), workertest.Policy)
+			},
+		}
+	})
+}
+
+func sendTestJob(t *testing.T) *redis.Client {
+	t.Helper()
+	client := useEmptyRedis(t)
+
+	sender, err := worker.NewRedisJobSender(client)
+	if err != nil {
+		t.Fatalf("failed to create job sender: %v", err)
+	}
+	err = sender.HandleJobs(t.Context(), worker.SoundCronStreamJob{
+		SoundCronID:     "bell",
+		Name:            "Bell",
+		GuildID:         "guild",
+		RunTime:         time.Now().Add(time.Minute).Truncate(time.Second),
+		TargetChannelID: "general",
+	})
+	if err != nil {
+		t.Fatalf("failed to send job: %v", err)
+	}
+	return client
+}
+
+func receive(t *testing.T, receiver worker.JobReceiver) []worker.SoundCronStreamJob {
+	t.Helper()
+	jobs, err := receiver.ReceiveJobs(t.Context())
+	if err != nil {
+		t.Fatalf("failed to receive jobs: %v", err)
+	}
+	return jobs
+}
+
+func TestJobReceiverRedeliversUnacknowledgedJobs(t *testing.T) {
+	client := sendTestJob(t)
+
+	first := worker.NewRedisJobReceiver(client, "first", testDeliveryPolicy)
+	if jobs := receive(t, first); len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(jobs))
+	}
+
+	// The first worker stops before the job plays, so another claims it.
+	time.Sleep(testDeliveryPolicy.AckWait)
+	second := worker.NewRedisJobReceiver(client, "second", testDeliveryPolicy)
+	jobs := receive(t, second)
+	if len(jobs) != 1 || jobs[0].SoundCronID != "bell" {
+		t.Fatalf("expected the job to be delivered again, got %+v", jobs)
+	}
+
+	if err := second.Ack(t.Context(), jobs...); err != nil {
+		t.Fatalf("failed to acknowledge job: %v", err)
+	}
+	time.Sleep(testDeliveryPolicy.AckWait)
+	if jobs := receive(t, second); len(jobs) != 0 {
+		t.Errorf("expected an acknowledged job not to be delivered again, got %+v", jobs)
+	}
+}
+
+func TestJobReceiverKeepsReceivedJobs(t *testing.T) {
+	client := sendTestJob(t)
+
+	first := worker.NewRedisJobReceiver(client, "first", testDeliveryPolicy)
+	if jobs := receive(t, first); len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(jobs))
+	}
+	// Waiting for the run time of the job takes longer than AckWait.
+	for range 6 {
+		receive(t, first)
+	}
+
+	second := worker.NewRedisJobReceiver(client, "second", testDeliveryPolicy)
+	if jobs := receive(t, second); len(jobs) != 0 {
+		t.Errorf("expected a job that is still waiting to play not to be claimed, got %+v", jobs)
+	}
+}
+
+func TestJobReceiverDeadLettersFailingJobs(t *testing.T) {
+	client := sendTestJob(t)
+
+	receiver := worker.NewRedisJobReceiver(client, "worker", testDeliveryPolicy)
+	jobs := receive(t, receiver)
+	for delivery := 1; delivery <= testDeliveryPolicy.MaxDeliveries; delivery++ {
+		if len(jobs) != 1 {
+			t.Fatalf("expected delivery %d of the job, got %+v", delivery, jobs)
+		}
+		if err := receiver.Fail(t.Context(), jobs...); err != nil {
+			t.Fatalf("failed to fail job: %v", err)
+		}
+		time.Sleep(testDeliveryPolicy.AckWait)
+		jobs = receive(t, receiver)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("expected the job to be given up, got %+v", jobs)
+	}
+
+	deadLetters := worker.NewRedisDeadLetters(client)
+	dead, err := deadLetters.List(t.Context(), 0)
+	if err != nil {
+		t.Fatalf("failed to list dead-lettered jobs: %v", err)
+	}
+	if len(dead) != 1 {
+		t.Fatalf("expected the job in the dead-letter stream, got %+v", dead)
+	}
+	envelope, _ := dead[0].Values["job"].(string)
+	if job, err := worker.DecodeJob([]byte(envelope)); err != nil || job.SoundCronID != "bell" {
+		t.Fatalf("expected the job to be dead-lettered as it was sent, got %+v", dead[0])
+	}
+
+	if err := deadLetters.Replay(t.Context(), dead[0].ID); err != nil {
+		t.Fatalf("failed to replay job: %v", err)
+	}
+	if jobs := receive(t, receiver); len(jobs) != 1 || jobs[0].SoundCronID != "bell" || !jobs[0].Replayed {
+		t.Errorf("expected the replayed job to be delivered as replayed, got %+v", jobs)
+	}
+	if dead, _ := deadLetters.List(t.Context(), 0); len(dead) != 0 {
+		t.Errorf("expected the replayed job to leave the dead-letter stream, got %+v", dead)
+	}
+}
+
+func TestJobReceiverDeadLettersMalformedJobs(t *testing.T) {
+	client := sendTestJob(t)
+	err := client.XAdd(t.Context(), &redis.XAddArgs{
+		Stream: "soundcron_jobs",
+		Values: map[string]any{"soundCronID": "horn", "runAt": "not a time"},
+	}).Err()
+	if err != nil {
+		t.Fatalf("failed to send malformed job: %v", err)
+	}
+
+	receiver := worker.NewRedisJobReceiver(client, "worker", testDeliveryPolicy)
+	jobs := receive(t, receiver)
+	if len(jobs) != 1 || jobs[0].SoundCronID != "bell" {
+		t.Errorf("expected the well-formed job to be received, got %+v", jobs)
+	}
+
+	dead, err := worker.NewRedisDeadLetters(client).List(t.Context(), 0)
+	if err != nil {
+		t.Fatalf("failed to list dead-lettered jobs: %v", err)
+	}
+	if len(dead) != 1 || dead[0].Values["soundCronID"] != "horn" || !strings.Contains(dead[0].Reason, "runAt") {
+		t.Errorf("expected the malformed job with its parse error, got %+v", dead)
+	}
+}
+
+func TestJobReceiverReleasesJobsRightAway(t *testing.T) {
+	client := sendTestJob(t)
+
+	first := worker.NewRedisJobReceiver(client, "first", testDeliveryPolicy)
+	jobs := receive(t, first)
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(jobs))
+	}
+
+	// The first worker stops long before the job is due.
+	if err := first.Release(t.Context(), jobs...); err != nil {
+		t.Fatalf("failed to release job: %v", err)
+	}
+	second := worker.NewRedisJobReceiver(client, "second", testDeliveryPolicy)
+	released := receive(t, second)
+	if len(released) != 1 || released[0].SoundCronID != "bell" || !released[0].RunTime.Equal(jobs[0].RunTime) {
+		t.Errorf("expected the released job to be delivered without waiting, got %+v", released)
+	}
+}
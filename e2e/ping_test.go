@@ -6,6 +6,7 @@ import (
 	"github.com/bwmarrin/discordgo"
 	"github.com/google/go-cmp/cmp"
 
+	"github.com/glizzus/sound-off/internal/config"
 	"github.com/glizzus/sound-off/internal/generator"
 	"github.com/glizzus/sound-off/internal/handler"
 )
@@ -39,7 +40,7 @@ func TestInteractionCreatePing(t *testing.T) {
 		},
 	}
 
-	handler := handler.NewInteractionHandler(nil, nil, &generator.UUIDV4Generator{}, nil)
+	handler := handler.NewInteractionHandler(nil, nil, nil, &generator.UUIDV4Generator{}, nil, nil, config.AudioConfig{}, nil)
 	handler(session, interaction)
 
 	expectedSession := &mockSession{
@@ -5,6 +5,7 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/glizzus/sound-off/e2e"
+	"github.com/glizzus/sound-off/internal/config"
 	"github.com/glizzus/sound-off/internal/generator"
 	"github.com/glizzus/sound-off/internal/handler"
 	"github.com/glizzus/sound-off/internal/repository"
@@ -20,12 +21,14 @@ func seedTestData(t *testing.T, repo *repository.PostgresSoundCronRepository) {
 			Name:    "Everything She Wants (Wham!)",
 			GuildID: guildID,
 			Cron:    "*/5 * * * *",
+			Status:  repository.SoundCronStatusReady,
 		},
 		{
 			ID:      "8597e24a-f204-4c88-bad0-fe0ab9a73ff1",
 			Name:    "Take On Me (A-ha)",
 			GuildID: guildID,
 			Cron:    "*/10 * * * *",
+			Status:  repository.SoundCronStatusReady,
 		},
 	}
 	for _, soundCron := range soundCrons {
@@ -67,7 +70,7 @@ func TestSoundCronList_NoSoundCrons(t *testing.T) {
 
 	session := &mockSession{}
 
-	handler := handler.NewInteractionHandler(repo, nil, &determinsticIDGenerator{}, nil)
+	handler := handler.NewInteractionHandler(repo, nil, nil, &determinsticIDGenerator{}, nil, nil, config.AudioConfig{}, nil)
 	handler(session, slashCommandInteraction)
 
 	expected := &discordgo.InteractionResponse{
@@ -103,7 +106,7 @@ var soundCronListSlashCommandInteraction = &discordgo.InteractionCreate{
 var expectedSoundCronListResponse = &discordgo.InteractionResponse{
 	Type: discordgo.InteractionResponseChannelMessageWithSource,
 	Data: &discordgo.InteractionResponseData{
-		Content: "Current SoundCrons",
+		Content: "Current SoundCrons (0.00 MB of 10.00 MB used)",
 		Components: []discordgo.MessageComponent{
 			discordgo.ActionsRow{
 				Components: []discordgo.MessageComponent{
@@ -166,7 +169,7 @@ func TestSoundCronList(t *testing.T) {
 	repo := e2e.GetRepository(t, connStr)
 	seedTestData(t, repo)
 
-	handler := handler.NewInteractionHandler(repo, nil, &determinsticIDGenerator{}, nil)
+	handler := handler.NewInteractionHandler(repo, nil, nil, &determinsticIDGenerator{}, nil, nil, config.AudioConfig{}, nil)
 	session := &mockSession{}
 
 	handler(session, soundCronListSlashCommandInteraction)
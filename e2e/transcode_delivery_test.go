@@ -0,0 +1,97 @@
+package e2e_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/glizzus/sound-off/internal/transcoder"
+)
+
+var testTranscodePolicy = transcoder.DeliveryPolicy{
+	AckWait:       300 * time.Millisecond,
+	MaxDeliveries: 2,
+}
+
+func sendTestTranscodeJob(t *testing.T) *redis.Client {
+	t.Helper()
+	client := useEmptyRedis(t)
+
+	queue, err := transcoder.NewRedisQueue(client, "bot", testTranscodePolicy)
+	if err != nil {
+		t.Fatalf("failed to create transcode queue: %v", err)
+	}
+	if err := queue.SendJob(t.Context(), transcoder.Job{SoundCronID: "bell"}); err != nil {
+		t.Fatalf("failed to send transcode job: %v", err)
+	}
+	return client
+}
+
+func newTranscodeQueue(t *testing.T, client *redis.Client, consumer string) *transcoder.RedisQueue {
+	t.Helper()
+	queue, err := transcoder.NewRedisQueue(client, consumer, testTranscodePolicy)
+	if err != nil {
+		t.Fatalf("failed to create transcode queue: %v", err)
+	}
+	return queue
+}
+
+func receiveTranscodeJobs(t *testing.T, queue *transcoder.RedisQueue) []transcoder.Job {
+	t.Helper()
+	jobs, err := queue.ReceiveJobs(t.Context())
+	if err != nil {
+		t.Fatalf("failed to receive transcode jobs: %v", err)
+	}
+	return jobs
+}
+
+func TestTranscodeQueueRedeliversUnacknowledgedJobs(t *testing.T) {
+	client := sendTestTranscodeJob(t)
+
+	first := newTranscodeQueue(t, client, "first")
+	if jobs := receiveTranscodeJobs(t, first); len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(jobs))
+	}
+
+	// The first transcoder stops before the job is processed, so another claims it.
+	time.Sleep(testTranscodePolicy.AckWait)
+	second := newTranscodeQueue(t, client, "second")
+	jobs := receiveTranscodeJobs(t, second)
+	if len(jobs) != 1 || jobs[0].SoundCronID != "bell" {
+		t.Fatalf("expected the job to be delivered again, got %+v", jobs)
+	}
+
+	if err := second.Ack(t.Context(), jobs[0]); err != nil {
+		t.Fatalf("failed to acknowledge job: %v", err)
+	}
+	time.Sleep(testTranscodePolicy.AckWait)
+	if jobs := receiveTranscodeJobs(t, second); len(jobs) != 0 {
+		t.Errorf("expected an acknowledged job not to be delivered again, got %+v", jobs)
+	}
+}
+
+func TestTranscodeQueueDeadLettersUnfinishedJobs(t *testing.T) {
+	client := sendTestTranscodeJob(t)
+
+	queue := newTranscodeQueue(t, client, "transcoder")
+	jobs := receiveTranscodeJobs(t, queue)
+	for delivery := 1; delivery <= testTranscodePolicy.MaxDeliveries; delivery++ {
+		if len(jobs) != 1 {
+			t.Fatalf("expected delivery %d of the job, got %+v", delivery, jobs)
+		}
+		time.Sleep(testTranscodePolicy.AckWait)
+		jobs = receiveTranscodeJobs(t, queue)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("expected the job to be given up, got %+v", jobs)
+	}
+
+	dead, err := client.XRange(t.Context(), transcoder.DeadLetterStream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("failed to read dead-letter stream: %v", err)
+	}
+	if len(dead) != 1 || dead[0].Values["soundCronID"] != "bell" {
+		t.Errorf("expected the job in the dead-letter stream, got %+v", dead)
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/opus"
+	"github.com/sethvargo/go-envconfig"
+)
+
+// AudioConfig controls how uploaded audio is encoded.
+type AudioConfig struct {
+	// TargetLUFS is the integrated loudness that soundcrons
+	// with normalization enabled are brought to.
+	TargetLUFS float64 `env:"SOUNDOFF_TARGET_LUFS, default=-16"`
+
+	// StorageFormat is the format that encoded audio is stored in,
+	// either "ogg" or "length-prefixed".
+	StorageFormat opus.Format `env:"SOUNDOFF_STORAGE_FORMAT, default=ogg"`
+
+	// FFmpegTimeout is how long ffmpeg and ffprobe may run on one file.
+	FFmpegTimeout time.Duration `env:"SOUNDOFF_FFMPEG_TIMEOUT, default=2m"`
+
+	// FFmpegThreads is how many threads ffmpeg may use. Zero lets ffmpeg decide.
+	FFmpegThreads int `env:"SOUNDOFF_FFMPEG_THREADS, default=0"`
+
+	// TranscodeAckWait is how long a transcode job may run before another
+	// transcoder takes it over, as it does the jobs of a transcoder that stopped.
+	// It must be longer than a job takes, which is mostly FFmpegTimeout.
+	TranscodeAckWait time.Duration `env:"SOUNDOFF_TRANSCODE_ACK_WAIT, default=5m"`
+
+	// TranscodeMaxDeliveries is how many times a transcode job is run before
+	// it is given up, such as a job that stops every transcoder that runs it.
+	TranscodeMaxDeliveries int `env:"SOUNDOFF_TRANSCODE_MAX_DELIVERIES, default=3"`
+}
+
+// FFmpegLimits returns the limits that ffmpeg and ffprobe run with.
+func (c AudioConfig) FFmpegLimits() opus.FFmpegLimits {
+	return opus.FFmpegLimits{
+		Timeout: c.FFmpegTimeout,
+		Threads: c.FFmpegThreads,
+	}
+}
+
+func NewAudioConfigFromEnv() (*AudioConfig, error) {
+	var cfg AudioConfig
+	if err := envconfig.Process(context.Background(), &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"context"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// OperatorConfig lists the Discord users that operate the bot itself,
+// as opposed to administrators of a single guild.
+type OperatorConfig struct {
+	OperatorIDs []string `env:"SOUNDOFF_OPERATOR_IDS"`
+}
+
+func NewOperatorConfigFromEnv() (*OperatorConfig, error) {
+	var cfg OperatorConfig
+	if err := envconfig.Process(context.Background(), &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"context"
+
+	"github.com/glizzus/sound-off/internal/worker"
+	"github.com/sethvargo/go-envconfig"
+)
+
+// QueueConfig chooses the message queue that the bot sends jobs to workers through.
+type QueueConfig struct {
+	// Backend is the message queue, either "redis", "nats" or "memory".
+	// With "nats", the bot and workers still need Redis, which holds the
+	// blacklist, skipped jobs, guild locks and transcode queue. With "memory",
+	// the bot plays soundcrons itself and no worker is run, and Redis is not
+	// used at all.
+	Backend worker.QueueBackend `env:"SOUNDOFF_QUEUE_BACKEND, default=redis"`
+
+	// NATSURL is the NATS server, with JetStream enabled, that the "nats" backend uses.
+	NATSURL string `env:"NATS_URL, default=nats://localhost:4222"`
+}
+
+func NewQueueConfigFromEnv() (*QueueConfig, error) {
+	var cfg QueueConfig
+	if err := envconfig.Process(context.Background(), &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
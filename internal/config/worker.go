@@ -0,0 +1,76 @@
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/worker"
+	"github.com/sethvargo/go-envconfig"
+)
+
+// WorkerConfig controls how workers play soundcrons.
+type WorkerConfig struct {
+	// BroadcastGap is how long a worker waits between the voice channels
+	// of a soundcron that plays in more than one channel.
+	BroadcastGap time.Duration `env:"SOUNDOFF_BROADCAST_GAP, default=2s"`
+
+	// CollisionPolicy is what a worker does with a soundcron that is due to play
+	// in a guild while another is playing there, either "queue", "drop" or "mix".
+	CollisionPolicy worker.CollisionPolicy `env:"SOUNDOFF_COLLISION_POLICY, default=queue"`
+
+	// CollisionMaxWait is how long a soundcron waits for another in the same
+	// guild to finish before it is not played.
+	CollisionMaxWait time.Duration `env:"SOUNDOFF_COLLISION_MAX_WAIT, default=5m"`
+
+	// JobAckWait is how long a job that a worker received is left unacknowledged,
+	// after the worker stops or fails to play it, before another worker plays it.
+	JobAckWait time.Duration `env:"SOUNDOFF_JOB_ACK_WAIT, default=30s"`
+
+	// JobMaxDeliveries is how many times a job is delivered to workers
+	// before it is moved to the dead-letter stream.
+	JobMaxDeliveries int `env:"SOUNDOFF_JOB_MAX_DELIVERIES, default=3"`
+
+	// JobMaxLateness is how long after its run time a job may still start to play,
+	// such as one that another worker plays after the first stopped. Later jobs
+	// are skipped, so that a soundcron does not play at a time nobody expects.
+	// Jobs that are replayed from the dead-letter stream are played however late.
+	JobMaxLateness time.Duration `env:"SOUNDOFF_JOB_MAX_LATENESS, default=1m"`
+
+	// ShutdownGrace is how soon a job must be due for a stopping worker to play it.
+	// Later jobs are given back to be played by another worker. The jobs that are
+	// played are kept claimed until they have played, however long that takes.
+	ShutdownGrace time.Duration `env:"SOUNDOFF_SHUTDOWN_GRACE, default=15s"`
+
+	// MaxPlayDuration is how long the longest sound that a worker plays runs,
+	// which is the longest MaxDuration of any guild. A stopping worker plays jobs
+	// for this long after ShutdownGrace, and then gives back those still playing.
+	MaxPlayDuration time.Duration `env:"SOUNDOFF_MAX_PLAY_DURATION, default=1m"`
+}
+
+// drainMargin is how much longer than a sound runs that a stopping worker
+// waits for it, such as to join the voice channel and to leave it again.
+const drainMargin = 15 * time.Second
+
+// DrainTimeout returns how long a stopping worker may play the jobs that were
+// due within ShutdownGrace. The terminationGracePeriodSeconds of the worker
+// deployment must be longer, so that the worker is not killed mid-sound.
+func (c WorkerConfig) DrainTimeout() time.Duration {
+	return c.ShutdownGrace + c.MaxPlayDuration + drainMargin
+}
+
+// DeliveryPolicy returns how jobs that were not acknowledged are delivered again.
+func (c WorkerConfig) DeliveryPolicy() worker.DeliveryPolicy {
+	return worker.DeliveryPolicy{
+		AckWait:       c.JobAckWait,
+		MaxDeliveries: c.JobMaxDeliveries,
+		MaxLateness:   c.JobMaxLateness,
+	}
+}
+
+func NewWorkerConfigFromEnv() (*WorkerConfig, error) {
+	var cfg WorkerConfig
+	if err := envconfig.Process(context.Background(), &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
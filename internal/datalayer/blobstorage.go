@@ -3,6 +3,8 @@ package datalayer
 import (
 	"context"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/glizzus/sound-off/internal/config"
 	"github.com/minio/minio-go/v7"
@@ -20,6 +22,18 @@ type BlobStorage interface {
 	Delete(ctx context.Context, key string) error
 }
 
+// BlobInfo describes an object in blob storage.
+type BlobInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// BlobLister is implemented by blob storage that can enumerate its objects.
+type BlobLister interface {
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+}
+
 type MinioStorage struct {
 	client *minio.Client
 	bucket string
@@ -93,6 +107,64 @@ func (s *MinioStorage) Get(ctx context.Context, key string) (io.ReadCloser, erro
 	return obj, nil
 }
 
+func (s *MinioStorage) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	var blobs []BlobInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		blobs = append(blobs, BlobInfo{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+		})
+	}
+	return blobs, nil
+}
+
+var _ BlobLister = (*MinioStorage)(nil)
+
 func (s *MinioStorage) Delete(ctx context.Context, key string) error {
 	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
 }
+
+// blobPrefix is the prefix that every object stored by Sound-Off lives under.
+const blobPrefix = "sound-off"
+
+// UploadedAudioKey returns the blob storage key of the original audio
+// that was uploaded for a soundcron.
+func UploadedAudioKey(soundCronID string) string {
+	return blobPrefix + "/uploaded/" + soundCronID
+}
+
+// OpusAudioKey returns the blob storage key of the encoded opus frames
+// that are streamed when a soundcron plays.
+func OpusAudioKey(soundCronID string) string {
+	return blobPrefix + "/opus/" + soundCronID
+}
+
+// StagedAudioKey returns the blob storage key that replacement audio for a
+// soundcron is uploaded to. It only takes the place of the original audio
+// once it has been encoded, so a bad replacement leaves the original alone.
+func StagedAudioKey(soundCronID string) string {
+	return blobPrefix + "/staged/" + soundCronID
+}
+
+// SoundCronIDFromKey returns the ID of the soundcron that a blob storage key
+// belongs to. It returns false for keys that were not created by Sound-Off.
+func SoundCronIDFromKey(key string) (string, bool) {
+	for _, prefix := range SoundCronKeys("") {
+		if id, ok := strings.CutPrefix(key, prefix); ok && id != "" && !strings.Contains(id, "/") {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// SoundCronKeys returns every blob storage key that belongs to a soundcron.
+func SoundCronKeys(soundCronID string) []string {
+	return []string{UploadedAudioKey(soundCronID), OpusAudioKey(soundCronID), StagedAudioKey(soundCronID)}
+}
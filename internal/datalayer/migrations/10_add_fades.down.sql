@@ -0,0 +1,3 @@
+ALTER TABLE soundcron
+DROP COLUMN fade_in_ms,
+DROP COLUMN fade_out_ms;
@@ -0,0 +1,3 @@
+ALTER TABLE soundcron
+ADD COLUMN fade_in_ms BIGINT NOT NULL DEFAULT 0 CHECK (fade_in_ms >= 0),
+ADD COLUMN fade_out_ms BIGINT NOT NULL DEFAULT 0 CHECK (fade_out_ms >= 0);
@@ -0,0 +1,6 @@
+ALTER TABLE soundcron
+DROP COLUMN creator_id,
+DROP COLUMN channel_strategy,
+DROP COLUMN channel_id,
+DROP COLUMN channel_allow,
+DROP COLUMN channel_deny;
@@ -0,0 +1,9 @@
+-- Soundcrons created before the creator was tracked have no creator,
+-- so the creator strategy never finds a channel for them.
+ALTER TABLE soundcron
+ADD COLUMN creator_id TEXT NOT NULL DEFAULT '',
+ADD COLUMN channel_strategy TEXT NOT NULL DEFAULT 'most_humans'
+CHECK (channel_strategy IN ('most_humans', 'fixed', 'creator', 'all_occupied')),
+ADD COLUMN channel_id TEXT NOT NULL DEFAULT '',
+ADD COLUMN channel_allow TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN channel_deny TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,2 @@
+ALTER TABLE soundcron
+ADD COLUMN priority INT NOT NULL DEFAULT 0 CHECK (priority BETWEEN 0 AND 10);
@@ -0,0 +1,8 @@
+-- Existing soundcrons were created before their audio was tracked,
+-- so they are assumed to be playable.
+ALTER TABLE soundcron
+ADD COLUMN status TEXT NOT NULL DEFAULT 'ready'
+CHECK (status IN ('pending', 'ready', 'failed'));
+
+ALTER TABLE soundcron
+ALTER COLUMN status SET DEFAULT 'pending';
@@ -0,0 +1,5 @@
+CREATE TABLE guild_settings (
+    guild_id BIGINT PRIMARY KEY,
+    storage_quota BIGINT NOT NULL CHECK (storage_quota > 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+-- file_size is the size of the uploaded audio. encoded_size is the size of the
+-- opus copy that is streamed during playback, which is also kept in blob storage.
+ALTER TABLE soundcron
+ADD COLUMN encoded_size BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+ALTER TABLE guild_settings
+DROP COLUMN max_duration_ms;
+
+ALTER TABLE soundcron
+DROP COLUMN duration_ms,
+DROP COLUMN channels,
+DROP COLUMN codec;
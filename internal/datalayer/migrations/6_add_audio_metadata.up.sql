@@ -0,0 +1,8 @@
+-- Soundcrons uploaded before probing have no metadata.
+ALTER TABLE soundcron
+ADD COLUMN duration_ms BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN channels INT NOT NULL DEFAULT 0,
+ADD COLUMN codec TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE guild_settings
+ADD COLUMN max_duration_ms BIGINT NOT NULL DEFAULT 60000 CHECK (max_duration_ms > 0);
@@ -0,0 +1,2 @@
+ALTER TABLE soundcron
+DROP COLUMN normalize;
@@ -0,0 +1,2 @@
+ALTER TABLE soundcron
+ADD COLUMN normalize BOOLEAN NOT NULL DEFAULT FALSE;
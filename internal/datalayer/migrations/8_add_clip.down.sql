@@ -0,0 +1,3 @@
+ALTER TABLE soundcron
+DROP COLUMN clip_start_ms,
+DROP COLUMN clip_end_ms;
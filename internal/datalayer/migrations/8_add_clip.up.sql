@@ -0,0 +1,4 @@
+-- A clip end of zero plays the audio to its end.
+ALTER TABLE soundcron
+ADD COLUMN clip_start_ms BIGINT NOT NULL DEFAULT 0 CHECK (clip_start_ms >= 0),
+ADD COLUMN clip_end_ms BIGINT NOT NULL DEFAULT 0 CHECK (clip_end_ms >= 0);
@@ -0,0 +1,2 @@
+ALTER TABLE soundcron
+ADD COLUMN volume INT NOT NULL DEFAULT 100 CHECK (volume BETWEEN 1 AND 200);
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+// SoundCronAddURLRequest is a request to add a soundcron
+// whose audio is downloaded from a direct link.
+type SoundCronAddURLRequest struct {
+	URL       string
+	Cron      string
+	Timezone  string
+	Name      string
+	Normalize bool
+
+	// Start and End are the timestamps that the audio is clipped to, as typed by the user.
+	Start string
+	End   string
+
+	FadeIn  time.Duration
+	FadeOut time.Duration
+}
+
+func CommandToAddURLRequest(
+	options []*discordgo.ApplicationCommandInteractionDataOption,
+) (*SoundCronAddURLRequest, error) {
+	var request SoundCronAddURLRequest
+
+	for _, option := range options {
+		if option.Name == "fade_in" || option.Name == "fade_out" {
+			fade, err := fadeOptionValue(option)
+			if err != nil {
+				return nil, err
+			}
+			if option.Name == "fade_in" {
+				request.FadeIn = fade
+			} else {
+				request.FadeOut = fade
+			}
+			continue
+		}
+		if option.Name == "normalize" {
+			if option.Type != discordgo.ApplicationCommandOptionBoolean {
+				return nil, fmt.Errorf("invalid type for normalize option")
+			}
+			request.Normalize = option.BoolValue()
+			continue
+		}
+		if option.Type != discordgo.ApplicationCommandOptionString {
+			return nil, fmt.Errorf("invalid type for %s option", option.Name)
+		}
+		switch option.Name {
+		case "url":
+			request.URL = option.StringValue()
+		case "cron":
+			request.Cron = option.StringValue()
+		case "timezone":
+			request.Timezone = option.StringValue()
+		case "name":
+			request.Name = option.StringValue()
+		case "start":
+			request.Start = option.StringValue()
+		case "end":
+			request.End = option.StringValue()
+		}
+	}
+
+	if request.URL == "" {
+		return nil, fmt.Errorf("missing url option")
+	}
+
+	if request.Name == "" {
+		if parsed, err := url.Parse(request.URL); err == nil {
+			if base := path.Base(parsed.Path); base != "/" && base != "." {
+				request.Name = base
+			}
+		}
+	}
+	if request.Name == "" {
+		request.Name = request.URL
+	}
+
+	return &request, nil
+}
+
+// downloadErrorToUserError turns the errors returned by BlobTransferService.Pipe
+// into messages that can be shown to the user. Errors that the user can not act on
+// are returned unchanged.
+func downloadErrorToUserError(err error) error {
+	var (
+		invalidURL  *InvalidURLError
+		failed      *DownloadFailedError
+		unsupported *UnsupportedContentTypeError
+		tooLarge    *DownloadTooLargeError
+	)
+	switch {
+	case errors.As(err, &invalidURL):
+		return &UserError{Message: "Only direct http:// or https:// links to audio files are supported"}
+	case errors.As(err, &failed):
+		return &UserError{Message: fmt.Sprintf("The link could not be downloaded (%s)", failed.Status)}
+	case errors.As(err, &unsupported):
+		return &UserError{Message: fmt.Sprintf("The link does not point to a supported audio file (got %q)", unsupported.ContentType)}
+	case errors.As(err, &tooLarge):
+		return &UserError{Message: fmt.Sprintf("The file is larger than the %d MB download limit", tooLarge.Max/(1024*1024))}
+	}
+	return err
+}
+
+// ProcessAddURLSoundCron adds a soundcron whose audio is downloaded from a URL.
+// The download is stored as the original audio and then goes through the same
+// opus encoding as an uploaded attachment, which is reported to interaction.
+func (h *AddFileHandler) ProcessAddURLSoundCron(
+	guildID string,
+	addURLRequest *SoundCronAddURLRequest,
+	interaction *discordgo.Interaction,
+) error {
+	ctx := context.Background()
+
+	soundCron, soundCrons, err := h.prepareSoundCron(
+		ctx,
+		guildID,
+		addURLRequest.Name,
+		addURLRequest.Cron,
+		addURLRequest.Timezone,
+	)
+	if err != nil {
+		return err
+	}
+	soundCron.CreatorID = interactionUserID(interaction)
+	soundCron.Clip, err = parseClip(addURLRequest.Start, addURLRequest.End)
+	if err != nil {
+		return err
+	}
+	if err := checkFades(addURLRequest.FadeIn, addURLRequest.FadeOut); err != nil {
+		return err
+	}
+	soundCron.FadeIn = addURLRequest.FadeIn
+	soundCron.FadeOut = addURLRequest.FadeOut
+
+	// The size of a download is not known up front, so the storage limit
+	// is checked once the file is in blob storage.
+	key := datalayer.UploadedAudioKey(soundCron.ID)
+	size, err := h.Transfer.Pipe(ctx, key, addURLRequest.URL)
+	if err != nil {
+		return downloadErrorToUserError(err)
+	}
+	soundCron.FileSize = size
+	soundCron.Normalize = addURLRequest.Normalize
+
+	quota, err := h.storageQuota(ctx, guildID)
+	if err != nil {
+		return err
+	}
+	err = CheckStorageAvailable(soundCrons, soundCron.FileSize, quota)
+	if err != nil {
+		if err := h.BlobStorage.Delete(ctx, key); err != nil {
+			slog.Error("failed to delete rejected download", "key", key, "error", err)
+		}
+		return &UserError{
+			Message: "Storage limit exceeded",
+		}
+	}
+
+	soundCron.Status = repository.SoundCronStatusPending
+	err = h.Repo.Save(ctx, soundCron)
+	if err != nil {
+		return fmt.Errorf("failed to persist soundcron row in database: %w", err)
+	}
+
+	if err := h.checkAudio(ctx, &soundCron); err != nil {
+		return h.failProcessing(ctx, soundCron.ID, err)
+	}
+
+	job, err := h.newTranscodeJob(ctx, soundCron, SoundCronAddedMessage)
+	if err != nil {
+		return h.failProcessing(ctx, soundCron.ID, err)
+	}
+	return h.transcode(ctx, interaction, job)
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/util"
+)
+
+// ChannelListNone is typed for the allow or deny list to clear it.
+const ChannelListNone = "none"
+
+// SoundCronChannelRequest is a request to change how the voice channel
+// that a soundcron plays in is chosen.
+type SoundCronChannelRequest struct {
+	Name      string
+	Strategy  repository.ChannelStrategy
+	ChannelID string
+
+	// Allow and Deny are the channel lists as typed by the user.
+	// An empty list keeps the current one, and ChannelListNone clears it.
+	Allow string
+	Deny  string
+}
+
+func CommandToChannelRequest(
+	options []*discordgo.ApplicationCommandInteractionDataOption,
+) (*SoundCronChannelRequest, error) {
+	var request SoundCronChannelRequest
+	for _, option := range options {
+		switch option.Name {
+		case "name":
+			if option.Type != discordgo.ApplicationCommandOptionString {
+				return nil, fmt.Errorf("invalid type for name option")
+			}
+			request.Name = option.StringValue()
+		case "strategy":
+			if option.Type != discordgo.ApplicationCommandOptionString {
+				return nil, fmt.Errorf("invalid type for strategy option")
+			}
+			request.Strategy = repository.ChannelStrategy(option.StringValue())
+		case "channel":
+			channelID, ok := option.Value.(string)
+			if option.Type != discordgo.ApplicationCommandOptionChannel || !ok {
+				return nil, fmt.Errorf("invalid type for channel option")
+			}
+			request.ChannelID = channelID
+		case "allow":
+			if option.Type != discordgo.ApplicationCommandOptionString {
+				return nil, fmt.Errorf("invalid type for allow option")
+			}
+			request.Allow = option.StringValue()
+		case "deny":
+			if option.Type != discordgo.ApplicationCommandOptionString {
+				return nil, fmt.Errorf("invalid type for deny option")
+			}
+			request.Deny = option.StringValue()
+		}
+	}
+	if request.Name == "" {
+		return nil, fmt.Errorf("missing name option")
+	}
+	if request.Strategy == "" {
+		return nil, fmt.Errorf("missing strategy option")
+	}
+	return &request, nil
+}
+
+// channelListPattern matches the channels of a channel list,
+// as channel mentions like <#123> or as bare IDs.
+var channelListPattern = regexp.MustCompile(`^(?:<#(\d+)>|(\d+))$`)
+
+// parseChannelList parses a list of channels separated by spaces or commas.
+func parseChannelList(list string) ([]string, error) {
+	if strings.EqualFold(strings.TrimSpace(list), ChannelListNone) {
+		return nil, nil
+	}
+	var channelIDs []string
+	for _, field := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		match := channelListPattern.FindStringSubmatch(field)
+		if match == nil {
+			return nil, &UserError{
+				Message: fmt.Sprintf("%q is not a channel. Mention channels like #general, or type `%s`.", field, ChannelListNone),
+			}
+		}
+		channelIDs = append(channelIDs, match[1]+match[2])
+	}
+	return channelIDs, nil
+}
+
+// SoundCronChannelUpdater finds soundcrons by name and changes how their channel is chosen.
+type SoundCronChannelUpdater interface {
+	repository.SoundCronLister
+	repository.SoundCronChannelSelectionSetter
+}
+
+// ChannelHandler changes how the voice channels that soundcrons play in are chosen.
+type ChannelHandler struct {
+	SoundCrons SoundCronChannelUpdater
+}
+
+// ProcessChannel applies channelRequest to the soundcron of the guild with the
+// requested name, and returns the message to show the user.
+func (h *ChannelHandler) ProcessChannel(
+	ctx context.Context,
+	guildID string,
+	channelRequest *SoundCronChannelRequest,
+) (string, error) {
+	switch channelRequest.Strategy {
+	case repository.ChannelStrategyFixed:
+		if channelRequest.ChannelID == "" {
+			return "", &UserError{Message: "Choose the channel to always play in"}
+		}
+	case repository.ChannelStrategyMostHumans, repository.ChannelStrategyCreator, repository.ChannelStrategyAllOccupied:
+		if channelRequest.ChannelID != "" {
+			return "", &UserError{Message: "A channel can only be chosen with the fixed channel strategy"}
+		}
+	default:
+		return "", &UserError{
+			Message: fmt.Sprintf("%q is not a channel strategy", channelRequest.Strategy),
+		}
+	}
+
+	soundCrons, err := h.SoundCrons.List(ctx, guildID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list soundcrons: %w", err)
+	}
+
+	soundCron, found := util.FindFirst(soundCrons, func(sc repository.SoundCron) bool {
+		return sc.Name == channelRequest.Name
+	})
+	if !found {
+		return "", &UserError{
+			Message: fmt.Sprintf("No soundcron named `%s` exists", channelRequest.Name),
+		}
+	}
+
+	channels := repository.ChannelSelection{
+		Strategy:  channelRequest.Strategy,
+		ChannelID: channelRequest.ChannelID,
+		Allow:     soundCron.Channels.Allow,
+		Deny:      soundCron.Channels.Deny,
+	}
+	if channelRequest.Allow != "" {
+		if channels.Allow, err = parseChannelList(channelRequest.Allow); err != nil {
+			return "", err
+		}
+	}
+	if channelRequest.Deny != "" {
+		if channels.Deny, err = parseChannelList(channelRequest.Deny); err != nil {
+			return "", err
+		}
+	}
+
+	if err := h.SoundCrons.SetChannelSelection(ctx, soundCron.ID, channels); err != nil {
+		return "", fmt.Errorf("failed to set channel selection: %w", err)
+	}
+	return fmt.Sprintf("`%s` will play in %s from its next run", soundCron.Name, DescribeChannels(channels)), nil
+}
+
+// DescribeChannels describes where a soundcron with the given channel selection plays.
+func DescribeChannels(channels repository.ChannelSelection) string {
+	var description string
+	switch channels.Strategy {
+	case repository.ChannelStrategyFixed:
+		description = fmt.Sprintf("<#%s> when anyone is listening there", channels.ChannelID)
+	case repository.ChannelStrategyCreator:
+		description = "the voice channel of whoever added it"
+	case repository.ChannelStrategyAllOccupied:
+		description = "every voice channel with listeners, one after another"
+	default:
+		description = "the voice channel with the most listeners"
+	}
+
+	if len(channels.Allow) > 0 {
+		description += ", only in " + channelMentions(channels.Allow)
+	}
+	if len(channels.Deny) > 0 {
+		description += ", never in " + channelMentions(channels.Deny)
+	}
+	return description
+}
+
+func channelMentions(channelIDs []string) string {
+	mentions := make([]string, len(channelIDs))
+	for i, channelID := range channelIDs {
+		mentions[i] = "<#" + channelID + ">"
+	}
+	return strings.Join(mentions, " ")
+}
+
+// NewChannelFlow creates the flow for the "/soundcron channel" command.
+func NewChannelFlow(h *ChannelHandler) *Flow {
+	return &Flow{
+		ID: "soundcron_channel",
+		Root: &Node{
+			ID: "soundcron_channel_slash_command",
+			Matcher: func(i *discordgo.InteractionCreate) bool {
+				if i.Type != discordgo.InteractionApplicationCommand {
+					return false
+				}
+				data := i.ApplicationCommandData()
+				return data.Name == "soundcron" &&
+					len(data.Options) > 0 && data.Options[0].Name == "channel"
+			},
+			Handler: func(s DiscordSession, i *discordgo.InteractionCreate, flowContext *FlowContext) error {
+				channelRequest, err := CommandToChannelRequest(i.ApplicationCommandData().Options[0].Options)
+				if err != nil {
+					return fmt.Errorf("failed to parse channel request: %w", err)
+				}
+
+				content, err := h.ProcessChannel(context.Background(), i.GuildID, channelRequest)
+				if err != nil {
+					var ue *UserError
+					if !errors.As(err, &ue) {
+						return fmt.Errorf("failed to process channel request: %w", err)
+					}
+					content = ue.Message
+				}
+
+				err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Content: content,
+						Flags:   discordgo.MessageFlagsEphemeral,
+					},
+				})
+				if err != nil {
+					return fmt.Errorf("failed to respond to interaction: %w", err)
+				}
+				return nil
+			},
+		},
+	}
+}
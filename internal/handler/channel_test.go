@@ -0,0 +1,132 @@
+package handler_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/handler"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+func TestCommandToChannelRequest(t *testing.T) {
+	result, err := handler.CommandToChannelRequest([]*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "name", Type: discordgo.ApplicationCommandOptionString, Value: "Bell"},
+		{Name: "strategy", Type: discordgo.ApplicationCommandOptionString, Value: "fixed"},
+		{Name: "channel", Type: discordgo.ApplicationCommandOptionChannel, Value: "123"},
+		{Name: "deny", Type: discordgo.ApplicationCommandOptionString, Value: "<#456>"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := handler.SoundCronChannelRequest{
+		Name:      "Bell",
+		Strategy:  repository.ChannelStrategyFixed,
+		ChannelID: "123",
+		Deny:      "<#456>",
+	}
+	if *result != want {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	_, err = handler.CommandToChannelRequest([]*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "name", Type: discordgo.ApplicationCommandOptionString, Value: "Bell"},
+	})
+	if err == nil {
+		t.Errorf("expected error for a request without a strategy")
+	}
+}
+
+func TestProcessChannel(t *testing.T) {
+	current := repository.ChannelSelection{
+		Strategy: repository.ChannelStrategyMostHumans,
+		Allow:    []string{"111"},
+		Deny:     []string{"222"},
+	}
+
+	tc := []struct {
+		name    string
+		request handler.SoundCronChannelRequest
+		wantErr bool
+		want    repository.ChannelSelection
+	}{
+		{
+			name: "Fixed channel keeps the current lists",
+			request: handler.SoundCronChannelRequest{
+				Name: "Bell", Strategy: repository.ChannelStrategyFixed, ChannelID: "333",
+			},
+			want: repository.ChannelSelection{
+				Strategy:  repository.ChannelStrategyFixed,
+				ChannelID: "333",
+				Allow:     []string{"111"},
+				Deny:      []string{"222"},
+			},
+		},
+		{
+			name: "Lists are replaced and cleared",
+			request: handler.SoundCronChannelRequest{
+				Name: "Bell", Strategy: repository.ChannelStrategyAllOccupied, Allow: "none", Deny: "<#444>, 555",
+			},
+			want: repository.ChannelSelection{
+				Strategy: repository.ChannelStrategyAllOccupied,
+				Deny:     []string{"444", "555"},
+			},
+		},
+		{
+			name: "Fixed strategy without a channel is rejected",
+			request: handler.SoundCronChannelRequest{
+				Name: "Bell", Strategy: repository.ChannelStrategyFixed,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Channel without the fixed strategy is rejected",
+			request: handler.SoundCronChannelRequest{
+				Name: "Bell", Strategy: repository.ChannelStrategyCreator, ChannelID: "333",
+			},
+			wantErr: true,
+		},
+		{
+			name: "List that is not channels is rejected",
+			request: handler.SoundCronChannelRequest{
+				Name: "Bell", Strategy: repository.ChannelStrategyMostHumans, Deny: "afk",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown soundcron is rejected",
+			request: handler.SoundCronChannelRequest{
+				Name: "Horn", Strategy: repository.ChannelStrategyMostHumans,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &fakeSoundCronRepository{soundCrons: []repository.SoundCron{
+				{ID: "sc-1", Name: "Bell", GuildID: "guild", Channels: current},
+			}}
+			h := &handler.ChannelHandler{SoundCrons: repo}
+
+			_, err := h.ProcessChannel(t.Context(), "guild", &testCase.request)
+			if testCase.wantErr {
+				var ue *handler.UserError
+				if !errors.As(err, &ue) {
+					t.Fatalf("expected UserError, got %v", err)
+				}
+				if len(repo.channels) != 0 {
+					t.Errorf("expected no channel selection to be set, got %v", repo.channels)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := repo.channels["sc-1"]; !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("expected channel selection %+v, got %+v", testCase.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/util"
+)
+
+// parseClip parses the start and end timestamps given by the user.
+// Either may be empty, in which case the clip starts at the beginning
+// or plays to the end of the audio.
+func parseClip(start, end string) (repository.Clip, error) {
+	var clip repository.Clip
+	if start != "" {
+		d, err := util.ParseTimestamp(start)
+		if err != nil {
+			return repository.Clip{}, &UserError{
+				Message: fmt.Sprintf("%q is not a valid start time. Use a timestamp like \"1:23.5\".", start),
+			}
+		}
+		clip.Start = d
+	}
+	if end != "" {
+		d, err := util.ParseTimestamp(end)
+		if err != nil || d == 0 {
+			return repository.Clip{}, &UserError{
+				Message: fmt.Sprintf("%q is not a valid end time. Use a timestamp like \"1:28.5\".", end),
+			}
+		}
+		clip.End = d
+	}
+	if clip.End != 0 && clip.End <= clip.Start {
+		return repository.Clip{}, &UserError{
+			Message: "The end of the clip must come after its start",
+		}
+	}
+	return clip, nil
+}
+
+// checkClip checks that a clip of audio with the given duration
+// is no longer than maxDuration and does not start past the end of the audio.
+// A zero duration means that the length of the audio is not known.
+func checkClip(clip repository.Clip, duration, maxDuration time.Duration) error {
+	if duration > 0 && clip.Start >= duration {
+		return &UserError{
+			Message: fmt.Sprintf(
+				"The clip starts at %s, but the audio is only %s long",
+				util.FormatTimestamp(clip.Start),
+				util.FormatTimestamp(duration),
+			),
+		}
+	}
+
+	length := clip.Length(duration)
+	if length <= maxDuration {
+		return nil
+	}
+	what := "audio"
+	if !clip.IsZero() {
+		what = "clip"
+	}
+	return &UserError{
+		Message: fmt.Sprintf(
+			"The %s is %s long, but this server only allows soundcrons of up to %s",
+			what,
+			length.Round(time.Second),
+			maxDuration,
+		),
+	}
+}
+
+// MaxFade is the longest that a soundcron may take to fade in or out.
+const MaxFade = 10 * time.Second
+
+// checkFades checks that the fades asked for by the user are within MaxFade.
+func checkFades(fadeIn, fadeOut time.Duration) error {
+	if fadeIn < 0 || fadeOut < 0 || fadeIn > MaxFade || fadeOut > MaxFade {
+		return &UserError{
+			Message: fmt.Sprintf("Fades must be between 0 and %s long", MaxFade),
+		}
+	}
+	return nil
+}
+
+// fadeOptionValue reads a fade command option, given in seconds.
+func fadeOptionValue(option *discordgo.ApplicationCommandInteractionDataOption) (time.Duration, error) {
+	seconds := option.FloatValue()
+	if math.IsNaN(seconds) || seconds < 0 || seconds > MaxFade.Seconds() {
+		return 0, &UserError{
+			Message: fmt.Sprintf("Fades must be between 0 and %s long", MaxFade),
+		}
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseFades parses the fade in and fade out durations given by the user,
+// in seconds. Either may be empty, in which case there is no fade.
+func parseFades(fadeIn, fadeOut string) (time.Duration, time.Duration, error) {
+	var fades [2]time.Duration
+	for i, s := range []string{fadeIn, fadeOut} {
+		if s == "" {
+			continue
+		}
+		d, err := util.ParseTimestamp(s)
+		if err != nil {
+			return 0, 0, &UserError{
+				Message: fmt.Sprintf("%q is not a valid fade. Use a number of seconds like \"0.5\".", s),
+			}
+		}
+		fades[i] = d
+	}
+	if err := checkFades(fades[0], fades[1]); err != nil {
+		return 0, 0, err
+	}
+	return fades[0], fades[1], nil
+}
+
+// playedLength returns how long the clip of a soundcron plays, which is never
+// longer than maxDuration. Audio whose duration is not known is assumed to run
+// past maxDuration, so that it is cut there.
+func playedLength(soundCron repository.SoundCron, maxDuration time.Duration) time.Duration {
+	duration := soundCron.Audio.Duration
+	if duration == 0 {
+		duration = time.Duration(math.MaxInt64)
+	}
+	return min(soundCron.Clip.Length(duration), maxDuration)
+}
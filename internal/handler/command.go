@@ -4,8 +4,11 @@ import (
 	"fmt"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
 )
 
+var fadeMinSeconds = 0.0
+
 var baseAddCommandOptions = []*discordgo.ApplicationCommandOption{
 	{
 		Name:        "cron",
@@ -26,6 +29,40 @@ var baseAddCommandOptions = []*discordgo.ApplicationCommandOption{
 		Description: "The name of the soundcron. Defaults to the file name if not provided.",
 		Required:    false,
 	},
+	{
+		Name:        "normalize",
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+		Description: "Even out the loudness of the audio so it is not too loud or too quiet.",
+		Required:    false,
+	},
+	{
+		Name:        "start",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Description: `Where in the audio to start playing (e.g. "1:23.5"). Defaults to the beginning.`,
+		Required:    false,
+	},
+	{
+		Name:        "end",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Description: `Where in the audio to stop playing (e.g. "1:28.5"). Defaults to the end.`,
+		Required:    false,
+	},
+	{
+		Name:        "fade_in",
+		Type:        discordgo.ApplicationCommandOptionNumber,
+		Description: "How many seconds the audio fades in for.",
+		Required:    false,
+		MinValue:    &fadeMinSeconds,
+		MaxValue:    MaxFade.Seconds(),
+	},
+	{
+		Name:        "fade_out",
+		Type:        discordgo.ApplicationCommandOptionNumber,
+		Description: "How many seconds the audio fades out for before it stops.",
+		Required:    false,
+		MinValue:    &fadeMinSeconds,
+		MaxValue:    MaxFade.Seconds(),
+	},
 }
 
 var fileAddOptions = append([]*discordgo.ApplicationCommandOption{
@@ -37,6 +74,130 @@ var fileAddOptions = append([]*discordgo.ApplicationCommandOption{
 	},
 }, baseAddCommandOptions...)
 
+var urlAddOptions = append([]*discordgo.ApplicationCommandOption{
+	{
+		Name:        "url",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Description: "A direct link to the audio file to play when the soundcron runs.",
+		Required:    true,
+	},
+}, baseAddCommandOptions...)
+
+var replaceOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Name:        "name",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Description: "The name of the soundcron to replace the audio of.",
+		Required:    true,
+	},
+	{
+		Name:        "audio",
+		Type:        discordgo.ApplicationCommandOptionAttachment,
+		Description: "The new file to play when the soundcron runs.",
+		Required:    true,
+	},
+}
+
+var quotaMinStorageMB = 1.0
+var quotaMinMaxDurationSeconds = 1.0
+
+var quotaOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Name:        "storage_mb",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Description: "Set a new storage quota in megabytes. Only bot operators can do this.",
+		Required:    false,
+		MinValue:    &quotaMinStorageMB,
+		MaxValue:    MaxQuotaStorageMB,
+	},
+	{
+		Name:        "max_duration_seconds",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Description: "Set the longest audio that may be uploaded, in seconds. Only bot operators can do this.",
+		Required:    false,
+		MinValue:    &quotaMinMaxDurationSeconds,
+		MaxValue:    MaxQuotaDurationSeconds,
+	},
+}
+
+var volumeMinPercent = 1.0
+
+var volumeOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Name:        "name",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Description: "The name of the soundcron to change the volume of.",
+		Required:    true,
+	},
+	{
+		Name:        "percent",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Description: "How loud to play the soundcron, where 100 is as loud as it was uploaded.",
+		Required:    true,
+		MinValue:    &volumeMinPercent,
+		MaxValue:    repository.MaxVolume,
+	},
+}
+
+var priorityMinLevel = 0.0
+
+var priorityOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Name:        "name",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Description: "The name of the soundcron to change the priority of.",
+		Required:    true,
+	},
+	{
+		Name:        "level",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Description: "Which soundcron plays when several play at once, where higher wins.",
+		Required:    true,
+		MinValue:    &priorityMinLevel,
+		MaxValue:    repository.MaxPriority,
+	},
+}
+
+var channelOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Name:        "name",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Description: "The name of the soundcron to change the channel of.",
+		Required:    true,
+	},
+	{
+		Name:        "strategy",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Description: "How to choose the voice channel to play in.",
+		Required:    true,
+		Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{Name: "The channel with the most listeners", Value: string(repository.ChannelStrategyMostHumans)},
+			{Name: "A fixed channel", Value: string(repository.ChannelStrategyFixed)},
+			{Name: "The channel of whoever added it", Value: string(repository.ChannelStrategyCreator)},
+			{Name: "Every channel with listeners, one after another", Value: string(repository.ChannelStrategyAllOccupied)},
+		},
+	},
+	{
+		Name:         "channel",
+		Type:         discordgo.ApplicationCommandOptionChannel,
+		Description:  "The channel to always play in, for the fixed channel strategy.",
+		Required:     false,
+		ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildVoice},
+	},
+	{
+		Name:        "allow",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Description: `The only channels to play in (e.g. "#general #music"), or "none" to allow every channel.`,
+		Required:    false,
+	},
+	{
+		Name:        "deny",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Description: `Channels to never play in (e.g. "#study"), or "none" to deny no channels.`,
+		Required:    false,
+	},
+}
+
 // Commands is a list of all the commands the bot can handle.
 // This is used to register the commands with Discord.
 var Commands = []*discordgo.ApplicationCommand{
@@ -60,8 +221,44 @@ var Commands = []*discordgo.ApplicationCommand{
 						Description: "Add a soundcron using a file attachment.",
 						Options:     fileAddOptions,
 					},
+					{
+						Name:        "url",
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Description: "Add a soundcron using a direct link to an audio file.",
+						Options:     urlAddOptions,
+					},
 				},
 			},
+			{
+				Name:        "replace",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Description: "Replace the audio of a soundcron while keeping its schedule",
+				Options:     replaceOptions,
+			},
+			{
+				Name:        "quota",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Description: "View this server's storage usage and limits",
+				Options:     quotaOptions,
+			},
+			{
+				Name:        "volume",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Description: "Change how loud a soundcron plays",
+				Options:     volumeOptions,
+			},
+			{
+				Name:        "priority",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Description: "Change which soundcron plays when several play at once",
+				Options:     priorityOptions,
+			},
+			{
+				Name:        "channel",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Description: "Change which voice channel a soundcron plays in",
+				Options:     channelOptions,
+			},
 		},
 	},
 }
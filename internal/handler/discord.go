@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"sort"
 	"strings"
@@ -14,12 +13,14 @@ import (
 
 	"log/slog"
 
+	"github.com/glizzus/sound-off/internal/config"
 	"github.com/glizzus/sound-off/internal/datalayer"
-	"github.com/glizzus/sound-off/internal/opus"
 	"github.com/glizzus/sound-off/internal/generator"
+	"github.com/glizzus/sound-off/internal/opus"
 	"github.com/glizzus/sound-off/internal/presenters"
 	"github.com/glizzus/sound-off/internal/repository"
 	"github.com/glizzus/sound-off/internal/schedule"
+	"github.com/glizzus/sound-off/internal/transcoder"
 	"github.com/glizzus/sound-off/internal/util"
 	"github.com/glizzus/sound-off/internal/worker"
 )
@@ -50,6 +51,14 @@ type SoundCronAddFileRequest struct {
 	Cron       string
 	Timezone   string
 	Name       string
+	Normalize  bool
+
+	// Start and End are the timestamps that the audio is clipped to, as typed by the user.
+	Start string
+	End   string
+
+	FadeIn  time.Duration
+	FadeOut time.Duration
 }
 
 func CommandToAddFileRequest(
@@ -64,6 +73,9 @@ func CommandToAddFileRequest(
 	var cron string
 	var timezone string
 	var name string
+	var normalize bool
+	var start, end string
+	var fadeIn, fadeOut time.Duration
 
 	for _, option := range options {
 		switch option.Name {
@@ -82,6 +94,30 @@ func CommandToAddFileRequest(
 				return nil, fmt.Errorf("invalid type for name option")
 			}
 			name = option.StringValue()
+		case "normalize":
+			if option.Type != discordgo.ApplicationCommandOptionBoolean {
+				return nil, fmt.Errorf("invalid type for normalize option")
+			}
+			normalize = option.BoolValue()
+		case "start", "end":
+			if option.Type != discordgo.ApplicationCommandOptionString {
+				return nil, fmt.Errorf("invalid type for %s option", option.Name)
+			}
+			if option.Name == "start" {
+				start = option.StringValue()
+			} else {
+				end = option.StringValue()
+			}
+		case "fade_in", "fade_out":
+			fade, err := fadeOptionValue(option)
+			if err != nil {
+				return nil, err
+			}
+			if option.Name == "fade_in" {
+				fadeIn = fade
+			} else {
+				fadeOut = fade
+			}
 		}
 	}
 
@@ -94,11 +130,14 @@ func CommandToAddFileRequest(
 		Cron:       cron,
 		Timezone:   timezone,
 		Name:       name,
+		Normalize:  normalize,
+		Start:      start,
+		End:        end,
+		FadeIn:     fadeIn,
+		FadeOut:    fadeOut,
 	}, nil
 }
 
-const MaxStorageSize = 10 * 1024 * 1024 // 10 MB
-
 type StorageLimitError struct {
 	Requested int64
 	Current   int64
@@ -114,7 +153,7 @@ var _ error = (*StorageLimitError)(nil)
 func CheckStorageAvailable(soundCrons []repository.SoundCron, requested, maxStorage int64) error {
 	var totalSize int64
 	for _, soundCron := range soundCrons {
-		totalSize += soundCron.FileSize
+		totalSize += soundCron.StorageSize()
 	}
 
 	if totalSize+requested > maxStorage {
@@ -145,44 +184,6 @@ type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-// BlobTransferService is a struct that provides
-// high-level operations for moving or getting data
-// from blob storage.
-type BlobTransferService struct {
-	blobStorage datalayer.BlobStorage
-	httpClient  HTTPClient
-	prefix      string
-}
-
-func (a *BlobTransferService) Pipe(ctx context.Context, key, sourceURL string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	log.Printf("Downloading file from %s", sourceURL)
-	resp, err := a.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	log.Printf("Received response with status: %s", resp.Status)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download file: %s", resp.Status)
-	}
-
-	key = a.prefix + "/" + key
-	err = a.blobStorage.Put(ctx, key, resp.Body, datalayer.PutOptions{
-		Size:        resp.ContentLength,
-		ContentType: resp.Header.Get("Content-Type"),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to upload file: %w", err)
-	}
-	return nil
-}
-
 type DiscordSession interface {
 	InteractionRespond(
 		*discordgo.Interaction,
@@ -213,14 +214,22 @@ type HandlerContext struct {
 func NewDiscordInteractionHandler(
 	repo *repository.PostgresSoundCronRepository,
 	blobStorage datalayer.BlobStorage,
+	guildSettings repository.GuildSettingsRepository,
 	blacklistAdder worker.BlacklistAdder,
+	transcodeQueue transcoder.JobSender,
+	audio config.AudioConfig,
+	operatorIDs []string,
 ) func(*discordgo.Session, *discordgo.InteractionCreate) {
 	uuidGenerator := &generator.UUIDV4Generator{}
 	internalHandler := NewInteractionHandler(
 		repo,
 		blobStorage,
+		guildSettings,
 		uuidGenerator,
 		blacklistAdder,
+		transcodeQueue,
+		audio,
+		operatorIDs,
 	)
 	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		internalHandler(s, i)
@@ -230,18 +239,39 @@ func NewDiscordInteractionHandler(
 func NewInteractionHandler(
 	repo *repository.PostgresSoundCronRepository,
 	blobStorage datalayer.BlobStorage,
+	guildSettings repository.GuildSettingsRepository,
 	idGenerator generator.Generator[string],
 	blacklistAdder worker.BlacklistAdder,
+	transcodeQueue transcoder.JobSender,
+	audio config.AudioConfig,
+	operatorIDs []string,
 ) func(DiscordSession, *discordgo.InteractionCreate) {
+	audioPiper := NewBlobTransferService(
+		blobStorage,
+		NewPublicHTTPClient(),
+		MaxURLDownloadSize,
+		DefaultAllowedContentTypes,
+	)
+
+	encoder := transcoder.NewTranscoder(blobStorage, repo, audio)
+	encoder.Quota = &transcoder.QuotaChecker{SoundCrons: repo, GuildSettings: guildSettings}
+
 	addFileHandler := &AddFileHandler{
 		Repo:          repo,
 		BlobStorage:   blobStorage,
 		HTTPClient:    http.DefaultClient,
 		UUIDGenerator: idGenerator,
+		Transfer:      audioPiper,
+		GuildSettings: guildSettings,
+		Probe:         opus.NewFFprobe(audio.FFmpegLimits()),
+
+		Transcoder:     encoder,
+		TranscodeQueue: transcodeQueue,
 	}
 
 	handlerCtx := &HandlerContext{
 		Repo:           repo,
+		AudioPiper:     audioPiper,
 		UUIDGenerator:  idGenerator,
 		AddFileHandler: addFileHandler,
 	}
@@ -249,6 +279,20 @@ func NewInteractionHandler(
 	flowManager := NewFlowManager(idGenerator)
 
 	flowManager.RegisterFlow(PingFlow)
+	flowManager.RegisterFlow(NewQuotaFlow(&QuotaHandler{
+		SoundCrons:    repo,
+		GuildSettings: guildSettings,
+		OperatorIDs:   operatorIDs,
+	}))
+	flowManager.RegisterFlow(NewVolumeFlow(&VolumeHandler{
+		SoundCrons: repo,
+	}))
+	flowManager.RegisterFlow(NewPriorityFlow(&PriorityHandler{
+		SoundCrons: repo,
+	}))
+	flowManager.RegisterFlow(NewChannelFlow(&ChannelHandler{
+		SoundCrons: repo,
+	}))
 
 	flowManager.RegisterFlow(&Flow{
 		ID: "soundcron_list",
@@ -275,7 +319,12 @@ func NewInteractionHandler(
 					return soundCrons[i].LastAccessed.After(soundCrons[j].LastAccessed)
 				})
 
-				response := presenters.BuildListSoundCronsResponse(soundCrons, flowContext.InstanceID)
+				settings, err := guildSettingsFor(ctx, guildSettings, i.GuildID)
+				if err != nil {
+					return err
+				}
+
+				response := presenters.BuildListSoundCronsResponse(soundCrons, settings.StorageQuota, flowContext.InstanceID)
 				err = s.InteractionRespond(i.Interaction, response)
 				if err != nil {
 					return fmt.Errorf("failed to respond to interaction: %w", err)
@@ -363,9 +412,50 @@ func NewInteractionHandler(
 								return strings.HasPrefix(customID, presenters.ComponentIDSoundCronEdit)
 							},
 							Handler: func(s DiscordSession, i *discordgo.InteractionCreate, ctx *FlowContext) error {
-								fmt.Println("Edit requested for soundcron")
+								soundcron, ok := ctx.State["soundcron"].(repository.SoundCron)
+								if !ok {
+									return fmt.Errorf("failed to get soundcron from context: got type %T", ctx.State["soundcron"])
+								}
+
+								response := presenters.SoundCronEditModal(ctx.InstanceID, soundcron)
+								err := s.InteractionRespond(i.Interaction, response)
+								if err != nil {
+									return fmt.Errorf("failed to respond to interaction: %w", err)
+								}
 								return nil
 							},
+							Next: []*Node{
+								{
+									ID: "soundcron_list_edit_submit",
+									Matcher: func(i *discordgo.InteractionCreate) bool {
+										if i.Type != discordgo.InteractionModalSubmit {
+											return false
+										}
+										customID := i.ModalSubmitData().CustomID
+										return strings.HasPrefix(customID, presenters.ModalIDSoundCronEdit)
+									},
+									Handler: func(s DiscordSession, i *discordgo.InteractionCreate, ctx *FlowContext) error {
+										soundcron, ok := ctx.State["soundcron"].(repository.SoundCron)
+										if !ok {
+											return fmt.Errorf("failed to get soundcron from context: got type %T", ctx.State["soundcron"])
+										}
+
+										delete(ctx.State, "soundcron")
+
+										editRequest, err := ModalToEditRequest(i.ModalSubmitData())
+										if err != nil {
+											return fmt.Errorf("failed to parse edit request: %w", err)
+										}
+
+										// Changing the clip re-encodes the audio, which can take
+										// longer than an interaction may go unanswered.
+										respondDeferred(s, i, soundCronUpdatedMessage(editRequest.Name), func() error {
+											return addFileHandler.ProcessEditSoundCron(soundcron, editRequest, i.Interaction)
+										})
+										return nil
+									},
+								},
+							},
 						},
 						{
 							ID: "soundcron_list_delete",
@@ -394,6 +484,19 @@ func NewInteractionHandler(
 									return fmt.Errorf("failed to add soundcron to blacklist: %w", err)
 								}
 
+								// Failing to remove the audio is not fatal; anything left
+								// behind is removed later by the blob reconciler.
+								for _, key := range datalayer.SoundCronKeys(soundcron.ID) {
+									if err := blobStorage.Delete(context.Background(), key); err != nil {
+										slog.Error(
+											"failed to delete soundcron audio",
+											"error", err,
+											"soundcron_id", soundcron.ID,
+											"key", key,
+										)
+									}
+								}
+
 								response := &discordgo.InteractionResponse{
 									Type: discordgo.InteractionResponseChannelMessageWithSource,
 									Data: &discordgo.InteractionResponseData{
@@ -448,6 +551,29 @@ func HandleInteractionCreate(
 			}
 			subCommand := command.Options[0]
 			switch subCommand.Name {
+			case "replace":
+				replaceRequest, err := CommandToReplaceRequest(
+					command.Resolved.Attachments,
+					subCommand.Options,
+				)
+				if err != nil {
+					slog.Warn("Failed to parse replace request", "error", err)
+					err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+						Type: discordgo.InteractionResponseChannelMessageWithSource,
+						Data: &discordgo.InteractionResponseData{
+							Content: "Invalid request format",
+							Flags:   discordgo.MessageFlagsEphemeral,
+						},
+					})
+					if err != nil {
+						slog.Error("Failed to respond to interaction", "error", err)
+					}
+					return
+				}
+
+				respondDeferred(s, i, fmt.Sprintf("Audio for `%s` replaced successfully!", replaceRequest.Name), func() error {
+					return addFileHandler.ProcessReplaceSoundCron(i.GuildID, replaceRequest, i.Interaction)
+				})
 			case "add":
 				if len(subCommand.Options) == 0 {
 					slog.Warn("No subcommand provided for soundcron add command")
@@ -455,6 +581,32 @@ func HandleInteractionCreate(
 				}
 				subCommandGroup := subCommand.Options[0]
 				switch subCommandGroup.Name {
+				case "url":
+					addURLRequest, err := CommandToAddURLRequest(subCommandGroup.Options)
+					content := ""
+					if err != nil {
+						slog.Warn("Failed to parse add url request", "error", err)
+						content = "Invalid request format"
+					} else if addURLRequest.Cron == "" {
+						content = "A cron expression is required when adding a soundcron from a URL"
+					}
+					if content != "" {
+						err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+							Type: discordgo.InteractionResponseChannelMessageWithSource,
+							Data: &discordgo.InteractionResponseData{
+								Content: content,
+								Flags:   discordgo.MessageFlagsEphemeral,
+							},
+						})
+						if err != nil {
+							slog.Error("Failed to respond to interaction", "error", err)
+						}
+						return
+					}
+
+					respondDeferred(s, i, SoundCronAddedMessage, func() error {
+						return addFileHandler.ProcessAddURLSoundCron(i.GuildID, addURLRequest, i.Interaction)
+					})
 				case "file":
 					addFileRequest, err := CommandToAddFileRequest(
 						command.Resolved.Attachments,
@@ -471,6 +623,7 @@ func HandleInteractionCreate(
 						if err != nil {
 							slog.Error("Failed to respond to interaction", "error", err)
 						}
+						return
 					}
 
 					var userID string
@@ -481,64 +634,37 @@ func HandleInteractionCreate(
 						return
 					}
 
-					var response *discordgo.InteractionResponse
-					if addFileRequest.Cron == "" {
-						sessions[userID] = addFileRequest
+					if addFileRequest.Cron != "" {
+						addFileHandler.Handle(s, i, addFileRequest)
+						return
+					}
 
-						menu := discordgo.SelectMenu{
-							CustomID:    ComponentIDIntervalSelect,
-							Placeholder: "Select an interval",
-							Options: []discordgo.SelectMenuOption{
-								{
-									Label: "Every hour",
-									Value: "@hourly",
-								},
-								{
-									Label: "Cron (Custom)",
-									Value: "cron",
-								},
+					sessions[userID] = addFileRequest
+
+					menu := discordgo.SelectMenu{
+						CustomID:    ComponentIDIntervalSelect,
+						Placeholder: "Select an interval",
+						Options: []discordgo.SelectMenuOption{
+							{
+								Label: "Every hour",
+								Value: "@hourly",
 							},
-						}
-						row := discordgo.ActionsRow{
-							Components: []discordgo.MessageComponent{menu},
-						}
-						respData := discordgo.InteractionResponseData{
-							Content:    "Choose an interval for your SoundCron:",
-							Components: []discordgo.MessageComponent{row},
-						}
-						response = &discordgo.InteractionResponse{
-							Type: discordgo.InteractionResponseChannelMessageWithSource,
-							Data: &respData,
-						}
-					} else {
-						err = addFileHandler.ProcessAddSoundCron(
-							i.GuildID,
-							addFileRequest,
-						)
-						if err != nil {
-							errorMessage := "Internal server error - please try again later"
-							var ue *UserError
-							if errors.As(err, &ue) {
-								errorMessage = ue.Message
-							} else {
-								slog.Error("Failed to handle add file request", "error", err)
-							}
-							response = &discordgo.InteractionResponse{
-								Type: discordgo.InteractionResponseChannelMessageWithSource,
-								Data: &discordgo.InteractionResponseData{
-									Content: errorMessage,
-									Flags:   discordgo.MessageFlagsEphemeral,
-								},
-							}
-						} else {
-							response = &discordgo.InteractionResponse{
-								Type: discordgo.InteractionResponseChannelMessageWithSource,
-								Data: &discordgo.InteractionResponseData{
-									Content: "SoundCron added successfully!",
-									Flags:   discordgo.MessageFlagsEphemeral,
-								},
-							}
-						}
+							{
+								Label: "Cron (Custom)",
+								Value: "cron",
+							},
+						},
+					}
+					row := discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{menu},
+					}
+					respData := discordgo.InteractionResponseData{
+						Content:    "Choose an interval for your SoundCron:",
+						Components: []discordgo.MessageComponent{row},
+					}
+					response := &discordgo.InteractionResponse{
+						Type: discordgo.InteractionResponseChannelMessageWithSource,
+						Data: &respData,
 					}
 
 					err = s.InteractionRespond(i.Interaction, response)
@@ -607,151 +733,356 @@ func HandleInteractionCreate(
 
 }
 
+// respondDeferred acknowledges the interaction with an ephemeral deferred response,
+// runs process, then edits the response with either the success message or
+// the reason that process failed. If process queued a transcode job, the
+// response is edited again once the job is done.
+func respondDeferred(
+	s DiscordSession,
+	i *discordgo.InteractionCreate,
+	success string,
+	process func() error,
+) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to send deferred response", "error", err)
+		return
+	}
+
+	content := success
+	if err := process(); errors.Is(err, errTranscodeQueued) {
+		content = TranscodeQueuedMessage
+	} else if err != nil {
+		content = "Internal server error - please try again later"
+		var ue *UserError
+		if errors.As(err, &ue) {
+			content = ue.Message
+		} else {
+			slog.Error("Failed to process deferred interaction", "error", err)
+		}
+	}
+
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+	})
+	if err != nil {
+		slog.Error("Failed to edit deferred response", "error", err)
+	}
+}
+
 type AddFileHandler struct {
 	Repo          repository.SoundCronRepository
 	BlobStorage   datalayer.BlobStorage
 	HTTPClient    HTTPClient
 	UUIDGenerator generator.Generator[string]
-}
 
-var SoundCronAddDeferredResponse = &discordgo.InteractionResponse{
-	Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
-	Data: &discordgo.InteractionResponseData{
-		Content: "Waiting!",
-	},
-}
+	// Transfer downloads audio from user-supplied URLs.
+	Transfer *BlobTransferService
+
+	// GuildSettings holds the storage quota and maximum duration of each guild.
+	// Every guild gets the defaults when it is nil.
+	GuildSettings repository.GuildSettingsGetter
 
-var FinalResponseContent = "Done!"
-var SoundCronAddFinalResponse = &discordgo.WebhookEdit{
-	Content: &FinalResponseContent,
+	// Probe reads the metadata of uploaded audio. Audio is not probed,
+	// and therefore not limited in duration, when it is nil.
+	Probe opus.ProbeFunc
+
+	// Transcoder encodes audio inline when TranscodeQueue is nil.
+	Transcoder *transcoder.Transcoder
+
+	// TranscodeQueue hands encoding off to a transcoder process.
+	TranscodeQueue transcoder.JobSender
 }
 
+// SoundCronAddedMessage is shown once a soundcron has been added.
+const SoundCronAddedMessage = "SoundCron added successfully!"
+
 func (h *AddFileHandler) Handle(
 	session DiscordSession,
 	interaction *discordgo.InteractionCreate,
 	addFileRequest *SoundCronAddFileRequest,
 ) {
-	err := session.InteractionRespond(interaction.Interaction, SoundCronAddDeferredResponse)
-	fmt.Println(err)
-
-	err = h.ProcessAddSoundCron(interaction.GuildID, addFileRequest)
-	fmt.Println(err)
-
-	_, err = session.InteractionResponseEdit(interaction.Interaction, SoundCronAddFinalResponse)
-	fmt.Println(err)
+	respondDeferred(session, interaction, SoundCronAddedMessage, func() error {
+		return h.ProcessAddSoundCron(interaction.GuildID, addFileRequest, interaction.Interaction)
+	})
 }
 
+// ProcessAddSoundCron adds a soundcron from an uploaded attachment.
+// The result of encoding is reported to interaction, which may be nil.
 func (h *AddFileHandler) ProcessAddSoundCron(
 	guildID string,
 	addFileRequest *SoundCronAddFileRequest,
+	interaction *discordgo.Interaction,
 ) error {
+	ctx := context.Background()
+
+	soundCron, soundCrons, err := h.prepareSoundCron(
+		ctx,
+		guildID,
+		addFileRequest.Name,
+		addFileRequest.Cron,
+		addFileRequest.Timezone,
+	)
+	if err != nil {
+		return err
+	}
+	soundCron.FileSize = int64(addFileRequest.Attachment.Size)
+	soundCron.CreatorID = interactionUserID(interaction)
+	soundCron.Normalize = addFileRequest.Normalize
+	soundCron.Clip, err = parseClip(addFileRequest.Start, addFileRequest.End)
+	if err != nil {
+		return err
+	}
+	if err := checkFades(addFileRequest.FadeIn, addFileRequest.FadeOut); err != nil {
+		return err
+	}
+	soundCron.FadeIn = addFileRequest.FadeIn
+	soundCron.FadeOut = addFileRequest.FadeOut
+
+	// The encoded size is not known until the audio is encoded,
+	// so the transcoder checks the quota again once it is.
+	quota, err := h.storageQuota(ctx, guildID)
+	if err != nil {
+		return err
+	}
+	err = CheckStorageAvailable(soundCrons, soundCron.FileSize, quota)
+	if err != nil {
+		return &UserError{
+			Message: "Storage limit exceeded",
+		}
+	}
+
+	soundCron.Status = repository.SoundCronStatusPending
+	err = h.Repo.Save(ctx, soundCron)
+	if err != nil {
+		return fmt.Errorf("failed to persist soundcron row in database: %w", err)
+	}
+
+	size, err := h.storeAudio(ctx, datalayer.UploadedAudioKey(soundCron.ID), addFileRequest.Attachment.URL)
+	if err != nil {
+		return h.failProcessing(ctx, soundCron.ID, err)
+	}
+	if size != soundCron.FileSize {
+		if err := h.Repo.UpdateFileSize(ctx, soundCron.ID, size); err != nil {
+			return fmt.Errorf("failed to update file size: %w", err)
+		}
+	}
+
+	if err := h.checkAudio(ctx, &soundCron); err != nil {
+		return h.failProcessing(ctx, soundCron.ID, err)
+	}
+
+	job, err := h.newTranscodeJob(ctx, soundCron, SoundCronAddedMessage)
+	if err != nil {
+		return h.failProcessing(ctx, soundCron.ID, err)
+	}
+	return h.transcode(ctx, interaction, job)
+}
+
+// ProcessingFailedMessage is shown to the user when the audio of a soundcron
+// could not be downloaded or encoded.
+const ProcessingFailedMessage = transcoder.FailureMessage
+
+// failProcessing marks a soundcron whose audio could not be stored as failed,
+// so that it is never scheduled, and tells the user what went wrong.
+// UserErrors are passed through, anything else is reported as ProcessingFailedMessage.
+func (h *AddFileHandler) failProcessing(ctx context.Context, soundCronID string, processErr error) error {
+	slog.Error(
+		"failed to process soundcron audio",
+		"error", processErr,
+		"soundcron_id", soundCronID,
+	)
+	if err := h.Repo.SetStatus(ctx, soundCronID, repository.SoundCronStatusFailed); err != nil {
+		slog.Error("failed to mark soundcron as failed", "error", err, "soundcron_id", soundCronID)
+	}
+
+	var ue *UserError
+	if errors.As(processErr, &ue) {
+		return ue
+	}
+	return &UserError{
+		Message: ProcessingFailedMessage,
+	}
+}
+
+// storageQuota returns the number of bytes of audio a guild may store.
+func (h *AddFileHandler) storageQuota(ctx context.Context, guildID string) (int64, error) {
+	settings, err := guildSettingsFor(ctx, h.GuildSettings, guildID)
+	if err != nil {
+		return 0, err
+	}
+	return settings.StorageQuota, nil
+}
+
+// guildSettingsFor returns the settings of a guild.
+// Every guild gets the default settings when guildSettings is nil.
+func guildSettingsFor(
+	ctx context.Context,
+	guildSettings repository.GuildSettingsGetter,
+	guildID string,
+) (repository.GuildSettings, error) {
+	if guildSettings == nil {
+		return repository.DefaultGuildSettings(guildID), nil
+	}
+	settings, err := guildSettings.GetGuildSettings(ctx, guildID)
+	if err != nil {
+		return repository.GuildSettings{}, fmt.Errorf("failed to get guild settings: %w", err)
+	}
+	return settings, nil
+}
+
+// checkAudio probes the uploaded audio of a soundcron, which must already be
+// in blob storage, and records what it found on the soundcron. Audio whose clip
+// is longer than the guild allows, or starts past the end of the audio,
+// is rejected with a UserError.
+func (h *AddFileHandler) checkAudio(ctx context.Context, soundCron *repository.SoundCron) error {
+	if h.Probe == nil {
+		return nil
+	}
+	if err := h.probeAudio(ctx, datalayer.UploadedAudioKey(soundCron.ID), soundCron); err != nil {
+		return err
+	}
+	if err := h.Repo.UpdateAudioMetadata(ctx, soundCron.ID, soundCron.Audio); err != nil {
+		return fmt.Errorf("failed to update audio metadata: %w", err)
+	}
+	return nil
+}
+
+// probeAudio probes the audio stored at key for soundCron, and sets the
+// audio of soundCron to what it found without recording it. Audio whose clip
+// is longer than the guild allows, or starts past the end of the audio,
+// is rejected with a UserError.
+func (h *AddFileHandler) probeAudio(ctx context.Context, key string, soundCron *repository.SoundCron) error {
+	uploaded, err := h.BlobStorage.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to get uploaded file from blob storage for probing: %w", err)
+	}
+	defer uploaded.Close()
+
+	metadata, err := h.Probe(uploaded)
+	if err != nil {
+		if message := transcoder.AudioErrorMessage(err); message != "" {
+			return &UserError{
+				Message: message,
+			}
+		}
+		return fmt.Errorf("failed to probe audio: %w", err)
+	}
+
+	settings, err := guildSettingsFor(ctx, h.GuildSettings, soundCron.GuildID)
+	if err != nil {
+		return err
+	}
+	if err := checkClip(soundCron.Clip, metadata.Duration, settings.MaxDuration); err != nil {
+		return err
+	}
+
+	soundCron.Audio = repository.AudioMetadata{
+		Duration: metadata.Duration,
+		Channels: metadata.Channels,
+		Codec:    metadata.Codec,
+	}
+	return nil
+}
+
+// prepareSoundCron validates the user-supplied fields of a new soundcron
+// and builds it with a freshly generated ID. The soundcrons that already
+// exist in the guild are returned so that callers can check storage limits.
+func (h *AddFileHandler) prepareSoundCron(
+	ctx context.Context,
+	guildID, name, cron, timezone string,
+) (repository.SoundCron, []repository.SoundCron, error) {
 	id, err := h.UUIDGenerator.Next()
 	if err != nil {
-		return fmt.Errorf("failed to generate UUID: %w", err)
+		return repository.SoundCron{}, nil, fmt.Errorf("failed to generate UUID: %w", err)
 	}
 
-	timezone := addFileRequest.Timezone
 	if timezone == "" {
 		timezone = "UTC"
 	}
 	if _, err := time.LoadLocation(timezone); err != nil {
-		return &UserError{
+		return repository.SoundCron{}, nil, &UserError{
 			Message: fmt.Sprintf("%q is not a valid timezone. Use an IANA name like \"America/New_York\".", timezone),
 		}
 	}
 
 	soundCron := repository.SoundCron{
 		ID:       id,
-		Name:     addFileRequest.Name,
+		Name:     name,
 		GuildID:  guildID,
-		Cron:     addFileRequest.Cron,
+		Cron:     cron,
 		Timezone: timezone,
-		FileSize: int64(addFileRequest.Attachment.Size),
 	}
 
-	ctx := context.Background()
-
 	soundCrons, err := h.Repo.List(ctx, guildID)
 	if err != nil {
-		return fmt.Errorf("failed to list soundcrons: %w", err)
-	}
-
-	err = CheckStorageAvailable(soundCrons, soundCron.FileSize, MaxStorageSize)
-	if err != nil {
-		return &UserError{
-			Message: "Storage limit exceeded",
-		}
+		return repository.SoundCron{}, nil, fmt.Errorf("failed to list soundcrons: %w", err)
 	}
 
 	err = CheckSoundCronAlreadyExists(soundCron, soundCrons)
 	if err != nil {
-		return &UserError{
+		return repository.SoundCron{}, nil, &UserError{
 			Message: "Soundcron with this name already exists",
 		}
 	}
 
 	err = schedule.ValidateCron(soundCron.Cron)
 	if err != nil {
-		return &UserError{
+		return repository.SoundCron{}, nil, &UserError{
 			Message: "Invalid cron expression",
 		}
 	}
 
-	err = h.Repo.Save(ctx, soundCron)
-	if err != nil {
-		return fmt.Errorf("failed to persist soundcron row in database: %w", err)
+	return soundCron, soundCrons, nil
+}
+
+// interactionUserID returns the ID of the user who made interaction,
+// or an empty string if it is not known.
+func interactionUserID(interaction *discordgo.Interaction) string {
+	switch {
+	case interaction == nil:
+		return ""
+	case interaction.Member != nil && interaction.Member.User != nil:
+		return interaction.Member.User.ID
+	case interaction.User != nil:
+		return interaction.User.ID
 	}
+	return ""
+}
 
+// storeAudio downloads the audio at sourceURL and stores it in blob storage
+// at key, overwriting anything stored there. It returns the number of bytes
+// that were stored.
+func (h *AddFileHandler) storeAudio(ctx context.Context, key, sourceURL string) (int64, error) {
 	req, _ := http.NewRequestWithContext(
 		ctx,
 		http.MethodGet,
-		addFileRequest.Attachment.URL,
+		sourceURL,
 		nil,
 	)
 	resp, err := h.HTTPClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to download file from discord due to error: %w", err)
+		return 0, fmt.Errorf("failed to download file from discord due to error: %w", err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download file from discord due to bad status: %s", resp.Status)
+		return 0, fmt.Errorf("failed to download file from discord due to bad status: %s", resp.Status)
 	}
 
-	// Store the original audio from Discord, then encode it to opus frames
-	// for playback. We do this sequentially for simplicity.
-	const prefix = "sound-off"
-
-	key := fmt.Sprintf("%s/%s/%s", prefix, "uploaded", soundCron.ID)
-	err = h.BlobStorage.Put(ctx, key, resp.Body, datalayer.PutOptions{
+	counter := &util.CountingReader{R: resp.Body}
+	err = h.BlobStorage.Put(ctx, key, counter, datalayer.PutOptions{
 		Size:        resp.ContentLength,
 		ContentType: resp.Header.Get("Content-Type"),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to upload file to blob storage: %w", err)
+		return 0, fmt.Errorf("failed to upload file to blob storage: %w", err)
 	}
-
-	uploaded, err := h.BlobStorage.Get(ctx, key)
-	if err != nil {
-		return fmt.Errorf("failed to get uploaded file from blob storage for conversion: %w", err)
-	}
-	defer uploaded.Close()
-
-	encoded, err := opus.Encode(uploaded)
-	if err != nil {
-		return fmt.Errorf("failed to encode opus: %w", err)
-	}
-	defer encoded.Close()
-
-	key = fmt.Sprintf("%s/%s/%s", prefix, "opus", soundCron.ID)
-	err = h.BlobStorage.Put(ctx, key, encoded, datalayer.PutOptions{
-		Size:        -1,
-		ContentType: "application/octet-stream",
-	})
-	if err != nil {
-		return fmt.Errorf("failed to upload opus file to blob storage: %w", err)
-	}
-
-	return nil
+	return counter.N, nil
 }
 
 type Handlers struct {
@@ -2,6 +2,7 @@ package handler_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/glizzus/sound-off/internal/handler"
@@ -35,6 +36,47 @@ func TestCommandToAddFileRequest(t *testing.T) {
 			expected: nil,
 			err:      true,
 		},
+		{
+			name: "Command with normalize should enable normalization",
+			attachments: map[string]*discordgo.MessageAttachment{
+				"attachment1": {ID: "attachment1", Filename: "bell.mp3"},
+			},
+			options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "normalize", Type: discordgo.ApplicationCommandOptionBoolean, Value: true},
+			},
+			expected: &handler.SoundCronAddFileRequest{
+				Attachment: &discordgo.MessageAttachment{ID: "attachment1"},
+				Name:       "bell.mp3",
+				Normalize:  true,
+			},
+		},
+		{
+			name: "Command with fades should read them in seconds",
+			attachments: map[string]*discordgo.MessageAttachment{
+				"attachment1": {ID: "attachment1", Filename: "bell.mp3"},
+			},
+			options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "fade_in", Type: discordgo.ApplicationCommandOptionNumber, Value: 0.5},
+				{Name: "fade_out", Type: discordgo.ApplicationCommandOptionNumber, Value: 2.0},
+			},
+			expected: &handler.SoundCronAddFileRequest{
+				Attachment: &discordgo.MessageAttachment{ID: "attachment1"},
+				Name:       "bell.mp3",
+				FadeIn:     500 * time.Millisecond,
+				FadeOut:    2 * time.Second,
+			},
+		},
+		{
+			name: "Command with a fade longer than the maximum should return error",
+			attachments: map[string]*discordgo.MessageAttachment{
+				"attachment1": {ID: "attachment1", Filename: "bell.mp3"},
+			},
+			options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "fade_out", Type: discordgo.ApplicationCommandOptionNumber, Value: 30.0},
+			},
+			expected: nil,
+			err:      true,
+		},
 	}
 
 	for _, testCase := range tc {
@@ -52,6 +94,11 @@ func TestCommandToAddFileRequest(t *testing.T) {
 					t.Errorf("expected non-nil result but got nil")
 				} else if result.Attachment.ID != testCase.expected.Attachment.ID {
 					t.Errorf("expected attachment ID %s, got %s", testCase.expected.Attachment.ID, result.Attachment.ID)
+				} else if result.Normalize != testCase.expected.Normalize {
+					t.Errorf("expected normalize %v, got %v", testCase.expected.Normalize, result.Normalize)
+				} else if result.FadeIn != testCase.expected.FadeIn || result.FadeOut != testCase.expected.FadeOut {
+					t.Errorf("expected fades %v and %v, got %v and %v",
+						testCase.expected.FadeIn, testCase.expected.FadeOut, result.FadeIn, result.FadeOut)
 				}
 			}
 		})
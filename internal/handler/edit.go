@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/presenters"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/schedule"
+)
+
+// SoundCronEditRequest contains the values submitted through the edit modal.
+type SoundCronEditRequest struct {
+	Name     string
+	Cron     string
+	Timezone string
+
+	// Start and End are the timestamps that the audio is clipped to.
+	// Leaving them empty plays the whole audio.
+	Start string
+	End   string
+
+	// FadeIn and FadeOut are how many seconds the audio fades in and out for.
+	// Leaving them empty does not fade the audio.
+	FadeIn  string
+	FadeOut string
+}
+
+// splitModalValue splits the value of a text input that holds two values,
+// like the start and end of a clip. A value without sep is only the first of them.
+func splitModalValue(value, sep string) (string, string) {
+	first, second, _ := strings.Cut(value, sep)
+	return strings.TrimSpace(first), strings.TrimSpace(second)
+}
+
+// ModalTextValues collects the values of every text input in a modal submission,
+// keyed by the custom ID of the input.
+func ModalTextValues(components []discordgo.MessageComponent) map[string]string {
+	values := make(map[string]string)
+	for _, component := range components {
+		switch c := component.(type) {
+		case *discordgo.ActionsRow:
+			for k, v := range ModalTextValues(c.Components) {
+				values[k] = v
+			}
+		case *discordgo.Label:
+			for k, v := range ModalTextValues([]discordgo.MessageComponent{c.Component}) {
+				values[k] = v
+			}
+		case *discordgo.TextInput:
+			values[c.CustomID] = c.Value
+		}
+	}
+	return values
+}
+
+// ModalToEditRequest converts the submission of the edit modal into a SoundCronEditRequest.
+func ModalToEditRequest(data discordgo.ModalSubmitInteractionData) (*SoundCronEditRequest, error) {
+	values := ModalTextValues(data.Components)
+
+	name, ok := values[presenters.TextInputIDSoundCronName]
+	if !ok {
+		return nil, fmt.Errorf("missing name input")
+	}
+	cron, ok := values[presenters.TextInputIDSoundCronCron]
+	if !ok {
+		return nil, fmt.Errorf("missing cron input")
+	}
+	timezone, ok := values[presenters.TextInputIDSoundCronTimezone]
+	if !ok {
+		return nil, fmt.Errorf("missing timezone input")
+	}
+
+	// The clip and fade inputs are optional, so they are empty rather than missing
+	// when the user leaves them blank.
+	start, end := splitModalValue(values[presenters.TextInputIDSoundCronClip], presenters.ClipSeparator)
+	fadeIn, fadeOut := splitModalValue(values[presenters.TextInputIDSoundCronFades], presenters.FadeSeparator)
+	return &SoundCronEditRequest{
+		Name:     strings.TrimSpace(name),
+		Cron:     strings.TrimSpace(cron),
+		Timezone: strings.TrimSpace(timezone),
+		Start:    start,
+		End:      end,
+		FadeIn:   fadeIn,
+		FadeOut:  fadeOut,
+	}, nil
+}
+
+// ApplySoundCronEdit validates an edit request against the original soundcron
+// and persists the result. Only the edited fields are written, so a transcode that
+// finishes meanwhile is not undone. Editing regenerates the upcoming jobs of the
+// soundcron, so a changed schedule takes effect right away. The clip may be no longer than
+// maxDuration. Re-encoding the audio for a changed clip or fades is left to the caller.
+func ApplySoundCronEdit(
+	ctx context.Context,
+	repo repository.SoundCronRepository,
+	original repository.SoundCron,
+	req *SoundCronEditRequest,
+	maxDuration time.Duration,
+) (repository.SoundCron, error) {
+	if req.Name == "" {
+		return repository.SoundCron{}, &UserError{
+			Message: "Name cannot be empty",
+		}
+	}
+
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return repository.SoundCron{}, &UserError{
+			Message: fmt.Sprintf("%q is not a valid timezone. Use an IANA name like \"America/New_York\".", timezone),
+		}
+	}
+
+	if err := schedule.ValidateCron(req.Cron); err != nil {
+		return repository.SoundCron{}, &UserError{
+			Message: "Invalid cron expression",
+		}
+	}
+
+	clip, err := parseClip(req.Start, req.End)
+	if err != nil {
+		return repository.SoundCron{}, err
+	}
+	if clip != original.Clip {
+		if err := checkClip(clip, original.Audio.Duration, maxDuration); err != nil {
+			return repository.SoundCron{}, err
+		}
+	}
+
+	fadeIn, fadeOut, err := parseFades(req.FadeIn, req.FadeOut)
+	if err != nil {
+		return repository.SoundCron{}, err
+	}
+
+	edited := original
+	edited.Name = req.Name
+	edited.Cron = req.Cron
+	edited.Timezone = timezone
+	edited.Clip = clip
+	edited.FadeIn = fadeIn
+	edited.FadeOut = fadeOut
+
+	if edited.Name != original.Name {
+		soundCrons, err := repo.List(ctx, original.GuildID)
+		if err != nil {
+			return repository.SoundCron{}, fmt.Errorf("failed to list soundcrons: %w", err)
+		}
+		if err := CheckSoundCronAlreadyExists(edited, soundCrons); err != nil {
+			return repository.SoundCron{}, &UserError{
+				Message: "Soundcron with this name already exists",
+			}
+		}
+	}
+
+	if err := repo.Edit(ctx, edited); err != nil {
+		return repository.SoundCron{}, fmt.Errorf("failed to save edited soundcron: %w", err)
+	}
+	return edited, nil
+}
+
+// soundCronUpdatedMessage is shown once a soundcron has been edited.
+func soundCronUpdatedMessage(name string) string {
+	return fmt.Sprintf("Soundcron `%s` updated successfully!", name)
+}
+
+// ProcessEditSoundCron applies an edit to a soundcron. A changed clip or fades are
+// encoded from the audio that was already uploaded, and the result of that is reported
+// to interaction, which may be nil. Failing to encode the new audio keeps the
+// previous audio, like a failed replacement.
+func (h *AddFileHandler) ProcessEditSoundCron(
+	original repository.SoundCron,
+	req *SoundCronEditRequest,
+	interaction *discordgo.Interaction,
+) error {
+	ctx := context.Background()
+
+	settings, err := guildSettingsFor(ctx, h.GuildSettings, original.GuildID)
+	if err != nil {
+		return err
+	}
+
+	edited, err := ApplySoundCronEdit(ctx, h.Repo, original, req, settings.MaxDuration)
+	if err != nil {
+		return err
+	}
+	if edited.Clip == original.Clip && edited.FadeIn == original.FadeIn && edited.FadeOut == original.FadeOut {
+		return nil
+	}
+
+	job, err := h.newTranscodeJob(ctx, edited, soundCronUpdatedMessage(edited.Name))
+	if err != nil {
+		return err
+	}
+	job.Replace = true
+	return h.transcode(ctx, interaction, job)
+}
@@ -0,0 +1,364 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/handler"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/transcoder"
+)
+
+type fakeSoundCronRepository struct {
+	soundCrons []repository.SoundCron
+	saved      []repository.SoundCron
+	edits      []repository.SoundCron
+	statuses   map[string]repository.SoundCronStatus
+	fileSizes  map[string]int64
+	volumes    map[string]int
+	priorities map[string]int
+	channels   map[string]repository.ChannelSelection
+}
+
+func (f *fakeSoundCronRepository) Save(ctx context.Context, soundCron repository.SoundCron) error {
+	f.saved = append(f.saved, soundCron)
+	return nil
+}
+
+func (f *fakeSoundCronRepository) Edit(ctx context.Context, soundCron repository.SoundCron) error {
+	f.edits = append(f.edits, soundCron)
+	return nil
+}
+
+func (f *fakeSoundCronRepository) List(ctx context.Context, guildID string) ([]repository.SoundCron, error) {
+	return f.soundCrons, nil
+}
+
+func (f *fakeSoundCronRepository) Pull(ctx context.Context, within time.Time) ([]repository.SoundCronJob, error) {
+	return nil, nil
+}
+
+func (f *fakeSoundCronRepository) Refresh(ctx context.Context, soundCronID string) error {
+	return nil
+}
+
+func (f *fakeSoundCronRepository) UpdateFileSize(ctx context.Context, soundCronID string, fileSize int64) error {
+	if f.fileSizes == nil {
+		f.fileSizes = make(map[string]int64)
+	}
+	f.fileSizes[soundCronID] = fileSize
+	return nil
+}
+
+func (f *fakeSoundCronRepository) UpdateEncodedSize(ctx context.Context, soundCronID string, encodedSize int64) error {
+	return nil
+}
+
+func (f *fakeSoundCronRepository) UpdateAudioMetadata(ctx context.Context, soundCronID string, audio repository.AudioMetadata) error {
+	return nil
+}
+
+func (f *fakeSoundCronRepository) SetVolume(ctx context.Context, soundCronID string, volume int) error {
+	if f.volumes == nil {
+		f.volumes = make(map[string]int)
+	}
+	f.volumes[soundCronID] = volume
+	return nil
+}
+
+func (f *fakeSoundCronRepository) SetPriority(ctx context.Context, soundCronID string, priority int) error {
+	if f.priorities == nil {
+		f.priorities = make(map[string]int)
+	}
+	f.priorities[soundCronID] = priority
+	return nil
+}
+
+func (f *fakeSoundCronRepository) SetChannelSelection(ctx context.Context, soundCronID string, channels repository.ChannelSelection) error {
+	if f.channels == nil {
+		f.channels = make(map[string]repository.ChannelSelection)
+	}
+	f.channels[soundCronID] = channels
+	return nil
+}
+
+func (f *fakeSoundCronRepository) SetStatus(ctx context.Context, soundCronID string, status repository.SoundCronStatus) error {
+	if f.statuses == nil {
+		f.statuses = make(map[string]repository.SoundCronStatus)
+	}
+	f.statuses[soundCronID] = status
+	return nil
+}
+
+var _ repository.SoundCronRepository = (*fakeSoundCronRepository)(nil)
+
+func TestModalToEditRequest(t *testing.T) {
+	data := discordgo.ModalSubmitInteractionData{
+		CustomID: "soundcron_edit_modal:instance",
+		Components: []discordgo.MessageComponent{
+			&discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					&discordgo.TextInput{CustomID: "soundcron_name", Value: " Bell "},
+				},
+			},
+			&discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					&discordgo.TextInput{CustomID: "soundcron_cron", Value: "0 * * * *"},
+				},
+			},
+			&discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					&discordgo.TextInput{CustomID: "soundcron_timezone", Value: "America/New_York"},
+				},
+			},
+		},
+	}
+
+	got, err := handler.ModalToEditRequest(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := handler.SoundCronEditRequest{Name: "Bell", Cron: "0 * * * *", Timezone: "America/New_York"}
+	if *got != want {
+		t.Errorf("ModalToEditRequest() = %+v, want %+v", *got, want)
+	}
+
+	data.Components = append(data.Components, &discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			&discordgo.TextInput{CustomID: "soundcron_clip", Value: " 1:23.5 "},
+		},
+	})
+	got, err = handler.ModalToEditRequest(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Start != "1:23.5" || got.End != "" {
+		t.Errorf("expected clip start to be read and the blank end to be empty, got %+v", *got)
+	}
+
+	data.Components = append(data.Components, &discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			&discordgo.TextInput{CustomID: "soundcron_fades", Value: "0.5, 1"},
+		},
+	})
+	data.Components[3].(*discordgo.ActionsRow).Components[0] = &discordgo.TextInput{
+		CustomID: "soundcron_clip", Value: "1:23.5 - 1:28.5",
+	}
+	got, err = handler.ModalToEditRequest(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Start != "1:23.5" || got.End != "1:28.5" || got.FadeIn != "0.5" || got.FadeOut != "1" {
+		t.Errorf("expected clip and fades to be split, got %+v", *got)
+	}
+
+	if _, err := handler.ModalToEditRequest(discordgo.ModalSubmitInteractionData{}); err == nil {
+		t.Errorf("expected error for modal without inputs")
+	}
+}
+
+func TestApplySoundCronEdit(t *testing.T) {
+	original := repository.SoundCron{
+		ID:       "sc-1",
+		Name:     "Bell",
+		GuildID:  "guild",
+		Cron:     "0 * * * *",
+		Timezone: "UTC",
+		FileSize: 1024,
+		Audio:    repository.AudioMetadata{Duration: 3 * time.Minute},
+	}
+	other := repository.SoundCron{
+		ID:      "sc-2",
+		Name:    "Horn",
+		GuildID: "guild",
+		Cron:    "0 0 * * *",
+	}
+
+	tc := []struct {
+		name      string
+		req       handler.SoundCronEditRequest
+		userError bool
+	}{
+		{
+			name: "Valid edit should be saved",
+			req:  handler.SoundCronEditRequest{Name: "Big Bell", Cron: "30 * * * *", Timezone: "Europe/Paris"},
+		},
+		{
+			name: "Empty timezone should default to UTC",
+			req:  handler.SoundCronEditRequest{Name: "Bell", Cron: "30 * * * *"},
+		},
+		{
+			name:      "Invalid cron should be rejected",
+			req:       handler.SoundCronEditRequest{Name: "Bell", Cron: "not a cron", Timezone: "UTC"},
+			userError: true,
+		},
+		{
+			name:      "Invalid timezone should be rejected",
+			req:       handler.SoundCronEditRequest{Name: "Bell", Cron: "0 * * * *", Timezone: "Mars/Olympus_Mons"},
+			userError: true,
+		},
+		{
+			name:      "Renaming onto an existing soundcron should be rejected",
+			req:       handler.SoundCronEditRequest{Name: "Horn", Cron: "0 * * * *", Timezone: "UTC"},
+			userError: true,
+		},
+		{
+			name: "Clip should be saved",
+			req:  handler.SoundCronEditRequest{Name: "Bell", Cron: "0 * * * *", Start: "1:23.5", End: "1:28.5"},
+		},
+		{
+			name:      "Clip that ends before it starts should be rejected",
+			req:       handler.SoundCronEditRequest{Name: "Bell", Cron: "0 * * * *", Start: "0:10", End: "0:05"},
+			userError: true,
+		},
+		{
+			name:      "Clip that starts past the end of the audio should be rejected",
+			req:       handler.SoundCronEditRequest{Name: "Bell", Cron: "0 * * * *", Start: "4:00"},
+			userError: true,
+		},
+		{
+			name:      "Clip that is longer than the guild allows should be rejected",
+			req:       handler.SoundCronEditRequest{Name: "Bell", Cron: "0 * * * *", Start: "0:30"},
+			userError: true,
+		},
+		{
+			name:      "Invalid timestamp should be rejected",
+			req:       handler.SoundCronEditRequest{Name: "Bell", Cron: "0 * * * *", Start: "soon"},
+			userError: true,
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &fakeSoundCronRepository{soundCrons: []repository.SoundCron{original, other}}
+			req := testCase.req
+			edited, err := handler.ApplySoundCronEdit(t.Context(), repo, original, &req, repository.DefaultMaxDuration)
+			if testCase.userError {
+				var ue *handler.UserError
+				if !errors.As(err, &ue) {
+					t.Fatalf("expected UserError, got %v", err)
+				}
+				if len(repo.edits) != 0 {
+					t.Errorf("expected nothing to be saved, got %+v", repo.edits)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(repo.edits) != 1 {
+				t.Fatalf("expected exactly one edit, got %d", len(repo.edits))
+			}
+			if len(repo.saved) != 0 {
+				t.Errorf("expected the edit not to save the whole soundcron, got %+v", repo.saved)
+			}
+			if !reflect.DeepEqual(repo.edits[0], edited) {
+				t.Errorf("saved soundcron %+v does not match returned %+v", repo.edits[0], edited)
+			}
+			if edited.ID != original.ID || edited.FileSize != original.FileSize {
+				t.Errorf("edit should keep identity and file size, got %+v", edited)
+			}
+			if edited.Name != req.Name || edited.Cron != req.Cron {
+				t.Errorf("edit was not applied, got %+v", edited)
+			}
+			if req.Timezone == "" && edited.Timezone != "UTC" {
+				t.Errorf("expected timezone to default to UTC, got %q", edited.Timezone)
+			}
+			if req.Start != "" && edited.Clip.IsZero() {
+				t.Errorf("expected clip to be applied, got %+v", edited.Clip)
+			}
+		})
+	}
+}
+
+func TestProcessEditSoundCronRequeuesChangedClip(t *testing.T) {
+	original := repository.SoundCron{
+		ID:       "sc-1",
+		Name:     "Drop",
+		GuildID:  "guild",
+		Cron:     "0 * * * *",
+		Timezone: "UTC",
+		Status:   repository.SoundCronStatusReady,
+		Audio:    repository.AudioMetadata{Duration: 3 * time.Minute},
+	}
+	queue := &fakeJobSender{}
+	h := &handler.AddFileHandler{
+		Repo:           &fakeSoundCronRepository{soundCrons: []repository.SoundCron{original}},
+		TranscodeQueue: queue,
+	}
+
+	req := &handler.SoundCronEditRequest{Name: "Drop", Cron: "0 * * * *", Timezone: "UTC"}
+	if err := h.ProcessEditSoundCron(original, req, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queue.jobs) != 0 {
+		t.Fatalf("expected no transcode for an unchanged clip, got %+v", queue.jobs)
+	}
+
+	req.Start, req.End = "1:23.5", "1:28.5"
+	err := h.ProcessEditSoundCron(original, req, &discordgo.Interaction{AppID: "app", Token: "token"})
+	if err == nil {
+		t.Fatalf("expected the queued job to be reported instead of a final result")
+	}
+
+	want := transcoder.Job{
+		SoundCronID:      "sc-1",
+		GuildID:          "guild",
+		Replace:          true,
+		Audio:            original.Audio,
+		Clip:             repository.Clip{Start: 83500 * time.Millisecond, End: 88500 * time.Millisecond},
+		Length:           5 * time.Second,
+		ApplicationID:    "app",
+		InteractionToken: "token",
+		SuccessMessage:   "Soundcron `Drop` updated successfully!",
+	}
+	if len(queue.jobs) != 1 || queue.jobs[0] != want {
+		t.Errorf("expected job %+v to be queued, got %+v", want, queue.jobs)
+	}
+}
+
+func TestProcessEditSoundCronRequeuesChangedFades(t *testing.T) {
+	original := repository.SoundCron{
+		ID:       "sc-1",
+		Name:     "Drop",
+		GuildID:  "guild",
+		Cron:     "0 * * * *",
+		Timezone: "UTC",
+		Status:   repository.SoundCronStatusReady,
+		Audio:    repository.AudioMetadata{Duration: 30 * time.Second},
+	}
+	queue := &fakeJobSender{}
+	h := &handler.AddFileHandler{
+		Repo:           &fakeSoundCronRepository{soundCrons: []repository.SoundCron{original}},
+		TranscodeQueue: queue,
+	}
+
+	req := &handler.SoundCronEditRequest{Name: "Drop", Cron: "0 * * * *", Timezone: "UTC", FadeIn: "11"}
+	var userErr *handler.UserError
+	if err := h.ProcessEditSoundCron(original, req, nil); !errors.As(err, &userErr) {
+		t.Fatalf("expected a user error for a fade longer than %s, got %v", handler.MaxFade, err)
+	}
+
+	req.FadeIn, req.FadeOut = "0.5", "2"
+	if err := h.ProcessEditSoundCron(original, req, nil); err == nil {
+		t.Fatalf("expected the queued job to be reported instead of a final result")
+	}
+
+	want := transcoder.Job{
+		SoundCronID:    "sc-1",
+		GuildID:        "guild",
+		Replace:        true,
+		Audio:          original.Audio,
+		Length:         30 * time.Second,
+		FadeIn:         500 * time.Millisecond,
+		FadeOut:        2 * time.Second,
+		SuccessMessage: "Soundcron `Drop` updated successfully!",
+	}
+	if len(queue.jobs) != 1 || queue.jobs[0] != want {
+		t.Errorf("expected job %+v to be queued, got %+v", want, queue.jobs)
+	}
+}
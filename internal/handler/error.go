@@ -26,3 +26,51 @@ func (e *UserError) Error() string {
 }
 
 var _ error = (*UserError)(nil)
+
+// InvalidURLError is an error that indicates that a user-supplied URL
+// can not be downloaded from.
+type InvalidURLError struct {
+	URL string
+}
+
+func (e *InvalidURLError) Error() string {
+	return fmt.Sprintf("invalid download URL %q", e.URL)
+}
+
+var _ error = (*InvalidURLError)(nil)
+
+// DownloadFailedError is an error that indicates that the remote server
+// did not successfully serve a download.
+type DownloadFailedError struct {
+	Status string
+}
+
+func (e *DownloadFailedError) Error() string {
+	return fmt.Sprintf("failed to download file: %s", e.Status)
+}
+
+var _ error = (*DownloadFailedError)(nil)
+
+// UnsupportedContentTypeError is an error that indicates that a download
+// was refused because of its content type.
+type UnsupportedContentTypeError struct {
+	ContentType string
+}
+
+func (e *UnsupportedContentTypeError) Error() string {
+	return fmt.Sprintf("unsupported content type %q", e.ContentType)
+}
+
+var _ error = (*UnsupportedContentTypeError)(nil)
+
+// DownloadTooLargeError is an error that indicates that a download
+// exceeded the maximum allowed size.
+type DownloadTooLargeError struct {
+	Max int64
+}
+
+func (e *DownloadTooLargeError) Error() string {
+	return fmt.Sprintf("download exceeds the maximum size of %d bytes", e.Max)
+}
+
+var _ error = (*DownloadTooLargeError)(nil)
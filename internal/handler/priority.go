@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/util"
+)
+
+// SoundCronPriorityRequest is a request to change which soundcron plays when
+// several of a guild play at the same time.
+type SoundCronPriorityRequest struct {
+	Name  string
+	Level int
+}
+
+func CommandToPriorityRequest(
+	options []*discordgo.ApplicationCommandInteractionDataOption,
+) (*SoundCronPriorityRequest, error) {
+	var request SoundCronPriorityRequest
+	// Zero is a valid level, so whether it was given is tracked separately.
+	hasLevel := false
+	for _, option := range options {
+		switch option.Name {
+		case "name":
+			if option.Type != discordgo.ApplicationCommandOptionString {
+				return nil, fmt.Errorf("invalid type for name option")
+			}
+			request.Name = option.StringValue()
+		case "level":
+			if option.Type != discordgo.ApplicationCommandOptionInteger {
+				return nil, fmt.Errorf("invalid type for level option")
+			}
+			request.Level = int(option.IntValue())
+			hasLevel = true
+		}
+	}
+	if request.Name == "" {
+		return nil, fmt.Errorf("missing name option")
+	}
+	if !hasLevel {
+		return nil, fmt.Errorf("missing level option")
+	}
+	return &request, nil
+}
+
+// SoundCronPriorityUpdater finds soundcrons by name and changes their priority.
+type SoundCronPriorityUpdater interface {
+	repository.SoundCronLister
+	repository.SoundCronPrioritySetter
+}
+
+// PriorityHandler changes the priority of soundcrons.
+type PriorityHandler struct {
+	SoundCrons SoundCronPriorityUpdater
+}
+
+// ProcessPriority applies priorityRequest to the soundcron of the guild with the
+// requested name, and returns the message to show the user.
+func (h *PriorityHandler) ProcessPriority(
+	ctx context.Context,
+	guildID string,
+	priorityRequest *SoundCronPriorityRequest,
+) (string, error) {
+	if priorityRequest.Level < 0 || priorityRequest.Level > repository.MaxPriority {
+		return "", &UserError{
+			Message: fmt.Sprintf("The priority must be between 0 and %d", repository.MaxPriority),
+		}
+	}
+
+	soundCrons, err := h.SoundCrons.List(ctx, guildID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list soundcrons: %w", err)
+	}
+
+	soundCron, found := util.FindFirst(soundCrons, func(sc repository.SoundCron) bool {
+		return sc.Name == priorityRequest.Name
+	})
+	if !found {
+		return "", &UserError{
+			Message: fmt.Sprintf("No soundcron named `%s` exists", priorityRequest.Name),
+		}
+	}
+
+	if err := h.SoundCrons.SetPriority(ctx, soundCron.ID, priorityRequest.Level); err != nil {
+		return "", fmt.Errorf("failed to set priority: %w", err)
+	}
+	return fmt.Sprintf("`%s` will play at priority %d from its next run", soundCron.Name, priorityRequest.Level), nil
+}
+
+// NewPriorityFlow creates the flow for the "/soundcron priority" command.
+func NewPriorityFlow(h *PriorityHandler) *Flow {
+	return &Flow{
+		ID: "soundcron_priority",
+		Root: &Node{
+			ID: "soundcron_priority_slash_command",
+			Matcher: func(i *discordgo.InteractionCreate) bool {
+				if i.Type != discordgo.InteractionApplicationCommand {
+					return false
+				}
+				data := i.ApplicationCommandData()
+				return data.Name == "soundcron" &&
+					len(data.Options) > 0 && data.Options[0].Name == "priority"
+			},
+			Handler: func(s DiscordSession, i *discordgo.InteractionCreate, flowContext *FlowContext) error {
+				priorityRequest, err := CommandToPriorityRequest(i.ApplicationCommandData().Options[0].Options)
+				if err != nil {
+					return fmt.Errorf("failed to parse priority request: %w", err)
+				}
+
+				content, err := h.ProcessPriority(context.Background(), i.GuildID, priorityRequest)
+				if err != nil {
+					var ue *UserError
+					if !errors.As(err, &ue) {
+						return fmt.Errorf("failed to process priority request: %w", err)
+					}
+					content = ue.Message
+				}
+
+				err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Content: content,
+						Flags:   discordgo.MessageFlagsEphemeral,
+					},
+				})
+				if err != nil {
+					return fmt.Errorf("failed to respond to interaction: %w", err)
+				}
+				return nil
+			},
+		},
+	}
+}
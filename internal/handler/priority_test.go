@@ -0,0 +1,82 @@
+package handler_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/handler"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+func TestCommandToPriorityRequest(t *testing.T) {
+	result, err := handler.CommandToPriorityRequest([]*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "name", Type: discordgo.ApplicationCommandOptionString, Value: "Bell"},
+		{Name: "level", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(0)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *result != (handler.SoundCronPriorityRequest{Name: "Bell", Level: 0}) {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	_, err = handler.CommandToPriorityRequest([]*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "name", Type: discordgo.ApplicationCommandOptionString, Value: "Bell"},
+	})
+	if err == nil {
+		t.Errorf("expected error for a request without a level")
+	}
+}
+
+func TestProcessPriority(t *testing.T) {
+	tc := []struct {
+		name         string
+		request      handler.SoundCronPriorityRequest
+		wantErr      bool
+		wantPriority int
+	}{
+		{
+			name:         "Priority of an existing soundcron is changed",
+			request:      handler.SoundCronPriorityRequest{Name: "Bell", Level: 7},
+			wantPriority: 7,
+		},
+		{
+			name:    "Unknown soundcron is rejected",
+			request: handler.SoundCronPriorityRequest{Name: "Horn", Level: 7},
+			wantErr: true,
+		},
+		{
+			name:    "Priority above the maximum is rejected",
+			request: handler.SoundCronPriorityRequest{Name: "Bell", Level: repository.MaxPriority + 1},
+			wantErr: true,
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &fakeSoundCronRepository{soundCrons: []repository.SoundCron{
+				{ID: "sc-1", Name: "Bell", GuildID: "guild"},
+			}}
+			h := &handler.PriorityHandler{SoundCrons: repo}
+
+			_, err := h.ProcessPriority(t.Context(), "guild", &testCase.request)
+			if testCase.wantErr {
+				var ue *handler.UserError
+				if !errors.As(err, &ue) {
+					t.Fatalf("expected UserError, got %v", err)
+				}
+				if len(repo.priorities) != 0 {
+					t.Errorf("expected no priority to be set, got %v", repo.priorities)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if repo.priorities["sc-1"] != testCase.wantPriority {
+				t.Errorf("expected priority %d, got %d", testCase.wantPriority, repo.priorities["sc-1"])
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/presenters"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+// MaxQuotaStorageMB and MaxQuotaDurationSeconds are the highest limits that
+// operators may set, which keeps them far from overflowing once they are
+// converted to bytes and durations.
+const (
+	MaxQuotaStorageMB       = 1024 * 1024
+	MaxQuotaDurationSeconds = 60 * 60
+)
+
+// SoundCronQuotaRequest is a request to view, and optionally change,
+// the storage quota and maximum duration of a guild.
+type SoundCronQuotaRequest struct {
+	// StorageMB is the new storage quota in megabytes.
+	// It is zero when the quota is not being changed.
+	StorageMB int64
+
+	// MaxDurationSeconds is the new maximum duration in seconds.
+	// It is zero when the maximum duration is not being changed.
+	MaxDurationSeconds int64
+}
+
+func CommandToQuotaRequest(
+	options []*discordgo.ApplicationCommandInteractionDataOption,
+) (*SoundCronQuotaRequest, error) {
+	var request SoundCronQuotaRequest
+	for _, option := range options {
+		var target *int64
+		switch option.Name {
+		case "storage_mb":
+			target = &request.StorageMB
+		case "max_duration_seconds":
+			target = &request.MaxDurationSeconds
+		default:
+			continue
+		}
+		if option.Type != discordgo.ApplicationCommandOptionInteger {
+			return nil, fmt.Errorf("invalid type for %s option", option.Name)
+		}
+		*target = option.IntValue()
+		if *target < 1 {
+			return nil, fmt.Errorf("%s must be positive, got %d", option.Name, *target)
+		}
+	}
+	return &request, nil
+}
+
+// QuotaHandler shows guild administrators how much of their storage quota is in use,
+// and lets bot operators change the limits of a guild.
+type QuotaHandler struct {
+	SoundCrons    repository.SoundCronLister
+	GuildSettings repository.GuildSettingsRepository
+
+	// OperatorIDs are the IDs of the users that may change quotas.
+	OperatorIDs []string
+}
+
+// ProcessQuota applies quotaRequest on behalf of member and returns
+// the response to show them. Requests that member is not allowed to make
+// are rejected with a UserError.
+func (h *QuotaHandler) ProcessQuota(
+	ctx context.Context,
+	guildID string,
+	member *discordgo.Member,
+	quotaRequest *SoundCronQuotaRequest,
+) (*discordgo.InteractionResponse, error) {
+	if guildID == "" || member == nil || member.User == nil {
+		return nil, &UserError{
+			Message: "Storage quotas can only be managed from within a server",
+		}
+	}
+
+	isOperator := slices.Contains(h.OperatorIDs, member.User.ID)
+	isAdmin := member.Permissions&discordgo.PermissionAdministrator != 0
+	if !isAdmin && !isOperator {
+		return nil, &UserError{
+			Message: "Only server administrators can view the storage quota",
+		}
+	}
+
+	settings, err := h.GuildSettings.GetGuildSettings(ctx, guildID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild settings: %w", err)
+	}
+
+	updated := quotaRequest.StorageMB > 0 || quotaRequest.MaxDurationSeconds > 0
+	if updated {
+		if !isOperator {
+			return nil, &UserError{
+				Message: "Only bot operators can change the limits of a server",
+			}
+		}
+		if quotaRequest.StorageMB > MaxQuotaStorageMB {
+			return nil, &UserError{
+				Message: fmt.Sprintf("The storage quota can be at most %d MB", MaxQuotaStorageMB),
+			}
+		}
+		if quotaRequest.MaxDurationSeconds > MaxQuotaDurationSeconds {
+			return nil, &UserError{
+				Message: fmt.Sprintf("The maximum duration can be at most %d seconds", MaxQuotaDurationSeconds),
+			}
+		}
+		if quotaRequest.StorageMB > 0 {
+			settings.StorageQuota = quotaRequest.StorageMB * 1024 * 1024
+		}
+		if quotaRequest.MaxDurationSeconds > 0 {
+			settings.MaxDuration = time.Duration(quotaRequest.MaxDurationSeconds) * time.Second
+		}
+		if err := h.GuildSettings.SaveGuildSettings(ctx, settings); err != nil {
+			return nil, fmt.Errorf("failed to save guild settings: %w", err)
+		}
+	}
+
+	soundCrons, err := h.SoundCrons.List(ctx, guildID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list soundcrons: %w", err)
+	}
+
+	response := presenters.QuotaResponse(soundCrons, settings)
+	if updated {
+		response.Data.Content = "Limits updated. " + response.Data.Content
+	}
+	return response, nil
+}
+
+// NewQuotaFlow creates the flow for the "/soundcron quota" command.
+func NewQuotaFlow(h *QuotaHandler) *Flow {
+	return &Flow{
+		ID: "soundcron_quota",
+		Root: &Node{
+			ID: "soundcron_quota_slash_command",
+			Matcher: func(i *discordgo.InteractionCreate) bool {
+				if i.Type != discordgo.InteractionApplicationCommand {
+					return false
+				}
+				data := i.ApplicationCommandData()
+				return data.Name == "soundcron" &&
+					len(data.Options) > 0 && data.Options[0].Name == "quota"
+			},
+			Handler: func(s DiscordSession, i *discordgo.InteractionCreate, flowContext *FlowContext) error {
+				quotaRequest, err := CommandToQuotaRequest(i.ApplicationCommandData().Options[0].Options)
+				if err != nil {
+					return fmt.Errorf("failed to parse quota request: %w", err)
+				}
+
+				response, err := h.ProcessQuota(context.Background(), i.GuildID, i.Member, quotaRequest)
+				if err != nil {
+					var ue *UserError
+					if !errors.As(err, &ue) {
+						return fmt.Errorf("failed to process quota request: %w", err)
+					}
+					response = &discordgo.InteractionResponse{
+						Type: discordgo.InteractionResponseChannelMessageWithSource,
+						Data: &discordgo.InteractionResponseData{
+							Content: ue.Message,
+							Flags:   discordgo.MessageFlagsEphemeral,
+						},
+					}
+				}
+
+				err = s.InteractionRespond(i.Interaction, response)
+				if err != nil {
+					return fmt.Errorf("failed to respond to interaction: %w", err)
+				}
+				return nil
+			},
+		},
+	}
+}
@@ -0,0 +1,143 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/handler"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+type fakeGuildSettingsRepository struct {
+	settings map[string]repository.GuildSettings
+}
+
+func (f *fakeGuildSettingsRepository) GetGuildSettings(ctx context.Context, guildID string) (repository.GuildSettings, error) {
+	if settings, ok := f.settings[guildID]; ok {
+		return settings, nil
+	}
+	return repository.DefaultGuildSettings(guildID), nil
+}
+
+func (f *fakeGuildSettingsRepository) SaveGuildSettings(ctx context.Context, settings repository.GuildSettings) error {
+	if f.settings == nil {
+		f.settings = make(map[string]repository.GuildSettings)
+	}
+	f.settings[settings.GuildID] = settings
+	return nil
+}
+
+var _ repository.GuildSettingsRepository = (*fakeGuildSettingsRepository)(nil)
+
+func TestProcessQuota(t *testing.T) {
+	const mb = 1024 * 1024
+
+	admin := &discordgo.Member{User: &discordgo.User{ID: "admin"}, Permissions: discordgo.PermissionAdministrator}
+	member := &discordgo.Member{User: &discordgo.User{ID: "member"}}
+	operator := &discordgo.Member{User: &discordgo.User{ID: "operator"}}
+
+	tc := []struct {
+		name      string
+		member    *discordgo.Member
+		request   handler.SoundCronQuotaRequest
+		wantErr   bool
+		wantQuota int64
+	}{
+		{
+			name:      "Administrators can view the quota",
+			member:    admin,
+			wantQuota: repository.DefaultStorageQuota,
+		},
+		{
+			name:    "Members can not view the quota",
+			member:  member,
+			wantErr: true,
+		},
+		{
+			name:    "Administrators can not change the quota",
+			member:  admin,
+			request: handler.SoundCronQuotaRequest{StorageMB: 50},
+			wantErr: true,
+		},
+		{
+			name:      "Operators can change the quota",
+			member:    operator,
+			request:   handler.SoundCronQuotaRequest{StorageMB: 50},
+			wantQuota: 50 * mb,
+		},
+		{
+			name:    "Quotas that would overflow are rejected",
+			member:  operator,
+			request: handler.SoundCronQuotaRequest{StorageMB: 1 << 50},
+			wantErr: true,
+		},
+		{
+			name:    "Maximum durations that would overflow are rejected",
+			member:  operator,
+			request: handler.SoundCronQuotaRequest{MaxDurationSeconds: 1 << 40},
+			wantErr: true,
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			settings := &fakeGuildSettingsRepository{}
+			h := &handler.QuotaHandler{
+				SoundCrons: &fakeSoundCronRepository{soundCrons: []repository.SoundCron{
+					{ID: "sc-1", Name: "Bell", GuildID: "guild", FileSize: 2 * mb},
+				}},
+				GuildSettings: settings,
+				OperatorIDs:   []string{"operator"},
+			}
+
+			response, err := h.ProcessQuota(t.Context(), "guild", testCase.member, &testCase.request)
+			if testCase.wantErr {
+				var ue *handler.UserError
+				if !errors.As(err, &ue) {
+					t.Fatalf("expected UserError, got %v", err)
+				}
+				if len(settings.settings) != 0 {
+					t.Errorf("expected quota to be unchanged, got %+v", settings.settings)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(response.Data.Content, "2.00 MB") {
+				t.Errorf("expected usage in response, got %q", response.Data.Content)
+			}
+			got, _ := settings.GetGuildSettings(t.Context(), "guild")
+			if got.StorageQuota != testCase.wantQuota {
+				t.Errorf("expected quota %d, got %d", testCase.wantQuota, got.StorageQuota)
+			}
+		})
+	}
+}
+
+func TestProcessReplaceSoundCronUsesGuildQuota(t *testing.T) {
+	queue := &fakeJobSender{}
+	h := &handler.AddFileHandler{
+		Repo: &fakeSoundCronRepository{soundCrons: []repository.SoundCron{
+			{ID: "sc-1", Name: "Bell", GuildID: "guild", FileSize: 1024},
+		}},
+		BlobStorage: newFakeBlobStorage(),
+		HTTPClient:  &fakeHTTPClient{status: 200, body: "ding"},
+		GuildSettings: &fakeGuildSettingsRepository{settings: map[string]repository.GuildSettings{
+			"guild": {GuildID: "guild", StorageQuota: 20 * 1024 * 1024},
+		}},
+		TranscodeQueue: queue,
+	}
+
+	// The replacement is over the default quota, but within the guild's own quota.
+	h.ProcessReplaceSoundCron("guild", &handler.SoundCronReplaceRequest{
+		Name:       "Bell",
+		Attachment: &discordgo.MessageAttachment{URL: "https://cdn.discordapp.com/bell.mp3", Size: 15 * 1024 * 1024},
+	}, nil)
+	if len(queue.jobs) != 1 {
+		t.Errorf("expected the replacement to be accepted, got %d queued jobs", len(queue.jobs))
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/transcoder"
+	"github.com/glizzus/sound-off/internal/util"
+)
+
+// SoundCronReplaceRequest is a request to swap the audio of an existing soundcron.
+type SoundCronReplaceRequest struct {
+	Attachment *discordgo.MessageAttachment
+	Name       string
+}
+
+func CommandToReplaceRequest(
+	attachments map[string]*discordgo.MessageAttachment,
+	options []*discordgo.ApplicationCommandInteractionDataOption,
+) (*SoundCronReplaceRequest, error) {
+	attachment, err := util.GetOne(attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	var name string
+	for _, option := range options {
+		if option.Name == "name" {
+			if option.Type != discordgo.ApplicationCommandOptionString {
+				return nil, fmt.Errorf("invalid type for name option")
+			}
+			name = option.StringValue()
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("missing name option")
+	}
+
+	return &SoundCronReplaceRequest{
+		Attachment: attachment,
+		Name:       name,
+	}, nil
+}
+
+// ProcessReplaceSoundCron replaces the audio of the soundcron with the given name.
+// The soundcron keeps its ID, so its schedule, timezone and last accessed time are untouched.
+// The audio, its size and its metadata are only replaced once the new audio is encoded.
+// The result of encoding the new audio is reported to interaction, which may be nil.
+func (h *AddFileHandler) ProcessReplaceSoundCron(
+	guildID string,
+	replaceRequest *SoundCronReplaceRequest,
+	interaction *discordgo.Interaction,
+) error {
+	ctx := context.Background()
+
+	soundCrons, err := h.Repo.List(ctx, guildID)
+	if err != nil {
+		return fmt.Errorf("failed to list soundcrons: %w", err)
+	}
+
+	soundCron, found := util.FindFirst(soundCrons, func(sc repository.SoundCron) bool {
+		return sc.Name == replaceRequest.Name
+	})
+	if !found {
+		return &UserError{
+			Message: fmt.Sprintf("No soundcron named `%s` exists", replaceRequest.Name),
+		}
+	}
+
+	quota, err := h.storageQuota(ctx, guildID)
+	if err != nil {
+		return err
+	}
+	// The new audio takes the place of both the original and the encoded audio.
+	newSize := int64(replaceRequest.Attachment.Size)
+	err = CheckStorageAvailable(soundCrons, newSize-soundCron.StorageSize(), quota)
+	if err != nil {
+		return &UserError{
+			Message: "Storage limit exceeded",
+		}
+	}
+
+	// The new audio is staged, and only replaces the original upload once it
+	// has been encoded. A failed replacement leaves the previous audio, its size
+	// and the status in place.
+	stagedKey := datalayer.StagedAudioKey(soundCron.ID)
+	storedSize, err := h.storeAudio(ctx, stagedKey, replaceRequest.Attachment.URL)
+	if err != nil {
+		slog.Error("failed to replace soundcron audio", "error", err, "soundcron_id", soundCron.ID)
+		return &UserError{
+			Message: transcoder.ReplaceFailureMessage,
+		}
+	}
+
+	// The clip of the soundcron is kept, and applies to the new audio.
+	soundCron.Audio = repository.AudioMetadata{}
+	if h.Probe != nil {
+		if err := h.probeAudio(ctx, stagedKey, &soundCron); err != nil {
+			h.discardStaged(ctx, soundCron.ID)
+			var ue *UserError
+			if errors.As(err, &ue) {
+				return ue
+			}
+			slog.Error("failed to check replacement audio", "error", err, "soundcron_id", soundCron.ID)
+			return &UserError{
+				Message: transcoder.ReplaceFailureMessage,
+			}
+		}
+	}
+
+	// Replacing the audio is also how a soundcron that failed to process is fixed,
+	// since a successful transcode marks it as ready.
+	job, err := h.newTranscodeJob(ctx, soundCron, fmt.Sprintf("Audio for `%s` replaced successfully!", soundCron.Name))
+	if err != nil {
+		h.discardStaged(ctx, soundCron.ID)
+		return err
+	}
+	job.Replace = true
+	job.Staged = true
+	job.FileSize = storedSize
+	return h.transcode(ctx, interaction, job)
+}
+
+// discardStaged deletes replacement audio that will not be encoded.
+func (h *AddFileHandler) discardStaged(ctx context.Context, soundCronID string) {
+	key := datalayer.StagedAudioKey(soundCronID)
+	if err := h.BlobStorage.Delete(ctx, key); err != nil {
+		slog.Error("failed to delete staged audio", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,329 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/generator"
+	"github.com/glizzus/sound-off/internal/handler"
+	"github.com/glizzus/sound-off/internal/opus"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/transcoder"
+)
+
+func TestCommandToReplaceRequest(t *testing.T) {
+	nameOption := []*discordgo.ApplicationCommandInteractionDataOption{
+		{
+			Name:  "name",
+			Type:  discordgo.ApplicationCommandOptionString,
+			Value: "Bell",
+		},
+	}
+
+	tc := []struct {
+		name        string
+		attachments map[string]*discordgo.MessageAttachment
+		options     []*discordgo.ApplicationCommandInteractionDataOption
+		err         bool
+	}{
+		{
+			name:        "Command with no attachments should return error",
+			attachments: map[string]*discordgo.MessageAttachment{},
+			options:     nameOption,
+			err:         true,
+		},
+		{
+			name: "Command without a name should return error",
+			attachments: map[string]*discordgo.MessageAttachment{
+				"attachment1": {ID: "attachment1"},
+			},
+			options: []*discordgo.ApplicationCommandInteractionDataOption{},
+			err:     true,
+		},
+		{
+			name: "Command with an attachment and a name should succeed",
+			attachments: map[string]*discordgo.MessageAttachment{
+				"attachment1": {ID: "attachment1"},
+			},
+			options: nameOption,
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			result, err := handler.CommandToReplaceRequest(testCase.attachments, testCase.options)
+			if testCase.err {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Name != "Bell" || result.Attachment.ID != "attachment1" {
+				t.Errorf("unexpected result: %+v", result)
+			}
+		})
+	}
+}
+
+func TestProcessReplaceSoundCronRejects(t *testing.T) {
+	existing := []repository.SoundCron{
+		{ID: "sc-1", Name: "Bell", GuildID: "guild", FileSize: 4 * 1024 * 1024},
+		{ID: "sc-2", Name: "Horn", GuildID: "guild", FileSize: 5 * 1024 * 1024},
+	}
+
+	tc := []struct {
+		name    string
+		request *handler.SoundCronReplaceRequest
+	}{
+		{
+			name: "Unknown soundcron",
+			request: &handler.SoundCronReplaceRequest{
+				Name:       "Whistle",
+				Attachment: &discordgo.MessageAttachment{Size: 1024},
+			},
+		},
+		{
+			name: "Replacement that exceeds the storage limit",
+			request: &handler.SoundCronReplaceRequest{
+				Name:       "Bell",
+				Attachment: &discordgo.MessageAttachment{Size: 6 * 1024 * 1024},
+			},
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			h := &handler.AddFileHandler{
+				Repo: &fakeSoundCronRepository{soundCrons: existing},
+			}
+			err := h.ProcessReplaceSoundCron("guild", testCase.request, nil)
+			var ue *handler.UserError
+			if !errors.As(err, &ue) {
+				t.Errorf("expected UserError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessAddSoundCronMarksFailedAudio(t *testing.T) {
+	repo := &fakeSoundCronRepository{}
+	h := &handler.AddFileHandler{
+		Repo:          repo,
+		BlobStorage:   newFakeBlobStorage(),
+		HTTPClient:    &fakeHTTPClient{status: http.StatusNotFound},
+		UUIDGenerator: &generator.UUIDV4Generator{},
+	}
+
+	err := h.ProcessAddSoundCron("guild", &handler.SoundCronAddFileRequest{
+		Attachment: &discordgo.MessageAttachment{URL: "https://cdn.discordapp.com/bell.mp3", Size: 1024},
+		Cron:       "0 * * * *",
+		Name:       "Bell",
+	}, nil)
+
+	var ue *handler.UserError
+	if !errors.As(err, &ue) || ue.Message != handler.ProcessingFailedMessage {
+		t.Fatalf("expected processing failure to be reported to the user, got %v", err)
+	}
+	if len(repo.saved) != 1 || repo.saved[0].Status != repository.SoundCronStatusPending {
+		t.Fatalf("expected soundcron to be saved as pending, got %+v", repo.saved)
+	}
+	if status := repo.statuses[repo.saved[0].ID]; status != repository.SoundCronStatusFailed {
+		t.Errorf("expected soundcron to be marked as failed, got %q", status)
+	}
+}
+
+type fakeJobSender struct {
+	jobs []transcoder.Job
+}
+
+func (f *fakeJobSender) SendJob(ctx context.Context, job transcoder.Job) error {
+	f.jobs = append(f.jobs, job)
+	return nil
+}
+
+func TestProcessReplaceSoundCronQueuesTranscode(t *testing.T) {
+	queue := &fakeJobSender{}
+	blobs := newFakeBlobStorage()
+	blobs.objects[datalayer.UploadedAudioKey("sc-1")] = []byte("dong")
+	// The guild is at its limit, but the new audio replaces both the original
+	// and the encoded audio of the soundcron, so it fits.
+	repo := &fakeSoundCronRepository{soundCrons: []repository.SoundCron{
+		{ID: "sc-1", Name: "Bell", GuildID: "guild", Status: repository.SoundCronStatusReady, FileSize: 4, EncodedSize: 1024},
+		{ID: "sc-2", Name: "Horn", GuildID: "guild", Status: repository.SoundCronStatusReady, FileSize: repository.DefaultStorageQuota - 1028},
+	}}
+	h := &handler.AddFileHandler{
+		Repo:           repo,
+		BlobStorage:    blobs,
+		HTTPClient:     &fakeHTTPClient{status: http.StatusOK, contentType: "audio/mpeg", body: "ding!"},
+		TranscodeQueue: queue,
+	}
+
+	err := h.ProcessReplaceSoundCron("guild", &handler.SoundCronReplaceRequest{
+		Name:       "Bell",
+		Attachment: &discordgo.MessageAttachment{URL: "https://cdn.discordapp.com/bell.mp3", Size: 5},
+	}, &discordgo.Interaction{AppID: "app", Token: "token"})
+	if err == nil {
+		t.Fatalf("expected the queued job to be reported instead of a final result")
+	}
+
+	// The duration of the audio is not known without a prober,
+	// so it is cut at the longest the guild allows.
+	want := transcoder.Job{
+		SoundCronID:      "sc-1",
+		GuildID:          "guild",
+		Replace:          true,
+		Staged:           true,
+		FileSize:         5,
+		Length:           repository.DefaultMaxDuration,
+		ApplicationID:    "app",
+		InteractionToken: "token",
+		SuccessMessage:   "Audio for `Bell` replaced successfully!",
+	}
+	if len(queue.jobs) != 1 || queue.jobs[0] != want {
+		t.Errorf("expected job %+v to be queued, got %+v", want, queue.jobs)
+	}
+
+	// The original audio is kept until the transcoder has encoded the new audio.
+	if got := string(blobs.objects[datalayer.UploadedAudioKey("sc-1")]); got != "dong" {
+		t.Errorf("expected the original upload to be kept, got %q", got)
+	}
+	if got := string(blobs.objects[datalayer.StagedAudioKey("sc-1")]); got != "ding!" {
+		t.Errorf("expected the new audio to be staged, got %q", got)
+	}
+	if len(repo.fileSizes) != 0 {
+		t.Errorf("expected the file size to be kept until the audio is encoded, got %v", repo.fileSizes)
+	}
+}
+
+func TestProcessReplaceSoundCronKeepsAudioThatFailsProbing(t *testing.T) {
+	blobs := newFakeBlobStorage()
+	blobs.objects[datalayer.UploadedAudioKey("sc-1")] = []byte("dong")
+	queue := &fakeJobSender{}
+	h := &handler.AddFileHandler{
+		Repo: &fakeSoundCronRepository{soundCrons: []repository.SoundCron{
+			{ID: "sc-1", Name: "Bell", GuildID: "guild", Status: repository.SoundCronStatusReady},
+		}},
+		BlobStorage: blobs,
+		HTTPClient:  &fakeHTTPClient{status: http.StatusOK, contentType: "audio/mpeg", body: "ding"},
+		Probe: func(r io.Reader) (opus.Metadata, error) {
+			return opus.Metadata{}, &opus.FFmpegError{Program: "ffprobe", ExitCode: 1, Err: opus.ErrNoAudioStream}
+		},
+		TranscodeQueue: queue,
+	}
+
+	err := h.ProcessReplaceSoundCron("guild", &handler.SoundCronReplaceRequest{
+		Name:       "Bell",
+		Attachment: &discordgo.MessageAttachment{URL: "https://cdn.discordapp.com/bell.mp3", Size: 4},
+	}, nil)
+
+	var ue *handler.UserError
+	if !errors.As(err, &ue) || ue.Message != "The file does not contain any audio." {
+		t.Fatalf("expected the missing audio to be reported to the user, got %v", err)
+	}
+	if len(queue.jobs) != 0 {
+		t.Errorf("expected no job to be queued, got %+v", queue.jobs)
+	}
+	if got := string(blobs.objects[datalayer.UploadedAudioKey("sc-1")]); got != "dong" {
+		t.Errorf("expected the original upload to be kept, got %q", got)
+	}
+	if _, ok := blobs.objects[datalayer.StagedAudioKey("sc-1")]; ok {
+		t.Errorf("expected the rejected audio to be discarded")
+	}
+}
+
+func TestProcessAddSoundCronRejectsLongAudio(t *testing.T) {
+	repo := &fakeSoundCronRepository{}
+	h := &handler.AddFileHandler{
+		Repo:          repo,
+		BlobStorage:   newFakeBlobStorage(),
+		HTTPClient:    &fakeHTTPClient{status: http.StatusOK, contentType: "audio/mpeg", body: "ding"},
+		UUIDGenerator: &generator.UUIDV4Generator{},
+		Probe: func(r io.Reader) (opus.Metadata, error) {
+			return opus.Metadata{Duration: 2 * time.Hour, Channels: 2, Codec: "mp3"}, nil
+		},
+		TranscodeQueue: &fakeJobSender{},
+	}
+
+	err := h.ProcessAddSoundCron("guild", &handler.SoundCronAddFileRequest{
+		Attachment: &discordgo.MessageAttachment{URL: "https://cdn.discordapp.com/bell.mp3", Size: 4},
+		Cron:       "0 * * * *",
+		Name:       "Bell",
+	}, nil)
+
+	var ue *handler.UserError
+	if !errors.As(err, &ue) || !strings.Contains(ue.Message, "2h0m0s") {
+		t.Fatalf("expected the duration to be reported to the user, got %v", err)
+	}
+	if status := repo.statuses[repo.saved[0].ID]; status != repository.SoundCronStatusFailed {
+		t.Errorf("expected soundcron to be marked as failed, got %q", status)
+	}
+}
+
+func TestProcessAddSoundCronAcceptsClipOfLongAudio(t *testing.T) {
+	queue := &fakeJobSender{}
+	h := &handler.AddFileHandler{
+		Repo:          &fakeSoundCronRepository{},
+		BlobStorage:   newFakeBlobStorage(),
+		HTTPClient:    &fakeHTTPClient{status: http.StatusOK, contentType: "audio/mpeg", body: "ding"},
+		UUIDGenerator: &generator.UUIDV4Generator{},
+		Probe: func(r io.Reader) (opus.Metadata, error) {
+			return opus.Metadata{Duration: 4 * time.Minute, Channels: 2, Codec: "mp3"}, nil
+		},
+		TranscodeQueue: queue,
+	}
+
+	err := h.ProcessAddSoundCron("guild", &handler.SoundCronAddFileRequest{
+		Attachment: &discordgo.MessageAttachment{URL: "https://cdn.discordapp.com/song.mp3", Size: 4},
+		Cron:       "0 * * * *",
+		Name:       "1st of the Month",
+		Start:      "1:23.5",
+		End:        "1:28.5",
+	}, nil)
+
+	var ue *handler.UserError
+	if errors.As(err, &ue) {
+		t.Fatalf("expected a short clip of long audio to be accepted, got %q", ue.Message)
+	}
+	want := repository.Clip{Start: 83500 * time.Millisecond, End: 88500 * time.Millisecond}
+	if len(queue.jobs) != 1 || queue.jobs[0].Clip != want {
+		t.Errorf("expected a job for clip %+v to be queued, got %+v", want, queue.jobs)
+	}
+}
+
+func TestProcessAddSoundCronDescribesBadAudio(t *testing.T) {
+	repo := &fakeSoundCronRepository{}
+	h := &handler.AddFileHandler{
+		Repo:          repo,
+		BlobStorage:   newFakeBlobStorage(),
+		HTTPClient:    &fakeHTTPClient{status: http.StatusOK, contentType: "audio/mpeg", body: "ding"},
+		UUIDGenerator: &generator.UUIDV4Generator{},
+		Probe: func(r io.Reader) (opus.Metadata, error) {
+			return opus.Metadata{}, &opus.FFmpegError{Program: "ffprobe", ExitCode: 1, Err: opus.ErrNoAudioStream}
+		},
+		TranscodeQueue: &fakeJobSender{},
+	}
+
+	err := h.ProcessAddSoundCron("guild", &handler.SoundCronAddFileRequest{
+		Attachment: &discordgo.MessageAttachment{URL: "https://cdn.discordapp.com/bell.mp3", Size: 4},
+		Cron:       "0 * * * *",
+		Name:       "Bell",
+	}, nil)
+
+	var ue *handler.UserError
+	if !errors.As(err, &ue) || ue.Message != "The file does not contain any audio." {
+		t.Fatalf("expected the missing audio to be reported to the user, got %v", err)
+	}
+	if status := repo.statuses[repo.saved[0].ID]; status != repository.SoundCronStatusFailed {
+		t.Errorf("expected soundcron to be marked as failed, got %q", status)
+	}
+}
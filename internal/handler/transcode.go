@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/transcoder"
+)
+
+// TranscodeQueuedMessage is shown while a queued transcode job is running.
+// The response is edited again once the transcoder reports a result.
+const TranscodeQueuedMessage = "Processing your audio, this message will be updated once it is done..."
+
+// errTranscodeQueued is returned by processing functions once encoding has been
+// handed to a transcoder. The final response is sent by ListenTranscodeResults.
+var errTranscodeQueued = errors.New("transcode job queued")
+
+// transcode encodes the uploaded audio of a soundcron. If a TranscodeQueue is
+// configured the job is queued and errTranscodeQueued is returned, otherwise
+// the audio is encoded inline.
+func (h *AddFileHandler) transcode(
+	ctx context.Context,
+	interaction *discordgo.Interaction,
+	job transcoder.Job,
+) error {
+	if interaction != nil {
+		job.ApplicationID = interaction.AppID
+		job.InteractionToken = interaction.Token
+	}
+
+	if h.TranscodeQueue != nil {
+		if err := h.TranscodeQueue.SendJob(ctx, job); err != nil {
+			return fmt.Errorf("failed to queue transcode job: %w", err)
+		}
+		return errTranscodeQueued
+	}
+
+	result := h.Transcoder.Process(ctx, job)
+	if result.Failed {
+		return &UserError{
+			Message: result.Message,
+		}
+	}
+	return nil
+}
+
+// newTranscodeJob builds the job that encodes the audio of a soundcron as the
+// soundcron describes it. The audio is never encoded longer than the guild allows.
+func (h *AddFileHandler) newTranscodeJob(
+	ctx context.Context,
+	soundCron repository.SoundCron,
+	successMessage string,
+) (transcoder.Job, error) {
+	settings, err := guildSettingsFor(ctx, h.GuildSettings, soundCron.GuildID)
+	if err != nil {
+		return transcoder.Job{}, err
+	}
+	return transcoder.Job{
+		SoundCronID:    soundCron.ID,
+		GuildID:        soundCron.GuildID,
+		Normalize:      soundCron.Normalize,
+		Clip:           soundCron.Clip,
+		Length:         playedLength(soundCron, settings.MaxDuration),
+		Audio:          soundCron.Audio,
+		FadeIn:         soundCron.FadeIn,
+		FadeOut:        soundCron.FadeOut,
+		SuccessMessage: successMessage,
+	}, nil
+}
+
+// ListenTranscodeResults edits the deferred interaction responses of
+// queued transcode jobs as their results come in. It returns once
+// results can no longer be received.
+func ListenTranscodeResults(
+	ctx context.Context,
+	s DiscordSession,
+	results transcoder.ResultReceiver,
+) error {
+	for {
+		received, err := results.ReceiveResults(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to receive transcode results: %w", err)
+		}
+
+		for _, result := range received {
+			if result.InteractionToken == "" {
+				continue
+			}
+			interaction := &discordgo.Interaction{
+				AppID: result.ApplicationID,
+				Token: result.InteractionToken,
+			}
+			content := result.Message
+			_, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+				Content: &content,
+			})
+			if err != nil {
+				slog.Error(
+					"Failed to edit response with transcode result",
+					"error", err,
+					"soundcron_id", result.SoundCronID,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/datalayer"
+)
+
+// MaxURLDownloadSize is the largest file that will be downloaded
+// when adding a soundcron from a URL.
+const MaxURLDownloadSize = 10 * 1024 * 1024 // 10 MB
+
+// DefaultAllowedContentTypes are the media types that may be downloaded
+// when adding a soundcron from a URL. Anything else is rejected before
+// the body is read.
+var DefaultAllowedContentTypes = []string{
+	"audio/aac",
+	"audio/flac",
+	"audio/mp4",
+	"audio/mpeg",
+	"audio/ogg",
+	"audio/opus",
+	"audio/wav",
+	"audio/wave",
+	"audio/webm",
+	"audio/x-flac",
+	"audio/x-m4a",
+	"audio/x-wav",
+	"application/ogg",
+	"video/mp4",
+	"video/webm",
+}
+
+// BlobTransferService is a struct that provides
+// high-level operations for moving or getting data
+// from blob storage.
+type BlobTransferService struct {
+	blobStorage         datalayer.BlobStorage
+	httpClient          HTTPClient
+	maxSize             int64
+	allowedContentTypes []string
+}
+
+// NewBlobTransferService constructs a BlobTransferService that refuses
+// downloads larger than maxSize or with a content type outside of allowedContentTypes.
+func NewBlobTransferService(
+	blobStorage datalayer.BlobStorage,
+	httpClient HTTPClient,
+	maxSize int64,
+	allowedContentTypes []string,
+) *BlobTransferService {
+	return &BlobTransferService{
+		blobStorage:         blobStorage,
+		httpClient:          httpClient,
+		maxSize:             maxSize,
+		allowedContentTypes: allowedContentTypes,
+	}
+}
+
+// Pipe downloads the file at sourceURL and streams it into blob storage under key.
+// It returns the number of bytes that were stored.
+func (a *BlobTransferService) Pipe(ctx context.Context, key, sourceURL string) (int64, error) {
+	parsed, err := url.Parse(sourceURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return 0, &InvalidURLError{URL: sourceURL}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	slog.Info("Downloading file", "url", sourceURL)
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	slog.Info("Received download response", "url", sourceURL, "status", resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return 0, &DownloadFailedError{Status: resp.Status}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !slices.Contains(a.allowedContentTypes, mediaType) {
+		return 0, &UnsupportedContentTypeError{ContentType: contentType}
+	}
+
+	if resp.ContentLength > a.maxSize {
+		return 0, &DownloadTooLargeError{Max: a.maxSize}
+	}
+
+	body := &limitedReader{r: resp.Body, remaining: a.maxSize}
+	err = a.blobStorage.Put(ctx, key, body, datalayer.PutOptions{
+		Size:        resp.ContentLength,
+		ContentType: mediaType,
+	})
+	if err != nil {
+		if body.exceeded {
+			return 0, &DownloadTooLargeError{Max: a.maxSize}
+		}
+		return 0, fmt.Errorf("failed to upload file: %w", err)
+	}
+	return body.read, nil
+}
+
+// limitedReader is like io.LimitedReader, except that it fails
+// instead of silently truncating once the limit is exceeded.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	read      int64
+	exceeded  bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		l.exceeded = true
+		return n, fmt.Errorf("download exceeds the maximum size")
+	}
+	return n, err
+}
+
+// NewPublicHTTPClient returns an http.Client that refuses to connect to loopback,
+// private and link-local addresses. It is used for downloads from user-supplied URLs
+// so that they cannot reach services on the internal network.
+func NewPublicHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("refusing to connect to non-public address %s", host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Minute,
+	}
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
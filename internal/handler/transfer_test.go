@@ -0,0 +1,172 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/handler"
+)
+
+type fakeBlobStorage struct {
+	objects map[string][]byte
+}
+
+func newFakeBlobStorage() *fakeBlobStorage {
+	return &fakeBlobStorage{objects: make(map[string][]byte)}
+}
+
+func (f *fakeBlobStorage) Put(ctx context.Context, key string, data io.Reader, opts datalayer.PutOptions) error {
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	f.objects[key] = b
+	return nil
+}
+
+func (f *fakeBlobStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	b, ok := f.objects[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (f *fakeBlobStorage) Delete(ctx context.Context, key string) error {
+	delete(f.objects, key)
+	return nil
+}
+
+var _ datalayer.BlobStorage = (*fakeBlobStorage)(nil)
+
+type fakeHTTPClient struct {
+	status        int
+	contentType   string
+	contentLength int64
+	body          string
+}
+
+func (f *fakeHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Content-Type", f.contentType)
+	return &http.Response{
+		Status:        http.StatusText(f.status),
+		StatusCode:    f.status,
+		Header:        header,
+		ContentLength: f.contentLength,
+		Body:          io.NopCloser(strings.NewReader(f.body)),
+	}, nil
+}
+
+func TestBlobTransferServicePipe(t *testing.T) {
+	const maxSize = 16
+
+	tc := []struct {
+		name    string
+		url     string
+		client  *fakeHTTPClient
+		wantErr any
+	}{
+		{
+			name:   "Allowed download is stored",
+			url:    "https://example.com/bell.mp3",
+			client: &fakeHTTPClient{status: http.StatusOK, contentType: "audio/mpeg", contentLength: 4, body: "ding"},
+		},
+		{
+			name:   "Content type parameters are ignored",
+			url:    "https://example.com/bell.ogg",
+			client: &fakeHTTPClient{status: http.StatusOK, contentType: "audio/ogg; codecs=opus", contentLength: -1, body: "ding"},
+		},
+		{
+			name:    "Non-http URLs are rejected",
+			url:     "file:///etc/passwd",
+			client:  &fakeHTTPClient{status: http.StatusOK, contentType: "audio/mpeg", body: "ding"},
+			wantErr: new(*handler.InvalidURLError),
+		},
+		{
+			name:    "Bad status is rejected",
+			url:     "https://example.com/missing.mp3",
+			client:  &fakeHTTPClient{status: http.StatusNotFound, contentType: "text/html"},
+			wantErr: new(*handler.DownloadFailedError),
+		},
+		{
+			name:    "Disallowed content type is rejected",
+			url:     "https://example.com/page",
+			client:  &fakeHTTPClient{status: http.StatusOK, contentType: "text/html", body: "<html>"},
+			wantErr: new(*handler.UnsupportedContentTypeError),
+		},
+		{
+			name:    "Declared size over the limit is rejected",
+			url:     "https://example.com/long.mp3",
+			client:  &fakeHTTPClient{status: http.StatusOK, contentType: "audio/mpeg", contentLength: maxSize + 1},
+			wantErr: new(*handler.DownloadTooLargeError),
+		},
+		{
+			name:    "Streamed size over the limit is rejected",
+			url:     "https://example.com/long.mp3",
+			client:  &fakeHTTPClient{status: http.StatusOK, contentType: "audio/mpeg", contentLength: -1, body: strings.Repeat("a", maxSize+1)},
+			wantErr: new(*handler.DownloadTooLargeError),
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			storage := newFakeBlobStorage()
+			service := handler.NewBlobTransferService(storage, testCase.client, maxSize, handler.DefaultAllowedContentTypes)
+
+			n, err := service.Pipe(t.Context(), "key", testCase.url)
+			if testCase.wantErr != nil {
+				if err == nil || !errors.As(err, testCase.wantErr) {
+					t.Fatalf("expected error of type %T, got %v", testCase.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != int64(len(testCase.client.body)) {
+				t.Errorf("expected %d bytes to be stored, got %d", len(testCase.client.body), n)
+			}
+			if string(storage.objects["key"]) != testCase.client.body {
+				t.Errorf("stored object does not match download: %q", storage.objects["key"])
+			}
+		})
+	}
+}
+
+func TestCommandToAddURLRequest(t *testing.T) {
+	option := func(name, value string) *discordgo.ApplicationCommandInteractionDataOption {
+		return &discordgo.ApplicationCommandInteractionDataOption{
+			Name:  name,
+			Type:  discordgo.ApplicationCommandOptionString,
+			Value: value,
+		}
+	}
+
+	got, err := handler.CommandToAddURLRequest([]*discordgo.ApplicationCommandInteractionDataOption{
+		option("url", "https://example.com/sounds/bell.mp3?download=1"),
+		option("cron", "0 * * * *"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := handler.SoundCronAddURLRequest{
+		URL:  "https://example.com/sounds/bell.mp3?download=1",
+		Cron: "0 * * * *",
+		Name: "bell.mp3",
+	}
+	if *got != want {
+		t.Errorf("CommandToAddURLRequest() = %+v, want %+v", *got, want)
+	}
+
+	if _, err := handler.CommandToAddURLRequest(nil); err == nil {
+		t.Errorf("expected error for request without url")
+	}
+}
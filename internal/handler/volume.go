@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/util"
+)
+
+// SoundCronVolumeRequest is a request to change how loud a soundcron is played.
+type SoundCronVolumeRequest struct {
+	Name    string
+	Percent int
+}
+
+func CommandToVolumeRequest(
+	options []*discordgo.ApplicationCommandInteractionDataOption,
+) (*SoundCronVolumeRequest, error) {
+	var request SoundCronVolumeRequest
+	for _, option := range options {
+		switch option.Name {
+		case "name":
+			if option.Type != discordgo.ApplicationCommandOptionString {
+				return nil, fmt.Errorf("invalid type for name option")
+			}
+			request.Name = option.StringValue()
+		case "percent":
+			if option.Type != discordgo.ApplicationCommandOptionInteger {
+				return nil, fmt.Errorf("invalid type for percent option")
+			}
+			request.Percent = int(option.IntValue())
+		}
+	}
+	if request.Name == "" {
+		return nil, fmt.Errorf("missing name option")
+	}
+	if request.Percent == 0 {
+		return nil, fmt.Errorf("missing percent option")
+	}
+	return &request, nil
+}
+
+// SoundCronVolumeUpdater finds soundcrons by name and changes their volume.
+type SoundCronVolumeUpdater interface {
+	repository.SoundCronLister
+	repository.SoundCronVolumeSetter
+}
+
+// VolumeHandler changes the volume that soundcrons are played at.
+type VolumeHandler struct {
+	SoundCrons SoundCronVolumeUpdater
+}
+
+// ProcessVolume applies volumeRequest to the soundcron of the guild with the
+// requested name, and returns the message to show the user. The volume is applied
+// during playback, so it takes effect from the next run without re-encoding.
+func (h *VolumeHandler) ProcessVolume(
+	ctx context.Context,
+	guildID string,
+	volumeRequest *SoundCronVolumeRequest,
+) (string, error) {
+	if volumeRequest.Percent < 1 || volumeRequest.Percent > repository.MaxVolume {
+		return "", &UserError{
+			Message: fmt.Sprintf("The volume must be between 1%% and %d%%", repository.MaxVolume),
+		}
+	}
+
+	soundCrons, err := h.SoundCrons.List(ctx, guildID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list soundcrons: %w", err)
+	}
+
+	soundCron, found := util.FindFirst(soundCrons, func(sc repository.SoundCron) bool {
+		return sc.Name == volumeRequest.Name
+	})
+	if !found {
+		return "", &UserError{
+			Message: fmt.Sprintf("No soundcron named `%s` exists", volumeRequest.Name),
+		}
+	}
+
+	if err := h.SoundCrons.SetVolume(ctx, soundCron.ID, volumeRequest.Percent); err != nil {
+		return "", fmt.Errorf("failed to set volume: %w", err)
+	}
+	return fmt.Sprintf("`%s` will play at %d%% volume from its next run", soundCron.Name, volumeRequest.Percent), nil
+}
+
+// NewVolumeFlow creates the flow for the "/soundcron volume" command.
+func NewVolumeFlow(h *VolumeHandler) *Flow {
+	return &Flow{
+		ID: "soundcron_volume",
+		Root: &Node{
+			ID: "soundcron_volume_slash_command",
+			Matcher: func(i *discordgo.InteractionCreate) bool {
+				if i.Type != discordgo.InteractionApplicationCommand {
+					return false
+				}
+				data := i.ApplicationCommandData()
+				return data.Name == "soundcron" &&
+					len(data.Options) > 0 && data.Options[0].Name == "volume"
+			},
+			Handler: func(s DiscordSession, i *discordgo.InteractionCreate, flowContext *FlowContext) error {
+				volumeRequest, err := CommandToVolumeRequest(i.ApplicationCommandData().Options[0].Options)
+				if err != nil {
+					return fmt.Errorf("failed to parse volume request: %w", err)
+				}
+
+				content, err := h.ProcessVolume(context.Background(), i.GuildID, volumeRequest)
+				if err != nil {
+					var ue *UserError
+					if !errors.As(err, &ue) {
+						return fmt.Errorf("failed to process volume request: %w", err)
+					}
+					content = ue.Message
+				}
+
+				err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Content: content,
+						Flags:   discordgo.MessageFlagsEphemeral,
+					},
+				})
+				if err != nil {
+					return fmt.Errorf("failed to respond to interaction: %w", err)
+				}
+				return nil
+			},
+		},
+	}
+}
@@ -0,0 +1,82 @@
+package handler_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/handler"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+func TestCommandToVolumeRequest(t *testing.T) {
+	result, err := handler.CommandToVolumeRequest([]*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "name", Type: discordgo.ApplicationCommandOptionString, Value: "Bell"},
+		{Name: "percent", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(50)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *result != (handler.SoundCronVolumeRequest{Name: "Bell", Percent: 50}) {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	_, err = handler.CommandToVolumeRequest([]*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "name", Type: discordgo.ApplicationCommandOptionString, Value: "Bell"},
+	})
+	if err == nil {
+		t.Errorf("expected error for a request without a percent")
+	}
+}
+
+func TestProcessVolume(t *testing.T) {
+	tc := []struct {
+		name       string
+		request    handler.SoundCronVolumeRequest
+		wantErr    bool
+		wantVolume int
+	}{
+		{
+			name:       "Volume of an existing soundcron is changed",
+			request:    handler.SoundCronVolumeRequest{Name: "Bell", Percent: 50},
+			wantVolume: 50,
+		},
+		{
+			name:    "Unknown soundcron is rejected",
+			request: handler.SoundCronVolumeRequest{Name: "Horn", Percent: 50},
+			wantErr: true,
+		},
+		{
+			name:    "Volume above the maximum is rejected",
+			request: handler.SoundCronVolumeRequest{Name: "Bell", Percent: repository.MaxVolume + 1},
+			wantErr: true,
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &fakeSoundCronRepository{soundCrons: []repository.SoundCron{
+				{ID: "sc-1", Name: "Bell", GuildID: "guild", Volume: repository.DefaultVolume},
+			}}
+			h := &handler.VolumeHandler{SoundCrons: repo}
+
+			_, err := h.ProcessVolume(t.Context(), "guild", &testCase.request)
+			if testCase.wantErr {
+				var ue *handler.UserError
+				if !errors.As(err, &ue) {
+					t.Fatalf("expected UserError, got %v", err)
+				}
+				if len(repo.volumes) != 0 {
+					t.Errorf("expected no volume to be set, got %v", repo.volumes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if repo.volumes["sc-1"] != testCase.wantVolume {
+				t.Errorf("expected volume %d, got %d", testCase.wantVolume, repo.volumes["sc-1"])
+			}
+		})
+	}
+}
@@ -1,10 +1,16 @@
 // Package opus handles encoding, decoding, and streaming of Opus audio frames
 // for Discord voice playback.
 //
-// Audio is stored in a minimal binary format: concatenated length-prefixed frames
-// ([uint16 LE length][opus bytes]). No headers, no metadata.
+// Audio is stored in one of two Formats. FormatOgg is a standard OGG/Opus stream
+// that any player can read. FormatLengthPrefixed is a Header (magic, version,
+// frame duration and sample rate) followed by concatenated length-prefixed frames
+// ([uint16 LE length][opus bytes]). Length-prefixed audio stored before there was
+// a Header is read as version 0.
 //
-// Encode transcodes any audio to Opus via FFmpeg and produces length-prefixed frames.
-// Decode reads length-prefixed frames back. Stream sends decoded frames to a
-// Discord voice connection.
+// Encode transcodes any audio to Opus via FFmpeg and writes its frames with a
+// FrameWriter. NewOggPassthrough skips FFmpeg for audio that is already
+// OGG/Opus. FFprobe reads the duration, channel count and codec of audio before
+// it is encoded. NewFrameReader detects the Format of stored audio and reads its
+// frames back. StreamToVoice sends those frames to a Discord voice connection.
+// AdjustVolume changes their loudness at playback time.
 package opus
@@ -1,24 +1,123 @@
 package opus
 
 import (
-	"encoding/binary"
-	"errors"
+	"fmt"
 	"io"
-	"os/exec"
-
-	"github.com/jonas747/ogg"
+	"strings"
+	"time"
 )
 
 // TranscodeFunc takes raw audio and returns a stream of OGG/Opus data.
 // The returned ReadCloser must be closed to release any underlying resources.
 type TranscodeFunc func(r io.Reader) (io.ReadCloser, error)
 
-// FFmpegTranscode is the default TranscodeFunc that shells out to ffmpeg.
-func FFmpegTranscode(r io.Reader) (io.ReadCloser, error) {
-	cmd := exec.Command("ffmpeg",
+// FFmpegOptions changes how FFmpegTranscode-style functions process audio.
+type FFmpegOptions struct {
+	// Normalize applies EBU R128 loudness normalization.
+	Normalize bool
+
+	// TargetLUFS is the integrated loudness to normalize to.
+	// It is only used when Normalize is set.
+	TargetLUFS float64
+
+	// Start and End trim the audio to the part between them.
+	// A zero End keeps the audio up to its end.
+	Start time.Duration
+	End   time.Duration
+
+	// Volume scales the loudness of the audio. Zero and one leave it unchanged.
+	Volume float64
+
+	// Length is how long the audio is once trimmed. Audio that runs longer is cut.
+	// It places the fade out, so FadeOut only applies when Length is set.
+	Length time.Duration
+
+	// Duration is how long the audio is before it is trimmed, if it is known.
+	// Audio is not trimmed at an end that it does not reach.
+	Duration time.Duration
+
+	// FadeIn and FadeOut are how long the audio takes to fade in at its start
+	// and to fade out before its end.
+	FadeIn  time.Duration
+	FadeOut time.Duration
+
+	// Limits bounds the resources that ffmpeg may use.
+	Limits FFmpegLimits
+}
+
+// trim returns where the audio is trimmed to start and end.
+// A zero end keeps the audio up to its end.
+func (o FFmpegOptions) trim() (start, end time.Duration) {
+	end = o.End
+	if o.Length > 0 && (end == 0 || o.Start+o.Length < end) {
+		end = o.Start + o.Length
+	}
+	if o.Duration > 0 && end >= o.Duration {
+		end = 0
+	}
+	return o.Start, end
+}
+
+// changesAudio reports whether the options change the audio,
+// rather than only store it in the format that it is streamed in.
+func (o FFmpegOptions) changesAudio() bool {
+	start, end := o.trim()
+	return start > 0 || end > 0 ||
+		o.Normalize ||
+		o.FadeIn > 0 ||
+		(o.FadeOut > 0 && o.Length > 0) ||
+		(o.Volume != 0 && o.Volume != 1)
+}
+
+// filters returns the ffmpeg audio filters for the options, in the order they are applied.
+func (o FFmpegOptions) filters() []string {
+	var filters []string
+	if start, end := o.trim(); start > 0 || end > 0 {
+		trim := fmt.Sprintf("atrim=start=%g", start.Seconds())
+		if end > 0 {
+			trim += fmt.Sprintf(":end=%g", end.Seconds())
+		}
+		// Later filters expect the trimmed audio to start at zero.
+		filters = append(filters, trim, "asetpts=PTS-STARTPTS")
+	}
+	if o.Normalize {
+		// Single-pass loudnorm, with the true peak kept below clipping
+		// after encoding and a loudness range suited to short clips.
+		filters = append(filters, fmt.Sprintf("loudnorm=I=%g:TP=-1.5:LRA=11", o.TargetLUFS))
+	}
+	// Fades come after normalization so that it does not even them out.
+	if o.FadeIn > 0 {
+		filters = append(filters, fmt.Sprintf("afade=t=in:d=%g", o.FadeIn.Seconds()))
+	}
+	if o.FadeOut > 0 && o.Length > 0 {
+		fadeOut := min(o.FadeOut, o.Length)
+		filters = append(filters, fmt.Sprintf("afade=t=out:st=%g:d=%g", (o.Length-fadeOut).Seconds(), fadeOut.Seconds()))
+	}
+	if o.Volume != 0 && o.Volume != 1 {
+		filters = append(filters, fmt.Sprintf("volume=%g", o.Volume))
+	}
+	return filters
+}
+
+// FFmpegArgs returns the arguments passed to ffmpeg for the given options.
+func FFmpegArgs(opts FFmpegOptions) []string {
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
 		"-i", "pipe:0",
 		"-vn",
 		"-map", "0:a",
+	}
+	if filters := opts.filters(); len(filters) > 0 {
+		args = append(args, "-af", strings.Join(filters, ","))
+	}
+	return append(args, outputArgs(opts.Limits)...)
+}
+
+// outputArgs returns the arguments that make ffmpeg write OGG/Opus to its stdout
+// with the frames that Encode stores.
+func outputArgs(limits FFmpegLimits) []string {
+	return []string{
 		"-acodec", "libopus",
 		"-f", "ogg",
 		"-vbr", "on",
@@ -29,98 +128,104 @@ func FFmpegTranscode(r io.Reader) (io.ReadCloser, error) {
 		"-application", "audio",
 		"-frame_duration", "20",
 		"-packet_loss", "1",
-		"-threads", "0",
+		"-threads", limits.threadsArg(),
 		"pipe:1",
-	)
+	}
+}
+
+// NewFFmpegTranscode returns a TranscodeFunc that shells out to ffmpeg
+// with the given options.
+func NewFFmpegTranscode(opts FFmpegOptions) TranscodeFunc {
+	return func(r io.Reader) (io.ReadCloser, error) {
+		return ffmpegTranscode(r, opts)
+	}
+}
 
-	cmd.Stdin = r
+// FFmpegTranscode is the default TranscodeFunc that shells out to ffmpeg.
+func FFmpegTranscode(r io.Reader) (io.ReadCloser, error) {
+	return ffmpegTranscode(r, FFmpegOptions{})
+}
 
-	stdout, err := cmd.StdoutPipe()
+func ffmpegTranscode(r io.Reader, opts FFmpegOptions) (io.ReadCloser, error) {
+	cmd := newFFmpegCommand(opts.Limits, "ffmpeg", FFmpegArgs(opts)...)
+	cmd.cmd.Stdin = r
+
+	stdout, err := cmd.cmd.StdoutPipe()
 	if err != nil {
+		cmd.cancel()
 		return nil, err
 	}
 
-	if err := cmd.Start(); err != nil {
-		return nil, err
+	if err := cmd.cmd.Start(); err != nil {
+		cmd.cancel()
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
 	}
 
 	return &cmdReadCloser{ReadCloser: stdout, cmd: cmd}, nil
 }
 
-// Encoder transcodes audio to length-prefixed Opus frames. The transcoding
+// Encoder transcodes audio to stored Opus frames. The transcoding
 // step is provided via a TranscodeFunc, keeping the OGG demux → frames
 // pipeline generic.
 type Encoder struct {
 	Transcode TranscodeFunc
+
+	// Format is the Format that the frames are written in.
+	Format Format
 }
 
-// NewEncoder returns an Encoder that uses the given TranscodeFunc.
+// NewEncoder returns an Encoder that uses the given TranscodeFunc
+// and writes length-prefixed frames.
 func NewEncoder(fn TranscodeFunc) *Encoder {
 	return &Encoder{Transcode: fn}
 }
 
 // Encode reads audio from r, transcodes it to OGG/Opus via the configured
-// TranscodeFunc, then demuxes the OGG stream into length-prefixed Opus frames.
+// TranscodeFunc, then writes its Opus frames in the configured Format.
 // The returned io.ReadCloser must be closed to clean up resources.
 func (e *Encoder) Encode(r io.Reader) (io.ReadCloser, error) {
 	oggStream, err := e.Transcode(r)
 	if err != nil {
 		return nil, err
 	}
+	return e.encodeOgg(oggStream), nil
+}
 
+// encodeOgg returns the frames of the OGG/Opus stream in oggStream,
+// written in the configured Format. It closes oggStream once it has been read.
+func (e *Encoder) encodeOgg(oggStream io.ReadCloser) io.ReadCloser {
 	pr, pw := io.Pipe()
 
 	go func() {
-		defer pw.Close()
-		defer oggStream.Close()
-
-		decoder := ogg.NewPacketDecoder(ogg.NewDecoder(oggStream))
-
-		// Skip the first 2 OGG metadata packets.
-		skip := 2
-		for {
-			packet, _, err := decoder.Decode()
-			if skip > 0 {
-				skip--
-				continue
-			}
-			if err != nil {
-				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
-					pw.CloseWithError(err)
-				}
-				return
-			}
-
-			var lenBuf [2]byte
-			binary.LittleEndian.PutUint16(lenBuf[:], uint16(len(packet)))
-			if _, err := pw.Write(lenBuf[:]); err != nil {
-				return
-			}
-			if _, err := pw.Write(packet); err != nil {
-				return
-			}
+		err := e.remux(pw, oggStream)
+		// When ffmpeg fails, how it exited explains why better than
+		// the output that it did not finish writing.
+		if closeErr := oggStream.Close(); closeErr != nil {
+			err = closeErr
 		}
+		pw.CloseWithError(err)
 	}()
 
-	return pr, nil
+	return pr
+}
+
+// remux reads the frames of the OGG/Opus stream in r and writes them to w.
+func (e *Encoder) remux(w io.Writer, r io.Reader) error {
+	source, err := NewOggReader(r)
+	if err != nil {
+		return err
+	}
+	frames, err := NewFrameWriter(w, e.Format)
+	if err != nil {
+		return err
+	}
+	if _, err := CopyFrames(frames, source); err != nil {
+		return err
+	}
+	return frames.Close()
 }
 
 // Encode is a convenience function that transcodes using FFmpeg.
 func Encode(r io.Reader) (io.ReadCloser, error) {
 	return NewEncoder(FFmpegTranscode).Encode(r)
 }
-
-// cmdReadCloser wraps a command's stdout and kills the process on Close.
-type cmdReadCloser struct {
-	io.ReadCloser
-	cmd *exec.Cmd
-}
-
-func (c *cmdReadCloser) Close() error {
-	err := c.ReadCloser.Close()
-	if c.cmd.Process != nil {
-		c.cmd.Process.Kill()
-	}
-	c.cmd.Wait()
-	return err
-}
@@ -0,0 +1,70 @@
+package opus_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/opus"
+)
+
+func TestFFmpegArgs(t *testing.T) {
+	args := opus.FFmpegArgs(opus.FFmpegOptions{})
+	if slices.Contains(args, "-af") {
+		t.Errorf("expected no audio filter without normalization, got %v", args)
+	}
+
+	args = opus.FFmpegArgs(opus.FFmpegOptions{Normalize: true, TargetLUFS: -14})
+	i := slices.Index(args, "-af")
+	if i == -1 || args[i+1] != "loudnorm=I=-14:TP=-1.5:LRA=11" {
+		t.Errorf("expected loudnorm filter targeting -14 LUFS, got %v", args)
+	}
+	if i > slices.Index(args, "-acodec") {
+		t.Errorf("expected the filter to come before the output options, got %v", args)
+	}
+
+	args = opus.FFmpegArgs(opus.FFmpegOptions{Start: 1500 * time.Millisecond, End: 5 * time.Second})
+	i = slices.Index(args, "-af")
+	if i == -1 || args[i+1] != "atrim=start=1.5:end=5,asetpts=PTS-STARTPTS" {
+		t.Errorf("expected atrim filter between 1.5s and 5s, got %v", args)
+	}
+
+	args = opus.FFmpegArgs(opus.FFmpegOptions{Start: 2 * time.Second, Normalize: true, TargetLUFS: -16})
+	i = slices.Index(args, "-af")
+	if i == -1 || args[i+1] != "atrim=start=2,asetpts=PTS-STARTPTS,loudnorm=I=-16:TP=-1.5:LRA=11" {
+		t.Errorf("expected the audio to be trimmed before it is normalized, got %v", args)
+	}
+
+	args = opus.FFmpegArgs(opus.FFmpegOptions{
+		Start:   10 * time.Second,
+		Length:  5 * time.Second,
+		FadeIn:  500 * time.Millisecond,
+		FadeOut: time.Second,
+	})
+	i = slices.Index(args, "-af")
+	if i == -1 || args[i+1] != "atrim=start=10:end=15,asetpts=PTS-STARTPTS,afade=t=in:d=0.5,afade=t=out:st=4:d=1" {
+		t.Errorf("expected the audio to be cut to its length and faded before the cut, got %v", args)
+	}
+
+	args = opus.FFmpegArgs(opus.FFmpegOptions{Length: 3 * time.Second, Duration: 3 * time.Second})
+	if slices.Contains(args, "-af") {
+		t.Errorf("expected no trim at the end of audio of a known duration, got %v", args)
+	}
+
+	args = opus.FFmpegArgs(opus.FFmpegOptions{Length: 3 * time.Second, Duration: 5 * time.Second})
+	i = slices.Index(args, "-af")
+	if i == -1 || args[i+1] != "atrim=start=0:end=3,asetpts=PTS-STARTPTS" {
+		t.Errorf("expected audio that runs longer than its length to be cut, got %v", args)
+	}
+
+	args = opus.FFmpegArgs(opus.FFmpegOptions{FadeOut: time.Second})
+	if slices.Contains(args, "-af") {
+		t.Errorf("expected no fade out without a length to place it, got %v", args)
+	}
+
+	args = opus.FFmpegArgs(opus.FFmpegOptions{Volume: 0.5})
+	i = slices.Index(args, "-af")
+	if i == -1 || args[i+1] != "volume=0.5" {
+		t.Errorf("expected volume filter at 50%%, got %v", args)
+	}
+}
@@ -0,0 +1,235 @@
+package opus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The ways that ffmpeg and ffprobe commonly fail on bad input.
+// They are wrapped by FFmpegError, so they can be checked with errors.Is.
+var (
+	ErrUnsupportedFormat = errors.New("unsupported audio format")
+	ErrNoAudioStream     = errors.New("no audio stream")
+	ErrTruncatedInput    = errors.New("truncated audio")
+	ErrTimeout           = errors.New("timed out")
+)
+
+// stderrPatterns maps messages that ffmpeg and ffprobe log for bad input
+// to the error they mean. They are checked in order.
+var stderrPatterns = []struct {
+	substring string
+	err       error
+}{
+	{"matches no streams", ErrNoAudioStream},
+	{"does not contain any stream", ErrNoAudioStream},
+	{"moov atom not found", ErrTruncatedInput},
+	{"partial file", ErrTruncatedInput},
+	{"Truncated", ErrTruncatedInput},
+	{"Invalid data found when processing input", ErrUnsupportedFormat},
+	{"Unknown decoder", ErrUnsupportedFormat},
+	{"could not find codec parameters", ErrUnsupportedFormat},
+}
+
+// FFmpegError is returned when ffmpeg or ffprobe does not exit successfully.
+type FFmpegError struct {
+	// Program is the name of the program that failed.
+	Program string
+
+	// ExitCode is the exit status of the program, or -1 if it was killed.
+	ExitCode int
+
+	// Stderr is the end of what the program logged.
+	Stderr string
+
+	// Err is the kind of failure, such as ErrUnsupportedFormat,
+	// or nil if it is not known.
+	Err error
+}
+
+func (e *FFmpegError) Error() string {
+	msg := fmt.Sprintf("%s exited with status %d", e.Program, e.ExitCode)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Stderr != "" {
+		msg += ": " + strings.TrimSpace(e.Stderr)
+	}
+	return msg
+}
+
+func (e *FFmpegError) Unwrap() error {
+	return e.Err
+}
+
+// FFmpegLimits bounds the resources that an ffmpeg or ffprobe process may use.
+// Memory is bounded by the container that the process runs in.
+type FFmpegLimits struct {
+	// Timeout is how long the process may run before it is killed.
+	// Zero does not limit it.
+	Timeout time.Duration
+
+	// Threads is how many threads ffmpeg may use. Zero lets ffmpeg decide.
+	Threads int
+}
+
+// stderrLimit is how much of the end of stderr is kept for an FFmpegError.
+const stderrLimit = 4096
+
+// tailBuffer keeps the last stderrLimit bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - stderrLimit; over > 0 {
+		t.buf = t.buf[over:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// ffmpegCommand is an ffmpeg or ffprobe process whose stderr is captured.
+type ffmpegCommand struct {
+	cmd    *exec.Cmd
+	ctx    context.Context
+	cancel context.CancelFunc
+	stderr *tailBuffer
+}
+
+func newFFmpegCommand(limits FFmpegLimits, program string, args ...string) *ffmpegCommand {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+	}
+	c := &ffmpegCommand{
+		cmd:    exec.CommandContext(ctx, program, args...),
+		ctx:    ctx,
+		cancel: cancel,
+		stderr: &tailBuffer{},
+	}
+	c.cmd.Stderr = c.stderr
+	return c
+}
+
+// run runs the process to completion and returns an FFmpegError if it failed.
+func (c *ffmpegCommand) run() error {
+	defer c.cancel()
+	return c.check(c.cmd.Run())
+}
+
+// wait waits for the process to exit and returns an FFmpegError if it failed.
+func (c *ffmpegCommand) wait() error {
+	defer c.cancel()
+	return c.check(c.cmd.Wait())
+}
+
+// check turns the error of a finished process into an FFmpegError.
+func (c *ffmpegCommand) check(err error) error {
+	if err == nil {
+		return nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("failed to run %s: %w", c.cmd.Args[0], err)
+	}
+
+	stderr := c.stderr.String()
+	ffmpegErr := &FFmpegError{
+		Program:  c.cmd.Args[0],
+		ExitCode: exitErr.ExitCode(),
+		Stderr:   stderr,
+	}
+	if errors.Is(c.ctx.Err(), context.DeadlineExceeded) {
+		ffmpegErr.Err = ErrTimeout
+		return ffmpegErr
+	}
+	for _, pattern := range stderrPatterns {
+		if strings.Contains(stderr, pattern.substring) {
+			ffmpegErr.Err = pattern.err
+			break
+		}
+	}
+	return ffmpegErr
+}
+
+// closeGrace is how long ffmpeg is given to exit once its output is closed
+// before it has all been read, after which it is killed.
+const closeGrace = time.Second
+
+// cmdReadCloser wraps the stdout of an ffmpeg process. Close reports how the
+// process exited, except for how closing its output early stopped it.
+type cmdReadCloser struct {
+	io.ReadCloser
+	cmd *ffmpegCommand
+	eof bool
+}
+
+func (c *cmdReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if errors.Is(err, io.EOF) {
+		c.eof = true
+	}
+	return n, err
+}
+
+func (c *cmdReadCloser) Close() error {
+	if c.eof {
+		return c.cmd.wait()
+	}
+
+	// Closing the output stops ffmpeg the next time it writes. It may have
+	// failed already, which is still reported, or be waiting for input, in
+	// which case it is killed.
+	c.ReadCloser.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.cmd.wait()
+	}()
+	timer := time.NewTimer(closeGrace)
+	defer timer.Stop()
+
+	var err error
+	killed := false
+	select {
+	case err = <-done:
+	case <-timer.C:
+		c.cmd.cmd.Process.Kill()
+		killed = true
+		err = <-done
+	}
+	if stoppedByClose(err, killed) {
+		return nil
+	}
+	return err
+}
+
+// stoppedByClose reports whether err only says that ffmpeg exited because its
+// output was closed early: it was killed, or failed to write to the closed pipe.
+func stoppedByClose(err error, killed bool) bool {
+	var ffmpegErr *FFmpegError
+	if !errors.As(err, &ffmpegErr) || errors.Is(ffmpegErr, ErrTimeout) {
+		return false
+	}
+	return killed || ffmpegErr.ExitCode == -1 || strings.Contains(ffmpegErr.Stderr, "Broken pipe")
+}
+
+// threadsArg returns the value of the -threads option of ffmpeg.
+func (l FFmpegLimits) threadsArg() string {
+	return strconv.Itoa(max(l.Threads, 0))
+}
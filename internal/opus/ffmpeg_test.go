@@ -0,0 +1,138 @@
+package opus_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/opus"
+)
+
+// fakeProgram puts a shell script named name first on the PATH for the test.
+func fakeProgram(t *testing.T, name, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0o755)
+	if err != nil {
+		t.Fatalf("failed to write fake %s: %v", name, err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func encodeWithFFmpeg(t *testing.T, opts opus.FFmpegOptions) error {
+	t.Helper()
+	encoded, err := opus.NewEncoder(opus.NewFFmpegTranscode(opts)).Encode(strings.NewReader("not audio"))
+	if err != nil {
+		return err
+	}
+	defer encoded.Close()
+	_, err = io.ReadAll(encoded)
+	return err
+}
+
+func TestFFmpegTranscodeReportsFailure(t *testing.T) {
+	fakeProgram(t, "ffmpeg", `echo "pipe:0: Invalid data found when processing input" >&2; exit 183`)
+
+	err := encodeWithFFmpeg(t, opus.FFmpegOptions{})
+	if !errors.Is(err, opus.ErrUnsupportedFormat) {
+		t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+	}
+	var ffmpegErr *opus.FFmpegError
+	if !errors.As(err, &ffmpegErr) {
+		t.Fatalf("expected an FFmpegError, got %T", err)
+	}
+	if ffmpegErr.ExitCode != 183 || !strings.Contains(ffmpegErr.Stderr, "Invalid data") {
+		t.Errorf("expected the exit status and stderr to be kept, got %+v", ffmpegErr)
+	}
+}
+
+func TestFFmpegTranscodeTimeout(t *testing.T) {
+	fakeProgram(t, "ffmpeg", "exec sleep 10")
+
+	start := time.Now()
+	err := encodeWithFFmpeg(t, opus.FFmpegOptions{Limits: opus.FFmpegLimits{Timeout: 50 * time.Millisecond}})
+	if !errors.Is(err, opus.ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected ffmpeg to be killed at the timeout, took %s", elapsed)
+	}
+}
+
+func TestFFmpegTranscodeCloseEarly(t *testing.T) {
+	tc := []struct {
+		name    string
+		script  string
+		wantErr error
+	}{
+		{
+			name:    "Failure is reported after the output is closed",
+			script:  `printf 'frames'; echo "pipe:0: partial file" >&2; exit 1`,
+			wantErr: opus.ErrTruncatedInput,
+		},
+		{
+			name:   "Writing to the closed output is not a failure",
+			script: "exec cat /dev/zero",
+		},
+		{
+			name:   "Being killed while waiting is not a failure",
+			script: `printf 'frames'; exec sleep 10`,
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			fakeProgram(t, "ffmpeg", testCase.script)
+
+			out, err := opus.NewFFmpegTranscode(opus.FFmpegOptions{})(strings.NewReader("not audio"))
+			if err != nil {
+				t.Fatalf("failed to start ffmpeg: %v", err)
+			}
+			// The reader stops early, such as when storing the output fails.
+			if _, err := out.Read(make([]byte, 1)); err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			err = out.Close()
+			if testCase.wantErr == nil && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if testCase.wantErr != nil && !errors.Is(err, testCase.wantErr) {
+				t.Errorf("expected %v, got %v", testCase.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFFprobeErrors(t *testing.T) {
+	tc := []struct {
+		name   string
+		script string
+		want   error
+	}{
+		{
+			name:   "No audio stream",
+			script: `echo '{"streams": [], "format": {"duration": "3.0"}}'`,
+			want:   opus.ErrNoAudioStream,
+		},
+		{
+			name:   "Truncated input",
+			script: `echo "moov atom not found" >&2; exit 1`,
+			want:   opus.ErrTruncatedInput,
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			fakeProgram(t, "ffprobe", test.script)
+
+			_, err := opus.NewFFprobe(opus.FFmpegLimits{Timeout: time.Minute})(strings.NewReader("audio"))
+			if !errors.Is(err, test.want) {
+				t.Errorf("expected %v, got %v", test.want, err)
+			}
+		})
+	}
+}
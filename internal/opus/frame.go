@@ -0,0 +1,228 @@
+package opus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// FrameReader reads Opus frames one at a time.
+type FrameReader interface {
+	// ReadFrame reads and returns the next raw Opus frame.
+	// Returns io.EOF when there are no more frames.
+	ReadFrame() ([]byte, error)
+}
+
+// FrameWriter writes Opus frames one at a time.
+type FrameWriter interface {
+	// WriteFrame writes a raw Opus frame.
+	WriteFrame(frame []byte) error
+
+	// Close finishes the stream. It does not close the underlying io.Writer.
+	Close() error
+}
+
+// Format is how Opus frames are laid out in storage.
+type Format uint8
+
+const (
+	// FormatLengthPrefixed is a Header followed by concatenated
+	// length-prefixed frames ([uint16 LE length][opus bytes]).
+	FormatLengthPrefixed Format = iota
+
+	// FormatOgg is a standard OGG/Opus stream (RFC 7845),
+	// which can be played by tools such as ffmpeg.
+	FormatOgg
+)
+
+// ParseFormat parses the name of a Format, as returned by Format.String.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "length-prefixed":
+		return FormatLengthPrefixed, nil
+	case "ogg":
+		return FormatOgg, nil
+	}
+	return 0, fmt.Errorf("unknown opus storage format %q", s)
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatLengthPrefixed:
+		return "length-prefixed"
+	case FormatOgg:
+		return "ogg"
+	}
+	return fmt.Sprintf("Format(%d)", uint8(f))
+}
+
+// ContentType returns the MIME type of audio stored in the format.
+func (f Format) ContentType() string {
+	if f == FormatOgg {
+		return "audio/ogg"
+	}
+	return "application/octet-stream"
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that a Format
+// can be read from configuration.
+func (f *Format) UnmarshalText(text []byte) error {
+	format, err := ParseFormat(string(text))
+	if err != nil {
+		return err
+	}
+	*f = format
+	return nil
+}
+
+// StoredSampleRate and StoredFrameDuration describe the frames that Encode
+// produces, which is what a Discord voice connection plays.
+const (
+	StoredSampleRate    = 48000
+	StoredFrameDuration = 20 * time.Millisecond
+)
+
+// HeaderVersion is the version of the Header that is written by NewFrameWriter.
+// Version 0 is length-prefixed storage from before there was a Header.
+const HeaderVersion = 1
+
+// headerMagic starts the Header of length-prefixed storage. Read as the length
+// of a frame, it is larger than any frame that is stored, so storage with a Header
+// can not be mistaken for storage without one.
+var headerMagic = [4]byte{'S', 'O', 'F', 'F'}
+
+// headerSize is the size of an encoded Header: the magic, the version,
+// the frame duration in microseconds and the sample rate.
+const headerSize = 4 + 1 + 4 + 4
+
+// oggMagic starts every page of an OGG stream.
+var oggMagic = []byte("OggS")
+
+// ErrUnsupportedVersion is returned for stored audio that was written
+// by a newer version of this package.
+var ErrUnsupportedVersion = errors.New("unsupported opus storage version")
+
+// Header describes stored Opus frames.
+type Header struct {
+	Format Format
+
+	// Version is the version of the Header of length-prefixed storage.
+	Version uint8
+
+	// FrameDuration is how long each frame plays for.
+	FrameDuration time.Duration
+
+	// SampleRate is the sample rate that the frames are decoded at.
+	SampleRate uint32
+}
+
+// legacyHeader describes length-prefixed storage from before there was a Header.
+// It was always written by Encode.
+var legacyHeader = Header{
+	Format:        FormatLengthPrefixed,
+	Version:       0,
+	FrameDuration: StoredFrameDuration,
+	SampleRate:    StoredSampleRate,
+}
+
+// CheckStreamable returns an error if the frames that h describes can not be
+// sent to a Discord voice connection, which plays 20 ms frames at 48 kHz.
+func (h Header) CheckStreamable() error {
+	if h.SampleRate != StoredSampleRate || h.FrameDuration != StoredFrameDuration {
+		return fmt.Errorf(
+			"opus frames of %s at %d Hz can not be streamed to Discord",
+			h.FrameDuration, h.SampleRate,
+		)
+	}
+	return nil
+}
+
+func (h Header) marshal() []byte {
+	b := make([]byte, 0, headerSize)
+	b = append(b, headerMagic[:]...)
+	b = append(b, h.Version)
+	b = binary.LittleEndian.AppendUint32(b, uint32(h.FrameDuration/time.Microsecond))
+	return binary.LittleEndian.AppendUint32(b, h.SampleRate)
+}
+
+func unmarshalHeader(b []byte) (Header, error) {
+	version := b[4]
+	if version > HeaderVersion {
+		return Header{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	return Header{
+		Format:        FormatLengthPrefixed,
+		Version:       version,
+		FrameDuration: time.Duration(binary.LittleEndian.Uint32(b[5:])) * time.Microsecond,
+		SampleRate:    binary.LittleEndian.Uint32(b[9:]),
+	}, nil
+}
+
+// NewFrameReader returns a FrameReader for stored audio in any Format,
+// which it detects from the start of r, along with the Header of the audio.
+// Length-prefixed audio without a Header is read as version 0.
+func NewFrameReader(r io.Reader) (FrameReader, Header, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	start, err := br.Peek(headerSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, Header{}, fmt.Errorf("failed to read opus header: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(start, oggMagic):
+		reader, err := NewOggReader(br)
+		if err != nil {
+			return nil, Header{}, err
+		}
+		return reader, reader.Header(), nil
+	case bytes.HasPrefix(start, headerMagic[:]) && len(start) == headerSize:
+		header, err := unmarshalHeader(start)
+		if err != nil {
+			return nil, Header{}, err
+		}
+		br.Discard(headerSize)
+		return NewLengthPrefixedReader(br), header, nil
+	default:
+		return NewLengthPrefixedReader(br), legacyHeader, nil
+	}
+}
+
+// NewFrameWriter returns a FrameWriter that writes audio in the given Format to w.
+// Length-prefixed audio starts with a Header, which is written right away.
+func NewFrameWriter(w io.Writer, format Format) (FrameWriter, error) {
+	switch format {
+	case FormatLengthPrefixed:
+		return NewLengthPrefixedWriter(w)
+	case FormatOgg:
+		return NewOggWriter(w)
+	}
+	return nil, fmt.Errorf("unknown opus storage format %d", format)
+}
+
+// CopyFrames writes the frames read from src to dst until src has no more frames,
+// and returns the number of frames copied. Like StreamToVoice, it treats a frame that
+// is cut short as the end of src. It does not close dst.
+func CopyFrames(dst FrameWriter, src FrameReader) (int, error) {
+	copied := 0
+	for {
+		frame, err := src.ReadFrame()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+		if err := dst.WriteFrame(frame); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+}
@@ -0,0 +1,77 @@
+package opus_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/opus"
+)
+
+func TestNewFrameReaderReadsLegacyFrames(t *testing.T) {
+	frames := [][]byte{{0xfc, 0x01}, {0xfc, 0x02, 0x03}}
+
+	got, header := readFrames(t, bytes.NewReader(lengthPrefixed(frames...)))
+	if !slices.EqualFunc(got, frames, bytes.Equal) {
+		t.Errorf("got frames %v, want %v", got, frames)
+	}
+	want := opus.Header{
+		Format:        opus.FormatLengthPrefixed,
+		Version:       0,
+		FrameDuration: opus.StoredFrameDuration,
+		SampleRate:    opus.StoredSampleRate,
+	}
+	if header != want {
+		t.Errorf("header = %+v, want %+v", header, want)
+	}
+}
+
+func TestLengthPrefixedRoundTrip(t *testing.T) {
+	frames := celtFrames(10)
+	stored := writeFrames(t, opus.FormatLengthPrefixed, frames)
+
+	got, header := readFrames(t, bytes.NewReader(stored))
+	if !slices.EqualFunc(got, frames, bytes.Equal) {
+		t.Errorf("round trip gave %v, want %v", got, frames)
+	}
+	if header.Format != opus.FormatLengthPrefixed || header.Version != opus.HeaderVersion {
+		t.Errorf("expected the current length-prefixed header, got %+v", header)
+	}
+	if err := header.CheckStreamable(); err != nil {
+		t.Errorf("expected stored frames to be streamable: %v", err)
+	}
+}
+
+func TestNewFrameReaderRejectsNewerVersion(t *testing.T) {
+	stored := []byte("SOFF")
+	stored = append(stored, opus.HeaderVersion+1)
+	stored = binary.LittleEndian.AppendUint32(stored, 20000)
+	stored = binary.LittleEndian.AppendUint32(stored, 48000)
+
+	_, _, err := opus.NewFrameReader(bytes.NewReader(stored))
+	if !errors.Is(err, opus.ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestHeaderCheckStreamable(t *testing.T) {
+	header := opus.Header{FrameDuration: 60 * time.Millisecond, SampleRate: opus.StoredSampleRate}
+	if err := header.CheckStreamable(); err == nil {
+		t.Errorf("expected 60 ms frames not to be streamable")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, format := range []opus.Format{opus.FormatLengthPrefixed, opus.FormatOgg} {
+		got, err := opus.ParseFormat(format.String())
+		if err != nil || got != format {
+			t.Errorf("ParseFormat(%q) = %v, %v", format.String(), got, err)
+		}
+	}
+	if _, err := opus.ParseFormat("wav"); err == nil {
+		t.Errorf("expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,80 @@
+package opus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// LengthPrefixedReader reads length-prefixed Opus frames from an io.Reader.
+type LengthPrefixedReader struct {
+	r   io.Reader
+	hdr [2]byte
+}
+
+// NewLengthPrefixedReader returns a new LengthPrefixedReader that reads from r,
+// which must be positioned after any Header.
+// The reader is buffered to minimize small reads against the underlying source.
+func NewLengthPrefixedReader(r io.Reader) *LengthPrefixedReader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &LengthPrefixedReader{r: br}
+}
+
+// ReadFrame reads and returns the next raw Opus frame.
+// Returns io.EOF when there are no more frames.
+func (f *LengthPrefixedReader) ReadFrame() ([]byte, error) {
+	if _, err := io.ReadFull(f.r, f.hdr[:]); err != nil {
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint16(f.hdr[:])
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(f.r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// LengthPrefixedWriter writes length-prefixed Opus frames to an io.Writer.
+type LengthPrefixedWriter struct {
+	w io.Writer
+}
+
+// NewLengthPrefixedWriter writes the current Header to w
+// and returns a LengthPrefixedWriter that writes frames after it.
+func NewLengthPrefixedWriter(w io.Writer) (*LengthPrefixedWriter, error) {
+	header := Header{
+		Format:        FormatLengthPrefixed,
+		Version:       HeaderVersion,
+		FrameDuration: StoredFrameDuration,
+		SampleRate:    StoredSampleRate,
+	}
+	if _, err := w.Write(header.marshal()); err != nil {
+		return nil, fmt.Errorf("failed to write opus header: %w", err)
+	}
+	return &LengthPrefixedWriter{w: w}, nil
+}
+
+// WriteFrame writes frame, prefixed with its length.
+func (f *LengthPrefixedWriter) WriteFrame(frame []byte) error {
+	if len(frame) > math.MaxUint16 {
+		return fmt.Errorf("opus frame of %d bytes is too large to store", len(frame))
+	}
+	var lenBuf [2]byte
+	binary.LittleEndian.PutUint16(lenBuf[:], uint16(len(frame)))
+	if _, err := f.w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := f.w.Write(frame)
+	return err
+}
+
+// Close does nothing, as length-prefixed frames have no trailer.
+func (f *LengthPrefixedWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,108 @@
+package opus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// mixInput returns the ffmpeg input that the i-th source of Mix is read from.
+// The first is stdin, and the others are the pipes that are passed to ffmpeg
+// after stdin, stdout and stderr.
+func mixInput(i int) string {
+	if i == 0 {
+		return "pipe:0"
+	}
+	return fmt.Sprintf("pipe:%d", 2+i)
+}
+
+// MixArgs returns the arguments passed to ffmpeg to mix the given number of inputs.
+func MixArgs(inputs int, limits FFmpegLimits) []string {
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+	}
+	for i := range inputs {
+		args = append(args, "-i", mixInput(i))
+	}
+	// Each input keeps its own loudness, since it was already scaled to its volume.
+	args = append(args, "-filter_complex", fmt.Sprintf("amix=inputs=%d:duration=longest:normalize=0", inputs))
+	return append(args, outputArgs(limits)...)
+}
+
+// Mix plays the stored frames read from each of sources at the same time, for
+// as long as the longest of them, and returns them as length-prefixed frames.
+// Opus frames can not be mixed directly, so they are decoded, mixed and encoded
+// again by ffmpeg. The returned io.ReadCloser must be closed to clean up resources.
+func Mix(limits FFmpegLimits, sources ...io.Reader) (io.ReadCloser, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("no audio to mix")
+	}
+	if len(sources) == 1 {
+		return io.NopCloser(sources[0]), nil
+	}
+
+	frames := make([]FrameReader, len(sources))
+	for i, source := range sources {
+		reader, _, err := NewFrameReader(source)
+		if err != nil {
+			return nil, err
+		}
+		frames[i] = reader
+	}
+
+	cmd := newFFmpegCommand(limits, "ffmpeg", MixArgs(len(sources), limits)...)
+
+	// Every input is written as OGG/Opus to a pipe of its own.
+	var readers []*os.File
+	writers := make([]io.WriteCloser, len(sources))
+	closeAll := func() {
+		for _, r := range readers {
+			r.Close()
+		}
+		for _, w := range writers {
+			if w != nil {
+				w.Close()
+			}
+		}
+	}
+	for i := range sources {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeAll()
+			cmd.cancel()
+			return nil, fmt.Errorf("failed to create pipe: %w", err)
+		}
+		readers = append(readers, r)
+		writers[i] = w
+	}
+	cmd.cmd.Stdin = readers[0]
+	cmd.cmd.ExtraFiles = readers[1:]
+
+	stdout, err := cmd.cmd.StdoutPipe()
+	if err != nil {
+		closeAll()
+		cmd.cancel()
+		return nil, err
+	}
+	if err := cmd.cmd.Start(); err != nil {
+		closeAll()
+		cmd.cancel()
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	// ffmpeg has its own copies of the read ends.
+	for _, r := range readers {
+		r.Close()
+	}
+
+	for i, w := range writers {
+		go func() {
+			// A write fails if ffmpeg exits early, which Close of the output reports.
+			writeOgg(w, frames[i])
+			w.Close()
+		}()
+	}
+
+	return NewEncoder(nil).encodeOgg(&cmdReadCloser{ReadCloser: stdout, cmd: cmd}), nil
+}
@@ -0,0 +1,54 @@
+package opus_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/glizzus/sound-off/internal/opus"
+)
+
+func TestMixArgs(t *testing.T) {
+	args := opus.MixArgs(3, opus.FFmpegLimits{})
+
+	var inputs []string
+	for i, arg := range args {
+		if arg == "-i" {
+			inputs = append(inputs, args[i+1])
+		}
+	}
+	if want := []string{"pipe:0", "pipe:3", "pipe:4"}; !slices.Equal(inputs, want) {
+		t.Errorf("expected inputs %v, got %v", want, inputs)
+	}
+	if !slices.Contains(args, "amix=inputs=3:duration=longest:normalize=0") {
+		t.Errorf("expected the inputs to be mixed, got %v", args)
+	}
+}
+
+func TestMixPipesEveryInput(t *testing.T) {
+	// The fake ffmpeg passes the second input through as it is,
+	// which shows that it was piped to ffmpeg as OGG/Opus.
+	fakeProgram(t, "ffmpeg", "cat >/dev/null & cat <&3; wait")
+
+	first := celtFrames(5)
+	second := celtFrames(300)
+	mixed, err := opus.Mix(
+		opus.FFmpegLimits{},
+		bytes.NewReader(lengthPrefixed(first...)),
+		bytes.NewReader(writeFrames(t, opus.FormatLengthPrefixed, second)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer mixed.Close()
+
+	got, _ := readFrames(t, mixed)
+	if len(got) != len(second) {
+		t.Fatalf("expected %d frames, got %d", len(second), len(got))
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], second[i]) {
+			t.Fatalf("frame %d differs", i)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package opus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jonas747/ogg"
+)
+
+// oggSerial is the serial number of the single logical stream written by OggWriter.
+const oggSerial = 1
+
+// opusHead is the identification header of an OGG/Opus stream (RFC 7845).
+// Stored frames are always encoded as 48 kHz stereo.
+func opusHead() []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1 // version
+	head[9] = 2 // channels
+	binary.LittleEndian.PutUint16(head[10:], 0)
+	binary.LittleEndian.PutUint32(head[12:], 48000)
+	binary.LittleEndian.PutUint16(head[16:], 0) // output gain
+	head[18] = 0                                // channel mapping family
+	return head
+}
+
+// opusTags is the comment header of an OGG/Opus stream, with no comments.
+func opusTags() []byte {
+	const vendor = "sound-off"
+	tags := make([]byte, 0, 8+4+len(vendor)+4)
+	tags = append(tags, "OpusTags"...)
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(vendor)))
+	tags = append(tags, vendor...)
+	return binary.LittleEndian.AppendUint32(tags, 0)
+}
+
+// packetSamples returns the number of 48 kHz samples in an Opus packet,
+// read from its TOC byte (RFC 6716, section 3.1).
+func packetSamples(packet []byte) (int, error) {
+	if len(packet) == 0 {
+		return 0, errors.New("empty opus packet")
+	}
+
+	config := int(packet[0] >> 3)
+	var frameSamples int
+	switch {
+	case config < 12: // SILK: 10, 20, 40 or 60 ms
+		frameSamples = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16: // Hybrid: 10 or 20 ms
+		frameSamples = []int{480, 960}[config%2]
+	default: // CELT: 2.5, 5, 10 or 20 ms
+		frameSamples = []int{120, 240, 480, 960}[config%4]
+	}
+
+	var frames int
+	switch packet[0] & 0x3 {
+	case 0:
+		frames = 1
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, errors.New("opus packet is missing its frame count")
+		}
+		frames = int(packet[1] & 0x3f)
+	}
+	return frames * frameSamples, nil
+}
+
+// oggCRCTable is the lookup table of the CRC-32 that OGG pages are checked with,
+// which uses the polynomial 0x04c11db7 without reflection.
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for range 8 {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// oggMaxSegments is the most lacing values that the segment table of a page holds.
+const oggMaxSegments = 255
+
+// lacing returns the lacing values of a packet of n bytes: one 255
+// for every full segment, then the size of the last, possibly empty, segment.
+func lacing(n int) []byte {
+	values := bytes.Repeat([]byte{255}, n/255)
+	return append(values, byte(n%255))
+}
+
+// OggWriter muxes Opus frames into an OGG/Opus stream (RFC 7845).
+// Frames are packed into as few pages as possible, and the last page
+// marks the end of the stream.
+type OggWriter struct {
+	w        io.Writer
+	sequence uint32
+	granule  int64
+
+	// segments and data are the lacing values and packets of the page being filled.
+	segments []byte
+	data     []byte
+}
+
+// NewOggWriter writes the OpusHead and OpusTags headers to w
+// and returns an OggWriter that writes frames after them.
+func NewOggWriter(w io.Writer) (*OggWriter, error) {
+	o := &OggWriter{w: w}
+	head, tags := opusHead(), opusTags()
+	if err := o.writePage(ogg.BOS, 0, lacing(len(head)), head); err != nil {
+		return nil, fmt.Errorf("failed to write opus header: %w", err)
+	}
+	if err := o.writePage(0, 0, lacing(len(tags)), tags); err != nil {
+		return nil, fmt.Errorf("failed to write opus tags: %w", err)
+	}
+	return o, nil
+}
+
+// WriteFrame adds frame to the current page, writing the page out first
+// if the frame does not fit on it.
+func (o *OggWriter) WriteFrame(frame []byte) error {
+	values := lacing(len(frame))
+	if len(values) > oggMaxSegments {
+		return fmt.Errorf("opus frame of %d bytes is too large for an ogg page", len(frame))
+	}
+	samples, err := packetSamples(frame)
+	if err != nil {
+		return err
+	}
+
+	if len(o.segments)+len(values) > oggMaxSegments {
+		if err := o.flush(0); err != nil {
+			return err
+		}
+	}
+	o.segments = append(o.segments, values...)
+	o.data = append(o.data, frame...)
+	o.granule += int64(samples)
+	return nil
+}
+
+// Close writes the last page, which marks the end of the stream.
+func (o *OggWriter) Close() error {
+	if len(o.segments) == 0 {
+		// A page needs at least one segment, so a stream without frames
+		// ends with an empty packet, which readers skip.
+		o.segments = lacing(0)
+	}
+	return o.flush(ogg.EOS)
+}
+
+func (o *OggWriter) flush(flags byte) error {
+	err := o.writePage(flags, o.granule, o.segments, o.data)
+	o.segments = o.segments[:0]
+	o.data = o.data[:0]
+	if err != nil {
+		return fmt.Errorf("failed to write ogg page: %w", err)
+	}
+	return nil
+}
+
+// writePage writes a page of the stream (RFC 3533, section 6). granule is
+// the number of samples up to the end of the last packet that finishes on the page.
+func (o *OggWriter) writePage(flags byte, granule int64, segments, data []byte) error {
+	page := make([]byte, ogg.HeaderSize, ogg.HeaderSize+len(segments)+len(data))
+	copy(page, oggMagic)
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:], uint64(granule))
+	binary.LittleEndian.PutUint32(page[14:], oggSerial)
+	binary.LittleEndian.PutUint32(page[18:], o.sequence)
+	page[26] = byte(len(segments))
+	page = append(page, segments...)
+	page = append(page, data...)
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(page))
+
+	o.sequence++
+	_, err := o.w.Write(page)
+	return err
+}
+
+// OggReader demuxes the Opus frames of an OGG/Opus stream.
+type OggReader struct {
+	packets *ogg.PacketDecoder
+
+	// first is the first frame of the stream, which is read ahead
+	// to find out how long the frames are.
+	first         []byte
+	frameDuration time.Duration
+}
+
+// NewOggReader reads the headers of the OGG/Opus stream in r
+// and returns an OggReader for its frames.
+func NewOggReader(r io.Reader) (*OggReader, error) {
+	packets := ogg.NewPacketDecoder(ogg.NewDecoder(r))
+
+	head, _, err := packets.Decode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read opus header: %w", err)
+	}
+	if !bytes.HasPrefix(head, []byte("OpusHead")) {
+		return nil, errors.New("ogg stream does not contain opus audio")
+	}
+	if _, _, err := packets.Decode(); err != nil {
+		return nil, fmt.Errorf("failed to read opus tags: %w", err)
+	}
+
+	o := &OggReader{packets: packets, frameDuration: StoredFrameDuration}
+	o.first, err = o.next()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	samples, err := packetSamples(o.first)
+	if err != nil {
+		return nil, err
+	}
+	o.frameDuration = time.Duration(samples) * time.Second / StoredSampleRate
+	return o, nil
+}
+
+// Header describes the frames of the stream. Opus is always decoded at 48 kHz.
+func (o *OggReader) Header() Header {
+	return Header{
+		Format:        FormatOgg,
+		Version:       HeaderVersion,
+		FrameDuration: o.frameDuration,
+		SampleRate:    StoredSampleRate,
+	}
+}
+
+// ReadFrame reads and returns the next raw Opus frame.
+// Returns io.EOF when there are no more frames.
+func (o *OggReader) ReadFrame() ([]byte, error) {
+	if o.first != nil {
+		frame := o.first
+		o.first = nil
+		return frame, nil
+	}
+	return o.next()
+}
+
+// next returns the next packet of the stream, skipping empty packets.
+func (o *OggReader) next() ([]byte, error) {
+	for {
+		packet, _, err := o.packets.Decode()
+		if err != nil {
+			return nil, err
+		}
+		if len(packet) > 0 {
+			return packet, nil
+		}
+	}
+}
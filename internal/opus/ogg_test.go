@@ -0,0 +1,180 @@
+package opus_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/glizzus/sound-off/internal/opus"
+	"github.com/jonas747/ogg"
+)
+
+func lengthPrefixed(frames ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, frame := range frames {
+		_ = binary.Write(&buf, binary.LittleEndian, uint16(len(frame)))
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+// celtFrames returns n 20 ms CELT frames of different sizes, some of which
+// take more than one segment of an OGG page.
+func celtFrames(n int) [][]byte {
+	frames := make([][]byte, n)
+	for i := range frames {
+		frame := make([]byte, 1+i%400)
+		frame[0] = 0xfc
+		for j := 1; j < len(frame); j++ {
+			frame[j] = byte(i + j)
+		}
+		frames[i] = frame
+	}
+	return frames
+}
+
+func writeFrames(t *testing.T, format opus.Format, frames [][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := opus.NewFrameWriter(&buf, format)
+	if err != nil {
+		t.Fatalf("failed to create frame writer: %v", err)
+	}
+	for _, frame := range frames {
+		if err := w.WriteFrame(frame); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close frame writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func readFrames(t *testing.T, r io.Reader) ([][]byte, opus.Header) {
+	t.Helper()
+	reader, header, err := opus.NewFrameReader(r)
+	if err != nil {
+		t.Fatalf("failed to create frame reader: %v", err)
+	}
+	var frames [][]byte
+	for {
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return frames, header
+		}
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func TestOggRoundTrip(t *testing.T) {
+	frames := celtFrames(600)
+	stream := writeFrames(t, opus.FormatOgg, frames)
+
+	got, header := readFrames(t, bytes.NewReader(stream))
+	if !slices.EqualFunc(got, frames, bytes.Equal) {
+		t.Errorf("round trip gave %d frames that differ from the %d written", len(got), len(frames))
+	}
+	want := opus.Header{
+		Format:        opus.FormatOgg,
+		Version:       opus.HeaderVersion,
+		FrameDuration: opus.StoredFrameDuration,
+		SampleRate:    opus.StoredSampleRate,
+	}
+	if header != want {
+		t.Errorf("header = %+v, want %+v", header, want)
+	}
+}
+
+func TestOggWriterPages(t *testing.T) {
+	frames := celtFrames(600)
+	decoder := ogg.NewDecoder(bytes.NewReader(writeFrames(t, opus.FormatOgg, frames)))
+
+	var pages []ogg.Page
+	for {
+		page, err := decoder.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to decode page %d: %v", len(pages), err)
+		}
+		pages = append(pages, page)
+	}
+
+	// The headers each take a page, and frames are packed into the rest.
+	if len(pages) < 4 || len(pages) > 2+len(frames)/100 {
+		t.Fatalf("expected frames to be packed into a few pages, got %d pages", len(pages))
+	}
+	if pages[0].Type != ogg.BOS {
+		t.Errorf("expected the first page to begin the stream, got type %d", pages[0].Type)
+	}
+	last := pages[len(pages)-1]
+	if last.Type != ogg.EOS {
+		t.Errorf("expected the last page to end the stream, got type %d", last.Type)
+	}
+	if want := int64(len(frames) * 960); last.Granule != want {
+		t.Errorf("expected the last page to end at sample %d, got %d", want, last.Granule)
+	}
+}
+
+func TestOggWriterWithoutFrames(t *testing.T) {
+	got, _ := readFrames(t, bytes.NewReader(writeFrames(t, opus.FormatOgg, nil)))
+	if len(got) != 0 {
+		t.Errorf("expected no frames, got %v", got)
+	}
+}
+
+func TestEncoderWritesFormat(t *testing.T) {
+	// TOC bytes for a 20 ms CELT frame, and for a packet of two 10 ms SILK frames.
+	frames := [][]byte{
+		{0xfc, 0x01, 0x02, 0x03},
+		{0x09, 0x04, 0x05},
+		{0xfc, 0x06},
+	}
+	passthrough := func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(r), nil
+	}
+
+	for _, format := range []opus.Format{opus.FormatLengthPrefixed, opus.FormatOgg} {
+		t.Run(format.String(), func(t *testing.T) {
+			encoder := &opus.Encoder{Transcode: passthrough, Format: format}
+			encoded, err := encoder.Encode(bytes.NewReader(writeFrames(t, opus.FormatOgg, frames)))
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			defer encoded.Close()
+
+			got, header := readFrames(t, encoded)
+			if !slices.EqualFunc(got, frames, bytes.Equal) {
+				t.Errorf("encoding gave %v, want %v", got, frames)
+			}
+			if header.Format != format || header.Version != opus.HeaderVersion {
+				t.Errorf("expected the current %s header, got %+v", format, header)
+			}
+		})
+	}
+}
+
+func TestAdjustVolumeLeavesFullVolumeUntouched(t *testing.T) {
+	frames := lengthPrefixed([]byte{0xfc, 0x01})
+	adjusted, err := opus.AdjustVolume(bytes.NewReader(frames), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer adjusted.Close()
+
+	got, err := io.ReadAll(adjusted)
+	if err != nil {
+		t.Fatalf("failed to read frames: %v", err)
+	}
+	if !bytes.Equal(got, frames) {
+		t.Errorf("expected frames to be passed through, got %v", got)
+	}
+}
@@ -0,0 +1,129 @@
+package opus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jonas747/ogg"
+)
+
+// NewTranscode returns the TranscodeFunc for audio that is processed as described
+// by opts. Audio that opts do not change is passed through without ffmpeg when it
+// is already OGG/Opus that can be stored as it is.
+func NewTranscode(opts FFmpegOptions) TranscodeFunc {
+	transcode := NewFFmpegTranscode(opts)
+	if opts.changesAudio() {
+		return transcode
+	}
+	return NewOggPassthrough(transcode)
+}
+
+// NewOggPassthrough returns a TranscodeFunc that passes OGG/Opus audio through as it is,
+// so that Encode only demuxes its frames. Audio is only transcoded by fallback if it is
+// not OGG/Opus, or if its frames can not be stored as they are. Audio that starts with
+// an OGG/Opus page is read into memory to decide; other audio is streamed to fallback.
+func NewOggPassthrough(fallback TranscodeFunc) TranscodeFunc {
+	return func(r io.Reader) (io.ReadCloser, error) {
+		br := bufio.NewReader(r)
+		if !startsWithOpusHead(br) {
+			return fallback(br)
+		}
+		audio, err := io.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audio: %w", err)
+		}
+		if CheckOggPassthrough(bytes.NewReader(audio)) == nil {
+			return io.NopCloser(bytes.NewReader(audio)), nil
+		}
+		return fallback(bytes.NewReader(audio))
+	}
+}
+
+// startsWithOpusHead reports whether the first OGG page in r holds the
+// identification header of an Opus stream, without reading past it.
+func startsWithOpusHead(r *bufio.Reader) bool {
+	// An OGG page header is 27 bytes, the last of which counts the segments
+	// of its table, which is followed by the first packet.
+	header, err := r.Peek(27)
+	if err != nil || !bytes.HasPrefix(header, []byte("OggS")) {
+		return false
+	}
+	start := 27 + int(header[26])
+	page, err := r.Peek(start + len("OpusHead"))
+	return err == nil && bytes.HasPrefix(page[start:], []byte("OpusHead"))
+}
+
+// CheckOggPassthrough returns an error if the audio in r is not a single OGG/Opus
+// stream whose frames can be stored without transcoding: mono or stereo 20 ms frames
+// without an output gain. The pre-skip of the stream can not be applied to whole
+// frames, so audio that is passed through starts with the few milliseconds of
+// encoder priming that a decoder would drop, typically 6.5 ms of near silence.
+func CheckOggPassthrough(r io.Reader) error {
+	packets := ogg.NewPacketDecoder(ogg.NewDecoder(r))
+
+	var serial uint32
+	frames := 0
+	for i := 0; ; i++ {
+		packet, page, err := packets.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read ogg stream: %w", err)
+		}
+		if i == 0 {
+			serial = page.Serial
+		} else if page.Data != nil && page.Serial != serial {
+			return errors.New("ogg stream contains more than one logical stream")
+		}
+
+		switch {
+		case i == 0:
+			if err := checkOpusHead(packet); err != nil {
+				return err
+			}
+		case i == 1:
+			if !bytes.HasPrefix(packet, []byte("OpusTags")) {
+				return errors.New("ogg stream is missing opus tags")
+			}
+		case len(packet) > 0:
+			samples, err := packetSamples(packet)
+			if err != nil {
+				return err
+			}
+			if samples != int(StoredFrameDuration.Seconds()*StoredSampleRate) {
+				return fmt.Errorf("opus frame %d has %d samples instead of 20 ms", frames, samples)
+			}
+			frames++
+		}
+	}
+
+	if frames == 0 {
+		return errors.New("ogg stream has no opus frames")
+	}
+	return nil
+}
+
+// checkOpusHead checks the identification header of an OGG/Opus stream (RFC 7845, section 5.1).
+func checkOpusHead(head []byte) error {
+	if len(head) < 19 || !bytes.HasPrefix(head, []byte("OpusHead")) {
+		return errors.New("ogg stream does not contain opus audio")
+	}
+	if version := head[8]; version>>4 != 0 {
+		return fmt.Errorf("unsupported opus header version %d", version)
+	}
+	if channels := head[9]; channels != 1 && channels != 2 {
+		return fmt.Errorf("opus stream has %d channels", channels)
+	}
+	if gain := binary.LittleEndian.Uint16(head[16:]); gain != 0 {
+		return errors.New("opus stream has an output gain")
+	}
+	if family := head[18]; family != 0 {
+		return fmt.Errorf("unsupported opus channel mapping family %d", family)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package opus_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/glizzus/sound-off/internal/opus"
+)
+
+func TestOggPassthrough(t *testing.T) {
+	tc := []struct {
+		name        string
+		input       []byte
+		passthrough bool
+	}{
+		{
+			name:        "OGG/Opus with 20 ms frames is passed through",
+			input:       writeFrames(t, opus.FormatOgg, celtFrames(100)),
+			passthrough: true,
+		},
+		{
+			name:  "Audio that is not OGG is transcoded",
+			input: []byte("ID3 mp3 audio"),
+		},
+		{
+			name: "OGG/Opus with 40 ms frames is transcoded",
+			// A packet of two 20 ms SILK frames.
+			input: writeFrames(t, opus.FormatOgg, [][]byte{{0x09, 0x01}}),
+		},
+		{
+			name:  "OGG/Opus without frames is transcoded",
+			input: writeFrames(t, opus.FormatOgg, nil),
+		},
+		{
+			name:  "Audio that is shorter than an OGG page is transcoded",
+			input: []byte("OggS"),
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			fellBack := false
+			transcode := opus.NewOggPassthrough(func(r io.Reader) (io.ReadCloser, error) {
+				fellBack = true
+				return io.NopCloser(r), nil
+			})
+
+			out, err := transcode(bytes.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer out.Close()
+
+			got, err := io.ReadAll(out)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if !bytes.Equal(got, test.input) {
+				t.Errorf("expected the audio to reach the output unchanged")
+			}
+			if fellBack == test.passthrough {
+				t.Errorf("expected passthrough %v, but fallback was used: %v", test.passthrough, fellBack)
+			}
+		})
+	}
+}
+
+func TestOggPassthroughStreamsOtherAudio(t *testing.T) {
+	// Audio that is not OGG is handed to the fallback before it is read whole,
+	// so a read error past its start is left for the fallback to meet.
+	errUnread := errors.New("audio was read past its start")
+	input := io.MultiReader(bytes.NewReader([]byte("ID3 mp3 audio")), iotest.ErrReader(errUnread))
+
+	fellBack := false
+	transcode := opus.NewOggPassthrough(func(r io.Reader) (io.ReadCloser, error) {
+		fellBack = true
+		return io.NopCloser(r), nil
+	})
+	out, err := transcode(input)
+	if err != nil {
+		t.Fatalf("expected the audio to be streamed to the fallback, got %v", err)
+	}
+	defer out.Close()
+	if !fellBack {
+		t.Fatal("expected audio that is not OGG to be transcoded")
+	}
+	if _, err := io.ReadAll(out); !errors.Is(err, errUnread) {
+		t.Errorf("expected the fallback to read the rest of the audio, got %v", err)
+	}
+}
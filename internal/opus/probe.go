@@ -0,0 +1,93 @@
+package opus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Metadata describes the audio stream of an uploaded file.
+type Metadata struct {
+	Duration time.Duration
+	Channels int
+	Codec    string
+}
+
+// ProbeFunc reads audio from r and returns its Metadata.
+type ProbeFunc func(r io.Reader) (Metadata, error)
+
+// FFprobe is the default ProbeFunc that shells out to ffprobe without limits.
+func FFprobe(r io.Reader) (Metadata, error) {
+	return ffprobe(r, FFmpegLimits{})
+}
+
+// NewFFprobe returns a ProbeFunc that shells out to ffprobe within limits.
+func NewFFprobe(limits FFmpegLimits) ProbeFunc {
+	return func(r io.Reader) (Metadata, error) {
+		return ffprobe(r, limits)
+	}
+}
+
+// ffprobe spools the audio to a temporary file first, because many containers
+// only report their duration when ffprobe is able to seek.
+func ffprobe(r io.Reader, limits FFmpegLimits) (Metadata, error) {
+	f, err := os.CreateTemp("", "soundoff-probe-*")
+	if err != nil {
+		return Metadata{}, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return Metadata{}, fmt.Errorf("failed to spool audio: %w", err)
+	}
+
+	cmd := newFFmpegCommand(limits, "ffprobe",
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=codec_name,channels:format=duration",
+		"-of", "json",
+		f.Name(),
+	)
+	var out bytes.Buffer
+	cmd.cmd.Stdout = &out
+	if err := cmd.run(); err != nil {
+		return Metadata{}, err
+	}
+	return ParseFFprobeOutput(out.Bytes())
+}
+
+// ParseFFprobeOutput parses the JSON written by ffprobe for the entries
+// requested by FFprobe. Input without an audio stream is rejected.
+func ParseFFprobeOutput(out []byte) (Metadata, error) {
+	var probe struct {
+		Streams []struct {
+			CodecName string `json:"codec_name"`
+			Channels  int    `json:"channels"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return Metadata{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return Metadata{}, fmt.Errorf("%w found", ErrNoAudioStream)
+	}
+
+	seconds, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("invalid duration %q: %w", probe.Format.Duration, err)
+	}
+
+	return Metadata{
+		Duration: time.Duration(seconds * float64(time.Second)),
+		Channels: probe.Streams[0].Channels,
+		Codec:    probe.Streams[0].CodecName,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package opus_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/opus"
+)
+
+func TestParseFFprobeOutput(t *testing.T) {
+	tc := []struct {
+		name    string
+		output  string
+		want    opus.Metadata
+		wantErr bool
+	}{
+		{
+			name:   "Audio stream",
+			output: `{"streams": [{"codec_name": "mp3", "channels": 2}], "format": {"duration": "3.500000"}}`,
+			want:   opus.Metadata{Duration: 3500 * time.Millisecond, Channels: 2, Codec: "mp3"},
+		},
+		{
+			name:    "No audio stream",
+			output:  `{"streams": [], "format": {"duration": "3.500000"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "Unknown duration",
+			output:  `{"streams": [{"codec_name": "opus", "channels": 1}], "format": {}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := opus.ParseFFprobeOutput([]byte(testCase.output))
+			if testCase.wantErr {
+				if err == nil {
+					t.Errorf("expected error but got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != testCase.want {
+				t.Errorf("ParseFFprobeOutput() = %+v, want %+v", got, testCase.want)
+			}
+		})
+	}
+}
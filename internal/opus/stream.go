@@ -1,6 +1,7 @@
 package opus
 
 import (
+	"context"
 	"errors"
 	"io"
 	"time"
@@ -11,9 +12,9 @@ import (
 var ErrVoiceConnClosed = errors.New("voice connection send timeout")
 
 // StreamToVoice reads Opus frames from source and sends them to the Discord
-// voice connection. It blocks until all frames are sent or an error occurs.
+// voice connection. It blocks until all frames are sent, ctx is done or an error occurs.
 // Returns nil on clean EOF.
-func StreamToVoice(source *FrameReader, vc *discordgo.VoiceConnection) error {
+func StreamToVoice(ctx context.Context, source FrameReader, vc *discordgo.VoiceConnection) error {
 	timer := time.NewTimer(time.Minute)
 	defer timer.Stop()
 
@@ -31,6 +32,8 @@ func StreamToVoice(source *FrameReader, vc *discordgo.VoiceConnection) error {
 		case vc.OpusSend <- frame:
 		case <-timer.C:
 			return ErrVoiceConnClosed
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
@@ -0,0 +1,45 @@
+package opus
+
+import (
+	"io"
+)
+
+// AdjustVolume scales the loudness of the stored frames read from source
+// by volume, where 1 leaves it unchanged, and returns them as length-prefixed frames.
+// Opus frames can not be scaled directly, so they are decoded and encoded again by ffmpeg.
+// The returned io.ReadCloser must be closed to clean up resources.
+func AdjustVolume(source io.Reader, volume float64) (io.ReadCloser, error) {
+	if volume == 1 {
+		return io.NopCloser(source), nil
+	}
+
+	frames, _, err := NewFrameReader(source)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeOgg(pw, frames))
+	}()
+
+	encoded, err := NewEncoder(NewFFmpegTranscode(FFmpegOptions{Volume: volume})).Encode(pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// writeOgg writes the frames read from source to w as an OGG/Opus stream,
+// which can be read by ffmpeg.
+func writeOgg(w io.Writer, source FrameReader) error {
+	oggFrames, err := NewOggWriter(w)
+	if err != nil {
+		return err
+	}
+	if _, err := CopyFrames(oggFrames, source); err != nil {
+		return err
+	}
+	return oggFrames.Close()
+}
@@ -0,0 +1,44 @@
+package presenters
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+// FormatBytes formats a byte count as megabytes with two decimal places,
+// which is the unit that quotas are configured in.
+func FormatBytes(n int64) string {
+	return fmt.Sprintf("%.2f MB", float64(n)/(1024*1024))
+}
+
+// StorageUsed sums the storage used by the given soundcrons.
+func StorageUsed(soundCrons []repository.SoundCron) int64 {
+	var used int64
+	for _, sc := range soundCrons {
+		used += sc.StorageSize()
+	}
+	return used
+}
+
+// QuotaResponse shows how much of its storage quota a guild is using,
+// and how long its soundcrons may be. It is only shown to the user who asked.
+func QuotaResponse(soundCrons []repository.SoundCron, settings repository.GuildSettings) *discordgo.InteractionResponse {
+	used := StorageUsed(soundCrons)
+	content := fmt.Sprintf(
+		"This server is using %s of its %s storage quota across %d soundcron(s). "+
+			"Soundcrons may be up to %s long.",
+		FormatBytes(used),
+		FormatBytes(settings.StorageQuota),
+		len(soundCrons),
+		settings.MaxDuration,
+	)
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	}
+}
@@ -0,0 +1,24 @@
+package presenters_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/presenters"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+func TestQuotaResponse(t *testing.T) {
+	soundCrons := []repository.SoundCron{
+		{Name: "Bell", FileSize: 1024 * 1024},
+		{Name: "Horn", FileSize: 512 * 1024},
+	}
+	settings := repository.GuildSettings{GuildID: "guild", StorageQuota: 20 * 1024 * 1024, MaxDuration: 90 * time.Second}
+
+	got := presenters.QuotaResponse(soundCrons, settings).Data.Content
+	want := "This server is using 1.50 MB of its 20.00 MB storage quota across 2 soundcron(s). " +
+		"Soundcrons may be up to 1m30s long."
+	if got != want {
+		t.Errorf("QuotaResponse() content = %q, want %q", got, want)
+	}
+}
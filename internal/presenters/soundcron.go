@@ -1,8 +1,12 @@
 package presenters
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/bwmarrin/discordgo"
 	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/util"
 )
 
 var noSoundCronFoundResponse = &discordgo.InteractionResponse{
@@ -23,8 +27,20 @@ func splitSoundCronsForList(soundCrons []repository.SoundCron) (buttons []reposi
 	return buttons, menu
 }
 
+// soundCronLabel is the name of a soundcron as shown in the list.
+// Soundcrons that are not ready to play are marked as such.
+func soundCronLabel(sc repository.SoundCron) string {
+	switch sc.Status {
+	case repository.SoundCronStatusPending:
+		return sc.Name + " (processing)"
+	case repository.SoundCronStatusFailed:
+		return sc.Name + " (failed)"
+	}
+	return sc.Name
+}
+
 func soundCronToButton(sc repository.SoundCron, instanceID string) discordgo.Button {
-	label := sc.Name
+	label := soundCronLabel(sc)
 	return discordgo.Button{
 		Label:    label,
 		Style:    discordgo.SecondaryButton,
@@ -34,7 +50,7 @@ func soundCronToButton(sc repository.SoundCron, instanceID string) discordgo.But
 
 func soundCronToSelectMenuOption(sc repository.SoundCron) discordgo.SelectMenuOption {
 	return discordgo.SelectMenuOption{
-		Label: sc.Name,
+		Label: soundCronLabel(sc),
 		Value: sc.ID,
 	}
 }
@@ -43,7 +59,7 @@ var soundCronSelectMinValues = 1
 
 const ComponentIDSoundCronSelect = "soundcron_select_menu"
 
-func buildSoundCronSelectMenu(soundCrons []repository.SoundCron, instanceID string) *discordgo.InteractionResponse {
+func buildSoundCronSelectMenu(soundCrons []repository.SoundCron, quota int64, instanceID string) *discordgo.InteractionResponse {
 	firstFour, rest := splitSoundCronsForList(soundCrons)
 
 	rows := make([]discordgo.MessageComponent, 0, len(firstFour)+1)
@@ -77,7 +93,7 @@ func buildSoundCronSelectMenu(soundCrons []repository.SoundCron, instanceID stri
 	return &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content:    "Current SoundCrons",
+			Content:    fmt.Sprintf("Current SoundCrons (%s of %s used)", FormatBytes(StorageUsed(soundCrons)), FormatBytes(quota)),
 			Components: rows,
 		},
 	}
@@ -86,12 +102,13 @@ func buildSoundCronSelectMenu(soundCrons []repository.SoundCron, instanceID stri
 // BuildListSoundCronsResponse builds the response for listing soundcrons.
 // This response is structured to where the first 4 rows are a button representing the
 // first 4 soundcrons, and the rest are in a select menu.
-func BuildListSoundCronsResponse(soundCrons []repository.SoundCron, instanceID string) *discordgo.InteractionResponse {
+// The storage used by the soundcrons is shown against the guild's quota.
+func BuildListSoundCronsResponse(soundCrons []repository.SoundCron, quota int64, instanceID string) *discordgo.InteractionResponse {
 	if len(soundCrons) == 0 {
 		return noSoundCronFoundResponse
 	}
 
-	return buildSoundCronSelectMenu(soundCrons, instanceID)
+	return buildSoundCronSelectMenu(soundCrons, quota, instanceID)
 }
 
 const (
@@ -126,3 +143,108 @@ func SoundCronListActionsMenu(instanceID, name string) *discordgo.InteractionRes
 	}
 	return response
 }
+
+const (
+	ModalIDSoundCronEdit = "soundcron_edit_modal"
+
+	TextInputIDSoundCronName     = "soundcron_name"
+	TextInputIDSoundCronCron     = "soundcron_cron"
+	TextInputIDSoundCronTimezone = "soundcron_timezone"
+	TextInputIDSoundCronClip     = "soundcron_clip"
+	TextInputIDSoundCronFades    = "soundcron_fades"
+)
+
+// ClipSeparator separates the start and end of a clip in the edit modal,
+// and FadeSeparator the fade in and fade out.
+const (
+	ClipSeparator = "-"
+	FadeSeparator = ","
+)
+
+func textInputRow(input discordgo.TextInput) discordgo.ActionsRow {
+	return discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{input},
+	}
+}
+
+// clipValue formats a clip for the edit modal, like "1:23.5 - 1:28.5".
+// A clip that starts at the beginning and plays to the end is left empty,
+// as is the end of a clip that plays to the end.
+func clipValue(clip repository.Clip) string {
+	if clip.IsZero() {
+		return ""
+	}
+	if clip.End == 0 {
+		return util.FormatTimestamp(clip.Start)
+	}
+	return util.FormatTimestamp(clip.Start) + " " + ClipSeparator + " " + util.FormatTimestamp(clip.End)
+}
+
+// fadesValue formats the fades of a soundcron for the edit modal in seconds, like "0.5, 1".
+func fadesValue(fadeIn, fadeOut time.Duration) string {
+	if fadeIn == 0 && fadeOut == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%g%s %g", fadeIn.Seconds(), FadeSeparator, fadeOut.Seconds())
+}
+
+// SoundCronEditModal builds the modal that is shown when the user chooses to edit a soundcron.
+// The inputs are prefilled with the current values of the soundcron.
+func SoundCronEditModal(instanceID string, sc repository.SoundCron) *discordgo.InteractionResponse {
+	timezone := sc.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: ModalIDSoundCronEdit + ":" + instanceID,
+			Title:    "Edit SoundCron",
+			Components: []discordgo.MessageComponent{
+				textInputRow(discordgo.TextInput{
+					CustomID:  TextInputIDSoundCronName,
+					Label:     "Name",
+					Style:     discordgo.TextInputShort,
+					Value:     sc.Name,
+					Required:  true,
+					MaxLength: 100,
+				}),
+				textInputRow(discordgo.TextInput{
+					CustomID:  TextInputIDSoundCronCron,
+					Label:     "Cron Expression",
+					Style:     discordgo.TextInputShort,
+					Value:     sc.Cron,
+					Required:  true,
+					MaxLength: 100,
+				}),
+				textInputRow(discordgo.TextInput{
+					CustomID:  TextInputIDSoundCronTimezone,
+					Label:     "Timezone",
+					Style:     discordgo.TextInputShort,
+					Value:     timezone,
+					Required:  true,
+					MaxLength: 64,
+				}),
+				textInputRow(discordgo.TextInput{
+					CustomID:    TextInputIDSoundCronClip,
+					Label:       "Clip (Start - End)",
+					Style:       discordgo.TextInputShort,
+					Placeholder: "Whole audio, or like 1:23.5 - 1:28.5",
+					Value:       clipValue(sc.Clip),
+					Required:    false,
+					MaxLength:   32,
+				}),
+				textInputRow(discordgo.TextInput{
+					CustomID:    TextInputIDSoundCronFades,
+					Label:       "Fade In, Fade Out (Seconds)",
+					Style:       discordgo.TextInputShort,
+					Placeholder: "No fades, or like 0.5, 1",
+					Value:       fadesValue(sc.FadeIn, sc.FadeOut),
+					Required:    false,
+					MaxLength:   16,
+				}),
+			},
+		},
+	}
+}
@@ -2,6 +2,7 @@ package presenters_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/glizzus/sound-off/internal/presenters"
@@ -29,8 +30,10 @@ func TestBuildListSoundCronsResponse(t *testing.T) {
 			name: "any soundcrons",
 			input: []repository.SoundCron{
 				{
-					ID:   "test-sc-1",
-					Name: "Test SoundCron 1",
+					ID:          "test-sc-1",
+					Name:        "Test SoundCron 1",
+					FileSize:    1024 * 1024,
+					EncodedSize: 512 * 1024,
 				},
 				{
 					ID:   "test-sc-2",
@@ -40,7 +43,7 @@ func TestBuildListSoundCronsResponse(t *testing.T) {
 			want: &discordgo.InteractionResponse{
 				Type: discordgo.InteractionResponseChannelMessageWithSource,
 				Data: &discordgo.InteractionResponseData{
-					Content: "Current SoundCrons",
+					Content: "Current SoundCrons (1.50 MB of 10.00 MB used)",
 					Components: []discordgo.MessageComponent{
 						discordgo.ActionsRow{
 							Components: []discordgo.MessageComponent{
@@ -96,7 +99,7 @@ func TestBuildListSoundCronsResponse(t *testing.T) {
 			want: &discordgo.InteractionResponse{
 				Type: discordgo.InteractionResponseChannelMessageWithSource,
 				Data: &discordgo.InteractionResponseData{
-					Content: "Current SoundCrons",
+					Content: "Current SoundCrons (0.00 MB of 10.00 MB used)",
 					Components: []discordgo.MessageComponent{
 						discordgo.ActionsRow{
 							Components: []discordgo.MessageComponent{
@@ -157,7 +160,7 @@ func TestBuildListSoundCronsResponse(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := presenters.BuildListSoundCronsResponse(tt.input, "random-instance-id")
+			got := presenters.BuildListSoundCronsResponse(tt.input, repository.DefaultStorageQuota, "random-instance-id")
 			diff := cmp.Diff(got, tt.want)
 			if diff != "" {
 				t.Errorf("BuildListSoundCronsResponse() mismatch (-want +got):\n%s", diff)
@@ -212,3 +215,138 @@ func TestSoundCronListActionsMenu(t *testing.T) {
 		})
 	}
 }
+
+func TestSoundCronEditModal(t *testing.T) {
+	tests := []struct {
+		name  string
+		input repository.SoundCron
+		want  *discordgo.InteractionResponse
+	}{
+		{
+			name: "soundcron without timezone defaults to UTC",
+			input: repository.SoundCron{
+				ID:   "test-sc-1",
+				Name: "Test SoundCron 1",
+				Cron: "0 * * * *",
+			},
+			want: &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseModal,
+				Data: &discordgo.InteractionResponseData{
+					CustomID: "soundcron_edit_modal:random-instance-id",
+					Title:    "Edit SoundCron",
+					Components: []discordgo.MessageComponent{
+						discordgo.ActionsRow{
+							Components: []discordgo.MessageComponent{
+								discordgo.TextInput{
+									CustomID:  "soundcron_name",
+									Label:     "Name",
+									Style:     discordgo.TextInputShort,
+									Value:     "Test SoundCron 1",
+									Required:  true,
+									MaxLength: 100,
+								},
+							},
+						},
+						discordgo.ActionsRow{
+							Components: []discordgo.MessageComponent{
+								discordgo.TextInput{
+									CustomID:  "soundcron_cron",
+									Label:     "Cron Expression",
+									Style:     discordgo.TextInputShort,
+									Value:     "0 * * * *",
+									Required:  true,
+									MaxLength: 100,
+								},
+							},
+						},
+						discordgo.ActionsRow{
+							Components: []discordgo.MessageComponent{
+								discordgo.TextInput{
+									CustomID:  "soundcron_timezone",
+									Label:     "Timezone",
+									Style:     discordgo.TextInputShort,
+									Value:     "UTC",
+									Required:  true,
+									MaxLength: 64,
+								},
+							},
+						},
+						discordgo.ActionsRow{
+							Components: []discordgo.MessageComponent{
+								discordgo.TextInput{
+									CustomID:    "soundcron_clip",
+									Label:       "Clip (Start - End)",
+									Style:       discordgo.TextInputShort,
+									Placeholder: "Whole audio, or like 1:23.5 - 1:28.5",
+									MaxLength:   32,
+								},
+							},
+						},
+						discordgo.ActionsRow{
+							Components: []discordgo.MessageComponent{
+								discordgo.TextInput{
+									CustomID:    "soundcron_fades",
+									Label:       "Fade In, Fade Out (Seconds)",
+									Style:       discordgo.TextInputShort,
+									Placeholder: "No fades, or like 0.5, 1",
+									MaxLength:   16,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := presenters.SoundCronEditModal("random-instance-id", tt.input)
+			diff := cmp.Diff(got, tt.want)
+			if diff != "" {
+				t.Errorf("SoundCronEditModal() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBuildListSoundCronsResponseMarksStatus(t *testing.T) {
+	input := []repository.SoundCron{
+		{ID: "test-sc-1", Name: "Ready", Status: repository.SoundCronStatusReady},
+		{ID: "test-sc-2", Name: "Pending", Status: repository.SoundCronStatusPending},
+		{ID: "test-sc-3", Name: "Failed", Status: repository.SoundCronStatusFailed},
+	}
+	wantLabels := []string{"Ready", "Pending (processing)", "Failed (failed)"}
+
+	got := presenters.BuildListSoundCronsResponse(input, repository.DefaultStorageQuota, "random-instance-id")
+	for i, want := range wantLabels {
+		row := got.Data.Components[i].(discordgo.ActionsRow)
+		button := row.Components[0].(discordgo.Button)
+		if button.Label != want {
+			t.Errorf("label of row %d = %q, want %q", i, button.Label, want)
+		}
+	}
+}
+
+func TestSoundCronEditModalPrefillsClip(t *testing.T) {
+	sc := repository.SoundCron{
+		ID:      "test-sc-1",
+		Name:    "Drop",
+		Cron:    "0 * * * *",
+		Clip:    repository.Clip{Start: 83500 * time.Millisecond, End: 88500 * time.Millisecond},
+		FadeIn:  500 * time.Millisecond,
+		FadeOut: time.Second,
+	}
+
+	got := presenters.SoundCronEditModal("random-instance-id", sc)
+	values := map[string]string{}
+	for _, component := range got.Data.Components {
+		input := component.(discordgo.ActionsRow).Components[0].(discordgo.TextInput)
+		values[input.CustomID] = input.Value
+	}
+	if values["soundcron_clip"] != "1:23.5 - 1:28.5" {
+		t.Errorf("expected the clip to be prefilled, got %q", values["soundcron_clip"])
+	}
+	if values["soundcron_fades"] != "0.5, 1" {
+		t.Errorf("expected the fades to be prefilled, got %q", values["soundcron_fades"])
+	}
+}
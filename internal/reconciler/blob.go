@@ -0,0 +1,122 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+// DefaultMinAge is how old an orphaned object must be before it is removed.
+// Adds save the pending soundcron row before they upload its audio, so most
+// objects have a row as soon as they exist. Younger objects without one may
+// still be in use, such as the staged audio of a replacement that is being
+// encoded while its soundcron is deleted, or an upload whose row failed to save.
+const DefaultMinAge = time.Hour
+
+// BlobStorage is the blob storage that the reconciler cleans up.
+type BlobStorage interface {
+	datalayer.BlobLister
+	Delete(ctx context.Context, key string) error
+}
+
+// BlobReconciler removes soundcron audio from blob storage
+// that no longer belongs to a soundcron in the database.
+type BlobReconciler struct {
+	Blobs      BlobStorage
+	SoundCrons repository.SoundCronIDLister
+
+	// MinAge is how long an object must have existed before it can be removed.
+	MinAge time.Duration
+
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewBlobReconciler constructs a BlobReconciler with DefaultMinAge.
+func NewBlobReconciler(blobs BlobStorage, soundCrons repository.SoundCronIDLister) *BlobReconciler {
+	return &BlobReconciler{
+		Blobs:      blobs,
+		SoundCrons: soundCrons,
+		MinAge:     DefaultMinAge,
+		Now:        time.Now,
+	}
+}
+
+// Reconcile performs a single pass over blob storage and returns the keys
+// of the objects that were removed.
+func (r *BlobReconciler) Reconcile(ctx context.Context) ([]string, error) {
+	// List the objects before the soundcrons. An object that is created after
+	// this point is not considered, and a soundcron that is committed after it
+	// only has objects that are younger than MinAge.
+	blobs, err := r.Blobs.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+
+	ids, err := r.SoundCrons.ListIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list soundcron IDs: %w", err)
+	}
+	known := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		known[id] = struct{}{}
+	}
+
+	now := time.Now
+	if r.Now != nil {
+		now = r.Now
+	}
+	cutoff := now().Add(-r.MinAge)
+
+	var (
+		deleted []string
+		errs    []error
+	)
+	for _, blob := range blobs {
+		id, ok := datalayer.SoundCronIDFromKey(blob.Key)
+		if !ok {
+			continue
+		}
+		if _, exists := known[id]; exists {
+			continue
+		}
+		if blob.LastModified.After(cutoff) {
+			continue
+		}
+
+		if err := r.Blobs.Delete(ctx, blob.Key); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %w", blob.Key, err))
+			continue
+		}
+		deleted = append(deleted, blob.Key)
+	}
+
+	return deleted, errors.Join(errs...)
+}
+
+// Run reconciles blob storage every interval until ctx is cancelled.
+func (r *BlobReconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := r.Reconcile(ctx)
+		if err != nil {
+			slog.Error("failed to reconcile blob storage", "error", err)
+		}
+		if len(deleted) > 0 {
+			slog.Info("removed orphaned blobs", "count", len(deleted), "keys", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
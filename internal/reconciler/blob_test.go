@@ -0,0 +1,133 @@
+package reconciler_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/reconciler"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+type fakeBlobStorage struct {
+	blobs   []datalayer.BlobInfo
+	deleted []string
+}
+
+func (f *fakeBlobStorage) List(ctx context.Context, prefix string) ([]datalayer.BlobInfo, error) {
+	return f.blobs, nil
+}
+
+func (f *fakeBlobStorage) Delete(ctx context.Context, key string) error {
+	f.deleted = append(f.deleted, key)
+	return nil
+}
+
+type fakeIDLister []string
+
+func (f fakeIDLister) ListIDs(ctx context.Context) ([]string, error) {
+	return f, nil
+}
+
+func TestBlobReconcilerReconcile(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-2 * time.Hour)
+	recent := now.Add(-time.Minute)
+
+	storage := &fakeBlobStorage{
+		blobs: []datalayer.BlobInfo{
+			{Key: "sound-off/uploaded/live", LastModified: old},
+			{Key: "sound-off/opus/live", LastModified: old},
+			{Key: "sound-off/uploaded/orphan", LastModified: old},
+			{Key: "sound-off/opus/orphan", LastModified: old},
+			{Key: "sound-off/uploaded/in-progress", LastModified: recent},
+			{Key: "unrelated/object", LastModified: old},
+		},
+	}
+
+	r := reconciler.NewBlobReconciler(storage, fakeIDLister{"live"})
+	r.Now = func() time.Time { return now }
+
+	deleted, err := r.Reconcile(t.Context())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"sound-off/uploaded/orphan", "sound-off/opus/orphan"}
+	if !slices.Equal(deleted, want) {
+		t.Errorf("Reconcile() deleted %v, want %v", deleted, want)
+	}
+	if !slices.Equal(storage.deleted, want) {
+		t.Errorf("storage deletes %v, want %v", storage.deleted, want)
+	}
+}
+
+type fakeSizeUpdater struct {
+	fileSizes    map[string]int64
+	encodedSizes map[string]int64
+	updated      []string
+}
+
+func (f *fakeSizeUpdater) ListSizes(ctx context.Context) ([]repository.SoundCronSizes, error) {
+	var sizes []repository.SoundCronSizes
+	for id, size := range f.fileSizes {
+		sizes = append(sizes, repository.SoundCronSizes{ID: id, FileSize: size, EncodedSize: f.encodedSizes[id]})
+	}
+	return sizes, nil
+}
+
+func (f *fakeSizeUpdater) UpdateFileSize(ctx context.Context, id string, size int64) error {
+	f.fileSizes[id] = size
+	f.updated = append(f.updated, id)
+	return nil
+}
+
+func (f *fakeSizeUpdater) UpdateEncodedSize(ctx context.Context, id string, size int64) error {
+	f.encodedSizes[id] = size
+	f.updated = append(f.updated, id)
+	return nil
+}
+
+func TestBackfillSizes(t *testing.T) {
+	storage := &fakeBlobStorage{
+		blobs: []datalayer.BlobInfo{
+			{Key: "sound-off/uploaded/bell", Size: 300},
+			{Key: "sound-off/opus/bell", Size: 100},
+			{Key: "sound-off/uploaded/failed", Size: 50},
+			{Key: "sound-off/opus/orphan", Size: 10},
+			{Key: "sound-off/uploaded/backfilled", Size: 70},
+			{Key: "sound-off/opus/backfilled", Size: 20},
+		},
+	}
+	soundCrons := &fakeSizeUpdater{
+		// Soundcrons without any stored audio, or whose sizes are already
+		// recorded, are not updated.
+		fileSizes:    map[string]int64{"bell": 0, "failed": 0, "missing": 0, "backfilled": 70},
+		encodedSizes: map[string]int64{"backfilled": 20},
+	}
+
+	updated, err := reconciler.BackfillSizes(t.Context(), storage, soundCrons)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("expected 2 soundcrons to be updated, got %d", updated)
+	}
+
+	if soundCrons.fileSizes["bell"] != 300 || soundCrons.encodedSizes["bell"] != 100 {
+		t.Errorf("unexpected sizes for bell: %d uploaded, %d encoded", soundCrons.fileSizes["bell"], soundCrons.encodedSizes["bell"])
+	}
+	if soundCrons.fileSizes["failed"] != 50 {
+		t.Errorf("unexpected uploaded size for failed: %d", soundCrons.fileSizes["failed"])
+	}
+	if soundCrons.encodedSizes["failed"] != 0 {
+		t.Errorf("expected no encoded size for a soundcron without opus audio")
+	}
+	for _, id := range soundCrons.updated {
+		if id == "missing" || id == "backfilled" {
+			t.Errorf("expected soundcron %s not to be updated", id)
+		}
+	}
+}
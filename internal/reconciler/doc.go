@@ -0,0 +1,9 @@
+// Package reconciler keeps blob storage consistent with the database.
+//
+// Deleting a soundcron removes its audio right away, but a crash or a failed
+// upload can still leave objects behind that no soundcron refers to.
+// BlobReconciler periodically finds and removes those orphaned objects.
+// BackfillSizes goes the other way, recording the size of the objects
+// that each soundcron owns. MigrateStorageFormat rewrites encoded audio
+// that was stored in an older format.
+package reconciler
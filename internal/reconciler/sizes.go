@@ -0,0 +1,58 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+// SoundCronSizeUpdater is the repository that BackfillSizes records sizes in.
+type SoundCronSizeUpdater interface {
+	repository.SoundCronSizeLister
+	repository.SoundCronFileSizeUpdater
+	repository.SoundCronEncodedSizeUpdater
+}
+
+// BackfillSizes sets the uploaded and encoded size of every soundcron
+// to the size of its objects in blob storage. Soundcrons created before
+// both sizes were tracked only recorded the size of the Discord attachment.
+// It returns the number of soundcrons whose recorded sizes changed.
+func BackfillSizes(ctx context.Context, blobs datalayer.BlobLister, soundCrons SoundCronSizeUpdater) (int, error) {
+	blobInfos, err := blobs.List(ctx, "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list blobs: %w", err)
+	}
+
+	sizes := make(map[string]int64, len(blobInfos))
+	for _, blob := range blobInfos {
+		sizes[blob.Key] = blob.Size
+	}
+
+	recorded, err := soundCrons.ListSizes(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list soundcron sizes: %w", err)
+	}
+
+	updated := 0
+	for _, sc := range recorded {
+		changed := false
+		if size, ok := sizes[datalayer.UploadedAudioKey(sc.ID)]; ok && size != sc.FileSize {
+			if err := soundCrons.UpdateFileSize(ctx, sc.ID, size); err != nil {
+				return updated, fmt.Errorf("failed to update file size of soundcron %s: %w", sc.ID, err)
+			}
+			changed = true
+		}
+		if size, ok := sizes[datalayer.OpusAudioKey(sc.ID)]; ok && size != sc.EncodedSize {
+			if err := soundCrons.UpdateEncodedSize(ctx, sc.ID, size); err != nil {
+				return updated, fmt.Errorf("failed to update encoded size of soundcron %s: %w", sc.ID, err)
+			}
+			changed = true
+		}
+		if changed {
+			updated++
+		}
+	}
+	return updated, nil
+}
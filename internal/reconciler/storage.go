@@ -0,0 +1,96 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/opus"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+// MigrationStorage is the blob storage whose encoded audio MigrateStorageFormat rewrites.
+type MigrationStorage interface {
+	datalayer.BlobLister
+	datalayer.BlobStorage
+}
+
+// MigrateStorageFormat rewrites the encoded audio of every soundcron that is
+// not already stored in format with the current header, and records the new
+// encoded size. Audio that is encoded while it runs may be overwritten with
+// its previous version, so it should be run while no transcoder is running.
+// It returns the number of objects that were rewritten.
+func MigrateStorageFormat(
+	ctx context.Context,
+	blobs MigrationStorage,
+	soundCrons repository.SoundCronEncodedSizeUpdater,
+	format opus.Format,
+) (int, error) {
+	blobInfos, err := blobs.List(ctx, datalayer.OpusAudioKey(""))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list blobs: %w", err)
+	}
+
+	migrated := 0
+	for _, blob := range blobInfos {
+		id, ok := datalayer.SoundCronIDFromKey(blob.Key)
+		if !ok || blob.Key != datalayer.OpusAudioKey(id) {
+			continue
+		}
+
+		rewritten, err := rewriteFrames(ctx, blobs, blob.Key, format)
+		if err != nil {
+			return migrated, fmt.Errorf("failed to rewrite audio of soundcron %s: %w", id, err)
+		}
+		if rewritten == nil {
+			continue
+		}
+
+		err = blobs.Put(ctx, blob.Key, bytes.NewReader(rewritten), datalayer.PutOptions{
+			Size:        int64(len(rewritten)),
+			ContentType: format.ContentType(),
+		})
+		if err != nil {
+			return migrated, fmt.Errorf("failed to upload audio of soundcron %s: %w", id, err)
+		}
+		if err := soundCrons.UpdateEncodedSize(ctx, id, int64(len(rewritten))); err != nil {
+			return migrated, fmt.Errorf("failed to update encoded size of soundcron %s: %w", id, err)
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// rewriteFrames returns the audio stored at key in format,
+// or nil if it is already stored that way.
+func rewriteFrames(ctx context.Context, blobs datalayer.BlobStorage, key string, format opus.Format) ([]byte, error) {
+	object, err := blobs.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audio from blob storage: %w", err)
+	}
+	defer object.Close()
+
+	frames, header, err := opus.NewFrameReader(object)
+	if err != nil {
+		return nil, err
+	}
+	if header.Format == format && header.Version == opus.HeaderVersion {
+		return nil, nil
+	}
+
+	// The object is read while it is rewritten,
+	// so the new audio is held in memory until it is complete.
+	var buf bytes.Buffer
+	writer, err := opus.NewFrameWriter(&buf, format)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := opus.CopyFrames(writer, frames); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package reconciler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/opus"
+	"github.com/glizzus/sound-off/internal/reconciler"
+)
+
+type fakeMigrationStorage struct {
+	objects map[string][]byte
+	puts    []string
+}
+
+func (f *fakeMigrationStorage) List(ctx context.Context, prefix string) ([]datalayer.BlobInfo, error) {
+	var blobs []datalayer.BlobInfo
+	for key, data := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			blobs = append(blobs, datalayer.BlobInfo{Key: key, Size: int64(len(data))})
+		}
+	}
+	return blobs, nil
+}
+
+func (f *fakeMigrationStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(f.objects[key])), nil
+}
+
+func (f *fakeMigrationStorage) Put(ctx context.Context, key string, data io.Reader, opts datalayer.PutOptions) error {
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	f.objects[key] = b
+	f.puts = append(f.puts, key)
+	return nil
+}
+
+func (f *fakeMigrationStorage) Delete(ctx context.Context, key string) error {
+	delete(f.objects, key)
+	return nil
+}
+
+func TestMigrateStorageFormat(t *testing.T) {
+	frame := []byte{0xfc, 0x01, 0x02}
+	var legacy bytes.Buffer
+	_ = binary.Write(&legacy, binary.LittleEndian, uint16(len(frame)))
+	legacy.Write(frame)
+
+	var current bytes.Buffer
+	writer, err := opus.NewFrameWriter(&current, opus.FormatOgg)
+	if err != nil {
+		t.Fatalf("failed to create frame writer: %v", err)
+	}
+	if err := writer.WriteFrame(frame); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close frame writer: %v", err)
+	}
+
+	storage := &fakeMigrationStorage{objects: map[string][]byte{
+		"sound-off/opus/legacy":     legacy.Bytes(),
+		"sound-off/opus/current":    current.Bytes(),
+		"sound-off/uploaded/legacy": []byte("not opus"),
+	}}
+	soundCrons := &fakeSizeUpdater{encodedSizes: map[string]int64{}}
+
+	migrated, err := reconciler.MigrateStorageFormat(t.Context(), storage, soundCrons, opus.FormatOgg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if migrated != 1 || !slices.Equal(storage.puts, []string{"sound-off/opus/legacy"}) {
+		t.Fatalf("expected only the legacy audio to be rewritten, got %d and puts %v", migrated, storage.puts)
+	}
+
+	reader, header, err := opus.NewFrameReader(bytes.NewReader(storage.objects["sound-off/opus/legacy"]))
+	if err != nil {
+		t.Fatalf("failed to read migrated audio: %v", err)
+	}
+	if header.Format != opus.FormatOgg {
+		t.Errorf("expected migrated audio to be ogg, got %v", header.Format)
+	}
+	if got, err := reader.ReadFrame(); err != nil || !bytes.Equal(got, frame) {
+		t.Errorf("expected the frame to be kept, got %v (%v)", got, err)
+	}
+	if size := soundCrons.encodedSizes["legacy"]; size != int64(len(storage.objects["sound-off/opus/legacy"])) {
+		t.Errorf("expected the new encoded size to be recorded, got %d", size)
+	}
+}
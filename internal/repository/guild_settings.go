@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultStorageQuota is the number of bytes of audio a guild may store
+// when it has no settings of its own.
+const DefaultStorageQuota = 10 * 1024 * 1024 // 10 MB
+
+// DefaultMaxDuration is the longest audio a guild may upload
+// when it has no settings of its own.
+const DefaultMaxDuration = time.Minute
+
+// GuildSettings are the limits that apply to a single guild.
+type GuildSettings struct {
+	GuildID string
+
+	// StorageQuota is the number of bytes of audio the guild may store.
+	StorageQuota int64
+
+	// MaxDuration is the longest audio the guild may upload.
+	MaxDuration time.Duration
+}
+
+// DefaultGuildSettings returns the settings used for a guild that has none stored.
+func DefaultGuildSettings(guildID string) GuildSettings {
+	return GuildSettings{
+		GuildID:      guildID,
+		StorageQuota: DefaultStorageQuota,
+		MaxDuration:  DefaultMaxDuration,
+	}
+}
+
+type GuildSettingsGetter interface {
+	GetGuildSettings(ctx context.Context, guildID string) (GuildSettings, error)
+}
+
+type GuildSettingsPersister interface {
+	SaveGuildSettings(ctx context.Context, settings GuildSettings) error
+}
+
+type GuildSettingsRepository interface {
+	GuildSettingsGetter
+	GuildSettingsPersister
+}
+
+type PostgresGuildSettingsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresGuildSettingsRepository(db *pgxpool.Pool) *PostgresGuildSettingsRepository {
+	return &PostgresGuildSettingsRepository{db: db}
+}
+
+// GetGuildSettings returns the settings of a guild, or the defaults
+// if nothing has been stored for it.
+func (r *PostgresGuildSettingsRepository) GetGuildSettings(ctx context.Context, guildID string) (GuildSettings, error) {
+	const query = `
+	SELECT guild_id, storage_quota, max_duration_ms
+	FROM guild_settings
+	WHERE guild_id = $1
+	`
+
+	var (
+		settings      GuildSettings
+		maxDurationMS int64
+	)
+	err := r.db.QueryRow(ctx, query, guildID).Scan(&settings.GuildID, &settings.StorageQuota, &maxDurationMS)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DefaultGuildSettings(guildID), nil
+	}
+	if err != nil {
+		return GuildSettings{}, fmt.Errorf("failed to query guild settings: %w", err)
+	}
+	settings.MaxDuration = time.Duration(maxDurationMS) * time.Millisecond
+	return settings, nil
+}
+
+func (r *PostgresGuildSettingsRepository) SaveGuildSettings(ctx context.Context, settings GuildSettings) error {
+	const query = `
+	INSERT INTO guild_settings (guild_id, storage_quota, max_duration_ms)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (guild_id)
+	DO UPDATE SET
+		storage_quota = EXCLUDED.storage_quota,
+		max_duration_ms = EXCLUDED.max_duration_ms,
+		updated_at = NOW();
+	`
+
+	_, err := r.db.Exec(ctx, query, settings.GuildID, settings.StorageQuota, settings.MaxDuration.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to save guild settings: %w", err)
+	}
+	return nil
+}
+
+var _ GuildSettingsRepository = (*PostgresGuildSettingsRepository)(nil)
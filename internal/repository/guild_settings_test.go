@@ -0,0 +1,40 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+func TestGuildSettings(t *testing.T) {
+	_, pool := getRepositoryAgainstPostgres(t)
+	repo := repository.NewPostgresGuildSettingsRepository(pool)
+	ctx := t.Context()
+
+	t.Run("A guild without settings gets the defaults", func(t *testing.T) {
+		settings, err := repo.GetGuildSettings(ctx, "1234567890")
+		if err != nil {
+			t.Fatalf("failed to get guild settings: %v", err)
+		}
+		if settings != repository.DefaultGuildSettings("1234567890") {
+			t.Errorf("expected default settings, got %+v", settings)
+		}
+	})
+
+	t.Run("Saved settings are returned and can be updated", func(t *testing.T) {
+		for _, quota := range []int64{50 * 1024 * 1024, 20 * 1024 * 1024} {
+			want := repository.GuildSettings{GuildID: "1234567890", StorageQuota: quota, MaxDuration: 90 * time.Second}
+			if err := repo.SaveGuildSettings(ctx, want); err != nil {
+				t.Fatalf("failed to save guild settings: %v", err)
+			}
+			got, err := repo.GetGuildSettings(ctx, "1234567890")
+			if err != nil {
+				t.Fatalf("failed to get guild settings: %v", err)
+			}
+			if got != want {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+		}
+	})
+}
@@ -11,24 +11,175 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// SoundCronStatus tracks whether the audio of a soundcron is ready for playback.
+type SoundCronStatus string
+
+const (
+	// SoundCronStatusPending means the soundcron has been saved,
+	// but its audio has not been encoded yet.
+	SoundCronStatusPending SoundCronStatus = "pending"
+
+	// SoundCronStatusReady means the soundcron's audio is encoded
+	// and the soundcron can be scheduled.
+	SoundCronStatusReady SoundCronStatus = "ready"
+
+	// SoundCronStatusFailed means the soundcron's audio could not be processed.
+	SoundCronStatusFailed SoundCronStatus = "failed"
+)
+
 type SoundCron struct {
 	ID       string
 	Name     string
 	GuildID  string
 	Cron     string
 	Timezone string
+
+	// FileSize is the size in bytes of the uploaded audio.
 	FileSize int64
 
+	// EncodedSize is the size in bytes of the opus frames that are streamed
+	// during playback. It is zero until the audio has been encoded.
+	EncodedSize int64
+
+	// Audio describes the uploaded audio. It is zero until the audio has been probed.
+	Audio AudioMetadata
+
+	// Normalize is whether the loudness of the audio is normalized when it is encoded.
+	Normalize bool
+
+	// Clip is the part of the uploaded audio that is encoded for playback.
+	Clip Clip
+
+	// FadeIn and FadeOut are how long the clip takes to fade in at its start
+	// and to fade out before its end.
+	FadeIn  time.Duration
+	FadeOut time.Duration
+
+	// Volume is the loudness that the soundcron is played at, as a percentage.
+	// It is applied during playback, so changing it does not re-encode the audio.
+	// A zero Volume is saved as DefaultVolume.
+	Volume int
+
+	// Priority decides which soundcron of a guild plays when several
+	// play at the same time. Higher priorities win.
+	Priority int
+
+	// CreatorID is the ID of the user who added the soundcron.
+	// It is empty for soundcrons that were added before it was recorded.
+	CreatorID string
+
+	// Channels is how the voice channel that the soundcron plays in is chosen.
+	Channels ChannelSelection
+
+	// Status is whether the audio of the soundcron is ready for playback.
+	// Only ready soundcrons are pulled for scheduling. An empty status is
+	// saved as pending.
+	Status SoundCronStatus
+
 	// LastAccessed is the last time a user interacted with this soundcron.
 	// This is used to order soundcrons by recency.
 	LastAccessed time.Time
 }
 
+// AudioMetadata describes the uploaded audio of a soundcron.
+type AudioMetadata struct {
+	Duration time.Duration
+	Channels int
+	Codec    string
+}
+
+const (
+	// DefaultVolume plays audio at the loudness it was encoded at.
+	DefaultVolume = 100
+
+	// MaxVolume is the loudest a soundcron may be played, as a percentage.
+	MaxVolume = 200
+
+	// MaxPriority is the highest priority of a soundcron. The lowest is zero.
+	MaxPriority = 10
+)
+
+// Clip selects the part of the uploaded audio that is played.
+// The zero Clip plays all of it.
+type Clip struct {
+	Start time.Duration
+
+	// End is where playback stops. A zero End plays to the end of the audio.
+	End time.Duration
+}
+
+// IsZero reports whether the clip plays all of the audio.
+func (c Clip) IsZero() bool {
+	return c == Clip{}
+}
+
+// Length returns how much of audio of the given duration is played.
+func (c Clip) Length(duration time.Duration) time.Duration {
+	end := duration
+	if c.End > 0 && c.End < end {
+		end = c.End
+	}
+	return max(end-c.Start, 0)
+}
+
+// ChannelStrategy is how the voice channel that a soundcron plays in is chosen.
+type ChannelStrategy string
+
+const (
+	// ChannelStrategyMostHumans plays in the channel with the most listeners,
+	// not counting bots and deafened users.
+	ChannelStrategyMostHumans ChannelStrategy = "most_humans"
+
+	// ChannelStrategyFixed plays in ChannelSelection.ChannelID.
+	ChannelStrategyFixed ChannelStrategy = "fixed"
+
+	// ChannelStrategyCreator plays in the channel that the creator of the soundcron is in.
+	ChannelStrategyCreator ChannelStrategy = "creator"
+
+	// ChannelStrategyAllOccupied plays in every channel that has listeners,
+	// one after another.
+	ChannelStrategyAllOccupied ChannelStrategy = "all_occupied"
+)
+
+// ChannelSelection describes how the voice channel that a soundcron plays in is chosen.
+// The zero ChannelSelection plays in the channel with the most listeners.
+type ChannelSelection struct {
+	// Strategy is how the channel is chosen. An empty Strategy is
+	// saved as ChannelStrategyMostHumans.
+	Strategy ChannelStrategy
+
+	// ChannelID is the channel that ChannelStrategyFixed plays in.
+	ChannelID string
+
+	// Allow is the only channels that may be chosen. An empty Allow allows every channel.
+	Allow []string
+
+	// Deny is channels that are never chosen.
+	Deny []string
+}
+
+// StorageSize is the number of bytes the soundcron takes up in blob storage.
+func (sc SoundCron) StorageSize() int64 {
+	return sc.FileSize + sc.EncodedSize
+}
+
 type SoundCronJob struct {
 	SoundCronID string
 	Name        string
 	GuildID     string
 	RunTime     time.Time
+
+	// Volume is the loudness that the soundcron is played at, as a percentage.
+	Volume int
+
+	// Priority decides which job plays when several of a guild play at the same time.
+	Priority int
+
+	// CreatorID is the ID of the user who added the soundcron.
+	CreatorID string
+
+	// Channels is how the voice channel that the job plays in is chosen.
+	Channels ChannelSelection
 }
 
 type SoundCronJobRow struct {
@@ -37,6 +188,10 @@ type SoundCronJobRow struct {
 	RunTime     time.Time
 }
 
+type SoundCronEditor interface {
+	Edit(ctx context.Context, soundCron SoundCron) error
+}
+
 type SoundCronLister interface {
 	List(ctx context.Context, guildID string) ([]SoundCron, error)
 }
@@ -53,11 +208,62 @@ type SoundCronRefresher interface {
 	Refresh(ctx context.Context, soundCronID string) error
 }
 
+type SoundCronFileSizeUpdater interface {
+	UpdateFileSize(ctx context.Context, soundCronID string, fileSize int64) error
+}
+
+type SoundCronEncodedSizeUpdater interface {
+	UpdateEncodedSize(ctx context.Context, soundCronID string, encodedSize int64) error
+}
+
+type SoundCronAudioMetadataUpdater interface {
+	UpdateAudioMetadata(ctx context.Context, soundCronID string, audio AudioMetadata) error
+}
+
+type SoundCronVolumeSetter interface {
+	SetVolume(ctx context.Context, soundCronID string, volume int) error
+}
+
+type SoundCronPrioritySetter interface {
+	SetPriority(ctx context.Context, soundCronID string, priority int) error
+}
+
+type SoundCronChannelSelectionSetter interface {
+	SetChannelSelection(ctx context.Context, soundCronID string, channels ChannelSelection) error
+}
+
+type SoundCronStatusSetter interface {
+	SetStatus(ctx context.Context, soundCronID string, status SoundCronStatus) error
+}
+
+type SoundCronIDLister interface {
+	ListIDs(ctx context.Context) ([]string, error)
+}
+
+// SoundCronSizes is the recorded size of the stored audio of a soundcron.
+type SoundCronSizes struct {
+	ID          string
+	FileSize    int64
+	EncodedSize int64
+}
+
+type SoundCronSizeLister interface {
+	ListSizes(ctx context.Context) ([]SoundCronSizes, error)
+}
+
 type SoundCronRepository interface {
 	SoundCronPersister
+	SoundCronEditor
 	SoundCronLister
 	SoundCronJobPuller
 	SoundCronRefresher
+	SoundCronFileSizeUpdater
+	SoundCronEncodedSizeUpdater
+	SoundCronAudioMetadataUpdater
+	SoundCronVolumeSetter
+	SoundCronPrioritySetter
+	SoundCronChannelSelectionSetter
+	SoundCronStatusSetter
 }
 
 type PostgresSoundCronRepository struct {
@@ -69,6 +275,15 @@ func NewPostgresSoundCronRepository(db *pgxpool.Pool) *PostgresSoundCronReposito
 }
 
 func soundCronToRowParams(soundCron SoundCron) []any {
+	status := soundCron.Status
+	if status == "" {
+		status = SoundCronStatusPending
+	}
+	volume := soundCron.Volume
+	if volume == 0 {
+		volume = DefaultVolume
+	}
+	channels := soundCron.Channels.withDefaults()
 	return []any{
 		soundCron.ID,
 		soundCron.Name,
@@ -76,7 +291,39 @@ func soundCronToRowParams(soundCron SoundCron) []any {
 		soundCron.Cron,
 		soundCron.Timezone,
 		soundCron.FileSize,
+		soundCron.EncodedSize,
+		soundCron.Audio.Duration.Milliseconds(),
+		soundCron.Audio.Channels,
+		soundCron.Audio.Codec,
+		soundCron.Normalize,
+		soundCron.Clip.Start.Milliseconds(),
+		soundCron.Clip.End.Milliseconds(),
+		soundCron.FadeIn.Milliseconds(),
+		soundCron.FadeOut.Milliseconds(),
+		volume,
+		soundCron.Priority,
+		soundCron.CreatorID,
+		channels.Strategy,
+		channels.ChannelID,
+		channels.Allow,
+		channels.Deny,
+		status,
+	}
+}
+
+// withDefaults returns c as it is saved: with a strategy, and with lists
+// that are empty rather than nil, since the columns can not be NULL.
+func (c ChannelSelection) withDefaults() ChannelSelection {
+	if c.Strategy == "" {
+		c.Strategy = ChannelStrategyMostHumans
+	}
+	if c.Allow == nil {
+		c.Allow = []string{}
 	}
+	if c.Deny == nil {
+		c.Deny = []string{}
+	}
+	return c
 }
 
 type pgxExecer interface {
@@ -95,15 +342,40 @@ func (r *PostgresSoundCronRepository) Save(ctx context.Context, soundCron SoundC
 	}()
 
 	const soundCronQuery = `
-	INSERT INTO soundcron (id, soundcron_name, guild_id, cron, timezone, file_size)
-	VALUES ($1, $2, $3, $4, $5, $6)
+	INSERT INTO soundcron (
+		id, soundcron_name, guild_id, cron, timezone, file_size, encoded_size,
+		duration_ms, channels, codec, normalize, clip_start_ms, clip_end_ms,
+		fade_in_ms, fade_out_ms, volume, priority, creator_id, channel_strategy,
+		channel_id, channel_allow, channel_deny, status
+	)
+	VALUES (
+		$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
+		$17, $18, $19, $20, $21, $22, $23
+	)
 	ON CONFLICT (id)
 	DO UPDATE SET
 		soundcron_name = EXCLUDED.soundcron_name,
 		guild_id = EXCLUDED.guild_id,
 		cron = EXCLUDED.cron,
 		timezone = EXCLUDED.timezone,
-		file_size = EXCLUDED.file_size;
+		file_size = EXCLUDED.file_size,
+		encoded_size = EXCLUDED.encoded_size,
+		duration_ms = EXCLUDED.duration_ms,
+		channels = EXCLUDED.channels,
+		codec = EXCLUDED.codec,
+		normalize = EXCLUDED.normalize,
+		clip_start_ms = EXCLUDED.clip_start_ms,
+		clip_end_ms = EXCLUDED.clip_end_ms,
+		fade_in_ms = EXCLUDED.fade_in_ms,
+		fade_out_ms = EXCLUDED.fade_out_ms,
+		volume = EXCLUDED.volume,
+		priority = EXCLUDED.priority,
+		creator_id = EXCLUDED.creator_id,
+		channel_strategy = EXCLUDED.channel_strategy,
+		channel_id = EXCLUDED.channel_id,
+		channel_allow = EXCLUDED.channel_allow,
+		channel_deny = EXCLUDED.channel_deny,
+		status = EXCLUDED.status;
 	`
 
 	_, err = tx.Exec(ctx, soundCronQuery, soundCronToRowParams(soundCron)...)
@@ -111,6 +383,20 @@ func (r *PostgresSoundCronRepository) Save(ctx context.Context, soundCron SoundC
 		return fmt.Errorf("failed to execute sound cron query: %w", err)
 	}
 
+	// Jobs that have not been picked up yet were generated from the previous
+	// schedule. Drop them so that an edited cron or timezone takes effect
+	// immediately; doRefresh regenerates them below.
+	const clearJobsQuery = `
+	DELETE FROM soundcron_job
+	WHERE soundcron_id = $1
+		AND picked_up_at IS NULL
+	`
+
+	_, err = tx.Exec(ctx, clearJobsQuery, soundCron.ID)
+	if err != nil {
+		return fmt.Errorf("failed to clear pending sound cron jobs: %w", err)
+	}
+
 	err = doRefresh(ctx, tx, soundCron.ID, soundCron.Cron, soundCron.Timezone)
 	if err != nil {
 		return fmt.Errorf("failed to refresh sound cron: %w", err)
@@ -123,9 +409,74 @@ func (r *PostgresSoundCronRepository) Save(ctx context.Context, soundCron SoundC
 	return nil
 }
 
+// Edit changes the name, schedule, clip and fades of a soundcron to those of
+// soundCron. Its other columns may have changed since soundCron was read, such as
+// its status or audio once a transcode finishes, so they are left as they are.
+// The jobs that have not been picked up yet are regenerated from the new schedule.
+func (r *PostgresSoundCronRepository) Edit(ctx context.Context, soundCron SoundCron) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			fmt.Printf("failed to rollback transaction: %v\n", err)
+		}
+	}()
+
+	const editQuery = `
+	UPDATE soundcron
+	SET soundcron_name = $2, cron = $3, timezone = $4, clip_start_ms = $5,
+		clip_end_ms = $6, fade_in_ms = $7, fade_out_ms = $8
+	WHERE id = $1
+	`
+
+	tag, err := tx.Exec(
+		ctx, editQuery,
+		soundCron.ID,
+		soundCron.Name,
+		soundCron.Cron,
+		soundCron.Timezone,
+		soundCron.Clip.Start.Milliseconds(),
+		soundCron.Clip.End.Milliseconds(),
+		soundCron.FadeIn.Milliseconds(),
+		soundCron.FadeOut.Milliseconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to edit sound cron: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("sound cron not found: %w", pgx.ErrNoRows)
+	}
+
+	const clearJobsQuery = `
+	DELETE FROM soundcron_job
+	WHERE soundcron_id = $1
+		AND picked_up_at IS NULL
+	`
+
+	_, err = tx.Exec(ctx, clearJobsQuery, soundCron.ID)
+	if err != nil {
+		return fmt.Errorf("failed to clear pending sound cron jobs: %w", err)
+	}
+
+	err = doRefresh(ctx, tx, soundCron.ID, soundCron.Cron, soundCron.Timezone)
+	if err != nil {
+		return fmt.Errorf("failed to refresh sound cron: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 func (r *PostgresSoundCronRepository) List(ctx context.Context, guildID string) ([]SoundCron, error) {
 	const query = `
-	SELECT id, soundcron_name, guild_id, cron, timezone, file_size, last_accessed
+	SELECT id, soundcron_name, guild_id, cron, timezone, file_size, encoded_size,
+		duration_ms, channels, codec, normalize, clip_start_ms, clip_end_ms,
+		fade_in_ms, fade_out_ms, volume, priority, creator_id, channel_strategy,
+		channel_id, channel_allow, channel_deny, status, last_accessed
 	FROM soundcron
 	WHERE guild_id = $1
 	`
@@ -137,7 +488,14 @@ func (r *PostgresSoundCronRepository) List(ctx context.Context, guildID string)
 
 	var soundCrons []SoundCron
 	for rows.Next() {
-		var sc SoundCron
+		var (
+			sc          SoundCron
+			durationMS  int64
+			clipStartMS int64
+			clipEndMS   int64
+			fadeInMS    int64
+			fadeOutMS   int64
+		)
 		err = rows.Scan(
 			&sc.ID,
 			&sc.Name,
@@ -145,11 +503,33 @@ func (r *PostgresSoundCronRepository) List(ctx context.Context, guildID string)
 			&sc.Cron,
 			&sc.Timezone,
 			&sc.FileSize,
+			&sc.EncodedSize,
+			&durationMS,
+			&sc.Audio.Channels,
+			&sc.Audio.Codec,
+			&sc.Normalize,
+			&clipStartMS,
+			&clipEndMS,
+			&fadeInMS,
+			&fadeOutMS,
+			&sc.Volume,
+			&sc.Priority,
+			&sc.CreatorID,
+			&sc.Channels.Strategy,
+			&sc.Channels.ChannelID,
+			&sc.Channels.Allow,
+			&sc.Channels.Deny,
+			&sc.Status,
 			&sc.LastAccessed,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan sound cron: %w", err)
 		}
+		sc.Audio.Duration = time.Duration(durationMS) * time.Millisecond
+		sc.Clip.Start = time.Duration(clipStartMS) * time.Millisecond
+		sc.Clip.End = time.Duration(clipEndMS) * time.Millisecond
+		sc.FadeIn = time.Duration(fadeInMS) * time.Millisecond
+		sc.FadeOut = time.Duration(fadeOutMS) * time.Millisecond
 		soundCrons = append(soundCrons, sc)
 	}
 
@@ -169,7 +549,9 @@ func (r *PostgresSoundCronRepository) Pull(ctx context.Context, within time.Time
 		AND scj.run_time > now()
 		AND scj.run_time <= $1
 		AND scj.picked_up_at IS NULL
-	RETURNING scj.soundcron_id, sc.soundcron_name, sc.guild_id, scj.run_time
+		AND sc.status = 'ready'
+	RETURNING scj.soundcron_id, sc.soundcron_name, sc.guild_id, scj.run_time, sc.volume,
+		sc.priority, sc.creator_id, sc.channel_strategy, sc.channel_id, sc.channel_allow, sc.channel_deny
 	`
 
 	rows, err := r.db.Query(ctx, query, within.UTC())
@@ -181,7 +563,20 @@ func (r *PostgresSoundCronRepository) Pull(ctx context.Context, within time.Time
 	var soundCronJobs []SoundCronJob
 	for rows.Next() {
 		var scj SoundCronJob
-		if err := rows.Scan(&scj.SoundCronID, &scj.Name, &scj.GuildID, &scj.RunTime); err != nil {
+		err := rows.Scan(
+			&scj.SoundCronID,
+			&scj.Name,
+			&scj.GuildID,
+			&scj.RunTime,
+			&scj.Volume,
+			&scj.Priority,
+			&scj.CreatorID,
+			&scj.Channels.Strategy,
+			&scj.Channels.ChannelID,
+			&scj.Channels.Allow,
+			&scj.Channels.Deny,
+		)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan sound cron job: %w", err)
 		}
 		soundCronJobs = append(soundCronJobs, scj)
@@ -251,6 +646,201 @@ func (r *PostgresSoundCronRepository) UpdateRecentlyAccessed(ctx context.Context
 	return nil
 }
 
+// SetStatus records whether the audio of a soundcron is ready for playback.
+// Jobs are not pulled while a soundcron is not ready, so the ones that were
+// generated before may have passed; they are regenerated once it is ready.
+func (r *PostgresSoundCronRepository) SetStatus(ctx context.Context, soundCronID string, status SoundCronStatus) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			fmt.Printf("failed to rollback transaction: %v\n", err)
+		}
+	}()
+
+	const query = `
+	UPDATE soundcron
+	SET status = $2
+	WHERE id = $1
+	RETURNING cron, timezone
+	`
+
+	var cron, timezone string
+	err = tx.QueryRow(ctx, query, soundCronID, status).Scan(&cron, &timezone)
+	if err == pgx.ErrNoRows {
+		// A soundcron that was deleted while its audio was transcoded has no jobs.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set status: %w", err)
+	}
+
+	if status == SoundCronStatusReady {
+		err = doRefresh(ctx, tx, soundCronID, cron, timezone)
+		if err != nil {
+			return fmt.Errorf("failed to refresh sound cron: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SetVolume changes the loudness that a soundcron is played at, as a percentage.
+// Jobs that have already been sent to a worker keep the previous volume.
+func (r *PostgresSoundCronRepository) SetVolume(ctx context.Context, soundCronID string, volume int) error {
+	const query = `
+	UPDATE soundcron
+	SET volume = $2
+	WHERE id = $1
+	`
+
+	_, err := r.db.Exec(ctx, query, soundCronID, volume)
+	if err != nil {
+		return fmt.Errorf("failed to set volume: %w", err)
+	}
+	return nil
+}
+
+// SetPriority changes which soundcron of a guild plays when several play at the same time.
+// Jobs that have already been sent to a worker keep the previous priority.
+func (r *PostgresSoundCronRepository) SetPriority(ctx context.Context, soundCronID string, priority int) error {
+	const query = `
+	UPDATE soundcron
+	SET priority = $2
+	WHERE id = $1
+	`
+
+	_, err := r.db.Exec(ctx, query, soundCronID, priority)
+	if err != nil {
+		return fmt.Errorf("failed to set priority: %w", err)
+	}
+	return nil
+}
+
+// SetChannelSelection changes how the voice channel that a soundcron plays in is chosen.
+// Jobs that have already been sent to a worker keep the previous channel.
+func (r *PostgresSoundCronRepository) SetChannelSelection(ctx context.Context, soundCronID string, channels ChannelSelection) error {
+	const query = `
+	UPDATE soundcron
+	SET channel_strategy = $2, channel_id = $3, channel_allow = $4, channel_deny = $5
+	WHERE id = $1
+	`
+
+	channels = channels.withDefaults()
+	_, err := r.db.Exec(ctx, query, soundCronID, channels.Strategy, channels.ChannelID, channels.Allow, channels.Deny)
+	if err != nil {
+		return fmt.Errorf("failed to set channel selection: %w", err)
+	}
+	return nil
+}
+
+// ListIDs returns the IDs of every soundcron across all guilds.
+func (r *PostgresSoundCronRepository) ListIDs(ctx context.Context) ([]string, error) {
+	const query = `
+	SELECT id
+	FROM soundcron
+	`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sound cron IDs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan sound cron ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over rows: %w", err)
+	}
+	return ids, nil
+}
+
+var _ SoundCronIDLister = (*PostgresSoundCronRepository)(nil)
+
+// ListSizes returns the recorded sizes of every soundcron across all guilds.
+func (r *PostgresSoundCronRepository) ListSizes(ctx context.Context) ([]SoundCronSizes, error) {
+	const query = `
+	SELECT id, file_size, encoded_size
+	FROM soundcron
+	`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sound cron sizes: %w", err)
+	}
+	defer rows.Close()
+
+	var sizes []SoundCronSizes
+	for rows.Next() {
+		var s SoundCronSizes
+		if err := rows.Scan(&s.ID, &s.FileSize, &s.EncodedSize); err != nil {
+			return nil, fmt.Errorf("failed to scan sound cron sizes: %w", err)
+		}
+		sizes = append(sizes, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over rows: %w", err)
+	}
+	return sizes, nil
+}
+
+var _ SoundCronSizeLister = (*PostgresSoundCronRepository)(nil)
+
+// UpdateFileSize sets the stored file size of a soundcron without touching
+// its schedule or its last accessed time.
+func (r *PostgresSoundCronRepository) UpdateFileSize(ctx context.Context, soundCronID string, fileSize int64) error {
+	const query = `
+	UPDATE soundcron
+	SET file_size = $2
+	WHERE id = $1
+	`
+
+	_, err := r.db.Exec(ctx, query, soundCronID, fileSize)
+	if err != nil {
+		return fmt.Errorf("failed to update file size: %w", err)
+	}
+	return nil
+}
+
+// UpdateEncodedSize sets the size of the encoded audio of a soundcron.
+func (r *PostgresSoundCronRepository) UpdateEncodedSize(ctx context.Context, soundCronID string, encodedSize int64) error {
+	const query = `
+	UPDATE soundcron
+	SET encoded_size = $2
+	WHERE id = $1
+	`
+
+	_, err := r.db.Exec(ctx, query, soundCronID, encodedSize)
+	if err != nil {
+		return fmt.Errorf("failed to update encoded size: %w", err)
+	}
+	return nil
+}
+
+// UpdateAudioMetadata records what probing the uploaded audio of a soundcron found.
+func (r *PostgresSoundCronRepository) UpdateAudioMetadata(ctx context.Context, soundCronID string, audio AudioMetadata) error {
+	const query = `
+	UPDATE soundcron
+	SET duration_ms = $2, channels = $3, codec = $4
+	WHERE id = $1
+	`
+
+	_, err := r.db.Exec(ctx, query, soundCronID, audio.Duration.Milliseconds(), audio.Channels, audio.Codec)
+	if err != nil {
+		return fmt.Errorf("failed to update audio metadata: %w", err)
+	}
+	return nil
+}
+
 func (r *PostgresSoundCronRepository) DeleteByID(ctx context.Context, soundCronID string) error {
 	const query = `
 	DELETE FROM soundcron
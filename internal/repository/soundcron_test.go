@@ -2,6 +2,7 @@ package repository_test
 
 import (
 	"context"
+	"slices"
 	"testing"
 	"time"
 
@@ -112,3 +113,425 @@ func TestRepositorySave(t *testing.T) {
 		}
 	})
 }
+
+func TestRepositorySaveReschedules(t *testing.T) {
+	repo, pool := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	id := "0b7a3c55-2f1e-4a8e-9a7e-0d15ea5e0001"
+	soundCron := repository.SoundCron{
+		ID:       id,
+		Name:     "Rescheduled SoundCron",
+		GuildID:  "1234567890",
+		Cron:     "* * * * *",
+		Timezone: "UTC",
+	}
+	if err := repo.Save(ctx, soundCron); err != nil {
+		t.Fatalf("failed to save SoundCron: %v", err)
+	}
+
+	// Move the schedule far enough out that none of the old jobs could match.
+	soundCron.Cron = "0 0 1 1 *"
+	if err := repo.Save(ctx, soundCron); err != nil {
+		t.Fatalf("failed to save edited SoundCron: %v", err)
+	}
+
+	rows, err := pool.Query(ctx, "SELECT run_time FROM soundcron_job WHERE soundcron_id = $1 AND picked_up_at IS NULL", id)
+	if err != nil {
+		t.Fatalf("failed to query SoundCron jobs: %v", err)
+	}
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		var runTime time.Time
+		if err := rows.Scan(&runTime); err != nil {
+			t.Fatalf("failed to scan row: %v", err)
+		}
+		count++
+		runTime = runTime.UTC()
+		if runTime.Month() != time.January || runTime.Day() != 1 || runTime.Hour() != 0 || runTime.Minute() != 0 {
+			t.Errorf("job at %v was not generated from the edited cron expression", runTime)
+		}
+	}
+	if count == 0 {
+		t.Errorf("expected jobs to be regenerated for the edited cron expression")
+	}
+}
+
+func TestRepositoryPullSkipsSoundCronsThatAreNotReady(t *testing.T) {
+	repo, _ := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	statuses := map[string]repository.SoundCronStatus{
+		"4a4e2a4e-0000-4000-8000-000000000001": repository.SoundCronStatusReady,
+		"4a4e2a4e-0000-4000-8000-000000000002": repository.SoundCronStatusPending,
+		"4a4e2a4e-0000-4000-8000-000000000003": repository.SoundCronStatusFailed,
+	}
+	for id, status := range statuses {
+		if err := repo.Save(ctx, repository.SoundCron{
+			ID:       id,
+			Name:     string(status),
+			GuildID:  "1234567890",
+			Cron:     "* * * * *",
+			Timezone: "UTC",
+			Status:   status,
+		}); err != nil {
+			t.Fatalf("failed to save SoundCron: %v", err)
+		}
+	}
+
+	jobs, err := repo.Pull(ctx, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to pull jobs: %v", err)
+	}
+	if len(jobs) == 0 {
+		t.Fatalf("expected jobs for the ready SoundCron")
+	}
+	for _, job := range jobs {
+		if statuses[job.SoundCronID] != repository.SoundCronStatusReady {
+			t.Errorf("pulled job for SoundCron with status %q", statuses[job.SoundCronID])
+		}
+	}
+}
+
+func TestRepositorySetStatusReadyRegeneratesJobs(t *testing.T) {
+	repo, pool := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	id := "4a4e2a4e-0000-4000-8000-000000000004"
+	if err := repo.Save(ctx, repository.SoundCron{
+		ID:       id,
+		Name:     "Slow transcode",
+		GuildID:  "1234567890",
+		Cron:     "* * * * *",
+		Timezone: "UTC",
+		Status:   repository.SoundCronStatusPending,
+	}); err != nil {
+		t.Fatalf("failed to save SoundCron: %v", err)
+	}
+
+	// The jobs that were generated when it was saved pass while it is transcoded.
+	if _, err := pool.Exec(ctx, "UPDATE soundcron_job SET run_time = run_time - interval '1 day' WHERE soundcron_id = $1", id); err != nil {
+		t.Fatalf("failed to expire jobs: %v", err)
+	}
+	if jobs, err := repo.Pull(ctx, time.Now().Add(10*time.Minute)); err != nil || len(jobs) != 0 {
+		t.Fatalf("expected no jobs before the SoundCron is ready, got %+v, %v", jobs, err)
+	}
+
+	if err := repo.SetStatus(ctx, id, repository.SoundCronStatusReady); err != nil {
+		t.Fatalf("failed to set status: %v", err)
+	}
+
+	jobs, err := repo.Pull(ctx, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to pull jobs: %v", err)
+	}
+	if len(jobs) == 0 || jobs[0].SoundCronID != id {
+		t.Errorf("expected jobs once the SoundCron is ready, got %+v", jobs)
+	}
+}
+
+func TestRepositoryEditKeepsConcurrentChanges(t *testing.T) {
+	repo, pool := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	original := repository.SoundCron{
+		ID:       "4a4e2a4e-0000-4000-8000-000000000005",
+		Name:     "Bell",
+		GuildID:  "1234567890",
+		Cron:     "0 0 1 1 *",
+		Timezone: "UTC",
+		Status:   repository.SoundCronStatusPending,
+	}
+	if err := repo.Save(ctx, original); err != nil {
+		t.Fatalf("failed to save SoundCron: %v", err)
+	}
+
+	// The transcode finishes after the edit read the soundcron.
+	if err := repo.UpdateEncodedSize(ctx, original.ID, 100); err != nil {
+		t.Fatalf("failed to update encoded size: %v", err)
+	}
+	if err := repo.SetStatus(ctx, original.ID, repository.SoundCronStatusReady); err != nil {
+		t.Fatalf("failed to set status: %v", err)
+	}
+
+	edited := original
+	edited.Name = "Big Bell"
+	edited.Cron = "* * * * *"
+	edited.Clip = repository.Clip{Start: time.Second, End: 2 * time.Second}
+	edited.FadeOut = time.Second
+	if err := repo.Edit(ctx, edited); err != nil {
+		t.Fatalf("failed to edit SoundCron: %v", err)
+	}
+
+	soundCrons, err := repo.List(ctx, original.GuildID)
+	if err != nil {
+		t.Fatalf("failed to list SoundCrons: %v", err)
+	}
+	if len(soundCrons) != 1 {
+		t.Fatalf("expected one SoundCron, got %+v", soundCrons)
+	}
+	got := soundCrons[0]
+	if got.Name != edited.Name || got.Cron != edited.Cron || got.Clip != edited.Clip || got.FadeOut != edited.FadeOut {
+		t.Errorf("expected the edit to be applied, got %+v", got)
+	}
+	if got.Status != repository.SoundCronStatusReady || got.EncodedSize != 100 {
+		t.Errorf("expected the edit to keep the finished transcode, got %+v", got)
+	}
+
+	// Jobs generated from the yearly schedule are replaced by minutely ones.
+	var jobs int
+	err = pool.QueryRow(ctx, "SELECT count(*) FROM soundcron_job WHERE soundcron_id = $1 AND run_time < now() + interval '1 hour'", original.ID).Scan(&jobs)
+	if err != nil {
+		t.Fatalf("failed to count jobs: %v", err)
+	}
+	if jobs == 0 {
+		t.Error("expected jobs to be regenerated from the edited schedule")
+	}
+}
+
+func TestRepositoryUpdateEncodedSize(t *testing.T) {
+	repo, _ := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	soundCron := repository.SoundCron{
+		ID:       "7b1e2f0c-5d5a-4c8e-9d3b-2f4f1c0de001",
+		Name:     "Bell",
+		GuildID:  "1234567890",
+		Cron:     "* * * * *",
+		Timezone: "UTC",
+		FileSize: 300,
+	}
+	if err := repo.Save(ctx, soundCron); err != nil {
+		t.Fatalf("failed to save SoundCron: %v", err)
+	}
+
+	if err := repo.UpdateEncodedSize(ctx, soundCron.ID, 100); err != nil {
+		t.Fatalf("failed to update encoded size: %v", err)
+	}
+
+	soundCrons, err := repo.List(ctx, soundCron.GuildID)
+	if err != nil {
+		t.Fatalf("failed to list SoundCrons: %v", err)
+	}
+	if len(soundCrons) != 1 || soundCrons[0].FileSize != 300 || soundCrons[0].EncodedSize != 100 {
+		t.Fatalf("expected uploaded and encoded sizes to be tracked separately, got %+v", soundCrons)
+	}
+	if soundCrons[0].StorageSize() != 400 {
+		t.Errorf("expected storage size of 400, got %d", soundCrons[0].StorageSize())
+	}
+}
+
+func TestRepositoryListSizes(t *testing.T) {
+	repo, pool := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	soundCron := repository.SoundCron{
+		ID:          "7b1e2f0c-5d5a-4c8e-9d3b-2f4f1c0de002",
+		Name:        "Bell",
+		GuildID:     "1234567890",
+		Cron:        "* * * * *",
+		Timezone:    "UTC",
+		FileSize:    300,
+		EncodedSize: 100,
+	}
+	if err := repo.Save(ctx, soundCron); err != nil {
+		t.Fatalf("failed to save SoundCron: %v", err)
+	}
+
+	sizes, err := repository.NewPostgresSoundCronRepository(pool).ListSizes(ctx)
+	if err != nil {
+		t.Fatalf("failed to list sizes: %v", err)
+	}
+	want := []repository.SoundCronSizes{{ID: soundCron.ID, FileSize: 300, EncodedSize: 100}}
+	if !slices.Equal(sizes, want) {
+		t.Errorf("expected sizes %+v, got %+v", want, sizes)
+	}
+}
+
+func TestRepositoryUpdateAudioMetadata(t *testing.T) {
+	repo, _ := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	soundCron := repository.SoundCron{
+		ID:       "7b1e2f0c-5d5a-4c8e-9d3b-2f4f1c0de002",
+		Name:     "Horn",
+		GuildID:  "1234567890",
+		Cron:     "* * * * *",
+		Timezone: "UTC",
+	}
+	if err := repo.Save(ctx, soundCron); err != nil {
+		t.Fatalf("failed to save SoundCron: %v", err)
+	}
+
+	want := repository.AudioMetadata{Duration: 3500 * time.Millisecond, Channels: 2, Codec: "mp3"}
+	if err := repo.UpdateAudioMetadata(ctx, soundCron.ID, want); err != nil {
+		t.Fatalf("failed to update audio metadata: %v", err)
+	}
+
+	soundCrons, err := repo.List(ctx, soundCron.GuildID)
+	if err != nil {
+		t.Fatalf("failed to list SoundCrons: %v", err)
+	}
+	if len(soundCrons) != 1 || soundCrons[0].Audio != want {
+		t.Errorf("expected audio metadata %+v, got %+v", want, soundCrons)
+	}
+}
+
+func TestRepositorySaveClipAndFades(t *testing.T) {
+	repo, _ := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	soundCron := repository.SoundCron{
+		ID:       "7b1e2f0c-5d5a-4c8e-9d3b-2f4f1c0de003",
+		Name:     "Drop",
+		GuildID:  "1234567890",
+		Cron:     "* * * * *",
+		Timezone: "UTC",
+		Clip:     repository.Clip{Start: 83500 * time.Millisecond, End: 88500 * time.Millisecond},
+		FadeIn:   500 * time.Millisecond,
+		FadeOut:  time.Second,
+	}
+	if err := repo.Save(ctx, soundCron); err != nil {
+		t.Fatalf("failed to save SoundCron: %v", err)
+	}
+
+	soundCrons, err := repo.List(ctx, soundCron.GuildID)
+	if err != nil {
+		t.Fatalf("failed to list SoundCrons: %v", err)
+	}
+	if len(soundCrons) != 1 || soundCrons[0].Clip != soundCron.Clip {
+		t.Errorf("expected clip %+v, got %+v", soundCron.Clip, soundCrons)
+	}
+	if len(soundCrons) == 1 && (soundCrons[0].FadeIn != soundCron.FadeIn || soundCrons[0].FadeOut != soundCron.FadeOut) {
+		t.Errorf("expected fades of %v and %v, got %+v", soundCron.FadeIn, soundCron.FadeOut, soundCrons[0])
+	}
+}
+
+func TestRepositorySetVolume(t *testing.T) {
+	repo, _ := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	soundCron := repository.SoundCron{
+		ID:       "7b1e2f0c-5d5a-4c8e-9d3b-2f4f1c0de004",
+		Name:     "Quiet Bell",
+		GuildID:  "1234567890",
+		Cron:     "* * * * *",
+		Timezone: "UTC",
+		Status:   repository.SoundCronStatusReady,
+	}
+	if err := repo.Save(ctx, soundCron); err != nil {
+		t.Fatalf("failed to save SoundCron: %v", err)
+	}
+
+	soundCrons, err := repo.List(ctx, soundCron.GuildID)
+	if err != nil {
+		t.Fatalf("failed to list SoundCrons: %v", err)
+	}
+	if len(soundCrons) != 1 || soundCrons[0].Volume != repository.DefaultVolume {
+		t.Fatalf("expected a new SoundCron to play at the default volume, got %+v", soundCrons)
+	}
+
+	if err := repo.SetVolume(ctx, soundCron.ID, 50); err != nil {
+		t.Fatalf("failed to set volume: %v", err)
+	}
+
+	jobs, err := repo.Pull(ctx, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to pull jobs: %v", err)
+	}
+	if len(jobs) == 0 {
+		t.Fatalf("expected jobs for the SoundCron")
+	}
+	for _, job := range jobs {
+		if job.Volume != 50 {
+			t.Errorf("expected pulled job to carry a volume of 50, got %d", job.Volume)
+		}
+	}
+}
+
+func TestRepositorySetPriority(t *testing.T) {
+	repo, _ := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	soundCron := repository.SoundCron{
+		ID:       "7b1e2f0c-5d5a-4c8e-9d3b-2f4f1c0de006",
+		Name:     "Urgent Bell",
+		GuildID:  "1234567890",
+		Cron:     "* * * * *",
+		Timezone: "UTC",
+		Status:   repository.SoundCronStatusReady,
+	}
+	if err := repo.Save(ctx, soundCron); err != nil {
+		t.Fatalf("failed to save SoundCron: %v", err)
+	}
+
+	if err := repo.SetPriority(ctx, soundCron.ID, repository.MaxPriority); err != nil {
+		t.Fatalf("failed to set priority: %v", err)
+	}
+	if err := repo.SetPriority(ctx, soundCron.ID, repository.MaxPriority+1); err == nil {
+		t.Errorf("expected error for a priority above the maximum")
+	}
+
+	jobs, err := repo.Pull(ctx, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to pull jobs: %v", err)
+	}
+	if len(jobs) == 0 {
+		t.Fatalf("expected jobs for the SoundCron")
+	}
+	for _, job := range jobs {
+		if job.Priority != repository.MaxPriority {
+			t.Errorf("expected pulled job to carry a priority of %d, got %d", repository.MaxPriority, job.Priority)
+		}
+	}
+}
+
+func TestRepositorySetChannelSelection(t *testing.T) {
+	repo, _ := getRepositoryAgainstPostgres(t)
+	ctx := t.Context()
+
+	soundCron := repository.SoundCron{
+		ID:        "7b1e2f0c-5d5a-4c8e-9d3b-2f4f1c0de005",
+		Name:      "Roaming Bell",
+		GuildID:   "1234567890",
+		Cron:      "* * * * *",
+		Timezone:  "UTC",
+		CreatorID: "42",
+		Status:    repository.SoundCronStatusReady,
+	}
+	if err := repo.Save(ctx, soundCron); err != nil {
+		t.Fatalf("failed to save SoundCron: %v", err)
+	}
+
+	soundCrons, err := repo.List(ctx, soundCron.GuildID)
+	if err != nil {
+		t.Fatalf("failed to list SoundCrons: %v", err)
+	}
+	if len(soundCrons) != 1 || soundCrons[0].Channels.Strategy != repository.ChannelStrategyMostHumans {
+		t.Fatalf("expected a new SoundCron to play where the most humans are, got %+v", soundCrons)
+	}
+
+	channels := repository.ChannelSelection{
+		Strategy: repository.ChannelStrategyCreator,
+		Deny:     []string{"afk"},
+	}
+	if err := repo.SetChannelSelection(ctx, soundCron.ID, channels); err != nil {
+		t.Fatalf("failed to set channel selection: %v", err)
+	}
+
+	jobs, err := repo.Pull(ctx, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to pull jobs: %v", err)
+	}
+	if len(jobs) == 0 {
+		t.Fatalf("expected jobs for the SoundCron")
+	}
+	for _, job := range jobs {
+		if job.CreatorID != "42" || job.Channels.Strategy != channels.Strategy ||
+			!slices.Equal(job.Channels.Deny, channels.Deny) || len(job.Channels.Allow) != 0 {
+			t.Errorf("expected pulled job to carry creator 42 and %+v, got %+v", channels, job)
+		}
+	}
+}
@@ -1,5 +1,6 @@
 // Package schedule provides utilities for cron expression handling and deferred execution.
 //
 // Cron functions parse and validate cron expressions and compute upcoming run times.
-// RunAt executes a function asynchronously at a specified time.
+// RunAt executes a function asynchronously at a specified time, and WaitUntil
+// waits for a specified time unless it is canceled.
 package schedule
@@ -14,3 +14,15 @@ func RunAt(ctx context.Context, runAt time.Time, execute func(ctx context.Contex
 		execute(ctx)
 	}()
 }
+
+// WaitUntil blocks until t or until ctx is done, and reports whether t was reached.
+func WaitUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,7 @@
+// Package transcoder encodes uploaded soundcron audio outside of the bot.
+//
+// Encoding runs ffmpeg, which can take far longer than the few seconds Discord
+// allows for responding to an interaction. The bot therefore defers its response,
+// queues a Job, and a transcoder process picks the job up, encodes the audio,
+// and reports a Result that the bot uses to edit the deferred response.
+package transcoder
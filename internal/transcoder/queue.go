@@ -0,0 +1,491 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	jobStream    = "soundcron_transcode_jobs"
+	jobGroup     = "soundcron_transcoding_group"
+	resultStream = "soundcron_transcode_results"
+	resultGroup  = "soundcron_transcode_results_group"
+)
+
+// DeadLetterStream is the Redis stream that transcode jobs are moved to
+// once they have been run DeliveryPolicy.MaxDeliveries times without finishing.
+const DeadLetterStream = jobStream + ":dead"
+
+// Keys that are added to a job when it is moved to DeadLetterStream. The other
+// keys are those of the job, so that it can be sent again as it was.
+const (
+	deadLetterMessageIDKey = "deadLetterMessageID"
+	deadLetterReasonKey    = "deadLetterReason"
+)
+
+// DeliveryPolicy controls how jobs that were received but never acknowledged,
+// such as those of a transcoder that stopped while running them, are run again.
+type DeliveryPolicy struct {
+	// AckWait is how long a job may go unacknowledged before
+	// another transcoder claims it. It must be longer than a job takes.
+	AckWait time.Duration
+
+	// MaxDeliveries is how many times a job is delivered before it is given up
+	// and moved to the dead-letter stream.
+	MaxDeliveries int
+}
+
+// NewDeliveryPolicy returns the DeliveryPolicy of transcode jobs configured by audio.
+func NewDeliveryPolicy(audio config.AudioConfig) DeliveryPolicy {
+	return DeliveryPolicy{
+		AckWait:       audio.TranscodeAckWait,
+		MaxDeliveries: audio.TranscodeMaxDeliveries,
+	}
+}
+
+// JobSender is an interface for anything that can queue a Job for a transcoder.
+type JobSender interface {
+	SendJob(ctx context.Context, job Job) error
+}
+
+// JobReceiver is an interface for anything that hands out queued jobs.
+// A job is handed out again if it is not acknowledged once it is processed.
+type JobReceiver interface {
+	ReceiveJobs(ctx context.Context) ([]Job, error)
+	Ack(ctx context.Context, job Job) error
+}
+
+// ResultSender is an interface for anything that can report the Result of a Job.
+type ResultSender interface {
+	SendResult(ctx context.Context, result Result) error
+}
+
+// ResultReceiver is an interface for anything that hands out reported results.
+type ResultReceiver interface {
+	ReceiveResults(ctx context.Context) ([]Result, error)
+}
+
+func createGroup(ctx context.Context, client *redis.Client, stream, group string) error {
+	err := client.XGroupCreateMkStream(ctx, stream, group, "$").Err()
+	if err != nil && err != redis.Nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+		return err
+	}
+	return nil
+}
+
+// RedisQueue passes jobs and results between the bot and transcoders
+// through Redis streams. Jobs stay pending in the stream until they are
+// acknowledged, so that the jobs of a transcoder that stops are run by another.
+type RedisQueue struct {
+	client   *redis.Client
+	consumer string
+	policy   DeliveryPolicy
+
+	lastReclaim time.Time
+}
+
+// NewRedisQueue constructs a RedisQueue using the given Redis client instance.
+// This will create the Redis streams for jobs and results if they don't exist.
+// The consumer name identifies this process within the stream consumer groups.
+// Jobs that are received are delivered again as policy describes.
+func NewRedisQueue(client *redis.Client, consumer string, policy DeliveryPolicy) (*RedisQueue, error) {
+	ctx := context.Background()
+	if err := createGroup(ctx, client, jobStream, jobGroup); err != nil {
+		return nil, fmt.Errorf("failed to create transcode job stream: %w", err)
+	}
+	if err := createGroup(ctx, client, resultStream, resultGroup); err != nil {
+		return nil, fmt.Errorf("failed to create transcode result stream: %w", err)
+	}
+	return &RedisQueue{client: client, consumer: consumer, policy: policy}, nil
+}
+
+func (q *RedisQueue) SendJob(ctx context.Context, job Job) error {
+	return q.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: jobStream,
+		Values: map[string]any{
+			"soundCronID":      job.SoundCronID,
+			"guildID":          job.GuildID,
+			"replace":          strconv.FormatBool(job.Replace),
+			"staged":           strconv.FormatBool(job.Staged),
+			"fileSize":         strconv.FormatInt(job.FileSize, 10),
+			"durationMS":       strconv.FormatInt(job.Audio.Duration.Milliseconds(), 10),
+			"channels":         strconv.Itoa(job.Audio.Channels),
+			"codec":            job.Audio.Codec,
+			"normalize":        strconv.FormatBool(job.Normalize),
+			"clipStartMS":      strconv.FormatInt(job.Clip.Start.Milliseconds(), 10),
+			"clipEndMS":        strconv.FormatInt(job.Clip.End.Milliseconds(), 10),
+			"lengthMS":         strconv.FormatInt(job.Length.Milliseconds(), 10),
+			"fadeInMS":         strconv.FormatInt(job.FadeIn.Milliseconds(), 10),
+			"fadeOutMS":        strconv.FormatInt(job.FadeOut.Milliseconds(), 10),
+			"applicationID":    job.ApplicationID,
+			"interactionToken": job.InteractionToken,
+			"successMessage":   job.SuccessMessage,
+		},
+	}).Err()
+}
+
+func (q *RedisQueue) SendResult(ctx context.Context, result Result) error {
+	return q.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: resultStream,
+		Values: map[string]any{
+			"soundCronID":      result.SoundCronID,
+			"applicationID":    result.ApplicationID,
+			"interactionToken": result.InteractionToken,
+			"message":          result.Message,
+			"failed":           strconv.FormatBool(result.Failed),
+		},
+	}).Err()
+}
+
+// read reads a batch of messages from a stream and acknowledges every message
+// that parse accepts. Messages that can not be parsed are logged and acknowledged
+// so they are not handed out again.
+func read[T any](
+	ctx context.Context,
+	q *RedisQueue,
+	stream, group string,
+	parse func(redis.XMessage) (T, error),
+) ([]T, error) {
+	streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: q.consumer,
+		Streams:  []string{stream, ">"},
+		Block:    0,
+		Count:    10,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from Redis stream: %w", err)
+	}
+
+	var (
+		items []T
+		errs  []error
+	)
+	for _, s := range streams {
+		for _, msg := range s.Messages {
+			item, err := parse(msg)
+			if err != nil {
+				slog.Error("dropping malformed message", "stream", stream, "messageID", msg.ID, "error", err)
+			} else {
+				items = append(items, item)
+			}
+
+			if _, err := q.client.XAck(ctx, stream, group, msg.ID).Result(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to acknowledge message %s: %w", msg.ID, err))
+			}
+		}
+	}
+	return items, errors.Join(errs...)
+}
+
+// ReceiveJobs returns a job that another transcoder left unacknowledged for
+// longer than the AckWait of the policy, or else a new job. It hands out one
+// job at a time, so that a job is only received once it can run, and does not
+// sit idle until it is claimed by another transcoder. It waits for a new job
+// for a fraction of AckWait at most, so that it must be called in a loop for
+// stale jobs to be claimed. Jobs that can not be read are dropped.
+func (q *RedisQueue) ReceiveJobs(ctx context.Context) ([]Job, error) {
+	var messages []redis.XMessage
+	// Stale jobs are claimed when the transcoder starts, and then every so often,
+	// since a transcoder can stop at any time.
+	if time.Since(q.lastReclaim) >= q.policy.AckWait {
+		reclaimed, err := q.reclaim(ctx)
+		switch {
+		case err != nil:
+			slog.ErrorContext(ctx, "failed to reclaim stale transcode jobs", slog.Any("error", err))
+		case reclaimed == nil:
+			// None are left to claim until more go stale.
+			q.lastReclaim = time.Now()
+		default:
+			messages = append(messages, *reclaimed)
+		}
+	}
+
+	if len(messages) == 0 {
+		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    jobGroup,
+			Consumer: q.consumer,
+			Streams:  []string{jobStream, ">"},
+			Block:    q.policy.AckWait / 3,
+			Count:    1,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("failed to read from Redis stream: %w", err)
+		}
+		for _, stream := range streams {
+			messages = append(messages, stream.Messages...)
+		}
+	}
+
+	var jobs []Job
+	for _, msg := range messages {
+		job, err := parseJob(msg)
+		if err != nil {
+			slog.ErrorContext(ctx, "dropping malformed message", "stream", jobStream, "messageID", msg.ID, "error", err)
+			if err := q.client.XAck(ctx, jobStream, jobGroup, msg.ID).Err(); err != nil {
+				return jobs, fmt.Errorf("failed to acknowledge message %s: %w", msg.ID, err)
+			}
+			continue
+		}
+		job.DeliveryID = msg.ID
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Ack acknowledges a job once it has been processed, whether it succeeded
+// or failed, so that it is not run again.
+func (q *RedisQueue) Ack(ctx context.Context, job Job) error {
+	if job.DeliveryID == "" {
+		return nil
+	}
+	if err := q.client.XAck(ctx, jobStream, jobGroup, job.DeliveryID).Err(); err != nil {
+		return fmt.Errorf("failed to acknowledge transcode job %s: %w", job.DeliveryID, err)
+	}
+	return nil
+}
+
+// reclaim claims a job that another transcoder has left unacknowledged for
+// longer than the AckWait of the policy, and returns it to be run again, or nil
+// if there is none. Jobs that have been delivered too many times are moved to
+// DeadLetterStream.
+func (q *RedisQueue) reclaim(ctx context.Context) (*redis.XMessage, error) {
+	start := "0-0"
+	for {
+		claimed, next, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   jobStream,
+			Group:    jobGroup,
+			Consumer: q.consumer,
+			MinIdle:  q.policy.AckWait,
+			Start:    start,
+			Count:    1,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim stale transcode jobs: %w", err)
+		}
+
+		for _, msg := range claimed {
+			pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream: jobStream,
+				Group:  jobGroup,
+				Start:  msg.ID,
+				End:    msg.ID,
+				Count:  1,
+			}).Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to list pending transcode jobs: %w", err)
+			}
+			if len(pending) == 1 && pending[0].RetryCount > int64(q.policy.MaxDeliveries) {
+				// The soundcron stays as it was, so it can be replaced again.
+				slog.ErrorContext(
+					ctx, "giving up transcode job",
+					"messageID", msg.ID,
+					"soundCronID", msg.Values["soundCronID"],
+					"deliveries", pending[0].RetryCount,
+				)
+				reason := fmt.Sprintf("not acknowledged after %d deliveries", q.policy.MaxDeliveries)
+				if err := q.deadLetter(ctx, msg, reason); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return &msg, nil
+		}
+
+		if next == "0-0" || next == "" {
+			return nil, nil
+		}
+		start = next
+	}
+}
+
+// deadLetter moves msg to DeadLetterStream, with why it was given up.
+func (q *RedisQueue) deadLetter(ctx context.Context, msg redis.XMessage, reason string) error {
+	values := maps.Clone(msg.Values)
+	values[deadLetterMessageIDKey] = msg.ID
+	values[deadLetterReasonKey] = reason
+
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: DeadLetterStream,
+			Values: values,
+		})
+		pipe.XAck(ctx, jobStream, jobGroup, msg.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter message %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+func (q *RedisQueue) ReceiveResults(ctx context.Context) ([]Result, error) {
+	return read(ctx, q, resultStream, resultGroup, parseResult)
+}
+
+func getString(msg redis.XMessage, key string) (string, error) {
+	v, ok := msg.Values[key]
+	if !ok {
+		return "", fmt.Errorf("missing key %q", key)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("key %q is not a string", key)
+	}
+	return s, nil
+}
+
+func getBool(msg redis.XMessage, key string) (bool, error) {
+	s, err := getString(msg, key)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("key %q is not a boolean: %w", key, err)
+	}
+	return b, nil
+}
+
+// getMilliseconds reads a duration that was written as a number of milliseconds.
+// Keys that are missing, such as those of jobs queued before the key existed,
+// are read as zero.
+func getMilliseconds(msg redis.XMessage, key string) (time.Duration, error) {
+	if _, ok := msg.Values[key]; !ok {
+		return 0, nil
+	}
+	s, err := getString(msg, key)
+	if err != nil {
+		return 0, err
+	}
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("key %q is not an integer: %w", key, err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// getInt reads an integer. Keys that are missing, such as those of jobs
+// queued before the key existed, are read as zero.
+func getInt(msg redis.XMessage, key string) (int64, error) {
+	if _, ok := msg.Values[key]; !ok {
+		return 0, nil
+	}
+	s, err := getString(msg, key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("key %q is not an integer: %w", key, err)
+	}
+	return n, nil
+}
+
+func parseJob(msg redis.XMessage) (Job, error) {
+	var (
+		job Job
+		err error
+	)
+	if job.SoundCronID, err = getString(msg, "soundCronID"); err != nil {
+		return Job{}, err
+	}
+	// Jobs queued before quotas were checked on encoding do not have the key.
+	if _, ok := msg.Values["guildID"]; ok {
+		if job.GuildID, err = getString(msg, "guildID"); err != nil {
+			return Job{}, err
+		}
+	}
+	if job.Replace, err = getBool(msg, "replace"); err != nil {
+		return Job{}, err
+	}
+	// Jobs queued before staging existed encode the original upload.
+	if _, ok := msg.Values["staged"]; ok {
+		if job.Staged, err = getBool(msg, "staged"); err != nil {
+			return Job{}, err
+		}
+	}
+	if job.FileSize, err = getInt(msg, "fileSize"); err != nil {
+		return Job{}, err
+	}
+	if job.Audio.Duration, err = getMilliseconds(msg, "durationMS"); err != nil {
+		return Job{}, err
+	}
+	channels, err := getInt(msg, "channels")
+	if err != nil {
+		return Job{}, err
+	}
+	job.Audio.Channels = int(channels)
+	if _, ok := msg.Values["codec"]; ok {
+		if job.Audio.Codec, err = getString(msg, "codec"); err != nil {
+			return Job{}, err
+		}
+	}
+	// Jobs queued before normalization existed do not have the key.
+	if _, ok := msg.Values["normalize"]; ok {
+		if job.Normalize, err = getBool(msg, "normalize"); err != nil {
+			return Job{}, err
+		}
+	}
+	if job.Clip.Start, err = getMilliseconds(msg, "clipStartMS"); err != nil {
+		return Job{}, err
+	}
+	if job.Clip.End, err = getMilliseconds(msg, "clipEndMS"); err != nil {
+		return Job{}, err
+	}
+	if job.Length, err = getMilliseconds(msg, "lengthMS"); err != nil {
+		return Job{}, err
+	}
+	if job.FadeIn, err = getMilliseconds(msg, "fadeInMS"); err != nil {
+		return Job{}, err
+	}
+	if job.FadeOut, err = getMilliseconds(msg, "fadeOutMS"); err != nil {
+		return Job{}, err
+	}
+	if job.ApplicationID, err = getString(msg, "applicationID"); err != nil {
+		return Job{}, err
+	}
+	if job.InteractionToken, err = getString(msg, "interactionToken"); err != nil {
+		return Job{}, err
+	}
+	if job.SuccessMessage, err = getString(msg, "successMessage"); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+func parseResult(msg redis.XMessage) (Result, error) {
+	var (
+		result Result
+		err    error
+	)
+	if result.SoundCronID, err = getString(msg, "soundCronID"); err != nil {
+		return Result{}, err
+	}
+	if result.ApplicationID, err = getString(msg, "applicationID"); err != nil {
+		return Result{}, err
+	}
+	if result.InteractionToken, err = getString(msg, "interactionToken"); err != nil {
+		return Result{}, err
+	}
+	if result.Message, err = getString(msg, "message"); err != nil {
+		return Result{}, err
+	}
+	if result.Failed, err = getBool(msg, "failed"); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+var _ JobSender = (*RedisQueue)(nil)
+var _ JobReceiver = (*RedisQueue)(nil)
+var _ ResultSender = (*RedisQueue)(nil)
+var _ ResultReceiver = (*RedisQueue)(nil)
@@ -0,0 +1,53 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+// ErrQuotaExceeded is returned when a guild stores more audio than its quota allows.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// QuotaExceededMessage is shown to the user when encoded audio
+// does not fit in the storage quota of its guild.
+const QuotaExceededMessage = "The processed audio does not fit in this server's storage quota, so the soundcron will not play. " +
+	"Delete other soundcrons, or use `/soundcron replace` with shorter audio."
+
+// QuotaChecker checks the storage used by a guild once the size of its
+// encoded audio is known, which is only estimated when audio is uploaded.
+type QuotaChecker struct {
+	SoundCrons repository.SoundCronLister
+
+	// GuildSettings holds the storage quota of each guild.
+	// Every guild gets the default quota when it is nil.
+	GuildSettings repository.GuildSettingsGetter
+}
+
+// Check returns ErrQuotaExceeded if the soundcrons of a guild,
+// both their uploaded and encoded audio, take up more than its quota.
+func (q *QuotaChecker) Check(ctx context.Context, guildID string) error {
+	settings := repository.DefaultGuildSettings(guildID)
+	if q.GuildSettings != nil {
+		var err error
+		settings, err = q.GuildSettings.GetGuildSettings(ctx, guildID)
+		if err != nil {
+			return fmt.Errorf("failed to get guild settings: %w", err)
+		}
+	}
+
+	soundCrons, err := q.SoundCrons.List(ctx, guildID)
+	if err != nil {
+		return fmt.Errorf("failed to list soundcrons: %w", err)
+	}
+	var used int64
+	for _, soundCron := range soundCrons {
+		used += soundCron.StorageSize()
+	}
+	if used > settings.StorageQuota {
+		return fmt.Errorf("%w: %d of %d bytes used", ErrQuotaExceeded, used, settings.StorageQuota)
+	}
+	return nil
+}
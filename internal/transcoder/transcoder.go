@@ -0,0 +1,364 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/config"
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/opus"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/util"
+)
+
+// FailureMessage is shown to the user when the audio of a new soundcron
+// could not be encoded.
+const FailureMessage = "The audio could not be processed, so the soundcron will not play. " +
+	"Make sure it is a valid audio file, then use `/soundcron replace` to try again."
+
+// ReplaceFailureMessage is shown to the user when replacement audio
+// could not be encoded.
+const ReplaceFailureMessage = "The new audio could not be processed. Make sure it is a valid audio file and try again."
+
+// AudioErrorMessage describes to the user why their audio could not be processed,
+// or returns an empty string if err is not a known problem with the audio.
+func AudioErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, opus.ErrNoAudioStream):
+		return "The file does not contain any audio."
+	case errors.Is(err, opus.ErrTruncatedInput):
+		return "The file is incomplete or corrupted. Try uploading it again."
+	case errors.Is(err, opus.ErrUnsupportedFormat):
+		return "The file is not in a supported audio format. Try converting it to MP3 or OGG first."
+	case errors.Is(err, opus.ErrTimeout):
+		return "The audio took too long to process. Try a shorter or smaller file."
+	}
+	return ""
+}
+
+// failureMessage is shown to the user when a job fails with err.
+func failureMessage(err error, replace bool) string {
+	reason := AudioErrorMessage(err)
+	switch {
+	case reason == "" && replace:
+		return ReplaceFailureMessage
+	case reason == "":
+		return FailureMessage
+	case replace:
+		return reason + " The previous audio is kept."
+	default:
+		return reason + " The soundcron will not play until you use `/soundcron replace` with other audio."
+	}
+}
+
+// Job is a request to encode the uploaded audio of a soundcron.
+type Job struct {
+	// SoundCronID is the ID of the soundcron whose uploaded audio is encoded.
+	SoundCronID string
+
+	// GuildID is the guild of the soundcron, whose storage quota the
+	// encoded audio must fit in. It is not checked when GuildID is empty.
+	GuildID string
+
+	// Replace is set when the job replaces the audio of a soundcron
+	// that may already be playable. A failed replacement keeps
+	// the previous audio and status of the soundcron.
+	Replace bool
+
+	// Staged is set when the job encodes new audio, which is read from
+	// datalayer.StagedAudioKey and only replaces the original upload once
+	// it is encoded. Other jobs encode the original upload again.
+	Staged bool
+
+	// FileSize is the size of the staged audio,
+	// which is recorded on the soundcron once it is encoded.
+	FileSize int64
+
+	// Audio is what probing found about the audio, which is zero if it was
+	// not probed. A known duration keeps audio that is encoded whole from
+	// being trimmed. The audio of a staged job is recorded on the soundcron
+	// once it is encoded.
+	Audio repository.AudioMetadata
+
+	// Normalize is set when the loudness of the audio should be normalized.
+	Normalize bool
+
+	// Clip is the part of the uploaded audio that is encoded.
+	Clip repository.Clip
+
+	// Length is how long the clip is. Audio that runs longer is cut,
+	// such as audio whose length was not known when the job was queued.
+	// Zero leaves the clip as long as it is, without a fade out.
+	Length time.Duration
+
+	// FadeIn and FadeOut are how long the clip takes to fade in
+	// at its start and to fade out before its end.
+	FadeIn  time.Duration
+	FadeOut time.Duration
+
+	// ApplicationID and InteractionToken identify the deferred interaction
+	// response that is edited with the result. They are empty when
+	// nobody is waiting on the result.
+	ApplicationID    string
+	InteractionToken string
+
+	// SuccessMessage is shown to the user if encoding succeeds.
+	SuccessMessage string
+
+	// DeliveryID identifies the delivery of the job to the JobReceiver
+	// that received it, which uses it to acknowledge the job.
+	// It is empty for jobs that were not received.
+	DeliveryID string
+}
+
+// Result is the outcome of a Job.
+type Result struct {
+	SoundCronID      string
+	ApplicationID    string
+	InteractionToken string
+
+	// Message is the user-facing description of the outcome.
+	Message string
+
+	// Failed is whether the job failed.
+	Failed bool
+}
+
+// EncodeFunc encodes audio to the format stored for playback.
+type EncodeFunc func(r io.Reader) (io.ReadCloser, error)
+
+// SoundCronUpdater records the outcome of a Job on the soundcron.
+type SoundCronUpdater interface {
+	repository.SoundCronStatusSetter
+	repository.SoundCronFileSizeUpdater
+	repository.SoundCronEncodedSizeUpdater
+	repository.SoundCronAudioMetadataUpdater
+}
+
+// EncoderFunc returns the EncodeFunc that processes audio as described by opts
+// and stores it in format.
+type EncoderFunc func(opts opus.FFmpegOptions, format opus.Format) EncodeFunc
+
+// FFmpegEncoder is the default EncoderFunc, which shells out to ffmpeg
+// unless the audio is already OGG/Opus that opts leave unchanged.
+func FFmpegEncoder(opts opus.FFmpegOptions, format opus.Format) EncodeFunc {
+	encoder := opus.NewEncoder(opus.NewTranscode(opts))
+	encoder.Format = format
+	return encoder.Encode
+}
+
+// Transcoder encodes uploaded audio from blob storage and records
+// the outcome on the soundcron.
+type Transcoder struct {
+	Blobs      datalayer.BlobStorage
+	SoundCrons SoundCronUpdater
+	Encoder    EncoderFunc
+
+	// TargetLUFS is the loudness that jobs which normalize are brought to.
+	TargetLUFS float64
+
+	// Format is the format that encoded audio is stored in.
+	Format opus.Format
+
+	// Limits bounds the resources that ffmpeg may use for a job.
+	Limits opus.FFmpegLimits
+
+	// Quota fails jobs whose encoded audio takes their guild over its
+	// storage quota. Quotas are not checked when it is nil.
+	Quota *QuotaChecker
+}
+
+// NewTranscoder constructs a Transcoder that encodes with ffmpeg as configured by audio.
+func NewTranscoder(blobs datalayer.BlobStorage, soundCrons SoundCronUpdater, audio config.AudioConfig) *Transcoder {
+	return &Transcoder{
+		Blobs:      blobs,
+		SoundCrons: soundCrons,
+		Encoder:    FFmpegEncoder,
+		TargetLUFS: audio.TargetLUFS,
+		Format:     audio.StorageFormat,
+		Limits:     audio.FFmpegLimits(),
+	}
+}
+
+// options returns how the audio of a job is processed before it is encoded.
+func (t *Transcoder) options(job Job) opus.FFmpegOptions {
+	return opus.FFmpegOptions{
+		Normalize:  job.Normalize,
+		TargetLUFS: t.TargetLUFS,
+		Start:      job.Clip.Start,
+		End:        job.Clip.End,
+		Length:     job.Length,
+		Duration:   job.Audio.Duration,
+		FadeIn:     job.FadeIn,
+		FadeOut:    job.FadeOut,
+		Limits:     t.Limits,
+	}
+}
+
+// sourceKey returns the blob storage key of the audio that job encodes.
+func (job Job) sourceKey() string {
+	if job.Staged {
+		return datalayer.StagedAudioKey(job.SoundCronID)
+	}
+	return datalayer.UploadedAudioKey(job.SoundCronID)
+}
+
+// Transcode encodes the audio at sourceKey, which must already be in blob
+// storage, to the opus frames that are streamed when the soundcron plays.
+// It returns the size of the encoded audio.
+func (t *Transcoder) Transcode(ctx context.Context, sourceKey, soundCronID string, encode EncodeFunc) (int64, error) {
+	uploaded, err := t.Blobs.Get(ctx, sourceKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get uploaded file from blob storage for conversion: %w", err)
+	}
+	defer uploaded.Close()
+
+	encoded, err := encode(uploaded)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode opus: %w", err)
+	}
+	defer encoded.Close()
+
+	// The encoded size is not known until encoding finishes,
+	// so it is measured as it is streamed to blob storage.
+	counter := &util.CountingReader{R: encoded}
+	err = t.Blobs.Put(ctx, datalayer.OpusAudioKey(soundCronID), counter, datalayer.PutOptions{
+		Size:        -1,
+		ContentType: t.Format.ContentType(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload opus file to blob storage: %w", err)
+	}
+	return counter.N, nil
+}
+
+// Process runs a Job and records the outcome on the soundcron.
+// A soundcron only becomes ready, and therefore scheduled, once its audio is encoded.
+func (t *Transcoder) Process(ctx context.Context, job Job) Result {
+	result := Result{
+		SoundCronID:      job.SoundCronID,
+		ApplicationID:    job.ApplicationID,
+		InteractionToken: job.InteractionToken,
+		Message:          job.SuccessMessage,
+	}
+
+	encodedSize, err := t.Transcode(ctx, job.sourceKey(), job.SoundCronID, t.Encoder(t.options(job), t.Format))
+	if err != nil {
+		slog.Error(
+			"failed to transcode soundcron audio",
+			"error", err,
+			"soundcron_id", job.SoundCronID,
+			"replace", job.Replace,
+			"normalize", job.Normalize,
+			"clip_start", job.Clip.Start,
+			"clip_end", job.Clip.End,
+		)
+		result.Failed = true
+		result.Message = failureMessage(err, job.Replace)
+		if job.Staged {
+			t.discardStaged(ctx, job.SoundCronID)
+		}
+		if job.Replace {
+			// Blob storage only swaps an object once it is fully written,
+			// so the previous opus file is still in place.
+			return result
+		}
+		if err := t.SoundCrons.SetStatus(ctx, job.SoundCronID, repository.SoundCronStatusFailed); err != nil {
+			slog.Error("failed to mark soundcron as failed", "error", err, "soundcron_id", job.SoundCronID)
+		}
+		return result
+	}
+
+	if err := t.SoundCrons.UpdateEncodedSize(ctx, job.SoundCronID, encodedSize); err != nil {
+		slog.Error("failed to update encoded size", "error", err, "soundcron_id", job.SoundCronID)
+	}
+
+	if job.Staged {
+		// The new audio already plays, so failing to keep it as the original
+		// only leaves the previous upload to be encoded again after an edit.
+		if err := t.promote(ctx, job); err != nil {
+			slog.Error("failed to replace uploaded audio", "error", err, "soundcron_id", job.SoundCronID)
+		}
+	}
+
+	if err := t.checkQuota(ctx, job); errors.Is(err, ErrQuotaExceeded) {
+		slog.Warn("encoded audio exceeds storage quota", "error", err, "soundcron_id", job.SoundCronID, "guild_id", job.GuildID)
+		t.discardEncoded(ctx, job.SoundCronID)
+		result.Failed = true
+		result.Message = QuotaExceededMessage
+		return result
+	} else if err != nil {
+		// The quota was checked when the audio was uploaded,
+		// so the job is not failed when it cannot be checked again.
+		slog.Error("failed to check storage quota", "error", err, "soundcron_id", job.SoundCronID, "guild_id", job.GuildID)
+	}
+
+	if err := t.SoundCrons.SetStatus(ctx, job.SoundCronID, repository.SoundCronStatusReady); err != nil {
+		slog.Error("failed to mark soundcron as ready", "error", err, "soundcron_id", job.SoundCronID)
+		result.Failed = true
+		result.Message = "Internal server error - please try again later"
+	}
+	return result
+}
+
+// checkQuota checks that the guild of a job is within its storage quota
+// now that the encoded size of its audio is recorded.
+func (t *Transcoder) checkQuota(ctx context.Context, job Job) error {
+	if t.Quota == nil || job.GuildID == "" {
+		return nil
+	}
+	return t.Quota.Check(ctx, job.GuildID)
+}
+
+// discardEncoded deletes encoded audio that does not fit in the storage quota.
+// The previous encoded audio of a replacement is already overwritten,
+// so the soundcron is marked failed either way.
+func (t *Transcoder) discardEncoded(ctx context.Context, soundCronID string) {
+	key := datalayer.OpusAudioKey(soundCronID)
+	if err := t.Blobs.Delete(ctx, key); err != nil {
+		slog.Error("failed to delete encoded audio", "key", key, "error", err)
+	}
+	if err := t.SoundCrons.UpdateEncodedSize(ctx, soundCronID, 0); err != nil {
+		slog.Error("failed to update encoded size", "error", err, "soundcron_id", soundCronID)
+	}
+	if err := t.SoundCrons.SetStatus(ctx, soundCronID, repository.SoundCronStatusFailed); err != nil {
+		slog.Error("failed to mark soundcron as failed", "error", err, "soundcron_id", soundCronID)
+	}
+}
+
+// promote makes the staged audio of a job the original upload of the
+// soundcron, and records its size and metadata.
+func (t *Transcoder) promote(ctx context.Context, job Job) error {
+	staged, err := t.Blobs.Get(ctx, datalayer.StagedAudioKey(job.SoundCronID))
+	if err != nil {
+		return fmt.Errorf("failed to get staged audio from blob storage: %w", err)
+	}
+	defer staged.Close()
+
+	err = t.Blobs.Put(ctx, datalayer.UploadedAudioKey(job.SoundCronID), staged, datalayer.PutOptions{
+		Size: job.FileSize,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload replaced audio to blob storage: %w", err)
+	}
+	if err := t.SoundCrons.UpdateFileSize(ctx, job.SoundCronID, job.FileSize); err != nil {
+		return fmt.Errorf("failed to update file size: %w", err)
+	}
+	if err := t.SoundCrons.UpdateAudioMetadata(ctx, job.SoundCronID, job.Audio); err != nil {
+		return fmt.Errorf("failed to update audio metadata: %w", err)
+	}
+	t.discardStaged(ctx, job.SoundCronID)
+	return nil
+}
+
+// discardStaged deletes the staged audio of a job once it is no longer needed.
+func (t *Transcoder) discardStaged(ctx context.Context, soundCronID string) {
+	key := datalayer.StagedAudioKey(soundCronID)
+	if err := t.Blobs.Delete(ctx, key); err != nil {
+		slog.Error("failed to delete staged audio", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,465 @@
+package transcoder_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/config"
+	"github.com/glizzus/sound-off/internal/datalayer"
+	"github.com/glizzus/sound-off/internal/opus"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/transcoder"
+)
+
+type fakeBlobStorage struct {
+	objects map[string][]byte
+}
+
+func (f *fakeBlobStorage) Put(ctx context.Context, key string, data io.Reader, opts datalayer.PutOptions) error {
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	f.objects[key] = b
+	return nil
+}
+
+func (f *fakeBlobStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	b, ok := f.objects[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (f *fakeBlobStorage) Delete(ctx context.Context, key string) error {
+	delete(f.objects, key)
+	return nil
+}
+
+type fakeSoundCronUpdater struct {
+	statuses     map[string]repository.SoundCronStatus
+	fileSizes    map[string]int64
+	encodedSizes map[string]int64
+	audio        map[string]repository.AudioMetadata
+}
+
+func (f *fakeSoundCronUpdater) SetStatus(ctx context.Context, id string, status repository.SoundCronStatus) error {
+	f.statuses[id] = status
+	return nil
+}
+
+func (f *fakeSoundCronUpdater) UpdateFileSize(ctx context.Context, id string, fileSize int64) error {
+	f.fileSizes[id] = fileSize
+	return nil
+}
+
+func (f *fakeSoundCronUpdater) UpdateAudioMetadata(ctx context.Context, id string, audio repository.AudioMetadata) error {
+	f.audio[id] = audio
+	return nil
+}
+
+func (f *fakeSoundCronUpdater) UpdateEncodedSize(ctx context.Context, id string, encodedSize int64) error {
+	f.encodedSizes[id] = encodedSize
+	return nil
+}
+
+func upperEncode(r io.Reader) (io.ReadCloser, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(strings.ToUpper(string(b)))), nil
+}
+
+func failingEncode(r io.Reader) (io.ReadCloser, error) {
+	return nil, errors.New("ffmpeg exited with status 1")
+}
+
+// ffmpegFailure returns an EncodeFunc that fails like ffmpeg does for the given kind of bad audio.
+func ffmpegFailure(kind error) transcoder.EncodeFunc {
+	return func(r io.Reader) (io.ReadCloser, error) {
+		return nil, &opus.FFmpegError{Program: "ffmpeg", ExitCode: 1, Err: kind}
+	}
+}
+
+func TestTranscoderProcess(t *testing.T) {
+	tc := []struct {
+		name       string
+		job        transcoder.Job
+		encode     transcoder.EncodeFunc
+		wantFailed bool
+		wantStatus repository.SoundCronStatus
+		wantMsg    string
+	}{
+		{
+			name:       "Encoded soundcron is marked ready",
+			job:        transcoder.Job{SoundCronID: "sc-1", SuccessMessage: "Added!"},
+			encode:     upperEncode,
+			wantStatus: repository.SoundCronStatusReady,
+			wantMsg:    "Added!",
+		},
+		{
+			name:       "Failed soundcron is marked failed",
+			job:        transcoder.Job{SoundCronID: "sc-1", SuccessMessage: "Added!"},
+			encode:     failingEncode,
+			wantFailed: true,
+			wantStatus: repository.SoundCronStatusFailed,
+			wantMsg:    transcoder.FailureMessage,
+		},
+		{
+			name:       "Edited soundcron encodes its original upload again",
+			job:        transcoder.Job{SoundCronID: "sc-1", Replace: true, SuccessMessage: "Updated!"},
+			encode:     upperEncode,
+			wantStatus: repository.SoundCronStatusReady,
+			wantMsg:    "Updated!",
+		},
+		{
+			name:       "Failed replacement keeps the previous status",
+			job:        transcoder.Job{SoundCronID: "sc-1", Replace: true, SuccessMessage: "Replaced!"},
+			encode:     failingEncode,
+			wantFailed: true,
+			wantMsg:    transcoder.ReplaceFailureMessage,
+		},
+		{
+			name:       "Unsupported audio is described to the user",
+			job:        transcoder.Job{SoundCronID: "sc-1", SuccessMessage: "Added!"},
+			encode:     ffmpegFailure(opus.ErrUnsupportedFormat),
+			wantFailed: true,
+			wantStatus: repository.SoundCronStatusFailed,
+			wantMsg: "The file is not in a supported audio format. Try converting it to MP3 or OGG first. " +
+				"The soundcron will not play until you use `/soundcron replace` with other audio.",
+		},
+		{
+			name:       "Truncated replacement is described to the user",
+			job:        transcoder.Job{SoundCronID: "sc-1", Replace: true, SuccessMessage: "Replaced!"},
+			encode:     ffmpegFailure(opus.ErrTruncatedInput),
+			wantFailed: true,
+			wantMsg:    "The file is incomplete or corrupted. Try uploading it again. The previous audio is kept.",
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			blobs := &fakeBlobStorage{objects: map[string][]byte{
+				datalayer.UploadedAudioKey("sc-1"): []byte("ding"),
+			}}
+			soundCrons := &fakeSoundCronUpdater{
+				statuses:     map[string]repository.SoundCronStatus{},
+				fileSizes:    map[string]int64{},
+				encodedSizes: map[string]int64{},
+				audio:        map[string]repository.AudioMetadata{},
+			}
+			tr := &transcoder.Transcoder{
+				Blobs:      blobs,
+				SoundCrons: soundCrons,
+				Encoder: func(opts opus.FFmpegOptions, format opus.Format) transcoder.EncodeFunc {
+					return testCase.encode
+				},
+			}
+
+			result := tr.Process(t.Context(), testCase.job)
+			if result.Failed != testCase.wantFailed || result.Message != testCase.wantMsg {
+				t.Errorf("Process() = %+v, want failed=%v message=%q", result, testCase.wantFailed, testCase.wantMsg)
+			}
+			if soundCrons.statuses["sc-1"] != testCase.wantStatus {
+				t.Errorf("expected status %q, got %q", testCase.wantStatus, soundCrons.statuses["sc-1"])
+			}
+			if testCase.wantFailed {
+				return
+			}
+			if string(blobs.objects[datalayer.OpusAudioKey("sc-1")]) != "DING" {
+				t.Errorf("expected encoded audio to be stored, got %q", blobs.objects[datalayer.OpusAudioKey("sc-1")])
+			}
+			if soundCrons.encodedSizes["sc-1"] != 4 {
+				t.Errorf("expected encoded size of 4, got %d", soundCrons.encodedSizes["sc-1"])
+			}
+		})
+	}
+}
+
+func TestTranscoderProcessReplace(t *testing.T) {
+	audio := repository.AudioMetadata{Duration: 3 * time.Second, Channels: 2, Codec: "mp3"}
+	tc := []struct {
+		name         string
+		encode       transcoder.EncodeFunc
+		wantUploaded string
+		wantOpus     string
+		wantFileSize int64
+	}{
+		{
+			name:         "Encoded replacement becomes the original audio",
+			encode:       upperEncode,
+			wantUploaded: "dong",
+			wantOpus:     "DONG",
+			wantFileSize: 4,
+		},
+		{
+			name:         "Failed replacement keeps the original audio",
+			encode:       failingEncode,
+			wantUploaded: "ding",
+			wantOpus:     "DING",
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			blobs := &fakeBlobStorage{objects: map[string][]byte{
+				datalayer.UploadedAudioKey("sc-1"): []byte("ding"),
+				datalayer.OpusAudioKey("sc-1"):     []byte("DING"),
+				datalayer.StagedAudioKey("sc-1"):   []byte("dong"),
+			}}
+			soundCrons := &fakeSoundCronUpdater{
+				statuses:     map[string]repository.SoundCronStatus{},
+				fileSizes:    map[string]int64{},
+				encodedSizes: map[string]int64{},
+				audio:        map[string]repository.AudioMetadata{},
+			}
+			tr := &transcoder.Transcoder{
+				Blobs:      blobs,
+				SoundCrons: soundCrons,
+				Encoder: func(opts opus.FFmpegOptions, format opus.Format) transcoder.EncodeFunc {
+					return testCase.encode
+				},
+			}
+
+			tr.Process(t.Context(), transcoder.Job{SoundCronID: "sc-1", Replace: true, Staged: true, FileSize: 4, Audio: audio})
+
+			if got := string(blobs.objects[datalayer.UploadedAudioKey("sc-1")]); got != testCase.wantUploaded {
+				t.Errorf("expected uploaded audio %q, got %q", testCase.wantUploaded, got)
+			}
+			if got := string(blobs.objects[datalayer.OpusAudioKey("sc-1")]); got != testCase.wantOpus {
+				t.Errorf("expected encoded audio %q, got %q", testCase.wantOpus, got)
+			}
+			if _, ok := blobs.objects[datalayer.StagedAudioKey("sc-1")]; ok {
+				t.Errorf("expected the staged audio to be deleted")
+			}
+			if got := soundCrons.fileSizes["sc-1"]; got != testCase.wantFileSize {
+				t.Errorf("expected file size %d, got %d", testCase.wantFileSize, got)
+			}
+			if testCase.wantFileSize != 0 && soundCrons.audio["sc-1"] != audio {
+				t.Errorf("expected audio metadata %+v, got %+v", audio, soundCrons.audio["sc-1"])
+			}
+		})
+	}
+}
+
+func TestTranscoderProcessOptions(t *testing.T) {
+	blobs := &fakeBlobStorage{objects: map[string][]byte{
+		datalayer.UploadedAudioKey("sc-1"): []byte("ding"),
+	}}
+	soundCrons := &fakeSoundCronUpdater{
+		statuses:     map[string]repository.SoundCronStatus{},
+		fileSizes:    map[string]int64{},
+		encodedSizes: map[string]int64{},
+		audio:        map[string]repository.AudioMetadata{},
+	}
+
+	var got opus.FFmpegOptions
+	var gotFormat opus.Format
+	tr := &transcoder.Transcoder{
+		Blobs:      blobs,
+		SoundCrons: soundCrons,
+		Encoder: func(opts opus.FFmpegOptions, format opus.Format) transcoder.EncodeFunc {
+			got, gotFormat = opts, format
+			return upperEncode
+		},
+		TargetLUFS: -14,
+		Format:     opus.FormatOgg,
+	}
+
+	clip := repository.Clip{Start: 83500 * time.Millisecond, End: 88500 * time.Millisecond}
+	result := tr.Process(t.Context(), transcoder.Job{
+		SoundCronID: "sc-1",
+		Normalize:   true,
+		Clip:        clip,
+		Length:      5 * time.Second,
+		Audio:       repository.AudioMetadata{Duration: 3 * time.Minute},
+		FadeIn:      500 * time.Millisecond,
+		FadeOut:     time.Second,
+	})
+	if result.Failed {
+		t.Fatalf("unexpected failure: %+v", result)
+	}
+
+	want := opus.FFmpegOptions{
+		Duration:   3 * time.Minute,
+		Normalize:  true,
+		TargetLUFS: -14,
+		Start:      clip.Start,
+		End:        clip.End,
+		Length:     5 * time.Second,
+		FadeIn:     500 * time.Millisecond,
+		FadeOut:    time.Second,
+	}
+	if got != want {
+		t.Errorf("encoded with options %+v, want %+v", got, want)
+	}
+	if gotFormat != opus.FormatOgg {
+		t.Errorf("encoded as %v, want %v", gotFormat, opus.FormatOgg)
+	}
+}
+
+// oggOpus returns OGG/Opus audio of n 20 ms CELT frames.
+func oggOpus(t *testing.T, n int) ([]byte, [][]byte) {
+	t.Helper()
+	frames := make([][]byte, n)
+	var buf bytes.Buffer
+	w, err := opus.NewFrameWriter(&buf, opus.FormatOgg)
+	if err != nil {
+		t.Fatalf("failed to create frame writer: %v", err)
+	}
+	for i := range frames {
+		frames[i] = []byte{0xfc, byte(i), byte(i + 1)}
+		if err := w.WriteFrame(frames[i]); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close frame writer: %v", err)
+	}
+	return buf.Bytes(), frames
+}
+
+func TestTranscoderProcessPassesThroughOggOpus(t *testing.T) {
+	// The job is built as the bot builds it for a probed two second upload,
+	// which is played whole.
+	audio, frames := oggOpus(t, 100)
+	blobs := &fakeBlobStorage{objects: map[string][]byte{
+		datalayer.UploadedAudioKey("sc-1"): audio,
+	}}
+	soundCrons := &fakeSoundCronUpdater{
+		statuses:     map[string]repository.SoundCronStatus{},
+		fileSizes:    map[string]int64{},
+		encodedSizes: map[string]int64{},
+		audio:        map[string]repository.AudioMetadata{},
+	}
+	// ffmpeg is not run for audio that is passed through, so it fails the job if it is.
+	tr := transcoder.NewTranscoder(blobs, soundCrons, config.AudioConfig{
+		StorageFormat: opus.FormatLengthPrefixed,
+		FFmpegTimeout: time.Nanosecond,
+	})
+
+	result := tr.Process(t.Context(), transcoder.Job{
+		SoundCronID: "sc-1",
+		Length:      2 * time.Second,
+		Audio:       repository.AudioMetadata{Duration: 2 * time.Second, Channels: 2, Codec: "opus"},
+	})
+	if result.Failed {
+		t.Fatalf("expected the audio to be passed through, got %+v", result)
+	}
+
+	reader, _, err := opus.NewFrameReader(bytes.NewReader(blobs.objects[datalayer.OpusAudioKey("sc-1")]))
+	if err != nil {
+		t.Fatalf("failed to read encoded audio: %v", err)
+	}
+	var got [][]byte
+	for {
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		got = append(got, frame)
+	}
+	if !slices.EqualFunc(got, frames, bytes.Equal) {
+		t.Errorf("expected the frames to be stored as they were uploaded, got %d frames", len(got))
+	}
+}
+
+// guildSoundCrons lists the soundcrons of a guild as they are recorded by updater,
+// alongside another soundcron that takes up otherSize bytes.
+type guildSoundCrons struct {
+	updater   *fakeSoundCronUpdater
+	otherSize int64
+}
+
+func (g *guildSoundCrons) List(ctx context.Context, guildID string) ([]repository.SoundCron, error) {
+	return []repository.SoundCron{
+		{ID: "sc-1", GuildID: guildID, FileSize: 4, EncodedSize: g.updater.encodedSizes["sc-1"]},
+		{ID: "sc-2", GuildID: guildID, FileSize: g.otherSize},
+	}, nil
+}
+
+type fixedGuildSettings struct {
+	quota int64
+}
+
+func (f fixedGuildSettings) GetGuildSettings(ctx context.Context, guildID string) (repository.GuildSettings, error) {
+	return repository.GuildSettings{GuildID: guildID, StorageQuota: f.quota}, nil
+}
+
+func TestTranscoderProcessChecksQuota(t *testing.T) {
+	tc := []struct {
+		name       string
+		otherSize  int64
+		wantFailed bool
+		wantStatus repository.SoundCronStatus
+	}{
+		{
+			name:       "Encoded audio that fits is kept",
+			otherSize:  2,
+			wantStatus: repository.SoundCronStatusReady,
+		},
+		{
+			// The upload and the other soundcron fit, but not with the encoded audio.
+			name:       "Encoded audio over the quota is discarded",
+			otherSize:  4,
+			wantFailed: true,
+			wantStatus: repository.SoundCronStatusFailed,
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			blobs := &fakeBlobStorage{objects: map[string][]byte{
+				datalayer.UploadedAudioKey("sc-1"): []byte("ding"),
+			}}
+			soundCrons := &fakeSoundCronUpdater{
+				statuses:     map[string]repository.SoundCronStatus{},
+				fileSizes:    map[string]int64{},
+				encodedSizes: map[string]int64{},
+				audio:        map[string]repository.AudioMetadata{},
+			}
+			tr := &transcoder.Transcoder{
+				Blobs:      blobs,
+				SoundCrons: soundCrons,
+				Encoder: func(opts opus.FFmpegOptions, format opus.Format) transcoder.EncodeFunc {
+					return upperEncode
+				},
+				Quota: &transcoder.QuotaChecker{
+					SoundCrons:    &guildSoundCrons{updater: soundCrons, otherSize: testCase.otherSize},
+					GuildSettings: fixedGuildSettings{quota: 10},
+				},
+			}
+
+			result := tr.Process(t.Context(), transcoder.Job{SoundCronID: "sc-1", GuildID: "guild", SuccessMessage: "Added!"})
+			if result.Failed != testCase.wantFailed {
+				t.Errorf("Process() = %+v, want failed=%v", result, testCase.wantFailed)
+			}
+			if soundCrons.statuses["sc-1"] != testCase.wantStatus {
+				t.Errorf("expected status %q, got %q", testCase.wantStatus, soundCrons.statuses["sc-1"])
+			}
+			if !testCase.wantFailed {
+				return
+			}
+			if result.Message != transcoder.QuotaExceededMessage {
+				t.Errorf("expected message %q, got %q", transcoder.QuotaExceededMessage, result.Message)
+			}
+			if _, ok := blobs.objects[datalayer.OpusAudioKey("sc-1")]; ok {
+				t.Errorf("expected the encoded audio to be deleted")
+			}
+			if got := soundCrons.encodedSizes["sc-1"]; got != 0 {
+				t.Errorf("expected no encoded size to be recorded, got %d", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package util
+
+import "io"
+
+// CountingReader wraps an io.Reader and counts the bytes read through it.
+// It is used to measure streams whose length is not known up front.
+type CountingReader struct {
+	R io.Reader
+	N int64
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.R.Read(p)
+	c.N += int64(n)
+	return n, err
+}
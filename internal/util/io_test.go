@@ -0,0 +1,19 @@
+package util_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/glizzus/sound-off/internal/util"
+)
+
+func TestCountingReader(t *testing.T) {
+	r := &util.CountingReader{R: strings.NewReader("hello, world")}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.N != 12 {
+		t.Errorf("expected 12 bytes to be counted, got %d", r.N)
+	}
+}
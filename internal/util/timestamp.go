@@ -0,0 +1,84 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTimestamp is the latest position that ParseTimestamp reads. It is far
+// past the end of any audio that is uploaded, and keeps the parts of a
+// timestamp from overflowing a time.Duration.
+const maxTimestamp = 1000 * time.Hour
+
+// ParseTimestamp parses a position in audio written as seconds,
+// minutes and seconds, or hours, minutes and seconds, such as
+// "5", "1:23.5" or "1:02:03". Only the seconds may have a fraction.
+func ParseTimestamp(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, ":")
+	if s == "" || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || seconds < 0 || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0, fmt.Errorf("invalid seconds in timestamp %q", s)
+	}
+	if seconds > maxTimestamp.Seconds() {
+		return 0, fmt.Errorf("timestamp %q is too late", s)
+	}
+	if len(parts) > 1 && seconds >= 60 {
+		return 0, fmt.Errorf("seconds must be less than 60 in timestamp %q", s)
+	}
+
+	var minutes, hours int
+	if len(parts) > 1 {
+		if minutes, err = strconv.Atoi(parts[len(parts)-2]); err != nil || minutes < 0 {
+			return 0, fmt.Errorf("invalid minutes in timestamp %q", s)
+		}
+		if minutes > int(maxTimestamp/time.Minute) {
+			return 0, fmt.Errorf("timestamp %q is too late", s)
+		}
+		if len(parts) > 2 && minutes >= 60 {
+			return 0, fmt.Errorf("minutes must be less than 60 in timestamp %q", s)
+		}
+	}
+	if len(parts) > 2 {
+		if hours, err = strconv.Atoi(parts[0]); err != nil || hours < 0 {
+			return 0, fmt.Errorf("invalid hours in timestamp %q", s)
+		}
+		if hours > int(maxTimestamp/time.Hour) {
+			return 0, fmt.Errorf("timestamp %q is too late", s)
+		}
+	}
+
+	d := time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(math.Round(seconds*1000))*time.Millisecond
+	if d > maxTimestamp {
+		return 0, fmt.Errorf("timestamp %q is too late", s)
+	}
+	return d, nil
+}
+
+// FormatTimestamp formats a position in audio the way ParseTimestamp reads it,
+// such as "0:05" or "1:23.5". Anything below a millisecond is dropped.
+func FormatTimestamp(d time.Duration) string {
+	d = d.Truncate(time.Millisecond)
+	hours := int(d / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	millis := int(d % time.Minute / time.Millisecond)
+
+	seconds := fmt.Sprintf("%02d", millis/1000)
+	if frac := millis % 1000; frac != 0 {
+		seconds += strings.TrimRight(fmt.Sprintf(".%03d", frac), "0")
+	}
+
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%s", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%d:%s", minutes, seconds)
+}
@@ -0,0 +1,77 @@
+package util_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/util"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tc := []struct {
+		input    string
+		expected time.Duration
+		err      bool
+	}{
+		{input: "5", expected: 5 * time.Second},
+		{input: "2.25", expected: 2250 * time.Millisecond},
+		{input: "1:23.5", expected: time.Minute + 23500*time.Millisecond},
+		{input: "90", expected: 90 * time.Second},
+		{input: "1:02:03", expected: time.Hour + 2*time.Minute + 3*time.Second},
+		{input: " 0:05 ", expected: 5 * time.Second},
+		{input: "", err: true},
+		{input: "abc", err: true},
+		{input: "-5", err: true},
+		{input: "1:60", err: true},
+		{input: "1:60:00", err: true},
+		{input: "1.5:00", err: true},
+		{input: "1:2:3:4", err: true},
+		{input: "1000:00:00", expected: 1000 * time.Hour},
+		{input: "1000:00:01", err: true},
+		{input: "9223372036854775807:00:00", err: true},
+		{input: "9999999999999:00", err: true},
+		{input: "1e300", err: true},
+	}
+
+	for _, test := range tc {
+		t.Run(test.input, func(t *testing.T) {
+			result, err := util.ParseTimestamp(test.input)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected error, got %v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	tc := []struct {
+		input    time.Duration
+		expected string
+	}{
+		{input: 5 * time.Second, expected: "0:05"},
+		{input: time.Minute + 23500*time.Millisecond, expected: "1:23.5"},
+		{input: time.Hour + 2*time.Minute + 3*time.Second, expected: "1:02:03"},
+	}
+
+	for _, test := range tc {
+		t.Run(test.expected, func(t *testing.T) {
+			result := util.FormatTimestamp(test.input)
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+			parsed, err := util.ParseTimestamp(result)
+			if err != nil || parsed != test.input {
+				t.Errorf("expected %q to parse back to %v, got %v (%v)", result, test.input, parsed, err)
+			}
+		})
+	}
+}
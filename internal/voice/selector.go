@@ -0,0 +1,195 @@
+package voice
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+// Guild is what a ChannelSelector knows about a guild when it selects channels.
+type Guild struct {
+	*discordgo.Guild
+
+	// Eligible reports whether a voice channel may be selected, such as whether
+	// the bot may speak in it. A nil Eligible allows every channel.
+	Eligible func(channelID string) bool
+}
+
+// NewGuild returns the Guild that s sees, where channels are only eligible
+// if the bot may connect and speak in them.
+func NewGuild(s *discordgo.Session, guild *discordgo.Guild) Guild {
+	return Guild{
+		Guild: guild,
+		Eligible: func(channelID string) bool {
+			perms, err := s.State.UserChannelPermissions(s.State.User.ID, channelID)
+			if err != nil {
+				return false
+			}
+			const needed = discordgo.PermissionVoiceConnect | discordgo.PermissionVoiceSpeak
+			return perms&needed == needed
+		},
+	}
+}
+
+func (g Guild) eligible(channelID string) bool {
+	if channelID == "" || channelID == g.AfkChannelID {
+		return false
+	}
+	return g.Eligible == nil || g.Eligible(channelID)
+}
+
+// listeners counts the humans who can hear audio in each eligible voice channel.
+// Bots and deafened users are not counted.
+func (g Guild) listeners() map[string]int {
+	bots := make(map[string]bool)
+	for _, member := range g.Members {
+		if member.User != nil && member.User.Bot {
+			bots[member.User.ID] = true
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, vs := range g.VoiceStates {
+		if !g.eligible(vs.ChannelID) || vs.SelfDeaf || vs.Deaf {
+			continue
+		}
+		if bots[vs.UserID] || (vs.Member != nil && vs.Member.User != nil && vs.Member.User.Bot) {
+			continue
+		}
+		counts[vs.ChannelID]++
+	}
+	return counts
+}
+
+// rankChannels returns the channels in counts with the most listeners first.
+// Ties are broken by the order of the channels in the guild, so the same
+// channel wins every time.
+func (g Guild) rankChannels(counts map[string]int) []string {
+	positions := make(map[string]int, len(g.Channels))
+	for _, channel := range g.Channels {
+		positions[channel.ID] = channel.Position
+	}
+
+	channelIDs := make([]string, 0, len(counts))
+	for channelID := range counts {
+		channelIDs = append(channelIDs, channelID)
+	}
+	slices.SortFunc(channelIDs, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		if positions[a] != positions[b] {
+			return positions[a] - positions[b]
+		}
+		return strings.Compare(a, b)
+	})
+	return channelIDs
+}
+
+// ChannelSelector chooses the voice channels of a guild that a soundcron plays in.
+// The AFK channel of the guild is never selected.
+type ChannelSelector interface {
+	// SelectChannels returns the IDs of the selected channels, best first.
+	// It returns no channels if there is nobody to play to.
+	SelectChannels(guild Guild) []string
+}
+
+// MostHumans selects the voice channel with the most listeners,
+// not counting bots and deafened users.
+type MostHumans struct{}
+
+func (MostHumans) SelectChannels(guild Guild) []string {
+	ranked := guild.rankChannels(guild.listeners())
+	if len(ranked) == 0 {
+		return nil
+	}
+	return ranked[:1]
+}
+
+// AllOccupied selects every voice channel that has listeners,
+// with the most listeners first.
+type AllOccupied struct{}
+
+func (AllOccupied) SelectChannels(guild Guild) []string {
+	return guild.rankChannels(guild.listeners())
+}
+
+// FixedChannel selects the same voice channel whenever it has listeners.
+type FixedChannel struct {
+	ChannelID string
+}
+
+func (f FixedChannel) SelectChannels(guild Guild) []string {
+	if guild.listeners()[f.ChannelID] == 0 {
+		return nil
+	}
+	return []string{f.ChannelID}
+}
+
+// CreatorChannel selects the voice channel that a user, usually the creator
+// of the soundcron, is in.
+type CreatorChannel struct {
+	UserID string
+}
+
+func (c CreatorChannel) SelectChannels(guild Guild) []string {
+	if c.UserID == "" {
+		return nil
+	}
+	for _, vs := range guild.VoiceStates {
+		if vs.UserID == c.UserID && guild.eligible(vs.ChannelID) {
+			return []string{vs.ChannelID}
+		}
+	}
+	return nil
+}
+
+// FilterChannels limits the voice channels that Selector may select.
+// The channels are filtered before Selector ranks them, so a denied
+// channel makes way for the next best one.
+type FilterChannels struct {
+	Selector ChannelSelector
+
+	// Allow is the only channels that may be selected. An empty Allow allows every channel.
+	Allow []string
+
+	// Deny is channels that are never selected.
+	Deny []string
+}
+
+func (f FilterChannels) SelectChannels(guild Guild) []string {
+	eligible := guild.Eligible
+	guild.Eligible = func(channelID string) bool {
+		if len(f.Allow) > 0 && !slices.Contains(f.Allow, channelID) {
+			return false
+		}
+		if slices.Contains(f.Deny, channelID) {
+			return false
+		}
+		return eligible == nil || eligible(channelID)
+	}
+	return f.Selector.SelectChannels(guild)
+}
+
+// NewChannelSelector returns the ChannelSelector that channels describes
+// for a soundcron that was added by creatorID.
+func NewChannelSelector(channels repository.ChannelSelection, creatorID string) ChannelSelector {
+	var selector ChannelSelector
+	switch channels.Strategy {
+	case repository.ChannelStrategyFixed:
+		selector = FixedChannel{ChannelID: channels.ChannelID}
+	case repository.ChannelStrategyCreator:
+		selector = CreatorChannel{UserID: creatorID}
+	case repository.ChannelStrategyAllOccupied:
+		selector = AllOccupied{}
+	default:
+		selector = MostHumans{}
+	}
+
+	if len(channels.Allow) == 0 && len(channels.Deny) == 0 {
+		return selector
+	}
+	return FilterChannels{Selector: selector, Allow: channels.Allow, Deny: channels.Deny}
+}
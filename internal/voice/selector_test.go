@@ -0,0 +1,172 @@
+package voice_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/voice"
+)
+
+// testGuild has a general channel with two humans and a bot, a music channel
+// with two humans of which one is deafened, a gaming channel with one human,
+// and an AFK channel with three humans.
+func testGuild() voice.Guild {
+	return voice.Guild{Guild: &discordgo.Guild{
+		AfkChannelID: "afk",
+		Channels: []*discordgo.Channel{
+			{ID: "general", Position: 0},
+			{ID: "music", Position: 1},
+			{ID: "gaming", Position: 2},
+			{ID: "afk", Position: 3},
+		},
+		Members: []*discordgo.Member{
+			{User: &discordgo.User{ID: "bot", Bot: true}},
+		},
+		VoiceStates: []*discordgo.VoiceState{
+			{UserID: "alice", ChannelID: "general"},
+			{UserID: "bob", ChannelID: "general"},
+			{UserID: "bot", ChannelID: "general"},
+			{UserID: "carol", ChannelID: "music"},
+			{UserID: "dave", ChannelID: "music", SelfDeaf: true},
+			{UserID: "erin", ChannelID: "gaming"},
+			{UserID: "frank", ChannelID: "afk"},
+			{UserID: "grace", ChannelID: "afk"},
+			{UserID: "heidi", ChannelID: "afk"},
+		},
+	}}
+}
+
+func TestChannelSelectors(t *testing.T) {
+	tc := []struct {
+		name     string
+		selector voice.ChannelSelector
+		guild    func() voice.Guild
+		want     []string
+	}{
+		{
+			name:     "Most humans skips the AFK channel",
+			selector: voice.MostHumans{},
+			guild:    testGuild,
+			want:     []string{"general"},
+		},
+		{
+			name:     "Bots and deafened users are not counted",
+			selector: voice.MostHumans{},
+			guild: func() voice.Guild {
+				g := testGuild()
+				g.VoiceStates = append(g.VoiceStates, &discordgo.VoiceState{UserID: "ivan", ChannelID: "music"})
+				return g
+			},
+			want: []string{"general"},
+		},
+		{
+			name:     "Ties go to the first channel in the guild",
+			selector: voice.MostHumans{},
+			guild: func() voice.Guild {
+				g := testGuild()
+				g.VoiceStates = append(g.VoiceStates,
+					&discordgo.VoiceState{UserID: "ivan", ChannelID: "gaming"},
+					&discordgo.VoiceState{UserID: "judy", ChannelID: "music"},
+				)
+				return g
+			},
+			want: []string{"general"},
+		},
+		{
+			name:     "Channels the bot can not speak in are not selected",
+			selector: voice.MostHumans{},
+			guild: func() voice.Guild {
+				g := testGuild()
+				g.Eligible = func(channelID string) bool { return channelID != "general" }
+				return g
+			},
+			want: []string{"music"},
+		},
+		{
+			name:     "All occupied selects every channel with listeners",
+			selector: voice.AllOccupied{},
+			guild:    testGuild,
+			want:     []string{"general", "music", "gaming"},
+		},
+		{
+			name:     "Fixed channel is selected when it has listeners",
+			selector: voice.FixedChannel{ChannelID: "gaming"},
+			guild:    testGuild,
+			want:     []string{"gaming"},
+		},
+		{
+			name:     "Fixed channel without listeners is not selected",
+			selector: voice.FixedChannel{ChannelID: "lobby"},
+			guild:    testGuild,
+		},
+		{
+			name:     "Creator channel follows the creator",
+			selector: voice.CreatorChannel{UserID: "erin"},
+			guild:    testGuild,
+			want:     []string{"gaming"},
+		},
+		{
+			name:     "Creator channel is not selected when the creator is AFK",
+			selector: voice.CreatorChannel{UserID: "frank"},
+			guild:    testGuild,
+		},
+		{
+			name:     "Denied channels make way for the next best",
+			selector: voice.FilterChannels{Selector: voice.MostHumans{}, Deny: []string{"general"}},
+			guild:    testGuild,
+			want:     []string{"music"},
+		},
+		{
+			name:     "Only allowed channels are selected",
+			selector: voice.FilterChannels{Selector: voice.AllOccupied{}, Allow: []string{"gaming", "music"}},
+			guild:    testGuild,
+			want:     []string{"music", "gaming"},
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			got := testCase.selector.SelectChannels(testCase.guild())
+			if !slices.Equal(got, testCase.want) {
+				t.Errorf("SelectChannels() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestNewChannelSelector(t *testing.T) {
+	tc := []struct {
+		name     string
+		channels repository.ChannelSelection
+		want     []string
+	}{
+		{
+			name: "Zero selection plays where the most humans are",
+			want: []string{"general"},
+		},
+		{
+			name:     "Creator strategy plays where the creator is",
+			channels: repository.ChannelSelection{Strategy: repository.ChannelStrategyCreator},
+			want:     []string{"music"},
+		},
+		{
+			name: "Deny list applies to the strategy",
+			channels: repository.ChannelSelection{
+				Strategy: repository.ChannelStrategyAllOccupied,
+				Deny:     []string{"music"},
+			},
+			want: []string{"general", "gaming"},
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			got := voice.NewChannelSelector(testCase.channels, "carol").SelectChannels(testGuild())
+			if !slices.Equal(got, testCase.want) {
+				t.Errorf("SelectChannels() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
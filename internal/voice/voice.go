@@ -7,30 +7,6 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
-// MaxAttendedVoiceChannel returns the ID of the voice channel with the most members.
-// If there are no voice channels with members, it returns an empty string.
-func MaxAttendedVoiceChannel(vcs []*discordgo.VoiceState) string {
-	var counts = make(map[string]int)
-	for _, vs := range vcs {
-		if vs.ChannelID == "" {
-			continue
-		}
-		counts[vs.ChannelID]++
-	}
-	var maxCount int
-	var maxChannelID string
-	for channelID, count := range counts {
-		if count > maxCount {
-			maxCount = count
-			maxChannelID = channelID
-		}
-	}
-	if maxCount == 0 {
-		return ""
-	}
-	return maxChannelID
-}
-
 // VoiceChannelFunc is a function type that takes a discordgo session and a voice connection.
 type VoiceChannelFunc func(*discordgo.Session, *discordgo.VoiceConnection) error
 
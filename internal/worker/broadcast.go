@@ -0,0 +1,110 @@
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/voice"
+)
+
+// Broadcast is the jobs of one run of a soundcron, which play the same audio
+// in one voice channel after another, in order. The bot sends a run as one job,
+// which Resolve turns into a job for each channel; bots that were deployed
+// before sent a job for each channel.
+type Broadcast []SoundCronStreamJob
+
+// GroupBroadcasts groups jobs into broadcasts by their guild, soundcron and run time.
+// The jobs of a broadcast keep the order that they were received in, which is
+// the order that the bot chose their channels in.
+func GroupBroadcasts(jobs []SoundCronStreamJob) []Broadcast {
+	type broadcastKey struct {
+		guildID     string
+		soundCronID string
+		runTime     time.Time
+	}
+
+	var broadcasts []Broadcast
+	indexes := make(map[broadcastKey]int)
+	for _, job := range jobs {
+		key := broadcastKey{job.GuildID, job.SoundCronID, job.RunTime.UTC()}
+		i, ok := indexes[key]
+		if !ok {
+			i = len(broadcasts)
+			indexes[key] = i
+			broadcasts = append(broadcasts, nil)
+		}
+		broadcasts[i] = append(broadcasts[i], job)
+	}
+	return broadcasts
+}
+
+// ReplayBuffer lets audio that is streamed once be played several times,
+// so that a broadcast fetches its audio only once.
+type ReplayBuffer struct {
+	source   io.Reader
+	buffered bytes.Buffer
+	replays  int
+}
+
+// NewReplayBuffer returns a ReplayBuffer of the audio that is read from source.
+func NewReplayBuffer(source io.Reader) *ReplayBuffer {
+	return &ReplayBuffer{source: source}
+}
+
+// Reader returns a reader of the audio from its start. The first reader streams
+// from the source, so playback does not wait for all of it. Later readers read
+// what was buffered, after the rest of the source has been read.
+func (b *ReplayBuffer) Reader() (io.Reader, error) {
+	b.replays++
+	if b.replays == 1 {
+		return io.TeeReader(b.source, &b.buffered), nil
+	}
+	if b.replays == 2 {
+		if _, err := io.Copy(&b.buffered, b.source); err != nil {
+			return nil, fmt.Errorf("failed to buffer audio: %w", err)
+		}
+	}
+	return bytes.NewReader(b.buffered.Bytes()), nil
+}
+
+// Resolve chooses the channels that the broadcast plays in from the current state
+// of guild, and returns a job for each of them, best first. It returns no jobs if
+// there is nobody to play to. Jobs that were sent without a channel selection
+// keep the channels that the bot chose.
+func (b Broadcast) Resolve(guild voice.Guild) Broadcast {
+	if len(b) == 0 || b[0].Channels.Strategy == "" {
+		return b.hinted()
+	}
+
+	first := b[0]
+	channelIDs := voice.NewChannelSelector(first.Channels, first.CreatorID).SelectChannels(guild)
+	return first.inChannels(channelIDs)
+}
+
+// hinted returns a job for each channel that the bot chose for the broadcast,
+// best first. It returns no jobs if the bot found nobody to play to.
+func (b Broadcast) hinted() Broadcast {
+	var hinted Broadcast
+	for _, job := range b {
+		switch {
+		case len(job.TargetChannelIDs) > 0:
+			hinted = append(hinted, job.inChannels(job.TargetChannelIDs)...)
+		case job.TargetChannelID != "":
+			hinted = append(hinted, job)
+		}
+	}
+	return hinted
+}
+
+// inChannels returns a copy of j for each of channelIDs, which plays in that channel.
+func (j SoundCronStreamJob) inChannels(channelIDs []string) Broadcast {
+	jobs := make(Broadcast, len(channelIDs))
+	for i, channelID := range channelIDs {
+		jobs[i] = j
+		jobs[i].TargetChannelID = channelID
+		jobs[i].TargetChannelIDs = nil
+	}
+	return jobs
+}
@@ -0,0 +1,208 @@
+package worker_test
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/voice"
+	"github.com/glizzus/sound-off/internal/worker"
+)
+
+func TestGroupBroadcasts(t *testing.T) {
+	runTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	job := func(guildID, soundCronID, channelID string, runTime time.Time) worker.SoundCronStreamJob {
+		return worker.SoundCronStreamJob{
+			GuildID:         guildID,
+			SoundCronID:     soundCronID,
+			RunTime:         runTime,
+			TargetChannelID: channelID,
+		}
+	}
+
+	broadcasts := worker.GroupBroadcasts([]worker.SoundCronStreamJob{
+		job("guild", "bell", "general", runTime),
+		job("guild", "horn", "general", runTime),
+		job("guild", "bell", "music", runTime),
+		job("guild", "bell", "general", runTime.Add(time.Hour)),
+		job("guild", "bell", "gaming", runTime.In(time.FixedZone("EST", -5*60*60))),
+	})
+
+	want := [][]string{
+		{"general", "music", "gaming"},
+		{"general"},
+		{"general"},
+	}
+	if len(broadcasts) != len(want) {
+		t.Fatalf("expected %d broadcasts, got %+v", len(want), broadcasts)
+	}
+	for i, broadcast := range broadcasts {
+		var channels []string
+		for _, job := range broadcast {
+			channels = append(channels, job.TargetChannelID)
+		}
+		if strings.Join(channels, ",") != strings.Join(want[i], ",") {
+			t.Errorf("broadcast %d plays in %v, want %v", i, channels, want[i])
+		}
+	}
+}
+
+func TestReplayBuffer(t *testing.T) {
+	buffer := worker.NewReplayBuffer(strings.NewReader("ding dong"))
+
+	first, err := buffer.Reader()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The first playback stops early, so the rest is buffered for the next one.
+	start := make([]byte, 4)
+	if _, err := io.ReadFull(first, start); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	for range 2 {
+		replay, err := buffer.Reader()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := iotest.TestReader(replay, []byte("ding dong")); err != nil {
+			t.Errorf("replay did not read the whole audio: %v", err)
+		}
+	}
+}
+
+func TestBroadcastResolve(t *testing.T) {
+	// Everyone has moved from general, which the bot chose, to music and gaming.
+	guild := voice.Guild{Guild: &discordgo.Guild{
+		Channels: []*discordgo.Channel{
+			{ID: "general", Position: 0},
+			{ID: "music", Position: 1},
+			{ID: "gaming", Position: 2},
+		},
+		VoiceStates: []*discordgo.VoiceState{
+			{UserID: "alice", ChannelID: "music"},
+			{UserID: "bob", ChannelID: "gaming"},
+			{UserID: "carol", ChannelID: "gaming"},
+		},
+	}}
+	hinted := func(channels repository.ChannelSelection) worker.Broadcast {
+		return worker.Broadcast{{SoundCronID: "bell", TargetChannelID: "general", Channels: channels}}
+	}
+
+	tc := []struct {
+		name      string
+		broadcast worker.Broadcast
+		want      []string
+	}{
+		{
+			name:      "Channel is chosen again from the current state",
+			broadcast: hinted(repository.ChannelSelection{Strategy: repository.ChannelStrategyMostHumans}),
+			want:      []string{"gaming"},
+		},
+		{
+			name:      "Broadcast plays in every channel that is occupied now",
+			broadcast: hinted(repository.ChannelSelection{Strategy: repository.ChannelStrategyAllOccupied}),
+			want:      []string{"gaming", "music"},
+		},
+		{
+			name: "Empty channel is skipped",
+			broadcast: hinted(repository.ChannelSelection{
+				Strategy: repository.ChannelStrategyFixed, ChannelID: "general",
+			}),
+		},
+		{
+			name:      "Job without a channel selection keeps the hint",
+			broadcast: hinted(repository.ChannelSelection{}),
+			want:      []string{"general"},
+		},
+		{
+			name: "Job without a channel selection plays in every channel the bot chose",
+			broadcast: worker.Broadcast{{
+				SoundCronID:      "bell",
+				TargetChannelID:  "general",
+				TargetChannelIDs: []string{"general", "music"},
+			}},
+			want: []string{"general", "music"},
+		},
+		{
+			name:      "Job that the bot found no channels for is skipped",
+			broadcast: worker.Broadcast{{SoundCronID: "bell"}},
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			var got []string
+			for _, job := range testCase.broadcast.Resolve(guild) {
+				if job.SoundCronID != "bell" {
+					t.Errorf("resolved job lost its soundcron: %+v", job)
+				}
+				got = append(got, job.TargetChannelID)
+			}
+			if strings.Join(got, ",") != strings.Join(testCase.want, ",") {
+				t.Errorf("Resolve() plays in %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestBroadcastIsReceivedWhole(t *testing.T) {
+	guild := voice.Guild{Guild: &discordgo.Guild{
+		Channels: []*discordgo.Channel{
+			{ID: "general", Position: 0},
+			{ID: "music", Position: 1},
+		},
+		VoiceStates: []*discordgo.VoiceState{
+			{UserID: "alice", ChannelID: "general"},
+			{UserID: "bob", ChannelID: "music"},
+		},
+	}}
+	runTime := time.Now().Add(time.Minute).Truncate(time.Second)
+	run := func(soundCronID string, channelIDs ...string) worker.SoundCronStreamJob {
+		return worker.NewStreamJob(repository.SoundCronJob{
+			SoundCronID: soundCronID,
+			GuildID:     "guild",
+			RunTime:     runTime,
+			Channels:    repository.ChannelSelection{Strategy: repository.ChannelStrategyAllOccupied},
+		}, channelIDs)
+	}
+
+	// The receiver hands out 100 jobs at a time, so a broadcast that was
+	// sent as a job per channel would be split between two batches.
+	var jobs []worker.SoundCronStreamJob
+	for i := range 99 {
+		jobs = append(jobs, run(strconv.Itoa(i), "general"))
+	}
+	jobs = append(jobs, run("bell", "general", "music"))
+	queue := worker.NewMemoryJobQueue(worker.DeliveryPolicy{AckWait: time.Second, MaxDeliveries: 1})
+	if err := queue.HandleJobs(t.Context(), jobs...); err != nil {
+		t.Fatalf("failed to send jobs: %v", err)
+	}
+
+	// Each batch is played on its own, as a worker does.
+	receiver := queue.Receiver()
+	played := make(map[string]int)
+	for range 2 {
+		received, err := receiver.ReceiveJobs(t.Context())
+		if err != nil {
+			t.Fatalf("failed to receive jobs: %v", err)
+		}
+		for _, broadcast := range worker.GroupBroadcasts(received) {
+			if broadcast[0].SoundCronID != "bell" {
+				continue
+			}
+			for _, job := range broadcast.Resolve(guild) {
+				played[job.TargetChannelID]++
+			}
+		}
+	}
+
+	if played["general"] != 1 || played["music"] != 1 || len(played) != 2 {
+		t.Errorf("expected the broadcast to play once in each channel, got %v", played)
+	}
+}
@@ -0,0 +1,436 @@
+package worker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CollisionPolicy is what a worker does with a soundcron that is due to play
+// in a guild while another soundcron is playing there. A Discord session can
+// only be in one voice channel of a guild at a time, so they can not both play.
+type CollisionPolicy string
+
+const (
+	// CollisionQueue plays the soundcron once the other has finished.
+	CollisionQueue CollisionPolicy = "queue"
+
+	// CollisionDrop plays the soundcron with the higher priority. A soundcron that
+	// does not have a higher priority than the one playing is not played, and one
+	// that does stops the one playing.
+	CollisionDrop CollisionPolicy = "drop"
+
+	// CollisionMix plays soundcrons that a worker runs at the same time
+	// together, as one sound. It queues soundcrons that collide otherwise.
+	CollisionMix CollisionPolicy = "mix"
+)
+
+// ParseCollisionPolicy parses the name of a CollisionPolicy.
+func ParseCollisionPolicy(s string) (CollisionPolicy, error) {
+	switch policy := CollisionPolicy(s); policy {
+	case CollisionQueue, CollisionDrop, CollisionMix:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown collision policy %q", s)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that a CollisionPolicy
+// can be read from configuration.
+func (p *CollisionPolicy) UnmarshalText(text []byte) error {
+	policy, err := ParseCollisionPolicy(string(text))
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// ErrCollision is returned by GuildQueue.Acquire when a playback is not played
+// because of another playback in the same guild.
+var ErrCollision = errors.New("another soundcron is playing in the guild")
+
+// GuildLease is the playback lock of a guild, held by one playback.
+type GuildLease interface {
+	// Done is closed when the playback should stop, because a playback of a higher
+	// priority asked for the lock or the lock was lost.
+	Done() <-chan struct{}
+
+	// Release gives up the lock so that other playbacks can take it.
+	Release(ctx context.Context) error
+}
+
+// GuildLocker hands out the playback lock of each guild to one playback at a time.
+type GuildLocker interface {
+	// TryLock takes the lock of the guild for a playback of the given priority.
+	// If another playback holds it, it returns a nil GuildLease and the priority
+	// of the playback that holds it.
+	TryLock(ctx context.Context, guildID string, priority int) (GuildLease, int, error)
+
+	// Preempt asks the playback that holds the lock of the guild to stop
+	// if it has a lower priority than the given one.
+	Preempt(ctx context.Context, guildID string, priority int) error
+}
+
+// GuildQueue makes playbacks of the same guild wait for each other,
+// or not play, as its Policy says.
+type GuildQueue struct {
+	Locker GuildLocker
+	Policy CollisionPolicy
+
+	// MaxWait is how long a playback waits for the lock before it is not played.
+	// It stops soundcrons from playing long after their run time.
+	MaxWait time.Duration
+
+	// PollInterval is how often a waiting playback tries to take the lock.
+	PollInterval time.Duration
+}
+
+// Acquire waits until a playback of the given priority may play in the guild.
+// The returned context is canceled when the playback should stop, and the
+// returned function must be called when the playback has finished.
+// It returns an error wrapping ErrCollision if the playback should not play.
+func (q *GuildQueue) Acquire(ctx context.Context, guildID string, priority int) (context.Context, func(), error) {
+	deadline := time.Now().Add(q.MaxWait)
+	preempted := false
+	for {
+		lease, holderPriority, err := q.Locker.TryLock(ctx, guildID, priority)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to lock guild %s: %w", guildID, err)
+		}
+		if lease != nil {
+			playCtx, cancel := context.WithCancel(ctx)
+			go func() {
+				select {
+				case <-lease.Done():
+					cancel()
+				case <-playCtx.Done():
+				}
+			}()
+			release := func() {
+				cancel()
+				// The lock is given up even if ctx is done, so that others do not
+				// wait for it to expire.
+				if err := lease.Release(context.Background()); err != nil {
+					slog.Error(
+						"failed to release guild lock",
+						slog.String("guildID", guildID),
+						slog.Any("error", err),
+					)
+				}
+			}
+			return playCtx, release, nil
+		}
+
+		if q.Policy == CollisionDrop {
+			if priority <= holderPriority {
+				return nil, nil, fmt.Errorf("%w with priority %d", ErrCollision, holderPriority)
+			}
+			if !preempted {
+				if err := q.Locker.Preempt(ctx, guildID, priority); err != nil {
+					return nil, nil, fmt.Errorf("failed to preempt playback in guild %s: %w", guildID, err)
+				}
+				preempted = true
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, nil, fmt.Errorf("%w for longer than %s", ErrCollision, q.MaxWait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(q.PollInterval):
+		}
+	}
+}
+
+// Playback is broadcasts of a guild that run at the same time and are played
+// together, highest priority first. Without mixing, it has one broadcast.
+type Playback []Broadcast
+
+// Priority returns the priority of the playback, which is that of its
+// broadcast with the highest priority.
+func (p Playback) Priority() int {
+	return p[0][0].Priority
+}
+
+// GroupPlaybacks groups broadcasts into playbacks. When mix is set, the broadcasts
+// of a guild that run at the same time are one playback. Otherwise each broadcast
+// is a playback of its own.
+func GroupPlaybacks(broadcasts []Broadcast, mix bool) []Playback {
+	if !mix {
+		playbacks := make([]Playback, len(broadcasts))
+		for i, broadcast := range broadcasts {
+			playbacks[i] = Playback{broadcast}
+		}
+		return playbacks
+	}
+
+	type playbackKey struct {
+		guildID string
+		runTime time.Time
+	}
+
+	var playbacks []Playback
+	indexes := make(map[playbackKey]int)
+	for _, broadcast := range broadcasts {
+		key := playbackKey{broadcast[0].GuildID, broadcast[0].RunTime.UTC()}
+		i, ok := indexes[key]
+		if !ok {
+			i = len(playbacks)
+			indexes[key] = i
+			playbacks = append(playbacks, nil)
+		}
+		playbacks[i] = append(playbacks[i], broadcast)
+	}
+	for _, playback := range playbacks {
+		sort.SliceStable(playback, func(i, j int) bool {
+			return playback[i][0].Priority > playback[j][0].Priority
+		})
+	}
+	return playbacks
+}
+
+// guildLockTTL is how long the playback lock of a guild is kept without being
+// renewed. A worker that stops without releasing it holds up the guild this long.
+const guildLockTTL = 15 * time.Second
+
+// guildLockRenewInterval is how often a held lock is renewed, and how often
+// its holder checks whether it was preempted.
+const guildLockRenewInterval = time.Second
+
+func guildLockKey(guildID string) string {
+	return fmt.Sprintf("soundcron:guild:%s:playback", guildID)
+}
+
+func guildPreemptKey(guildID string) string {
+	return fmt.Sprintf("soundcron:guild:%s:preempt", guildID)
+}
+
+// tryLockScript takes the lock, or returns its value if it is held. A preemption
+// that the new holder does not need to give way to is cleared, since it was
+// meant for an earlier holder.
+var tryLockScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	local preempt = tonumber(redis.call("GET", KEYS[2]))
+	if preempt and preempt <= tonumber(ARGV[3]) then
+		redis.call("DEL", KEYS[2])
+	end
+	return ""
+end
+return redis.call("GET", KEYS[1])
+`)
+
+// renewLockScript extends the lock if it is still held, and returns -1 if it is
+// not, 1 if a playback of a higher priority asked for it, and 0 otherwise.
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return -1
+end
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+local preempt = tonumber(redis.call("GET", KEYS[2]))
+if preempt and preempt > tonumber(ARGV[3]) then
+	return 1
+end
+return 0
+`)
+
+// releaseLockScript deletes the lock if it is still held by the same playback.
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// preemptScript records the highest priority that asked for the lock.
+var preemptScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]))
+if not current or current < tonumber(ARGV[1]) then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+end
+return 0
+`)
+
+// RedisGuildLocker is a GuildLocker that keeps the lock of each guild in Redis,
+// so that workers on different hosts do not play in the same guild at once.
+type RedisGuildLocker struct {
+	client *redis.Client
+}
+
+func NewRedisGuildLocker(client *redis.Client) *RedisGuildLocker {
+	return &RedisGuildLocker{client: client}
+}
+
+func (l *RedisGuildLocker) TryLock(ctx context.Context, guildID string, priority int) (GuildLease, int, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, 0, fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	// The priority is kept in the lock, so that others can tell whether to wait.
+	value := strconv.Itoa(priority) + ":" + hex.EncodeToString(token)
+
+	keys := []string{guildLockKey(guildID), guildPreemptKey(guildID)}
+	holder, err := tryLockScript.Run(ctx, l.client, keys, value, guildLockTTL.Milliseconds(), priority).Text()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to take lock: %w", err)
+	}
+	if holder != "" {
+		rawPriority, _, _ := strings.Cut(holder, ":")
+		holderPriority, err := strconv.Atoi(rawPriority)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid lock value %q: %w", holder, err)
+		}
+		return nil, holderPriority, nil
+	}
+
+	lease := &redisGuildLease{
+		client:   l.client,
+		keys:     keys,
+		value:    value,
+		priority: priority,
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go lease.renew()
+	return lease, 0, nil
+}
+
+func (l *RedisGuildLocker) Preempt(ctx context.Context, guildID string, priority int) error {
+	err := preemptScript.Run(ctx, l.client, []string{guildPreemptKey(guildID)}, priority, guildLockTTL.Milliseconds()).Err()
+	if err != nil {
+		return fmt.Errorf("failed to preempt lock: %w", err)
+	}
+	return nil
+}
+
+var _ GuildLocker = (*RedisGuildLocker)(nil)
+
+type redisGuildLease struct {
+	client   *redis.Client
+	keys     []string
+	value    string
+	priority int
+
+	done     chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// renew keeps the lock until it is released, and closes done if the
+// playback was preempted or the lock could not be kept.
+func (l *redisGuildLease) renew() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(guildLockRenewInterval)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), guildLockRenewInterval)
+		result, err := renewLockScript.Run(ctx, l.client, l.keys, l.value, guildLockTTL.Milliseconds(), l.priority).Int()
+		cancel()
+		if err != nil {
+			// Another worker may take the lock once it expires.
+			if time.Since(renewed) < guildLockTTL {
+				continue
+			}
+			close(l.done)
+			return
+		}
+		if result != 0 {
+			close(l.done)
+			return
+		}
+		renewed = time.Now()
+	}
+}
+
+func (l *redisGuildLease) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *redisGuildLease) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.stopped
+	if err := releaseLockScript.Run(ctx, l.client, l.keys[:1], l.value).Err(); err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	return nil
+}
+
+// MemoryGuildLocker is a GuildLocker for a single worker,
+// intended for testing and development.
+type MemoryGuildLocker struct {
+	mu     sync.Mutex
+	leases map[string]*memoryGuildLease
+}
+
+func NewMemoryGuildLocker() *MemoryGuildLocker {
+	return &MemoryGuildLocker{leases: make(map[string]*memoryGuildLease)}
+}
+
+func (l *MemoryGuildLocker) TryLock(ctx context.Context, guildID string, priority int) (GuildLease, int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if holder, ok := l.leases[guildID]; ok {
+		return nil, holder.priority, nil
+	}
+	lease := &memoryGuildLease{
+		locker:   l,
+		guildID:  guildID,
+		priority: priority,
+		done:     make(chan struct{}),
+	}
+	l.leases[guildID] = lease
+	return lease, 0, nil
+}
+
+func (l *MemoryGuildLocker) Preempt(ctx context.Context, guildID string, priority int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if holder, ok := l.leases[guildID]; ok && holder.priority < priority {
+		holder.preemptOnce.Do(func() { close(holder.done) })
+	}
+	return nil
+}
+
+var _ GuildLocker = (*MemoryGuildLocker)(nil)
+
+type memoryGuildLease struct {
+	locker      *MemoryGuildLocker
+	guildID     string
+	priority    int
+	done        chan struct{}
+	preemptOnce sync.Once
+}
+
+func (l *memoryGuildLease) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *memoryGuildLease) Release(ctx context.Context) error {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+	if l.locker.leases[l.guildID] == l {
+		delete(l.locker.leases, l.guildID)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package worker_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/worker"
+)
+
+func newGuildQueue(policy worker.CollisionPolicy) *worker.GuildQueue {
+	return &worker.GuildQueue{
+		Locker:       worker.NewMemoryGuildLocker(),
+		Policy:       policy,
+		MaxWait:      time.Second,
+		PollInterval: time.Millisecond,
+	}
+}
+
+func TestGuildQueueQueuesPlaybacks(t *testing.T) {
+	queue := newGuildQueue(worker.CollisionQueue)
+
+	_, release, err := queue.Acquire(t.Context(), "guild", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Other guilds are not held up.
+	_, releaseOther, err := queue.Acquire(t.Context(), "other", 0)
+	if err != nil {
+		t.Fatalf("unexpected error for another guild: %v", err)
+	}
+	releaseOther()
+
+	acquired := make(chan error)
+	go func() {
+		_, releaseSecond, err := queue.Acquire(t.Context(), "guild", 10)
+		if err == nil {
+			releaseSecond()
+		}
+		acquired <- err
+	}()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("second playback did not wait for the first, err: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	if err := <-acquired; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGuildQueueGivesUpAfterMaxWait(t *testing.T) {
+	queue := newGuildQueue(worker.CollisionQueue)
+	queue.MaxWait = 10 * time.Millisecond
+
+	_, release, err := queue.Acquire(t.Context(), "guild", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+
+	if _, _, err := queue.Acquire(t.Context(), "guild", 0); !errors.Is(err, worker.ErrCollision) {
+		t.Errorf("expected ErrCollision, got %v", err)
+	}
+}
+
+func TestGuildQueueDropsLowerPriority(t *testing.T) {
+	queue := newGuildQueue(worker.CollisionDrop)
+
+	playCtx, release, err := queue.Acquire(t.Context(), "guild", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, priority := range []int{0, 5} {
+		if _, _, err := queue.Acquire(t.Context(), "guild", priority); !errors.Is(err, worker.ErrCollision) {
+			t.Errorf("expected priority %d to be dropped, got %v", priority, err)
+		}
+	}
+	if playCtx.Err() != nil {
+		t.Errorf("playback was stopped by a playback it outranks")
+	}
+	release()
+}
+
+func TestGuildQueuePreemptsHigherPriority(t *testing.T) {
+	queue := newGuildQueue(worker.CollisionDrop)
+
+	playCtx, release, err := queue.Acquire(t.Context(), "guild", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		_, releaseUrgent, err := queue.Acquire(t.Context(), "guild", 10)
+		if err == nil {
+			releaseUrgent()
+		}
+		acquired <- err
+	}()
+
+	select {
+	case <-playCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("playback was not stopped for a higher priority")
+	}
+	release()
+	if err := <-acquired; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGroupPlaybacks(t *testing.T) {
+	runTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	broadcast := func(guildID, soundCronID string, priority int) worker.Broadcast {
+		return worker.Broadcast{{
+			GuildID:     guildID,
+			SoundCronID: soundCronID,
+			RunTime:     runTime,
+			Priority:    priority,
+		}}
+	}
+	broadcasts := []worker.Broadcast{
+		broadcast("guild", "bell", 1),
+		broadcast("guild", "horn", 7),
+		broadcast("other", "bell", 0),
+	}
+
+	if playbacks := worker.GroupPlaybacks(broadcasts, false); len(playbacks) != 3 {
+		t.Errorf("expected every broadcast to play on its own, got %d playbacks", len(playbacks))
+	}
+
+	playbacks := worker.GroupPlaybacks(broadcasts, true)
+	if len(playbacks) != 2 {
+		t.Fatalf("expected 2 playbacks, got %d", len(playbacks))
+	}
+	mixed := playbacks[0]
+	if len(mixed) != 2 || mixed[0][0].SoundCronID != "horn" || mixed.Priority() != 7 {
+		t.Errorf("expected horn to lead the mixed playback, got %+v", mixed)
+	}
+}
+
+func TestParseCollisionPolicy(t *testing.T) {
+	var policy worker.CollisionPolicy
+	if err := policy.UnmarshalText([]byte("drop")); err != nil || policy != worker.CollisionDrop {
+		t.Errorf("expected drop, got %q, err: %v", policy, err)
+	}
+	if _, err := worker.ParseCollisionPolicy("loudest"); err == nil {
+		t.Errorf("expected error for an unknown policy")
+	}
+}
@@ -0,0 +1,350 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DeliveryPolicy controls how jobs that were received but never acknowledged,
+// such as those of a worker that restarted before their run time, are delivered again.
+type DeliveryPolicy struct {
+	// AckWait is how long a job may go unacknowledged after its receiver stops
+	// keeping it before another receiver claims it. A receiver keeps every job
+	// that it has received until the job is acknowledged or failed.
+	AckWait time.Duration
+
+	// MaxDeliveries is how many times a job is delivered before it is given up
+	// and moved to the dead-letter stream.
+	MaxDeliveries int
+
+	// MaxLateness is how long after its run time a job may still start to play,
+	// such as one that is delivered again after its worker stopped. Later jobs
+	// are skipped. Zero plays jobs however late they are, as are jobs that were
+	// replayed from the dead-letter stream.
+	MaxLateness time.Duration
+}
+
+const (
+	jobStream = "soundcron_jobs"
+	jobGroup  = "soundcron_streaming_group"
+)
+
+// DeadLetterStream is the Redis stream that jobs are moved to when they can not
+// be read, or could not be played after DeliveryPolicy.MaxDeliveries deliveries.
+const DeadLetterStream = jobStream + ":dead"
+
+// Keys that are added to a job when it is moved to DeadLetterStream. The other
+// keys are those of the job, so that it can be sent again as it was.
+const (
+	deadLetterMessageIDKey = "deadLetterMessageID"
+	deadLetterReasonKey    = "deadLetterReason"
+)
+
+// replayedKey is added to a job that is sent again from DeadLetterStream,
+// outside of its envelope so that a job of any envelope version can be replayed.
+const replayedKey = "replayed"
+
+// KeepClaimed resets how long the jobs that r has received have been idle,
+// so that other receivers do not claim them before they have played.
+// Jobs that another receiver has claimed in the meantime are forgotten.
+func (r *RedisJobReceiver) KeepClaimed(ctx context.Context) error {
+	r.mu.Lock()
+	ids := slices.Collect(maps.Keys(r.inFlight))
+	r.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	pending, err := r.pending(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	var keep []string
+	r.mu.Lock()
+	for _, id := range ids {
+		if p, ok := pending[id]; ok && p.Consumer == r.consumer {
+			keep = append(keep, id)
+		} else {
+			delete(r.inFlight, id)
+		}
+	}
+	r.mu.Unlock()
+	if len(keep) == 0 {
+		return nil
+	}
+
+	// Claiming a message by ID only does not count as delivering it again.
+	err = r.client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   jobStream,
+		Group:    jobGroup,
+		Consumer: r.consumer,
+		Messages: keep,
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to keep pending jobs: %w", err)
+	}
+	return nil
+}
+
+// reclaim claims the jobs that other receivers have left unacknowledged for
+// longer than the AckWait of the policy, and returns them to be played again.
+// Jobs that have been delivered too many times are moved to DeadLetterStream.
+func (r *RedisJobReceiver) reclaim(ctx context.Context) ([]redis.XMessage, error) {
+	var messages []redis.XMessage
+	start := "0-0"
+	for {
+		claimed, next, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   jobStream,
+			Group:    jobGroup,
+			Consumer: r.consumer,
+			MinIdle:  r.policy.AckWait,
+			Start:    start,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			return messages, fmt.Errorf("failed to claim stale jobs: %w", err)
+		}
+
+		if len(claimed) > 0 {
+			ids := make([]string, len(claimed))
+			for i, msg := range claimed {
+				ids[i] = msg.ID
+			}
+			pending, err := r.pending(ctx, ids)
+			if err != nil {
+				return messages, err
+			}
+			for _, msg := range claimed {
+				if pending[msg.ID].RetryCount > int64(r.policy.MaxDeliveries) {
+					reason := fmt.Sprintf("not acknowledged after %d deliveries", r.policy.MaxDeliveries)
+					if err := r.deadLetter(ctx, msg, reason); err != nil {
+						return messages, err
+					}
+					continue
+				}
+				messages = append(messages, msg)
+			}
+		}
+
+		if next == "0-0" || next == "" {
+			return messages, nil
+		}
+		start = next
+	}
+}
+
+// pending returns the pending entries of the messages with the given IDs,
+// which say who they were delivered to and how many times.
+func (r *RedisJobReceiver) pending(ctx context.Context, ids []string) (map[string]redis.XPendingExt, error) {
+	cmds := make([]*redis.XPendingExtCmd, len(ids))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream: jobStream,
+				Group:  jobGroup,
+				Start:  id,
+				End:    id,
+				Count:  1,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending jobs: %w", err)
+	}
+	pending := make(map[string]redis.XPendingExt, len(ids))
+	for _, cmd := range cmds {
+		for _, p := range cmd.Val() {
+			pending[p.ID] = p
+		}
+	}
+	return pending, nil
+}
+
+// deadLetter moves msg to DeadLetterStream, with why it was given up.
+func (r *RedisJobReceiver) deadLetter(ctx context.Context, msg redis.XMessage, reason string) error {
+	values := maps.Clone(msg.Values)
+	values[deadLetterMessageIDKey] = msg.ID
+	values[deadLetterReasonKey] = reason
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: DeadLetterStream,
+			Values: values,
+		})
+		pipe.XAck(ctx, jobStream, jobGroup, msg.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter message %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// deliveryIDs returns the distinct delivery IDs of jobs.
+func deliveryIDs(jobs []SoundCronStreamJob) []string {
+	var ids []string
+	for _, job := range jobs {
+		if job.DeliveryID != "" && !slices.Contains(ids, job.DeliveryID) {
+			ids = append(ids, job.DeliveryID)
+		}
+	}
+	return ids
+}
+
+func (r *RedisJobReceiver) Ack(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	ids := deliveryIDs(jobs)
+	if len(ids) == 0 {
+		return nil
+	}
+	r.forget(ids)
+	if err := r.client.XAck(ctx, jobStream, jobGroup, ids...).Err(); err != nil {
+		return fmt.Errorf("failed to acknowledge jobs: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisJobReceiver) Fail(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	// The jobs stay pending, so once they have been idle for AckWait,
+	// a receiver claims them and they are played again.
+	r.forget(deliveryIDs(jobs))
+	return nil
+}
+
+func (r *RedisJobReceiver) Release(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	var released []SoundCronStreamJob
+	for _, job := range jobs {
+		if job.DeliveryID != "" && !slices.ContainsFunc(released, func(j SoundCronStreamJob) bool {
+			return j.DeliveryID == job.DeliveryID
+		}) {
+			released = append(released, job)
+		}
+	}
+	if len(released) == 0 {
+		return nil
+	}
+	values := make([]map[string]any, len(released))
+	for i, job := range released {
+		v, err := StreamValues(job)
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+	ids := deliveryIDs(released)
+	r.forget(ids)
+
+	// A pending job can only be claimed once it has been idle for AckWait,
+	// so the jobs are sent again as new jobs instead.
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, v := range values {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: jobStream,
+				Values: v,
+			})
+		}
+		pipe.XAck(ctx, jobStream, jobGroup, ids...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release jobs: %w", err)
+	}
+	return nil
+}
+
+// forget stops keeping the jobs with the given delivery IDs.
+func (r *RedisJobReceiver) forget(ids []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		delete(r.inFlight, id)
+	}
+}
+
+// DeadJob is a job that was moved to DeadLetterStream.
+type DeadJob struct {
+	// ID is the ID of the job in DeadLetterStream.
+	ID string
+
+	// MessageID is the ID that the job had when it was sent to workers.
+	MessageID string
+
+	// Reason is why the job was given up.
+	Reason string
+
+	// Values is the job as it was sent to workers.
+	Values map[string]any
+}
+
+// RedisDeadLetters inspects the jobs in DeadLetterStream and sends them to workers again.
+type RedisDeadLetters struct {
+	client *redis.Client
+}
+
+func NewRedisDeadLetters(client *redis.Client) *RedisDeadLetters {
+	return &RedisDeadLetters{client: client}
+}
+
+// List returns up to count of the jobs in DeadLetterStream, oldest first.
+// A count of zero or less returns every job.
+func (d *RedisDeadLetters) List(ctx context.Context, count int64) ([]DeadJob, error) {
+	var cmd *redis.XMessageSliceCmd
+	if count > 0 {
+		cmd = d.client.XRangeN(ctx, DeadLetterStream, "-", "+", count)
+	} else {
+		cmd = d.client.XRange(ctx, DeadLetterStream, "-", "+")
+	}
+	messages, err := cmd.Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead-letter stream: %w", err)
+	}
+	jobs := make([]DeadJob, len(messages))
+	for i, msg := range messages {
+		jobs[i] = parseDeadJob(msg)
+	}
+	return jobs, nil
+}
+
+func parseDeadJob(msg redis.XMessage) DeadJob {
+	values := maps.Clone(msg.Values)
+	job := DeadJob{ID: msg.ID, Values: values}
+	job.MessageID, _ = values[deadLetterMessageIDKey].(string)
+	job.Reason, _ = values[deadLetterReasonKey].(string)
+	delete(values, deadLetterMessageIDKey)
+	delete(values, deadLetterReasonKey)
+	return job
+}
+
+// Replay sends the job with the given ID in DeadLetterStream to workers again,
+// as it was first sent, and removes it from DeadLetterStream. A job whose run
+// time has passed is played as soon as a worker receives it, however late it is.
+func (d *RedisDeadLetters) Replay(ctx context.Context, id string) error {
+	messages, err := d.client.XRangeN(ctx, DeadLetterStream, id, id, 1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read dead-letter stream: %w", err)
+	}
+	if len(messages) == 0 {
+		return fmt.Errorf("no dead-lettered job with ID %s", id)
+	}
+	job := parseDeadJob(messages[0])
+	job.Values[replayedKey] = "true"
+
+	_, err = d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: jobStream,
+			Values: job.Values,
+		})
+		pipe.XDel(ctx, DeadLetterStream, id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replay dead-lettered job %s: %w", id, err)
+	}
+	return nil
+}
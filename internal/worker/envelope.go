@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/repository"
+)
+
+// JobEnvelopeVersion is the version of the job envelope that is sent to workers.
+//
+// Jobs are sent as JSON, which keeps mixed versions of the bot and workers working
+// together through deploys:
+//   - Fields may be added without changing the version. Workers ignore fields that
+//     they do not know, and read fields that a job was sent without as zero, so a
+//     field must be added with a zero value that keeps the old behavior.
+//   - The version is only raised when the meaning of a field changes. Workers reject
+//     jobs of a version newer than they know, which are moved to the dead-letter
+//     stream to be replayed once every worker has been updated.
+//
+// Workers also read the loose fields that jobs were sent as before the envelope
+// existed, so workers are deployed before the bot.
+const JobEnvelopeVersion = 1
+
+// jobEnvelopeKey is the stream field that the job envelope is sent in.
+const jobEnvelopeKey = "job"
+
+type jobEnvelope struct {
+	Version int        `json:"version"`
+	Job     jobPayload `json:"job"`
+}
+
+type jobPayload struct {
+	SoundCronID      string          `json:"soundCronID"`
+	Name             string          `json:"name"`
+	GuildID          string          `json:"guildID"`
+	RunAt            time.Time       `json:"runAt"`
+	TargetChannelID  string          `json:"targetChannelID"`
+	TargetChannelIDs []string        `json:"targetChannelIDs,omitempty"`
+	Volume           int             `json:"volume,omitempty"`
+	Priority         int             `json:"priority,omitempty"`
+	CreatorID        string          `json:"creatorID,omitempty"`
+	Channels         channelsPayload `json:"channels"`
+}
+
+type channelsPayload struct {
+	Strategy  string   `json:"strategy,omitempty"`
+	ChannelID string   `json:"channelID,omitempty"`
+	Allow     []string `json:"allow,omitempty"`
+	Deny      []string `json:"deny,omitempty"`
+}
+
+// EncodeJob returns job as a job envelope of JobEnvelopeVersion.
+// The DeliveryID of job is not sent.
+func EncodeJob(job SoundCronStreamJob) ([]byte, error) {
+	data, err := json.Marshal(jobEnvelope{
+		Version: JobEnvelopeVersion,
+		Job: jobPayload{
+			SoundCronID:      job.SoundCronID,
+			Name:             job.Name,
+			GuildID:          job.GuildID,
+			RunAt:            job.RunTime,
+			TargetChannelID:  job.TargetChannelID,
+			TargetChannelIDs: job.TargetChannelIDs,
+			Volume:           job.Volume,
+			Priority:         job.Priority,
+			CreatorID:        job.CreatorID,
+			Channels: channelsPayload{
+				Strategy:  string(job.Channels.Strategy),
+				ChannelID: job.Channels.ChannelID,
+				Allow:     job.Channels.Allow,
+				Deny:      job.Channels.Deny,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job: %w", err)
+	}
+	return data, nil
+}
+
+// DecodeJob reads a job envelope written by EncodeJob, by this or
+// any other version of the bot.
+func DecodeJob(data []byte) (SoundCronStreamJob, error) {
+	var envelope jobEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return SoundCronStreamJob{}, fmt.Errorf("invalid job envelope: %w", err)
+	}
+	if envelope.Version < 1 || envelope.Version > JobEnvelopeVersion {
+		return SoundCronStreamJob{}, fmt.Errorf("unsupported job envelope version %d", envelope.Version)
+	}
+
+	payload := envelope.Job
+	if payload.SoundCronID == "" {
+		return SoundCronStreamJob{}, fmt.Errorf("missing soundCronID")
+	}
+	if payload.GuildID == "" {
+		return SoundCronStreamJob{}, fmt.Errorf("missing guildID")
+	}
+	if payload.RunAt.IsZero() {
+		return SoundCronStreamJob{}, fmt.Errorf("missing runAt")
+	}
+
+	return SoundCronStreamJob{
+		SoundCronID:      payload.SoundCronID,
+		Name:             payload.Name,
+		GuildID:          payload.GuildID,
+		RunTime:          payload.RunAt,
+		TargetChannelID:  payload.TargetChannelID,
+		TargetChannelIDs: payload.TargetChannelIDs,
+		Volume:           payload.Volume,
+		Priority:         payload.Priority,
+		CreatorID:        payload.CreatorID,
+		Channels: repository.ChannelSelection{
+			Strategy:  repository.ChannelStrategy(payload.Channels.Strategy),
+			ChannelID: payload.Channels.ChannelID,
+			Allow:     payload.Channels.Allow,
+			Deny:      payload.Channels.Deny,
+		},
+	}, nil
+}
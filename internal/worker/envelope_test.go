@@ -0,0 +1,173 @@
+package worker_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/worker"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStreamJobRoundTrip(t *testing.T) {
+	runTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+	tc := []struct {
+		name string
+		job  worker.SoundCronStreamJob
+	}{
+		{
+			name: "Job with every field",
+			job: worker.SoundCronStreamJob{
+				SoundCronID:      "bell",
+				Name:             "Bell",
+				GuildID:          "guild",
+				RunTime:          runTime,
+				TargetChannelID:  "general",
+				TargetChannelIDs: []string{"general", "music"},
+				Volume:           150,
+				Priority:         7,
+				CreatorID:        "alice",
+				Channels: repository.ChannelSelection{
+					Strategy: repository.ChannelStrategyAllOccupied,
+					Allow:    []string{"general", "music"},
+					Deny:     []string{"study"},
+				},
+			},
+		},
+		{
+			name: "Job with only the required fields",
+			job: worker.SoundCronStreamJob{
+				SoundCronID: "bell",
+				GuildID:     "guild",
+				RunTime:     runTime,
+			},
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			values, err := worker.StreamValues(testCase.job)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := worker.ParseStreamJob(redis.XMessage{ID: "1-0", Values: values})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.RunTime.Equal(testCase.job.RunTime) {
+				t.Errorf("expected run time %v, got %v", testCase.job.RunTime, got.RunTime)
+			}
+			got.RunTime = testCase.job.RunTime
+			if !reflect.DeepEqual(got, testCase.job) {
+				t.Errorf("round trip changed the job:\nwant %+v\ngot  %+v", testCase.job, got)
+			}
+		})
+	}
+}
+
+func TestDecodeJobCompatibility(t *testing.T) {
+	tc := []struct {
+		name     string
+		envelope string
+		want     worker.SoundCronStreamJob
+		wantErr  string
+	}{
+		{
+			name: "Fields added by a newer bot are ignored",
+			envelope: `{"version":1,"shard":3,"job":{"soundCronID":"bell","guildID":"guild",` +
+				`"runAt":"2025-01-01T12:00:00Z","fadeMS":500,"channels":{"strategy":"fixed","channelID":"music","quiet":true}}}`,
+			want: worker.SoundCronStreamJob{
+				SoundCronID: "bell",
+				GuildID:     "guild",
+				RunTime:     time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+				Channels: repository.ChannelSelection{
+					Strategy:  repository.ChannelStrategyFixed,
+					ChannelID: "music",
+				},
+			},
+		},
+		{
+			name: "Fields missing from an older bot are zero",
+			envelope: `{"version":1,"job":{"soundCronID":"bell","guildID":"guild",` +
+				`"runAt":"2025-01-01T12:00:00Z","targetChannelID":"general"}}`,
+			want: worker.SoundCronStreamJob{
+				SoundCronID:     "bell",
+				GuildID:         "guild",
+				RunTime:         time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+				TargetChannelID: "general",
+			},
+		},
+		{
+			name:     "Newer version is rejected",
+			envelope: `{"version":2,"job":{"soundCronID":"bell","guildID":"guild","runAt":"2025-01-01T12:00:00Z"}}`,
+			wantErr:  "unsupported job envelope version 2",
+		},
+		{
+			name:     "Envelope without a version is rejected",
+			envelope: `{"job":{"soundCronID":"bell","guildID":"guild","runAt":"2025-01-01T12:00:00Z"}}`,
+			wantErr:  "unsupported job envelope version 0",
+		},
+		{
+			name:     "Job without a run time is rejected",
+			envelope: `{"version":1,"job":{"soundCronID":"bell","guildID":"guild"}}`,
+			wantErr:  "missing runAt",
+		},
+		{
+			name:     "Envelope that is not JSON is rejected",
+			envelope: `soundCronID=bell`,
+			wantErr:  "invalid job envelope",
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := worker.DecodeJob([]byte(testCase.envelope))
+			if testCase.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", testCase.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("unexpected job:\nwant %+v\ngot  %+v", testCase.want, got)
+			}
+		})
+	}
+}
+
+func TestParseStreamJobReadsLegacyFields(t *testing.T) {
+	// Jobs that were sent before the job envelope existed.
+	got, err := worker.ParseStreamJob(redis.XMessage{ID: "1-0", Values: map[string]any{
+		"jobName":         "Bell",
+		"soundCronID":     "bell",
+		"guildID":         "guild",
+		"runAt":           "2025-01-01T12:00:00Z",
+		"targetChannelID": "general",
+		"volume":          "50",
+		"channelStrategy": "most_humans",
+		"channelDeny":     "study,afk",
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := worker.SoundCronStreamJob{
+		SoundCronID:     "bell",
+		Name:            "Bell",
+		GuildID:         "guild",
+		RunTime:         time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		TargetChannelID: "general",
+		Volume:          50,
+		Channels: repository.ChannelSelection{
+			Strategy: repository.ChannelStrategyMostHumans,
+			Deny:     []string{"study", "afk"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected job:\nwant %+v\ngot  %+v", want, got)
+	}
+}
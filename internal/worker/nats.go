@@ -0,0 +1,283 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	natsJobStream   = "SOUNDCRON_JOBS"
+	natsJobSubject  = "soundcron.jobs"
+	natsJobConsumer = "soundcron_workers"
+)
+
+const (
+	// NATSDeadLetterStream is the JetStream stream that jobs are moved to when they
+	// can not be read, or could not be played after DeliveryPolicy.MaxDeliveries
+	// deliveries. Jobs are kept as they were sent, with why they were given up in
+	// their headers.
+	NATSDeadLetterStream = natsJobStream + "_DEAD"
+
+	natsDeadLetterSubject = natsJobSubject + ".dead"
+)
+
+// ensureNATSStreams creates the JetStream streams for jobs if they do not exist.
+// Jobs are removed from the stream once a worker acknowledges them.
+func ensureNATSStreams(ctx context.Context, js jetstream.JetStream) error {
+	_, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      natsJobStream,
+		Subjects:  []string{natsJobSubject},
+		Retention: jetstream.WorkQueuePolicy,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create NATS job stream: %w", err)
+	}
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     NATSDeadLetterStream,
+		Subjects: []string{natsDeadLetterSubject},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create NATS dead-letter stream: %w", err)
+	}
+	return nil
+}
+
+// NATSJobSender is a JobSender implementation that sends
+// SoundCronStreamJob instances to a NATS JetStream stream.
+type NATSJobSender struct {
+	js jetstream.JetStream
+}
+
+// NewNATSJobSender constructs a new NATSJobSender instance using the given
+// JetStream instance. This will create the JetStream streams for jobs
+// if they don't exist.
+func NewNATSJobSender(ctx context.Context, js jetstream.JetStream) (*NATSJobSender, error) {
+	if err := ensureNATSStreams(ctx, js); err != nil {
+		return nil, err
+	}
+	return &NATSJobSender{js: js}, nil
+}
+
+func (s *NATSJobSender) HandleJobs(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	for _, job := range jobs {
+		if err := publishNATSJob(ctx, s.js, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ JobSender = (*NATSJobSender)(nil)
+
+func publishNATSJob(ctx context.Context, js jetstream.JetStream, job SoundCronStreamJob) error {
+	envelope, err := EncodeJob(job)
+	if err != nil {
+		return err
+	}
+	if _, err := js.Publish(ctx, natsJobSubject, envelope); err != nil {
+		return fmt.Errorf("failed to publish job to NATS: %w", err)
+	}
+	return nil
+}
+
+// NATSJobReceiver is a JobReceiver that reads jobs from the JetStream stream
+// that NATSJobSender sends them to, through a consumer that every worker shares.
+// JetStream delivers a job again once it has gone unacknowledged for AckWait.
+type NATSJobReceiver struct {
+	js       jetstream.JetStream
+	consumer jetstream.Consumer
+	policy   DeliveryPolicy
+
+	mu sync.Mutex
+	// inFlight is the messages of the jobs that have been received
+	// and are neither acknowledged nor failed, by delivery ID.
+	inFlight map[string]jetstream.Msg
+}
+
+// NewNATSJobReceiver constructs a new NATSJobReceiver instance using the given
+// JetStream instance. This will create the JetStream streams for jobs and the
+// consumer of workers if they don't exist, and update the consumer to policy.
+func NewNATSJobReceiver(ctx context.Context, js jetstream.JetStream, policy DeliveryPolicy) (*NATSJobReceiver, error) {
+	if err := ensureNATSStreams(ctx, js); err != nil {
+		return nil, err
+	}
+	// Jobs that have been delivered too many times are dead-lettered by the
+	// receiver, so JetStream is left to deliver them for as long as it takes.
+	consumer, err := js.CreateOrUpdateConsumer(ctx, natsJobStream, jetstream.ConsumerConfig{
+		Durable:       natsJobConsumer,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       policy.AckWait,
+		MaxDeliver:    -1,
+		MaxAckPending: -1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NATS job consumer: %w", err)
+	}
+	return &NATSJobReceiver{
+		js:       js,
+		consumer: consumer,
+		policy:   policy,
+		inFlight: make(map[string]jetstream.Msg),
+	}, nil
+}
+
+// ReceiveJobs returns the jobs that are waiting to be received. It waits for jobs
+// for a fraction of AckWait, so that it must be called in a loop for the received
+// jobs to be kept from other receivers. Jobs that can not be read, or have been
+// delivered too many times, are moved to NATSDeadLetterStream.
+func (r *NATSJobReceiver) ReceiveJobs(ctx context.Context) ([]SoundCronStreamJob, error) {
+	// Failing to keep a job is logged, and retried on the next call.
+	r.KeepClaimed(ctx)
+
+	batch, err := r.consumer.Fetch(100, jetstream.FetchMaxWait(r.policy.AckWait/3))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jobs from NATS: %w", err)
+	}
+
+	var jobs []SoundCronStreamJob
+	for {
+		var msg jetstream.Msg
+		select {
+		case <-ctx.Done():
+			// The jobs that were fetched are delivered again after AckWait.
+			return nil, ctx.Err()
+		case m, ok := <-batch.Messages():
+			if !ok {
+				if err := batch.Error(); err != nil {
+					slog.ErrorContext(ctx, "failed to fetch every job from NATS", slog.Any("error", err))
+				}
+				return jobs, nil
+			}
+			msg = m
+		}
+
+		metadata, err := msg.Metadata()
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to read job metadata", slog.Any("error", err))
+			continue
+		}
+		messageID := strconv.FormatUint(metadata.Sequence.Stream, 10)
+
+		if metadata.NumDelivered > uint64(r.policy.MaxDeliveries) {
+			reason := fmt.Sprintf("not acknowledged after %d deliveries", r.policy.MaxDeliveries)
+			if err := r.deadLetter(ctx, msg, messageID, reason); err != nil {
+				slog.ErrorContext(ctx, "failed to dead-letter job", slog.String("messageID", messageID), slog.Any("error", err))
+			}
+			continue
+		}
+		job, err := DecodeJob(msg.Data())
+		if err != nil {
+			slog.ErrorContext(ctx, "dead-lettering malformed job", slog.String("messageID", messageID), slog.Any("error", err))
+			// A job that could not be moved is delivered again after AckWait.
+			if err := r.deadLetter(ctx, msg, messageID, fmt.Sprintf("failed to parse job: %v", err)); err != nil {
+				slog.ErrorContext(ctx, "failed to dead-letter malformed job", slog.String("messageID", messageID), slog.Any("error", err))
+			}
+			continue
+		}
+		job.DeliveryID = messageID
+		jobs = append(jobs, job)
+
+		r.mu.Lock()
+		r.inFlight[messageID] = msg
+		r.mu.Unlock()
+	}
+}
+
+// KeepClaimed resets the AckWait of the jobs that r has received,
+// so that they are not delivered again before they have played.
+func (r *NATSJobReceiver) KeepClaimed(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for id, msg := range r.inFlight {
+		if err := msg.InProgress(); err != nil {
+			slog.ErrorContext(ctx, "failed to keep received job", slog.String("messageID", id), slog.Any("error", err))
+			errs = append(errs, fmt.Errorf("failed to keep job %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deadLetter moves msg to NATSDeadLetterStream, with why it was given up.
+func (r *NATSJobReceiver) deadLetter(ctx context.Context, msg jetstream.Msg, messageID, reason string) error {
+	header := nats.Header{}
+	header.Set(deadLetterMessageIDKey, messageID)
+	header.Set(deadLetterReasonKey, reason)
+	_, err := r.js.PublishMsg(ctx, &nats.Msg{
+		Subject: natsDeadLetterSubject,
+		Data:    msg.Data(),
+		Header:  header,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter message %s: %w", messageID, err)
+	}
+	if err := msg.DoubleAck(ctx); err != nil {
+		return fmt.Errorf("failed to acknowledge dead-lettered message %s: %w", messageID, err)
+	}
+	return nil
+}
+
+// take stops keeping the jobs with the given delivery IDs,
+// and returns their messages.
+func (r *NATSJobReceiver) take(ids []string) map[string]jetstream.Msg {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msgs := make(map[string]jetstream.Msg, len(ids))
+	for _, id := range ids {
+		if msg, ok := r.inFlight[id]; ok {
+			msgs[id] = msg
+			delete(r.inFlight, id)
+		}
+	}
+	return msgs
+}
+
+func (r *NATSJobReceiver) Ack(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	var errs []error
+	for id, msg := range r.take(deliveryIDs(jobs)) {
+		if err := msg.DoubleAck(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to acknowledge job %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *NATSJobReceiver) Fail(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	// The jobs are no longer kept, so once AckWait has passed,
+	// JetStream delivers them again.
+	r.take(deliveryIDs(jobs))
+	return nil
+}
+
+func (r *NATSJobReceiver) Release(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	msgs := r.take(deliveryIDs(jobs))
+	var errs []error
+	for _, job := range jobs {
+		msg, ok := msgs[job.DeliveryID]
+		if !ok {
+			continue
+		}
+		delete(msgs, job.DeliveryID)
+
+		// A job that is given back with a negative acknowledgement counts as
+		// delivered again, so it is sent again as a new job instead. A job that is
+		// sent but not acknowledged is delivered twice, once AckWait has passed.
+		if err := publishNATSJob(ctx, r.js, job); err != nil {
+			errs = append(errs, fmt.Errorf("failed to release job %s: %w", job.DeliveryID, err))
+			continue
+		}
+		if err := msg.DoubleAck(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to acknowledge released job %s: %w", job.DeliveryID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var _ JobReceiver = (*NATSJobReceiver)(nil)
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Playbacks runs the playbacks that a worker has received, and lets the worker
+// stop without losing them.
+type Playbacks struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	cancels map[*time.Time]context.CancelFunc
+}
+
+// Go runs playback in a goroutine of its own. The context that is passed to it
+// is canceled if the worker stops well before runTime, in which case playback
+// should give up its jobs so that another worker plays them.
+func (p *Playbacks) Go(runTime time.Time, playback func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	key := &runTime
+
+	p.mu.Lock()
+	if p.cancels == nil {
+		p.cancels = make(map[*time.Time]context.CancelFunc)
+	}
+	p.cancels[key] = cancel
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() {
+			p.mu.Lock()
+			delete(p.cancels, key)
+			p.mu.Unlock()
+			cancel()
+		}()
+		playback(ctx)
+	}()
+}
+
+// Drain cancels the playbacks that run later than grace from now, and waits for
+// every playback to return. Playbacks that are still running once limit has
+// passed are canceled too, so that the worker stops before it is killed.
+// A limit of zero waits for playbacks however long they take.
+func (p *Playbacks) Drain(grace, limit time.Duration) {
+	deadline := time.Now().Add(grace)
+
+	p.mu.Lock()
+	for runTime, cancel := range p.cancels {
+		if runTime.After(deadline) {
+			cancel()
+		}
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	if limit <= 0 {
+		<-done
+		return
+	}
+
+	timer := time.NewTimer(limit)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	p.mu.Lock()
+	for _, cancel := range p.cancels {
+		cancel()
+	}
+	p.mu.Unlock()
+	<-done
+}
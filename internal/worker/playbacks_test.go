@@ -0,0 +1,72 @@
+package worker_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/worker"
+)
+
+func TestPlaybacksDrain(t *testing.T) {
+	var playbacks worker.Playbacks
+	var played, released atomic.Int32
+
+	run := func(ctx context.Context, runTime time.Time) {
+		select {
+		case <-ctx.Done():
+			released.Add(1)
+		case <-time.After(time.Until(runTime)):
+			played.Add(1)
+		}
+	}
+	soon := time.Now().Add(20 * time.Millisecond)
+	later := time.Now().Add(time.Hour)
+	playbacks.Go(soon, func(ctx context.Context) { run(ctx, soon) })
+	playbacks.Go(later, func(ctx context.Context) { run(ctx, later) })
+
+	done := make(chan struct{})
+	go func() {
+		playbacks.Drain(time.Second, 0)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Drain did not return")
+	}
+
+	if played.Load() != 1 || released.Load() != 1 {
+		t.Errorf("expected the playback due soon to play and the other to be released, got %d played and %d released",
+			played.Load(), released.Load())
+	}
+}
+
+func TestPlaybacksDrainLimit(t *testing.T) {
+	var playbacks worker.Playbacks
+	var stopped atomic.Bool
+
+	// The playback is due, but plays for longer than the worker may wait.
+	playbacks.Go(time.Now(), func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+			stopped.Store(true)
+		case <-time.After(time.Hour):
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		playbacks.Drain(time.Second, 50*time.Millisecond)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Drain did not return once its limit passed")
+	}
+	if !stopped.Load() {
+		t.Error("expected the playback that was still running to be stopped")
+	}
+}
@@ -0,0 +1,477 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/opus"
+	"github.com/glizzus/sound-off/internal/schedule"
+	"github.com/glizzus/sound-off/internal/voice"
+)
+
+// Player plays the jobs that it receives in the voice channels of their guilds.
+// It is the worker, which runs in a process of its own, or in the bot when jobs
+// are sent through a MemoryJobQueue.
+type Player struct {
+	Session   *discordgo.Session
+	Jobs      JobReceiver
+	Blacklist BlacklistChecker
+
+	// Skips records the jobs that are not played on purpose.
+	// If it is nil, they are only logged.
+	Skips SkipRecorder
+
+	// Guilds serializes playback per guild, since a Discord session
+	// can only be in one voice channel of a guild at a time.
+	Guilds *GuildQueue
+
+	// FetchAudio fetches the encoded audio of a soundcron.
+	FetchAudio func(ctx context.Context, soundCronID string) (io.ReadCloser, error)
+
+	// FFmpegThreads is how many threads ffmpeg may use to mix audio.
+	FFmpegThreads int
+
+	// BroadcastGap is how long to wait between the voice channels
+	// of a soundcron that plays in more than one channel.
+	BroadcastGap time.Duration
+
+	// ShutdownGrace is how soon a job must be due to be played once Run is
+	// stopping. Later jobs are released for another worker to play.
+	ShutdownGrace time.Duration
+
+	// DrainTimeout is how long a stopping Run may keep playing the jobs that
+	// were due within ShutdownGrace. Jobs that are still playing then are given
+	// back for another worker to play. Zero waits however long they take.
+	DrainTimeout time.Duration
+
+	// AckWait is the DeliveryPolicy.AckWait of Jobs. The jobs that a stopping
+	// Run still plays are kept claimed a few times within it.
+	AckWait time.Duration
+
+	// MaxLateness is the DeliveryPolicy.MaxLateness of Jobs. Jobs that can not
+	// start to play until longer after their run time are skipped.
+	MaxLateness time.Duration
+
+	// DryRun logs the jobs instead of playing them.
+	DryRun bool
+}
+
+func logAttrs(job SoundCronStreamJob) []any {
+	return []any{
+		"soundCronID", job.SoundCronID,
+		"jobName", job.Name,
+		"guildID", job.GuildID,
+		"runAt", job.RunTime.Format("2006-01-02 15:04:05"),
+		"targetChannelID", job.TargetChannelID,
+		"volume", job.Volume,
+		"priority", job.Priority,
+	}
+}
+
+// readCloser reads from Reader and closes every closer when it is closed.
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var errs []error
+	for _, c := range r.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// preloaded is the audio of a broadcast, fetched before it runs,
+// and the jobs of the channels that it plays in.
+type preloaded struct {
+	audio     io.ReadCloser
+	broadcast Broadcast
+
+	// received is the jobs of the broadcast as they were received,
+	// which are acknowledged once it has played.
+	received Broadcast
+}
+
+// Run receives jobs and plays them when they are due, until ctx is done.
+// It then waits for the playbacks that are due within ShutdownGrace,
+// and releases the jobs of the others.
+func (p *Player) Run(ctx context.Context) error {
+	var playbacks Playbacks
+	mix := p.Guilds.Policy == CollisionMix
+
+	for ctx.Err() == nil {
+		jobs, err := p.Jobs.ReceiveJobs(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			p.drain(&playbacks)
+			return fmt.Errorf("failed to receive jobs: %w", err)
+		}
+
+		// The jobs of a broadcast share their audio, which is fetched once
+		// and played in each of their channels in turn. Broadcasts that are
+		// mixed are one playback, which plays in the channels of the first.
+		for _, playback := range GroupPlaybacks(GroupBroadcasts(jobs), mix) {
+			// ctx is canceled if the worker stops well before the playback is due,
+			// and its jobs are given back for another worker to play.
+			playbacks.Go(playback[0][0].RunTime, func(ctx context.Context) {
+				p.play(ctx, playback)
+			})
+		}
+	}
+
+	slog.Info(
+		"worker is stopping, waiting for playbacks that are due soon",
+		slog.Duration("grace", p.ShutdownGrace),
+	)
+	p.drain(&playbacks)
+	return nil
+}
+
+// drain waits for the playbacks that are due soon once Run is stopping, while
+// keeping their jobs claimed, since Run no longer receives jobs to keep them.
+func (p *Player) drain(playbacks *Playbacks) {
+	done := make(chan struct{})
+	defer close(done)
+	if p.AckWait > 0 {
+		go func() {
+			ticker := time.NewTicker(p.AckWait / 3)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if err := p.Jobs.KeepClaimed(context.Background()); err != nil {
+						slog.Error("failed to keep jobs that are still to play", slog.Any("error", err))
+					}
+				}
+			}
+		}()
+	}
+	playbacks.Drain(p.ShutdownGrace, p.DrainTimeout)
+}
+
+// ack acknowledges jobs once they have played or are skipped on purpose. Jobs
+// are settled even once the worker is stopping, so their context is not canceled.
+func (p *Player) ack(ctx context.Context, jobs ...SoundCronStreamJob) {
+	if err := p.Jobs.Ack(context.WithoutCancel(ctx), jobs...); err != nil {
+		slog.Error("failed to acknowledge jobs", slog.Any("error", err))
+	}
+}
+
+// fail gives up jobs that failed to play, which are delivered again,
+// to this worker or another.
+func (p *Player) fail(ctx context.Context, jobs ...SoundCronStreamJob) {
+	if err := p.Jobs.Fail(context.WithoutCancel(ctx), jobs...); err != nil {
+		slog.Error("failed to give up jobs", slog.Any("error", err))
+	}
+}
+
+func (p *Player) release(ctx context.Context, jobs ...SoundCronStreamJob) {
+	for _, job := range jobs {
+		slog.Info("releasing job for another worker", logAttrs(job)...)
+	}
+	if err := p.Jobs.Release(context.WithoutCancel(ctx), jobs...); err != nil {
+		slog.Error("failed to release jobs", slog.Any("error", err))
+	}
+}
+
+func (p *Player) skip(ctx context.Context, broadcast Broadcast, reason SkipReason) {
+	job := broadcast[0]
+	slog.Info(
+		"skipping job",
+		append(logAttrs(job), slog.String("reason", string(reason)))...,
+	)
+	if p.Skips != nil {
+		if err := p.Skips.RecordSkip(ctx, job, reason); err != nil {
+			slog.Error("failed to record skipped job", slog.Any("error", err))
+		}
+	}
+	p.ack(ctx, broadcast...)
+}
+
+// preload fetches the audio of broadcast and chooses its channels. It returns
+// nil, after logging why and settling its jobs, if the broadcast should not be played.
+func (p *Player) preload(ctx context.Context, broadcast Broadcast) *preloaded {
+	job := broadcast[0]
+	blacklisted, err := p.Blacklist.IsBlacklisted(context.Background(), job.SoundCronID)
+	if err != nil {
+		slog.Error(
+			"failed to check blacklist",
+			slog.String("soundCronID", job.SoundCronID),
+			slog.Any("error", err),
+		)
+		p.fail(ctx, broadcast...)
+		return nil
+	}
+	if blacklisted {
+		p.skip(ctx, broadcast, SkipReasonBlacklisted)
+		return nil
+	}
+
+	// Listeners may have moved since the bot sent the job,
+	// so the channels are chosen again from what this worker sees.
+	resolved := broadcast.hinted()
+	if guild, err := p.Session.State.Guild(job.GuildID); err != nil {
+		slog.Warn(
+			"guild is not known to the worker, playing in the channels the bot chose",
+			append(logAttrs(job), slog.Any("error", err))...,
+		)
+	} else {
+		resolved = broadcast.Resolve(voice.NewGuild(p.Session, guild))
+	}
+	if len(resolved) == 0 {
+		p.skip(ctx, broadcast, SkipReasonNoListeners)
+		return nil
+	}
+
+	if p.DryRun {
+		slog.Info(
+			"Dry run mode: job would be preloaded",
+			"soundCronID", job.SoundCronID,
+		)
+		return nil
+	}
+	audio, err := p.FetchAudio(ctx, job.SoundCronID)
+	if err != nil {
+		slog.Error(
+			"failed to preload opus file",
+			slog.String("soundCronID", job.SoundCronID),
+			slog.Any("error", err),
+		)
+		p.fail(ctx, broadcast...)
+		return nil
+	}
+
+	// Scaling the volume re-encodes the audio, which starts here
+	// so that playback is not held up at the run time.
+	adjusted, err := opus.AdjustVolume(audio, job.Gain())
+	if err != nil {
+		slog.Error(
+			"failed to adjust volume",
+			slog.String("soundCronID", job.SoundCronID),
+			slog.Any("error", err),
+		)
+		audio.Close()
+		p.fail(ctx, broadcast...)
+		return nil
+	}
+	return &preloaded{
+		audio:     &readCloser{Reader: adjusted, closers: []io.Closer{adjusted, audio}},
+		broadcast: resolved,
+		received:  broadcast,
+	}
+}
+
+// onTime returns the broadcasts of playback that may still start to play,
+// which runs at runTime, after logging and settling those that are too late.
+// Replayed broadcasts are played however late they are.
+func (p *Player) onTime(ctx context.Context, playback Playback, runTime time.Time) Playback {
+	if p.MaxLateness <= 0 || time.Since(runTime) <= p.MaxLateness {
+		return playback
+	}
+	var onTime Playback
+	for _, broadcast := range playback {
+		if broadcast[0].Replayed {
+			onTime = append(onTime, broadcast)
+		} else {
+			p.skip(ctx, broadcast, SkipReasonLate)
+		}
+	}
+	return onTime
+}
+
+// play preloads playback shortly before it is due, and plays it when it is.
+func (p *Player) play(ctx context.Context, playback Playback) {
+	job := playback[0][0]
+	preloadTime := job.RunTime.Add(-time.Second * 5)
+
+	// A job that is delivered again after its worker stopped may be long past
+	// its run time, which WaitUntil does not wait for.
+	if playback = p.onTime(ctx, playback, job.RunTime); len(playback) == 0 {
+		return
+	}
+
+	if !schedule.WaitUntil(ctx, preloadTime) {
+		for _, broadcast := range playback {
+			p.release(ctx, broadcast...)
+		}
+		return
+	}
+
+	readies := make([]chan *preloaded, len(playback))
+	for i, broadcast := range playback {
+		ready := make(chan *preloaded, 1)
+		readies[i] = ready
+		go func() {
+			ready <- p.preload(ctx, broadcast)
+		}()
+	}
+
+	if !schedule.WaitUntil(ctx, job.RunTime) {
+		for _, ready := range readies {
+			if pre := <-ready; pre != nil {
+				pre.audio.Close()
+				p.release(ctx, pre.received...)
+			}
+		}
+		return
+	}
+
+	if p.DryRun {
+		for _, broadcast := range playback {
+			for _, channelJob := range broadcast.hinted() {
+				slog.Info(
+					"Dry run mode: job would be executed",
+					logAttrs(channelJob)...,
+				)
+			}
+			p.ack(ctx, broadcast...)
+		}
+		return
+	}
+	var preloads []*preloaded
+	var sources []io.Reader
+	var received []SoundCronStreamJob
+	for _, ready := range readies {
+		// The preload step has logged why a job that is nil is not played.
+		pre := <-ready
+		if pre == nil {
+			continue
+		}
+		defer pre.audio.Close()
+		// Preloading a job that was already due may take long enough to make it late.
+		if len(p.onTime(ctx, Playback{pre.received}, job.RunTime)) == 0 {
+			continue
+		}
+		preloads = append(preloads, pre)
+		sources = append(sources, pre.audio)
+		received = append(received, pre.received...)
+	}
+	if len(preloads) == 0 {
+		return
+	}
+
+	// The first preload has the highest priority, so the playback
+	// takes its priority and its channels.
+	broadcast := preloads[0].broadcast
+	playCtx, unlock, err := p.Guilds.Acquire(ctx, job.GuildID, broadcast[0].Priority)
+	if errors.Is(err, ErrCollision) {
+		for _, pre := range preloads {
+			p.skip(ctx, pre.received, SkipReasonCollision)
+		}
+		return
+	}
+	if err != nil {
+		attrs := append(logAttrs(broadcast[0]), slog.Any("error", err))
+		slog.Error(
+			"failed to wait for the guild",
+			attrs...,
+		)
+		p.fail(ctx, received...)
+		return
+	}
+	defer unlock()
+
+	// Mixing is paced by playback, so ffmpeg is not given the timeout
+	// that bounds how long it may take to encode an upload.
+	mixed, err := opus.Mix(opus.FFmpegLimits{Threads: p.FFmpegThreads}, sources...)
+	if err != nil {
+		attrs := append(logAttrs(broadcast[0]), slog.Any("error", err))
+		slog.Error(
+			"failed to mix opus files",
+			attrs...,
+		)
+		p.fail(ctx, received...)
+		return
+	}
+	defer mixed.Close()
+
+	// A broadcast that played in any of its channels is not played again,
+	// so that channels it has played in do not hear it twice.
+	played := false
+	audio := NewReplayBuffer(mixed)
+	for i, channelJob := range broadcast {
+		if i > 0 {
+			select {
+			case <-playCtx.Done():
+			case <-time.After(p.BroadcastGap):
+			}
+		}
+		if ctx.Err() != nil && !played {
+			// The worker is stopping before the broadcast played anywhere.
+			p.release(ctx, received...)
+			return
+		}
+		if playCtx.Err() != nil {
+			// A playback of a higher priority took over the guild.
+			slog.Info("playback was stopped", logAttrs(channelJob)...)
+			played = true
+			break
+		}
+		source, err := audio.Reader()
+		if err != nil {
+			attrs := append(logAttrs(channelJob), slog.Any("error", err))
+			slog.Error(
+				"failed to replay opus file",
+				attrs...,
+			)
+			break
+		}
+		if p.stream(playCtx, channelJob, source) {
+			if ctx.Err() != nil && !played {
+				// The worker stopped partway through the sound,
+				// so another worker plays it whole.
+				p.release(ctx, received...)
+				return
+			}
+			played = true
+		}
+	}
+	if played {
+		p.ack(ctx, received...)
+	} else {
+		p.fail(ctx, received...)
+	}
+}
+
+// stream streams the audio in source to the voice channel of job, until it ends
+// or ctx is done. It returns false, after logging why, if the job failed to play.
+func (p *Player) stream(ctx context.Context, job SoundCronStreamJob, source io.Reader) bool {
+	reader, header, err := opus.NewFrameReader(source)
+	if err == nil {
+		err = header.CheckStreamable()
+	}
+	if err != nil {
+		attrs := append(logAttrs(job), slog.Any("error", err))
+		slog.Error(
+			"failed to read opus file",
+			attrs...,
+		)
+		return false
+	}
+	err = voice.WithVoiceChannel(p.Session, job.GuildID, job.TargetChannelID, func(_ *discordgo.Session, vc *discordgo.VoiceConnection) error {
+		return opus.StreamToVoice(ctx, reader, vc)
+	})
+	if errors.Is(err, context.Canceled) {
+		slog.Info("playback was stopped", logAttrs(job)...)
+		return true
+	}
+	if err != nil {
+		attrs := append(logAttrs(job), slog.Any("error", err))
+		slog.Error(
+			"failed to execute scheduled job",
+			attrs...,
+		)
+		return false
+	}
+	return true
+}
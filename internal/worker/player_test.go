@@ -0,0 +1,162 @@
+package worker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/worker"
+)
+
+type skipRecorder struct {
+	reasons chan worker.SkipReason
+}
+
+func (r *skipRecorder) RecordSkip(ctx context.Context, job worker.SoundCronStreamJob, reason worker.SkipReason) error {
+	r.reasons <- reason
+	return nil
+}
+
+func TestPlayerSkipsLateJobs(t *testing.T) {
+	policy := worker.DeliveryPolicy{AckWait: time.Second, MaxDeliveries: 1, MaxLateness: time.Minute}
+	queue := worker.NewMemoryJobQueue(policy)
+	// A job that was delivered again long after its worker stopped.
+	job := worker.NewStreamJob(repository.SoundCronJob{
+		SoundCronID: "bell",
+		GuildID:     "guild",
+		RunTime:     time.Now().Add(-10 * time.Minute),
+	}, []string{"general"})
+	if err := queue.HandleJobs(t.Context(), job); err != nil {
+		t.Fatalf("failed to send jobs: %v", err)
+	}
+
+	skips := &skipRecorder{reasons: make(chan worker.SkipReason, 1)}
+	player := &worker.Player{
+		Jobs:        queue.Receiver(),
+		Skips:       skips,
+		Guilds:      &worker.GuildQueue{Locker: worker.NewMemoryGuildLocker()},
+		MaxLateness: policy.MaxLateness,
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		done <- player.Run(ctx)
+	}()
+
+	select {
+	case reason := <-skips.reasons:
+		if reason != worker.SkipReasonLate {
+			t.Errorf("expected the job to be skipped as %q, got %q", worker.SkipReasonLate, reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the late job to be skipped")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("failed to run player: %v", err)
+	}
+
+	// A skipped job is acknowledged, so it is not delivered again.
+	ctx, cancel = context.WithTimeout(t.Context(), 2*policy.AckWait)
+	defer cancel()
+	if received, _ := queue.Receiver().ReceiveJobs(ctx); len(received) != 0 {
+		t.Errorf("expected the skipped job to be acknowledged, got %v", received)
+	}
+}
+
+func TestPlayerPlaysLateReplayedJobs(t *testing.T) {
+	policy := worker.DeliveryPolicy{AckWait: time.Second, MaxDeliveries: 2, MaxLateness: time.Minute}
+	queue := worker.NewMemoryJobQueue(policy)
+	// A job that was dead-lettered long ago is replayed.
+	job := worker.NewStreamJob(repository.SoundCronJob{
+		SoundCronID: "bell",
+		GuildID:     "guild",
+		RunTime:     time.Now().Add(-time.Hour),
+	}, []string{"general"})
+	job.Replayed = true
+	if err := queue.HandleJobs(t.Context(), job); err != nil {
+		t.Fatalf("failed to send jobs: %v", err)
+	}
+
+	skips := &skipRecorder{reasons: make(chan worker.SkipReason, 1)}
+	player := &worker.Player{
+		Session:     &discordgo.Session{State: discordgo.NewState()},
+		Jobs:        queue.Receiver(),
+		Blacklist:   worker.NewMemoryBlacklistAdder(),
+		Skips:       skips,
+		Guilds:      &worker.GuildQueue{Locker: worker.NewMemoryGuildLocker()},
+		MaxLateness: policy.MaxLateness,
+		DryRun:      true,
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), policy.AckWait/2)
+	defer cancel()
+	if err := player.Run(ctx); err != nil {
+		t.Fatalf("failed to run player: %v", err)
+	}
+
+	select {
+	case reason := <-skips.reasons:
+		t.Errorf("expected the replayed job to play, but it was skipped as %q", reason)
+	default:
+	}
+	ctx, cancel = context.WithTimeout(t.Context(), 2*policy.AckWait)
+	defer cancel()
+	if received, _ := queue.Receiver().ReceiveJobs(ctx); len(received) != 0 {
+		t.Errorf("expected the replayed job to be acknowledged once it played, got %v", received)
+	}
+}
+
+func TestPlayerKeepsDrainedJobs(t *testing.T) {
+	policy := worker.DeliveryPolicy{AckWait: 300 * time.Millisecond, MaxDeliveries: 2}
+	queue := worker.NewMemoryJobQueue(policy)
+	// The job is due soon after the worker stops, and plays for longer than AckWait.
+	job := worker.NewStreamJob(repository.SoundCronJob{
+		SoundCronID: "bell",
+		GuildID:     "guild",
+		RunTime:     time.Now().Add(3 * policy.AckWait),
+	}, []string{"general"})
+	if err := queue.HandleJobs(t.Context(), job); err != nil {
+		t.Fatalf("failed to send jobs: %v", err)
+	}
+
+	player := &worker.Player{
+		Session:       &discordgo.Session{State: discordgo.NewState()},
+		Jobs:          queue.Receiver(),
+		Blacklist:     worker.NewMemoryBlacklistAdder(),
+		Guilds:        &worker.GuildQueue{Locker: worker.NewMemoryGuildLocker()},
+		ShutdownGrace: time.Minute,
+		AckWait:       policy.AckWait,
+		DryRun:        true,
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		done <- player.Run(ctx)
+	}()
+	time.Sleep(policy.AckWait / 6)
+	cancel()
+
+	// Another worker receives jobs for as long as the first drains.
+	other := queue.Receiver()
+	var redelivered []worker.SoundCronStreamJob
+	for draining := true; draining; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("failed to run player: %v", err)
+			}
+			draining = false
+		default:
+			jobs, err := other.ReceiveJobs(t.Context())
+			if err != nil {
+				t.Fatalf("failed to receive jobs: %v", err)
+			}
+			redelivered = append(redelivered, jobs...)
+		}
+	}
+	if len(redelivered) != 0 {
+		t.Errorf("expected a job that is still to play not to be delivered again, got %+v", redelivered)
+	}
+}
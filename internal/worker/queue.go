@@ -0,0 +1,269 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// QueueBackend is the message queue that the bot sends jobs to workers through.
+type QueueBackend string
+
+const (
+	// QueueRedis sends jobs through a Redis stream.
+	QueueRedis QueueBackend = "redis"
+
+	// QueueNATS sends jobs through a NATS JetStream stream.
+	QueueNATS QueueBackend = "nats"
+
+	// QueueMemory sends jobs to a worker that runs in the bot itself,
+	// for running the bot and the worker as one process.
+	QueueMemory QueueBackend = "memory"
+)
+
+// ParseQueueBackend parses the name of a QueueBackend.
+func ParseQueueBackend(s string) (QueueBackend, error) {
+	switch backend := QueueBackend(s); backend {
+	case QueueRedis, QueueNATS, QueueMemory:
+		return backend, nil
+	}
+	return "", fmt.Errorf("unknown queue backend %q", s)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that a QueueBackend
+// can be read from configuration.
+func (b *QueueBackend) UnmarshalText(text []byte) error {
+	backend, err := ParseQueueBackend(string(text))
+	if err != nil {
+		return err
+	}
+	*b = backend
+	return nil
+}
+
+// MemoryJobQueue is a JobSender that hands jobs to the JobReceivers of workers
+// in the same process. Jobs are delivered again as they are by the other receivers,
+// but they are lost when the process stops.
+type MemoryJobQueue struct {
+	policy DeliveryPolicy
+
+	mu sync.Mutex
+	// ready is the jobs that are waiting to be received, oldest first.
+	ready []*memoryDelivery
+	// pending is the jobs that have been received and are not acknowledged,
+	// by delivery ID.
+	pending map[string]*memoryDelivery
+	nextID  uint64
+	// notify is signaled when a job is added to ready.
+	notify chan struct{}
+}
+
+// memoryDelivery is a job of a MemoryJobQueue and how it was delivered.
+type memoryDelivery struct {
+	job        SoundCronStreamJob
+	deliveries int
+
+	// receiver is the receiver that the job was delivered to last,
+	// and expires hands the job out again once it has been idle for AckWait.
+	receiver *MemoryJobReceiver
+	expires  *time.Timer
+}
+
+func NewMemoryJobQueue(policy DeliveryPolicy) *MemoryJobQueue {
+	return &MemoryJobQueue{
+		policy:  policy,
+		pending: make(map[string]*memoryDelivery),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+func (q *MemoryJobQueue) HandleJobs(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range jobs {
+		job.DeliveryID = ""
+		q.push(&memoryDelivery{job: job})
+	}
+	return nil
+}
+
+var _ JobSender = (*MemoryJobQueue)(nil)
+
+// push adds a job to be received. q.mu must be held.
+func (q *MemoryJobQueue) push(d *memoryDelivery) {
+	q.ready = append(q.ready, d)
+	q.signal()
+}
+
+// signal wakes up a receiver that is waiting for jobs.
+func (q *MemoryJobQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Receiver returns a JobReceiver for a worker of the process.
+func (q *MemoryJobQueue) Receiver() *MemoryJobReceiver {
+	return &MemoryJobReceiver{
+		queue:    q,
+		inFlight: make(map[string]struct{}),
+	}
+}
+
+// MemoryJobReceiver is a JobReceiver that receives the jobs of a MemoryJobQueue.
+type MemoryJobReceiver struct {
+	queue *MemoryJobQueue
+
+	mu sync.Mutex
+	// inFlight is the delivery IDs of the jobs that have been received
+	// and are neither acknowledged nor failed.
+	inFlight map[string]struct{}
+}
+
+// ReceiveJobs returns the jobs that are waiting to be received. It waits for jobs
+// for a fraction of AckWait at most, so that it must be called in a loop for the
+// received jobs to be kept from other receivers.
+func (r *MemoryJobReceiver) ReceiveJobs(ctx context.Context) ([]SoundCronStreamJob, error) {
+	q := r.queue
+	r.KeepClaimed(ctx)
+
+	timer := time.NewTimer(q.policy.AckWait / 3)
+	defer timer.Stop()
+	for {
+		q.mu.Lock()
+		if len(q.ready) > 0 {
+			break
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, nil
+		case <-q.notify:
+		}
+	}
+	defer q.mu.Unlock()
+
+	var jobs []SoundCronStreamJob
+	for len(q.ready) > 0 && len(jobs) < 100 {
+		d := q.ready[0]
+		q.ready = q.ready[1:]
+
+		d.deliveries++
+		if d.deliveries > q.policy.MaxDeliveries {
+			slog.ErrorContext(
+				ctx,
+				"giving up job after too many deliveries",
+				slog.String("soundCronID", d.job.SoundCronID),
+				slog.String("deliveryID", d.job.DeliveryID),
+				slog.Int("deliveries", q.policy.MaxDeliveries),
+			)
+			continue
+		}
+
+		q.nextID++
+		id := strconv.FormatUint(q.nextID, 10)
+		d.job.DeliveryID = id
+		d.receiver = r
+		d.expires = time.AfterFunc(q.policy.AckWait, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if q.pending[id] == d {
+				delete(q.pending, id)
+				q.push(d)
+			}
+		})
+		q.pending[id] = d
+		jobs = append(jobs, d.job)
+
+		r.mu.Lock()
+		r.inFlight[id] = struct{}{}
+		r.mu.Unlock()
+	}
+	// Other receivers are woken up for the jobs that are left.
+	if len(q.ready) > 0 {
+		q.signal()
+	}
+	return jobs, nil
+}
+
+// KeepClaimed resets how long the jobs that r has received have been idle,
+// so that they are not handed out again before they have played.
+// Jobs that have been handed out again in the meantime are forgotten.
+func (r *MemoryJobReceiver) KeepClaimed(ctx context.Context) error {
+	q := r.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range r.inFlight {
+		d, ok := q.pending[id]
+		if !ok || d.receiver != r {
+			delete(r.inFlight, id)
+			continue
+		}
+		d.expires.Reset(q.policy.AckWait)
+	}
+	return nil
+}
+
+func (r *MemoryJobReceiver) Ack(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	q := r.queue
+	ids := deliveryIDs(jobs)
+	r.forget(ids)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, id := range ids {
+		if d, ok := q.pending[id]; ok {
+			d.expires.Stop()
+			delete(q.pending, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryJobReceiver) Fail(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	// The jobs stay pending, so once they have been idle for AckWait,
+	// they are handed out again.
+	r.forget(deliveryIDs(jobs))
+	return nil
+}
+
+func (r *MemoryJobReceiver) Release(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	q := r.queue
+	ids := deliveryIDs(jobs)
+	r.forget(ids)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, id := range ids {
+		d, ok := q.pending[id]
+		if !ok {
+			continue
+		}
+		d.expires.Stop()
+		delete(q.pending, id)
+		// A released job was not given a chance to play,
+		// so it does not count as having been delivered.
+		q.push(&memoryDelivery{job: d.job})
+	}
+	return nil
+}
+
+// forget stops keeping the jobs with the given delivery IDs.
+func (r *MemoryJobReceiver) forget(ids []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		delete(r.inFlight, id)
+	}
+}
+
+var _ JobReceiver = (*MemoryJobReceiver)(nil)
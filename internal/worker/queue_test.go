@@ -0,0 +1,109 @@
+package worker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/glizzus/sound-off/internal/worker"
+	"github.com/glizzus/sound-off/internal/worker/workertest"
+)
+
+func TestMemoryJobQueue(t *testing.T) {
+	workertest.TestJobQueue(t, func(t *testing.T) workertest.Queue {
+		queue := worker.NewMemoryJobQueue(workertest.Policy)
+		return workertest.Queue{
+			Sender: queue,
+			NewReceiver: func(t *testing.T) worker.JobReceiver {
+				return queue.Receiver()
+			},
+		}
+	})
+}
+
+// useNATS starts a NATS server with JetStream for the test,
+// and returns a JetStream instance that is connected to it.
+func useNATS(t *testing.T) jetstream.JetStream {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create NATS server: %v", err)
+	}
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("failed to connect to NATS: %v", err)
+	}
+	t.Cleanup(conn.Close)
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatalf("failed to create JetStream instance: %v", err)
+	}
+	return js
+}
+
+func TestNATSJobQueue(t *testing.T) {
+	workertest.TestJobQueue(t, func(t *testing.T) workertest.Queue {
+		js := useNATS(t)
+		sender, err := worker.NewNATSJobSender(t.Context(), js)
+		if err != nil {
+			t.Fatalf("failed to create job sender: %v", err)
+		}
+		return workertest.Queue{
+			Sender: sender,
+			NewReceiver: func(t *testing.T) worker.JobReceiver {
+				receiver, err := worker.NewNATSJobReceiver(t.Context(), js, workertest.Policy)
+				if err != nil {
+					t.Fatalf("failed to create job receiver: %v", err)
+				}
+				return receiver
+			},
+		}
+	})
+}
+
+func TestNATSJobReceiverDeadLettersMalformedJobs(t *testing.T) {
+	js := useNATS(t)
+	receiver, err := worker.NewNATSJobReceiver(t.Context(), js, workertest.Policy)
+	if err != nil {
+		t.Fatalf("failed to create job receiver: %v", err)
+	}
+	if _, err := js.Publish(t.Context(), "soundcron.jobs", []byte(`{"version":1,"job":{"soundCronID":"horn"}}`)); err != nil {
+		t.Fatalf("failed to send malformed job: %v", err)
+	}
+
+	jobs, err := receiver.ReceiveJobs(t.Context())
+	if err != nil {
+		t.Fatalf("failed to receive jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("expected the malformed job not to be received, got %+v", jobs)
+	}
+
+	dead, err := js.Stream(t.Context(), worker.NATSDeadLetterStream)
+	if err != nil {
+		t.Fatalf("failed to find dead-letter stream: %v", err)
+	}
+	msg, err := dead.GetLastMsgForSubject(t.Context(), "soundcron.jobs.dead")
+	if err != nil {
+		t.Fatalf("expected the malformed job in the dead-letter stream: %v", err)
+	}
+	if reason := msg.Header.Get("deadLetterReason"); reason == "" {
+		t.Errorf("expected the dead-lettered job to say why it was given up, got headers %v", msg.Header)
+	}
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SkipReason is why a worker did not play a job.
+type SkipReason string
+
+const (
+	// SkipReasonBlacklisted means the SoundCron of the job was blacklisted.
+	SkipReasonBlacklisted SkipReason = "blacklisted"
+
+	// SkipReasonNoListeners means nobody was in a voice channel
+	// that the job could play in when it was preloaded.
+	SkipReasonNoListeners SkipReason = "no listeners"
+
+	// SkipReasonCollision means another SoundCron was playing in the guild,
+	// and the collision policy of the worker did not let the job play.
+	SkipReasonCollision SkipReason = "collision"
+
+	// SkipReasonLate means the job could not start to play until longer
+	// after its run time than DeliveryPolicy.MaxLateness allows.
+	SkipReasonLate SkipReason = "late"
+)
+
+// SkipRecorder records the jobs that a worker did not play, and why.
+type SkipRecorder interface {
+	RecordSkip(ctx context.Context, job SoundCronStreamJob, reason SkipReason) error
+}
+
+// SkippedJobsStream is the Redis stream that RedisSkipRecorder records to.
+const SkippedJobsStream = "soundcron_skipped_jobs"
+
+// skippedJobsMaxLen is roughly how many skipped jobs are kept. The stream is
+// for looking into why recent jobs did not play, so older entries are trimmed.
+const skippedJobsMaxLen = 10000
+
+// RedisSkipRecorder is a SkipRecorder that adds skipped jobs to SkippedJobsStream.
+type RedisSkipRecorder struct {
+	client *redis.Client
+}
+
+func NewRedisSkipRecorder(client *redis.Client) *RedisSkipRecorder {
+	return &RedisSkipRecorder{client: client}
+}
+
+func (r *RedisSkipRecorder) RecordSkip(ctx context.Context, job SoundCronStreamJob, reason SkipReason) error {
+	err := r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: SkippedJobsStream,
+		MaxLen: skippedJobsMaxLen,
+		Approx: true,
+		Values: map[string]any{
+			"soundCronID":     job.SoundCronID,
+			"guildID":         job.GuildID,
+			"runAt":           job.RunTime.Format(time.RFC3339),
+			"targetChannelID": job.TargetChannelID,
+			"reason":          string(reason),
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to record skipped job for soundCronID %s: %w", job.SoundCronID, err)
+	}
+	return nil
+}
+
+var _ SkipRecorder = (*RedisSkipRecorder)(nil)
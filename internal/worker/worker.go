@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/glizzus/sound-off/internal/repository"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -31,9 +35,52 @@ type SoundCronStreamJob struct {
 	RunTime time.Time
 
 	// TargetChannelID is the Discord ID of the voice
-	// channel that the worker should join or interact
-	// with in executing the job.
+	// channel that the bot chose when it sent the job.
+	// The worker chooses again when it preloads the job,
+	// so this is only a hint for when it can not.
 	TargetChannelID string
+
+	// TargetChannelIDs is every voice channel that the bot chose,
+	// best first, for a soundcron that plays in more than one.
+	// TargetChannelID is the first of them. Like it, they are
+	// only hints. Jobs sent before it existed were sent once
+	// per channel, and do not have it.
+	TargetChannelIDs []string
+
+	// Volume is the loudness that the audio is played at,
+	// as a percentage. Zero plays it as it was encoded.
+	Volume int
+
+	// Priority decides which job plays when several of a guild
+	// play at the same time. Higher priorities win.
+	Priority int
+
+	// CreatorID is the Discord ID of the user who added
+	// the SoundCron, for playing in the channel they are in.
+	CreatorID string
+
+	// Channels is how the worker chooses the voice channel
+	// when it preloads the job. An empty Strategy means the
+	// job was sent without it, and TargetChannelID is used.
+	Channels repository.ChannelSelection
+
+	// DeliveryID identifies the delivery of the job to the
+	// JobReceiver that received it, which uses it to acknowledge
+	// the job. It is empty for jobs that were not received.
+	DeliveryID string
+
+	// Replayed is set on jobs that were sent again from the dead-letter stream,
+	// which are played however long after their run time they are received.
+	Replayed bool
+}
+
+// Gain returns the factor that the loudness of the audio
+// of the job is scaled by.
+func (j SoundCronStreamJob) Gain() float64 {
+	if j.Volume == 0 {
+		return 1
+	}
+	return float64(j.Volume) / 100
 }
 
 // JobSender is an interface for anything that can handle
@@ -44,6 +91,28 @@ type JobSender interface {
 	HandleJobs(ctx context.Context, jobs ...SoundCronStreamJob) error
 }
 
+// NewStreamJob returns the job that plays a run of a soundcron, in the voice
+// channels that the bot chose for it, best first. A run is sent as one job,
+// even if it plays in more than one channel or in none, so that it is received
+// whole and the worker can choose the channels again when it preloads it.
+func NewStreamJob(job repository.SoundCronJob, channelIDs []string) SoundCronStreamJob {
+	streamJob := SoundCronStreamJob{
+		SoundCronID:      job.SoundCronID,
+		Name:             job.Name,
+		GuildID:          job.GuildID,
+		RunTime:          job.RunTime,
+		TargetChannelIDs: channelIDs,
+		Volume:           job.Volume,
+		Priority:         job.Priority,
+		CreatorID:        job.CreatorID,
+		Channels:         job.Channels,
+	}
+	if len(channelIDs) > 0 {
+		streamJob.TargetChannelID = channelIDs[0]
+	}
+	return streamJob
+}
+
 // PrintingJobSender is a JobSender implementation that just
 // logs provided SoundCronStreamJob instances.
 // This is intended for development and debugging.
@@ -59,6 +128,9 @@ func (h *PrintingJobSender) HandleJobs(ctx context.Context, jobs ...SoundCronStr
 			slog.String("guildID", job.GuildID),
 			slog.String("runAt", job.RunTime.Format("2006-01-02 15:04:05")),
 			slog.String("targetChannelID", job.TargetChannelID),
+			slog.Int("volume", job.Volume),
+			slog.Int("priority", job.Priority),
+			slog.String("channelStrategy", string(job.Channels.Strategy)),
 		)
 	}
 	return nil
@@ -79,7 +151,7 @@ type RedisJobSender struct {
 // if it doesn't exist.
 // If there is a failure to create the Redis stream, this returns an error.
 func NewRedisJobSender(client *redis.Client) (*RedisJobSender, error) {
-	err := client.XGroupCreateMkStream(context.Background(), "soundcron_jobs", "soundcron_streaming_group", "$").Err()
+	err := client.XGroupCreateMkStream(context.Background(), jobStream, jobGroup, "$").Err()
 	if err != nil && err != redis.Nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
 		return nil, err
 	}
@@ -88,17 +160,20 @@ func NewRedisJobSender(client *redis.Client) (*RedisJobSender, error) {
 }
 
 func (h *RedisJobSender) HandleJobs(ctx context.Context, jobs ...SoundCronStreamJob) error {
+	values := make([]map[string]any, len(jobs))
+	for i, job := range jobs {
+		v, err := StreamValues(job)
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+
 	_, err := h.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
-		for _, job := range jobs {
+		for _, v := range values {
 			pipe.XAdd(ctx, &redis.XAddArgs{
-				Stream: "soundcron_jobs",
-				Values: map[string]any{
-					"jobName":         job.Name,
-					"soundCronID":     job.SoundCronID,
-					"guildID":         job.GuildID,
-					"runAt":           job.RunTime.Format(time.RFC3339),
-					"targetChannelID": job.TargetChannelID,
-				},
+				Stream: jobStream,
+				Values: v,
 			})
 		}
 		return nil
@@ -106,6 +181,16 @@ func (h *RedisJobSender) HandleJobs(ctx context.Context, jobs ...SoundCronStream
 	return err
 }
 
+// StreamValues returns the fields that job is sent to the Redis stream with,
+// which ParseStreamJob reads.
+func StreamValues(job SoundCronStreamJob) (map[string]any, error) {
+	envelope, err := EncodeJob(job)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{jobEnvelopeKey: string(envelope)}, nil
+}
+
 var _ JobSender = (*RedisJobSender)(nil)
 
 // BlacklistAdder is an interface that defines behavior
@@ -160,6 +245,7 @@ var _ BlacklistAdder = (*RedisBlacklistHandler)(nil)
 var _ BlacklistChecker = (*RedisBlacklistHandler)(nil)
 
 type MemoryBlacklistAdder struct {
+	mu        sync.Mutex
 	blacklist map[string]struct{}
 }
 
@@ -170,70 +256,154 @@ func NewMemoryBlacklistAdder() *MemoryBlacklistAdder {
 }
 
 func (m *MemoryBlacklistAdder) AddToBlacklist(ctx context.Context, soundCronID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.blacklist[soundCronID] = struct{}{}
 	return nil
 }
 
 func (m *MemoryBlacklistAdder) IsBlacklisted(ctx context.Context, soundCronID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	_, exists := m.blacklist[soundCronID]
 	return exists, nil
 }
 
+// JobReceiver is an interface for anything that hands out jobs to a worker.
+// A job that is received is delivered again, possibly to another worker,
+// unless it is acknowledged.
 type JobReceiver interface {
 	ReceiveJobs(ctx context.Context) ([]SoundCronStreamJob, error)
+
+	// KeepClaimed keeps the jobs that have been received from being delivered
+	// again, as ReceiveJobs does, while the worker no longer receives jobs but
+	// still plays those it has. It must be called a few times within AckWait.
+	KeepClaimed(ctx context.Context) error
+
+	// Ack marks jobs as handled once they have played, or will not play
+	// on purpose, so that they are not delivered again.
+	Ack(ctx context.Context, jobs ...SoundCronStreamJob) error
+
+	// Fail gives up jobs that could not be played, so that they are delivered
+	// again later, or dead-lettered once they have been delivered too many times.
+	Fail(ctx context.Context, jobs ...SoundCronStreamJob) error
+
+	// Release gives back jobs that the worker will not play because it is
+	// stopping, so that they are delivered to another worker right away.
+	Release(ctx context.Context, jobs ...SoundCronStreamJob) error
 }
 
+// RedisJobReceiver is a JobReceiver that reads jobs from the Redis stream
+// that RedisJobSender sends them to. Jobs stay pending in the stream until they
+// are acknowledged, so that jobs of a worker that stops are claimed by another.
 type RedisJobReceiver struct {
 	client   *redis.Client
 	consumer string
+	policy   DeliveryPolicy
+
+	mu sync.Mutex
+	// inFlight is the message IDs of the jobs that have been received
+	// and are neither acknowledged nor failed.
+	inFlight    map[string]struct{}
+	lastReclaim time.Time
 }
 
-func NewRedisJobReceiver(client *redis.Client, consumer string) *RedisJobReceiver {
-	return &RedisJobReceiver{client: client, consumer: consumer}
+func NewRedisJobReceiver(client *redis.Client, consumer string, policy DeliveryPolicy) *RedisJobReceiver {
+	return &RedisJobReceiver{
+		client:   client,
+		consumer: consumer,
+		policy:   policy,
+		inFlight: make(map[string]struct{}),
+	}
 }
 
+// ReceiveJobs returns jobs that other receivers left unacknowledged, and then
+// new jobs. It waits for new jobs for a fraction of AckWait at most, so that it
+// must be called in a loop for the received jobs to be kept from other receivers.
+// Jobs that can not be read are moved to DeadLetterStream, so that they are not
+// delivered again.
 func (r *RedisJobReceiver) ReceiveJobs(ctx context.Context) ([]SoundCronStreamJob, error) {
-	const (
-		streamName = "soundcron_jobs"
-		groupName  = "soundcron_streaming_group"
-	)
+	// Failing to keep or reclaim jobs is retried on the next call.
+	if err := r.KeepClaimed(ctx); err != nil {
+		slog.ErrorContext(ctx, "failed to keep received jobs", slog.Any("error", err))
+	}
 
-	var (
-		jobs []SoundCronStreamJob
-		errs []error
-	)
+	var messages []redis.XMessage
+	// Stale jobs are claimed when the worker starts, and then every so often,
+	// since a worker can stop at any time.
+	if time.Since(r.lastReclaim) >= r.policy.AckWait {
+		reclaimed, err := r.reclaim(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to reclaim stale jobs", slog.Any("error", err))
+		} else {
+			r.lastReclaim = time.Now()
+		}
+		messages = append(messages, reclaimed...)
+	}
 
 	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
-		Group:    groupName,
+		Group:    jobGroup,
 		Consumer: r.consumer,
-		Streams:  []string{streamName, ">"},
-		Block:    0,
+		Streams:  []string{jobStream, ">"},
+		Block:    r.policy.AckWait / 3,
 		Count:    100,
 	}).Result()
-	if err != nil {
+	if err != nil && !errors.Is(err, redis.Nil) {
 		return nil, fmt.Errorf("failed to read from Redis stream: %w", err)
 	}
-
 	for _, stream := range streams {
-		for _, msg := range stream.Messages {
-			job, err := parseStreamJob(msg)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("message %s: %w", msg.ID, err))
-				continue
-			}
-
-			jobs = append(jobs, job)
+		messages = append(messages, stream.Messages...)
+	}
 
-			if _, err := r.client.XAck(ctx, streamName, groupName, msg.ID).Result(); err != nil {
-				errs = append(errs, fmt.Errorf("failed to acknowledge message %s: %w", msg.ID, err))
+	var jobs []SoundCronStreamJob
+	for _, msg := range messages {
+		job, err := ParseStreamJob(msg)
+		if err != nil {
+			slog.ErrorContext(ctx, "dead-lettering malformed job", slog.String("messageID", msg.ID), slog.Any("error", err))
+			// A job that could not be moved stays pending, and is tried again
+			// once it has been idle for AckWait.
+			if err := r.deadLetter(ctx, msg, fmt.Sprintf("failed to parse job: %v", err)); err != nil {
+				slog.ErrorContext(ctx, "failed to dead-letter malformed job", slog.String("messageID", msg.ID), slog.Any("error", err))
 			}
+			continue
 		}
+		job.DeliveryID = msg.ID
+		jobs = append(jobs, job)
+
+		r.mu.Lock()
+		r.inFlight[msg.ID] = struct{}{}
+		r.mu.Unlock()
 	}
 
-	return jobs, errors.Join(errs...)
+	return jobs, nil
+}
+
+// ParseStreamJob reads a job that was sent to the Redis stream, either in a job
+// envelope or in the loose fields that jobs were sent as before it existed.
+func ParseStreamJob(msg redis.XMessage) (SoundCronStreamJob, error) {
+	var (
+		job SoundCronStreamJob
+		err error
+	)
+	if raw, ok := msg.Values[jobEnvelopeKey]; ok {
+		envelope, ok := raw.(string)
+		if !ok {
+			return SoundCronStreamJob{}, fmt.Errorf("key %q is not a string", jobEnvelopeKey)
+		}
+		job, err = DecodeJob([]byte(envelope))
+	} else {
+		job, err = parseLegacyStreamJob(msg)
+	}
+	if err != nil {
+		return SoundCronStreamJob{}, err
+	}
+	job.Replayed = msg.Values[replayedKey] == "true"
+	return job, nil
 }
 
-func parseStreamJob(msg redis.XMessage) (SoundCronStreamJob, error) {
+// parseLegacyStreamJob reads a job that was sent as loose fields,
+// before jobs were sent in a job envelope.
+func parseLegacyStreamJob(msg redis.XMessage) (SoundCronStreamJob, error) {
 	getString := func(key string) (string, error) {
 		v, ok := msg.Values[key]
 		if !ok {
@@ -272,13 +442,87 @@ func parseStreamJob(msg redis.XMessage) (SoundCronStreamJob, error) {
 		return SoundCronStreamJob{}, err
 	}
 
+	// Jobs sent before volumes existed do not have the key,
+	// and are played as they were encoded.
+	var volume int
+	if _, ok := msg.Values["volume"]; ok {
+		rawVolume, err := getString("volume")
+		if err != nil {
+			return SoundCronStreamJob{}, err
+		}
+		volume, err = strconv.Atoi(rawVolume)
+		if err != nil {
+			return SoundCronStreamJob{}, fmt.Errorf("invalid volume: %w", err)
+		}
+	}
+
+	// Jobs sent before priorities existed do not have the key,
+	// and have the lowest priority.
+	var priority int
+	if _, ok := msg.Values["priority"]; ok {
+		rawPriority, err := getString("priority")
+		if err != nil {
+			return SoundCronStreamJob{}, err
+		}
+		priority, err = strconv.Atoi(rawPriority)
+		if err != nil {
+			return SoundCronStreamJob{}, fmt.Errorf("invalid priority: %w", err)
+		}
+	}
+
+	// Jobs sent before the worker chose channels do not have these keys,
+	// and are played in their target channel.
+	getOptionalString := func(key string) (string, error) {
+		if _, ok := msg.Values[key]; !ok {
+			return "", nil
+		}
+		return getString(key)
+	}
+	creatorID, err := getOptionalString("creatorID")
+	if err != nil {
+		return SoundCronStreamJob{}, err
+	}
+	strategy, err := getOptionalString("channelStrategy")
+	if err != nil {
+		return SoundCronStreamJob{}, err
+	}
+	channelID, err := getOptionalString("channelID")
+	if err != nil {
+		return SoundCronStreamJob{}, err
+	}
+	allow, err := getOptionalString("channelAllow")
+	if err != nil {
+		return SoundCronStreamJob{}, err
+	}
+	deny, err := getOptionalString("channelDeny")
+	if err != nil {
+		return SoundCronStreamJob{}, err
+	}
+
 	return SoundCronStreamJob{
 		Name:            jobName,
 		SoundCronID:     soundCronID,
 		GuildID:         guildID,
 		RunTime:         runAt,
 		TargetChannelID: targetChannelID,
+		Volume:          volume,
+		Priority:        priority,
+		CreatorID:       creatorID,
+		Channels: repository.ChannelSelection{
+			Strategy:  repository.ChannelStrategy(strategy),
+			ChannelID: channelID,
+			Allow:     splitChannelIDs(allow),
+			Deny:      splitChannelIDs(deny),
+		},
 	}, nil
 }
 
+// splitChannelIDs splits a comma-separated list of channel IDs.
+func splitChannelIDs(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
 var _ JobReceiver = (*RedisJobReceiver)(nil)
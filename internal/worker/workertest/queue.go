@@ -0,0 +1,230 @@
+// Package workertest tests that the job queue backends of workers behave alike.
+package workertest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/glizzus/sound-off/internal/repository"
+	"github.com/glizzus/sound-off/internal/worker"
+)
+
+// Policy is the delivery policy that the queues under test are made with.
+var Policy = worker.DeliveryPolicy{
+	AckWait:       300 * time.Millisecond,
+	MaxDeliveries: 2,
+}
+
+// Queue is a job queue backend under test.
+type Queue struct {
+	// Sender sends jobs to the queue.
+	Sender worker.JobSender
+
+	// NewReceiver returns a receiver of the queue for another worker.
+	NewReceiver func(t *testing.T) worker.JobReceiver
+}
+
+// TestJobQueue runs the tests that every job queue backend must pass.
+// newQueue must return an empty queue whose receivers deliver jobs with Policy.
+func TestJobQueue(t *testing.T, newQueue func(t *testing.T) Queue) {
+	tc := []struct {
+		name string
+		test func(t *testing.T, queue Queue)
+	}{
+		{"Jobs are received as they were sent", testJobsAreReceivedAsSent},
+		{"Unacknowledged jobs are delivered again", testUnacknowledgedJobsAreDeliveredAgain},
+		{"Received jobs are kept from other receivers", testReceivedJobsAreKept},
+		{"Jobs are kept without receiving more", testJobsAreKeptWithoutReceiving},
+		{"Failing jobs are given up", testFailingJobsAreGivenUp},
+		{"Released jobs are delivered right away", testReleasedJobsAreDeliveredRightAway},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.test(t, newQueue(t))
+		})
+	}
+}
+
+func testJob(soundCronID string) worker.SoundCronStreamJob {
+	return worker.SoundCronStreamJob{
+		SoundCronID:     soundCronID,
+		Name:            "Bell",
+		GuildID:         "guild",
+		RunTime:         time.Now().Add(time.Minute).Truncate(time.Second).UTC(),
+		TargetChannelID: "general",
+		Volume:          80,
+		Priority:        3,
+		CreatorID:       "alice",
+		Channels: repository.ChannelSelection{
+			Strategy: repository.ChannelStrategyMostHumans,
+			Deny:     []string{"study"},
+		},
+	}
+}
+
+func send(t *testing.T, queue Queue, jobs ...worker.SoundCronStreamJob) {
+	t.Helper()
+	if err := queue.Sender.HandleJobs(t.Context(), jobs...); err != nil {
+		t.Fatalf("failed to send jobs: %v", err)
+	}
+}
+
+// receive calls ReceiveJobs until it has received want jobs, or for as long as
+// within otherwise, and returns every job that it received.
+func receive(t *testing.T, receiver worker.JobReceiver, want int, within time.Duration) []worker.SoundCronStreamJob {
+	t.Helper()
+	var received []worker.SoundCronStreamJob
+	deadline := time.Now().Add(within)
+	for {
+		jobs, err := receiver.ReceiveJobs(t.Context())
+		if err != nil {
+			t.Fatalf("failed to receive jobs: %v", err)
+		}
+		received = append(received, jobs...)
+		if (want > 0 && len(received) >= want) || time.Now().After(deadline) {
+			return received
+		}
+	}
+}
+
+func testJobsAreReceivedAsSent(t *testing.T, queue Queue) {
+	sent := []worker.SoundCronStreamJob{testJob("bell"), testJob("horn")}
+	send(t, queue, sent...)
+
+	received := receive(t, queue.NewReceiver(t), len(sent), time.Second)
+	if len(received) != len(sent) {
+		t.Fatalf("expected %d jobs, got %+v", len(sent), received)
+	}
+	deliveryIDs := make(map[string]bool)
+	for _, job := range received {
+		if job.DeliveryID == "" || deliveryIDs[job.DeliveryID] {
+			t.Errorf("expected a distinct delivery ID, got %q", job.DeliveryID)
+		}
+		deliveryIDs[job.DeliveryID] = true
+	}
+
+	for _, want := range sent {
+		found := false
+		for _, got := range received {
+			got.DeliveryID = ""
+			if got.SoundCronID == want.SoundCronID && got.RunTime.Equal(want.RunTime) {
+				got.RunTime = want.RunTime
+				found = reflect.DeepEqual(got, want)
+			}
+		}
+		if !found {
+			t.Errorf("expected job %+v to be received as it was sent, got %+v", want, received)
+		}
+	}
+}
+
+func testUnacknowledgedJobsAreDeliveredAgain(t *testing.T, queue Queue) {
+	send(t, queue, testJob("bell"))
+
+	first := queue.NewReceiver(t)
+	if jobs := receive(t, first, 1, time.Second); len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %+v", jobs)
+	}
+
+	// The first worker stops before the job plays, so another receives it.
+	time.Sleep(Policy.AckWait)
+	second := queue.NewReceiver(t)
+	jobs := receive(t, second, 1, 3*Policy.AckWait)
+	if len(jobs) != 1 || jobs[0].SoundCronID != "bell" {
+		t.Fatalf("expected the job to be delivered again, got %+v", jobs)
+	}
+
+	if err := second.Ack(t.Context(), jobs...); err != nil {
+		t.Fatalf("failed to acknowledge job: %v", err)
+	}
+	if jobs := receive(t, second, 0, 3*Policy.AckWait); len(jobs) != 0 {
+		t.Errorf("expected an acknowledged job not to be delivered again, got %+v", jobs)
+	}
+}
+
+func testReceivedJobsAreKept(t *testing.T, queue Queue) {
+	send(t, queue, testJob("bell"))
+
+	first := queue.NewReceiver(t)
+	if jobs := receive(t, first, 1, time.Second); len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %+v", jobs)
+	}
+
+	// Waiting for the run time of the job takes longer than AckWait.
+	second := queue.NewReceiver(t)
+	deadline := time.Now().Add(3 * Policy.AckWait)
+	for time.Now().Before(deadline) {
+		receive(t, first, 0, 0)
+		if jobs := receive(t, second, 0, 0); len(jobs) != 0 {
+			t.Fatalf("expected a job that is still waiting to play not to be delivered again, got %+v", jobs)
+		}
+	}
+}
+
+func testJobsAreKeptWithoutReceiving(t *testing.T, queue Queue) {
+	send(t, queue, testJob("bell"))
+
+	first := queue.NewReceiver(t)
+	if jobs := receive(t, first, 1, time.Second); len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %+v", jobs)
+	}
+
+	// The first worker is stopping, so it no longer receives jobs,
+	// but it still plays the job for longer than AckWait.
+	second := queue.NewReceiver(t)
+	deadline := time.Now().Add(3 * Policy.AckWait)
+	for time.Now().Before(deadline) {
+		if err := first.KeepClaimed(t.Context()); err != nil {
+			t.Fatalf("failed to keep jobs: %v", err)
+		}
+		if jobs := receive(t, second, 0, 0); len(jobs) != 0 {
+			t.Fatalf("expected a job that is still playing not to be delivered again, got %+v", jobs)
+		}
+	}
+}
+
+func testFailingJobsAreGivenUp(t *testing.T, queue Queue) {
+	send(t, queue, testJob("bell"))
+
+	receiver := queue.NewReceiver(t)
+	jobs := receive(t, receiver, 1, time.Second)
+	for delivery := 1; delivery <= Policy.MaxDeliveries; delivery++ {
+		if len(jobs) != 1 {
+			t.Fatalf("expected delivery %d of the job, got %+v", delivery, jobs)
+		}
+		if err := receiver.Fail(t.Context(), jobs...); err != nil {
+			t.Fatalf("failed to fail job: %v", err)
+		}
+		time.Sleep(Policy.AckWait)
+		jobs = receive(t, receiver, 1, 3*Policy.AckWait)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("expected the job to be given up, got %+v", jobs)
+	}
+}
+
+func testReleasedJobsAreDeliveredRightAway(t *testing.T, queue Queue) {
+	send(t, queue, testJob("bell"))
+
+	first := queue.NewReceiver(t)
+	jobs := receive(t, first, 1, time.Second)
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %+v", jobs)
+	}
+
+	// The first worker stops long before the job is due.
+	released := time.Now()
+	if err := first.Release(t.Context(), jobs...); err != nil {
+		t.Fatalf("failed to release job: %v", err)
+	}
+	second := queue.NewReceiver(t)
+	again := receive(t, second, 1, Policy.AckWait)
+	if len(again) != 1 || again[0].SoundCronID != "bell" || !again[0].RunTime.Equal(jobs[0].RunTime) {
+		t.Fatalf("expected the released job to be delivered, got %+v", again)
+	}
+	if waited := time.Since(released); waited >= Policy.AckWait {
+		t.Errorf("expected the released job to be delivered before AckWait, took %v", waited)
+	}
+}